@@ -0,0 +1,242 @@
+// Package client is a Go client for the wake-me-up HTTP and WebSocket API.
+//
+//	c := client.New("http://wake-me-up:8080")
+//	c.APIKey = os.Getenv("WAKE_ME_UP_API_KEY")
+//	result, err := c.PushAlerts(ctx, payload)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a wake-me-up server
+type Client struct {
+	BaseURL    string       // e.g. http://localhost:8080
+	APIKey     string       // sent as X-API-Key on webhook requests, if set
+	Username   string       // basic auth credentials of the board's basic_auth, if set
+	Password   string       // of Username
+	HTTPClient *http.Client // used for all HTTP requests
+
+	// Reconnect delays of StreamUpdates, doubling from min up to max
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+}
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:           strings.TrimRight(baseURL, "/"),
+		HTTPClient:        &http.Client{Timeout: 10 * time.Second},
+		MinReconnectDelay: time.Second,
+		MaxReconnectDelay: 30 * time.Second,
+	}
+}
+
+// StatusError is returned when the server replies with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("wake-me-up returned %d: %s", e.StatusCode, e.Message)
+}
+
+// PushAlerts sends a webhook payload and returns what it did to the board
+func (c *Client) PushAlerts(ctx context.Context, payload WebhookPayload) (*IngestResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/webhook", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	var result IngestResult
+	if err := c.do(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAlerts returns the alerts on the board, firing first
+func (c *Client) ListAlerts(ctx context.Context) ([]AlertEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/alerts", nil)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []AlertEntry
+	if err := c.do(req, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// AlertQuery filters, sorts and pages QueryAlerts; the zero value lists the
+// whole board
+type AlertQuery struct {
+	Status       string   // firing or resolved
+	Acknowledged *bool    // only acknowledged or unacknowledged alerts
+	Env          string   // only the alerts of an environment tab
+	Labels       []string // selectors such as severity=critical or instance=~"db-.*"
+	Sort         string   // board (default), received, starts_at, severity or name
+	Descending   bool
+	Limit        int // 0 for all
+	Offset       int
+}
+
+// values returns the query parameters of the alerts API
+func (q AlertQuery) values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("status", q.Status)
+	if q.Acknowledged != nil {
+		values.Set("acknowledged", strconv.FormatBool(*q.Acknowledged))
+	}
+	set("env", q.Env)
+	for _, selector := range q.Labels {
+		values.Add("label", selector)
+	}
+	set("sort", q.Sort)
+	if q.Descending {
+		values.Set("order", "desc")
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return values
+}
+
+// QueryAlerts returns a page of the alerts matching a query, and how many
+// alerts matched in all
+func (c *Client) QueryAlerts(ctx context.Context, query AlertQuery) ([]AlertEntry, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/alerts?"+query.values().Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var alerts []AlertEntry
+	header, err := c.doHeader(req, &alerts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := strconv.Atoi(header.Get("X-Total-Count"))
+	if err != nil {
+		total = len(alerts)
+	}
+	return alerts, total, nil
+}
+
+// Acknowledge acknowledges an alert by ID
+func (c *Client) Acknowledge(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/acknowledge?id="+url.QueryEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// AcknowledgeWithComment acknowledges an alert on behalf of someone, with a
+// comment such as what is being done about it. A server behind an
+// authenticating proxy names who acknowledged from the proxy instead.
+func (c *Client) AcknowledgeWithComment(ctx context.Context, id, by, comment string) error {
+	query := url.Values{"id": {id}, "by": {by}, "comment": {comment}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/acknowledge?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Snooze acknowledges a firing alert for a duration, after which it needs
+// acknowledging again if still firing
+func (c *Client) Snooze(ctx context.Context, id string, duration time.Duration) error {
+	query := url.Values{"id": {id}, "duration": {duration.String()}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/snooze?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// AcknowledgeAlerts acknowledges several alerts at once and returns their IDs
+func (c *Client) AcknowledgeAlerts(ctx context.Context, ids []string) ([]string, error) {
+	return c.acknowledgeBulk(ctx, map[string]interface{}{"ids": ids})
+}
+
+// AcknowledgeAllAlerts acknowledges every alert awaiting acknowledgement, only
+// those of an environment unless env is empty, and returns their IDs
+func (c *Client) AcknowledgeAllAlerts(ctx context.Context, env string) ([]string, error) {
+	return c.acknowledgeBulk(ctx, map[string]interface{}{"all": true, "env": env})
+}
+
+func (c *Client) acknowledgeBulk(ctx context.Context, request map[string]interface{}) ([]string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/v1/alerts/acknowledge", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Acknowledged []string `json:"acknowledged"`
+	}
+	if err := c.do(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Acknowledged, nil
+}
+
+// do sends a request and decodes a JSON response into out, if not nil
+func (c *Client) do(req *http.Request, out interface{}) error {
+	_, err := c.doHeader(req, out)
+	return err
+}
+
+// doHeader is do, also returning the response headers
+func (c *Client) doHeader(req *http.Request, out interface{}) (http.Header, error) {
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return resp.Header, nil
+}
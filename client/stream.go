@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// How long the stream may stay silent; the server pings about every minute
+const streamReadTimeout = 90 * time.Second
+
+// StreamUpdates calls fn with every board update until ctx is done,
+// reconnecting with backoff when the connection drops. Reconnects resume
+// from the last sequence number seen, so the first update after a reconnect
+// carries the tombstones of alerts removed in the meantime.
+func (c *Client) StreamUpdates(ctx context.Context, fn func(Update)) error {
+	wsURL, err := url.Parse(c.BaseURL + "/ws")
+	if err != nil {
+		return err
+	}
+	wsURL.Scheme = strings.Replace(wsURL.Scheme, "http", "ws", 1)
+
+	var seq uint64
+	delay := c.MinReconnectDelay
+	for {
+		if seq > 0 {
+			wsURL.RawQuery = "since=" + strconv.FormatUint(seq, 10)
+		}
+		if c.stream(ctx, wsURL.String(), &seq, fn) {
+			delay = c.MinReconnectDelay
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > c.MaxReconnectDelay {
+			delay = c.MaxReconnectDelay
+		}
+	}
+}
+
+// stream reads updates from one connection until it fails, and reports
+// whether any update was received
+func (c *Client) stream(ctx context.Context, wsURL string, seq *uint64, fn func(Update)) bool {
+	var header http.Header
+	if c.Username != "" {
+		header = http.Header{}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)))
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	// Unblock the read when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+	conn.SetPingHandler(func(payload string) error {
+		conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(payload), time.Now().Add(10*time.Second))
+	})
+
+	received := false
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return received
+		}
+		conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+
+		// The server batches queued messages, separated by newlines
+		for _, message := range bytes.Split(data, []byte{'\n'}) {
+			var envelope struct {
+				Type string `json:"type"`
+				Update
+			}
+			if err := json.Unmarshal(message, &envelope); err != nil || envelope.Type != "update" {
+				continue
+			}
+			*seq = envelope.Seq
+			received = true
+			fn(envelope.Update)
+		}
+	}
+}
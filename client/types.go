@@ -0,0 +1,114 @@
+package client
+
+import "time"
+
+// Alert is a single Alertmanager alert
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"` // e.g. summary, description and runbook_url
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint,omitempty"` // set by Alertmanager, from the labels
+}
+
+// WebhookPayload is an Alertmanager webhook payload, as accepted by /webhook
+type WebhookPayload struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// AlertEntry is an alert on the board
+type AlertEntry struct {
+	ID              string           `json:"id"`
+	Timestamp       time.Time        `json:"timestamp"`
+	Alert           Alert            `json:"alert"`
+	IsAcknowledged  bool             `json:"isAcknowledged"`
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"` // who acknowledged it
+	Decoration      string           `json:"decoration,omitempty"`      // icons and prefixes configured for its labels
+	Severity        string           `json:"severity,omitempty"`        // lowercase severity label
+	IncidentID      string           `json:"incidentId,omitempty"`
+	Receiver        string           `json:"receiver,omitempty"`
+	ExternalURL     string           `json:"externalURL,omitempty"`
+	Replicas        []string         `json:"replicas,omitempty"` // external URLs of other Alertmanager replicas that delivered it too
+	Snooze          *Snooze          `json:"snooze,omitempty"`   // acknowledged until the snooze ends
+	Rule            *AlertRule       `json:"rule,omitempty"`     // Prometheus alerting rule it came from, if imported
+}
+
+// AlertRule is the Prometheus alerting rule of an alert
+type AlertRule struct {
+	Name        string            `json:"name"`
+	Group       string            `json:"group"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Acknowledgement records who acknowledged an alert, when and why
+type Acknowledgement struct {
+	By      string    `json:"by,omitempty"` // empty if unknown
+	At      time.Time `json:"at"`
+	Comment string    `json:"comment,omitempty"`
+	Silence string    `json:"silence,omitempty"` // ID of the silence that acknowledged it
+}
+
+// Snooze is a temporary acknowledgement of an alert
+type Snooze struct {
+	Until time.Time `json:"until"`
+	Actor string    `json:"actor,omitempty"`
+}
+
+// AlertOutcome reports what happened to a single pushed alert
+type AlertOutcome struct {
+	Alert      Alert    `json:"alert"`
+	Outcome    string   `json:"outcome"`            // created, dropped or duplicate
+	ID         string   `json:"id,omitempty"`       // ID of the created entry, or of the entry it duplicates
+	Resolves   []string `json:"resolves,omitempty"` // IDs of the firing entries it resolves
+	IncidentID string   `json:"incidentId,omitempty"`
+}
+
+// IngestResult summarizes what a push did to the board
+type IngestResult struct {
+	Alerts   []AlertOutcome `json:"alerts"`
+	Created  int            `json:"created"`
+	Resolved int            `json:"resolved"`
+	Dropped  int            `json:"dropped"`
+
+	Duplicates int `json:"duplicates,omitempty"` // alerts another Alertmanager replica delivered first
+}
+
+// Tombstone records an alert removed from the board
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	RemovedAt time.Time `json:"removedAt"`
+	Seq       uint64    `json:"seq"`
+}
+
+// Banner is the operator message shown above the alerts
+type Banner struct {
+	Message   string     `json:"message"`
+	SetAt     time.Time  `json:"setAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Update is a full board state, as sent to WebSocket clients
+type Update struct {
+	Alerts            []AlertEntry `json:"alerts"`
+	HasUnacknowledged bool         `json:"hasUnacknowledged"`
+	Level             string       `json:"level"`
+	Seq               uint64       `json:"seq"`
+	Checksum          string       `json:"checksum,omitempty"` // of the alert IDs, statuses and acknowledgements
+	Tombstones        []Tombstone  `json:"tombstones,omitempty"`
+	Banner            *Banner      `json:"banner,omitempty"`
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ackLinker signs acknowledge links sent in notifications, so they work
+// with a plain GET from a mail client without exposing the dashboard
+type ackLinker struct {
+	baseURL string
+	secret  []byte
+}
+
+// newAckLinker creates a linker; without a configured secret a random one is
+// used, so links stop working after a restart
+func newAckLinker(baseURL, secret string) (*ackLinker, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &ackLinker{baseURL: strings.TrimRight(baseURL, "/"), secret: key}, nil
+}
+
+func (l *ackLinker) sign(alertID string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte("ack:" + alertID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *ackLinker) verify(alertID, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	actual, _ := hex.DecodeString(l.sign(alertID))
+	return hmac.Equal(expected, actual)
+}
+
+// Link returns the acknowledge link for an alert, or an empty string when no
+// external URL is configured
+func (l *ackLinker) Link(alertID string) string {
+	if l == nil || l.baseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/acknowledge/link?id=%s&sig=%s", l.baseURL, url.QueryEscape(alertID), l.sign(alertID))
+}
+
+// LinkFor returns the acknowledge link for an alert, falling back to the host
+// the request was sent to when no external URL is configured
+func (l *ackLinker) LinkFor(r *http.Request, alertID string) string {
+	if l.baseURL != "" {
+		return l.Link(alertID)
+	}
+	scheme := "http"
+	if r.TLS != nil || (fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/acknowledge/link?id=%s&sig=%s", scheme, r.Host, url.QueryEscape(alertID), l.sign(alertID))
+}
+
+// ackLinkPage asks for confirmation before acknowledging, since mail
+// scanners open links on their own
+var ackLinkPage = template.Must(template.New("ack-link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Wake me Up!</title>
+    <link rel="stylesheet" href="/static/style.css">
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            {{if .Done}}
+            <h1>✓ Alert acknowledged</h1>
+            {{else}}
+            <h1>Acknowledge alert?</h1>
+            <form method="POST">
+                <button class="ack-btn" type="submit">✓ Acknowledge Alert</button>
+            </form>
+            {{end}}
+            <p><a href="/">Open the board</a></p>
+        </div>
+    </div>
+</body>
+</html>
+`))
+
+// ackLinkHandler acknowledges an alert from a signed notification link: GET
+// shows a confirmation page, POST acknowledges
+func ackLinkHandler(state *AppState, links *ackLinker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		alertID := r.URL.Query().Get("id")
+		if alertID == "" || !links.verify(alertID, r.URL.Query().Get("sig")) {
+			audit.RecordRequest(r, AuditAuthFailure, 5, "Invalid acknowledge link", map[string]string{"alertId": alertID})
+			http.Error(w, "Invalid or expired link", http.StatusForbidden)
+			return
+		}
+
+		done := r.Method == http.MethodPost
+		if done {
+			state.Acknowledge(alertID, requestActor(r, "acknowledge link"))
+			audit.RecordRequest(r, AuditAcknowledge, 3, "Alert acknowledged via link", map[string]string{"alertId": alertID})
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		ackLinkPage.Execute(w, struct{ Done bool }{done})
+	}
+}
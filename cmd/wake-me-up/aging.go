@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How often derived alert states, such as age buckets, are re-evaluated
+const derivedStateCheckInterval = 15 * time.Second
+
+// ageThresholds are the configured ages, shortest first, past which
+// unacknowledged firing alerts bubble to the top of the board
+var ageThresholds []time.Duration
+
+// setAgeThresholds applies the age_thresholds config
+func setAgeThresholds(thresholds []time.Duration) error {
+	for _, threshold := range thresholds {
+		if threshold <= 0 {
+			return fmt.Errorf("age_thresholds: %s is not positive", threshold)
+		}
+	}
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ageThresholds = sorted
+	return nil
+}
+
+// ageBucket returns how many age thresholds an unacknowledged firing alert
+// has been on the board for, 0 for other alerts
+func ageBucket(entry AlertEntry, acknowledged bool, now time.Time) int {
+	if entry.Alert.Status != "firing" || acknowledged {
+		return 0
+	}
+	age := now.Sub(entry.Timestamp)
+	bucket := 0
+	for _, threshold := range ageThresholds {
+		if age < threshold {
+			break
+		}
+		bucket++
+	}
+	return bucket
+}
+
+// ageText describes the threshold of a bucket, e.g. "over 15m"
+func ageText(bucket int) string {
+	if bucket == 0 {
+		return ""
+	}
+	return "over " + shortDuration(ageThresholds[bucket-1])
+}
+
+// shortDuration formats a duration without trailing zero units, e.g. 15m
+// rather than 15m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// derivedStates returns the states computed from the board and the clock
+// rather than from webhooks, keyed by alert ID
+// This should be called while holding the lock
+func (a *AppState) derivedStates(now time.Time) map[string]int {
+	states := make(map[string]int)
+	for _, entry := range a.alerts {
+		if bucket := ageBucket(entry, a.acknowledged[entry.ID] != nil, now); bucket > 0 {
+			states[entry.ID] = bucket
+		}
+	}
+	return states
+}
+
+// runDerivedStateUpdates periodically re-evaluates derived alert states and
+// sends an update when any changed, so aging alerts move up the board even
+// without webhook traffic, and the alarm follows quiet hours
+func (a *AppState) runDerivedStateUpdates() {
+	var last map[string]int
+	var lastSound SoundDirective
+	var lastWarned bool
+	ticker := time.NewTicker(derivedStateCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		a.mu.RLock()
+		states := a.derivedStates(now)
+		sound := *a.soundDirective(now)
+		a.mu.RUnlock()
+		warned := a.labels.warning(now) != nil
+
+		if !maps.Equal(states, last) || sound != lastSound || warned != lastWarned {
+			log.Debugf("Derived alert states changed, updating clients")
+			a.broadcastUpdate()
+		}
+		last, lastSound, lastWarned = states, sound, warned
+	}
+}
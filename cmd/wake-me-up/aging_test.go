@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoardAlertsAgeOrdering(t *testing.T) {
+	if err := setAgeThresholds([]time.Duration{time.Hour, 15 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	defer setAgeThresholds(nil)
+
+	now := time.Now()
+	alert := Alert{Status: "firing", Labels: map[string]string{"alertname": "A"}}
+	alerts := []AlertEntry{
+		{ID: "new", Timestamp: now, Alert: alert},
+		{ID: "acked", Timestamp: now.Add(-2 * time.Hour), Alert: alert},
+		{ID: "old", Timestamp: now.Add(-20 * time.Minute), Alert: alert},
+		{ID: "oldest", Timestamp: now.Add(-90 * time.Minute), Alert: alert},
+	}
+	board := boardAlerts(alerts, map[string]Acknowledgement{"acked": {}}, nil, nil, nil)
+
+	want := []struct {
+		id      string
+		ageText string
+	}{{"oldest", "over 1h"}, {"old", "over 15m"}, {"new", ""}, {"acked", ""}}
+	for i, w := range want {
+		if board[i].ID != w.id || board[i].AgeText != w.ageText {
+			t.Fatalf("Position %d: got %s (%q), want %s (%q)", i, board[i].ID, board[i].AgeText, w.id, w.ageText)
+		}
+	}
+}
+
+func TestSetAgeThresholdsRejectsNonPositive(t *testing.T) {
+	defer setAgeThresholds(nil)
+	if err := setAgeThresholds([]time.Duration{15 * time.Minute, 0}); err == nil {
+		t.Fatal("Expected an error for a zero threshold")
+	}
+}
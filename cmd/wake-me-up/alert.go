@@ -1,13 +1,19 @@
 package main
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 type Alert struct {
 	Status       string            `json:"status"`
 	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"` // e.g. summary, description and runbook_url
 	StartsAt     time.Time         `json:"startsAt"`
 	EndsAt       *time.Time        `json:"endsAt,omitempty"`
 	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint,omitempty"` // set by Alertmanager, from the labels
 }
 
 type AlertGroup struct {
@@ -15,50 +21,76 @@ type AlertGroup struct {
 	Alerts []Alert           `json:"alerts"`
 }
 
-func getStatusClass(hasUnacknowledged bool) string {
-	if hasUnacknowledged {
+// Board status levels, from the highest-severity unacknowledged firing alert
+const (
+	StatusLevelOK       = "ok"
+	StatusLevelWarning  = "warning"
+	StatusLevelCritical = "critical"
+)
+
+// criticalSeverities are the severity label values that raise the board to critical
+var criticalSeverities = map[string]bool{
+	"critical":  true,
+	"page":      true,
+	"error":     true,
+	"high":      true,
+	"emergency": true,
+}
+
+// alertSeverity returns the normalized severity label of an alert
+func alertSeverity(alert Alert) string {
+	return strings.ToLower(strings.TrimSpace(alert.Labels["severity"]))
+}
+
+// severityLevel maps an alert severity to the board status level it causes
+// when unacknowledged; anything not known to be critical is a warning
+func severityLevel(severity string) string {
+	if criticalSeverities[severity] {
+		return StatusLevelCritical
+	}
+	return StatusLevelWarning
+}
+
+func getStatusClass(level string) string {
+	switch level {
+	case StatusLevelCritical:
 		return "active"
+	case StatusLevelWarning:
+		return "warning"
 	}
 	return "clear"
 }
 
-func getStatusText(hasUnacknowledged bool) string {
-	if hasUnacknowledged {
+func getStatusText(level string) string {
+	switch level {
+	case StatusLevelCritical:
+		return "🚨 CRITICAL ALERTS UNACKNOWLEDGED"
+	case StatusLevelWarning:
 		return "⚠️ UNACKNOWLEDGED ALERTS"
 	}
 	return "✓ ALL CLEAR"
 }
 
-// alertsMatch checks if two alerts have matching labels
-// Two alerts match only if ALL labels match exactly (bidirectional check)
-// Both alerts must have the same set of labels with the same values
-func alertsMatch(resolvedAlert, firingAlert Alert) bool {
-	// Both must have labels
-	if len(resolvedAlert.Labels) == 0 || len(firingAlert.Labels) == 0 {
-		return false
-	}
-
-	// Must have the same number of labels
-	if len(resolvedAlert.Labels) != len(firingAlert.Labels) {
-		return false
+// labelFingerprint identifies a label set: two alerts match only if they have
+// exactly the same labels with the same values. Alerts without labels get an
+// empty fingerprint and match nothing.
+func labelFingerprint(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
 	}
-
-	// Check if all labels from the resolved alert match the firing alert
-	for key, resolvedValue := range resolvedAlert.Labels {
-		firingValue, exists := firingAlert.Labels[key]
-		if !exists || firingValue != resolvedValue {
-			return false
-		}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	// Check if all labels from the firing alert match the resolved alert (bidirectional)
-	// Since we already checked length and one direction, this ensures exact match
-	for key, firingValue := range firingAlert.Labels {
-		resolvedValue, exists := resolvedAlert.Labels[key]
-		if !exists || resolvedValue != firingValue {
-			return false
-		}
+	// 0xff never occurs in UTF-8 label names and values, so it can't be confused
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xff)
+		b.WriteString(labels[k])
+		b.WriteByte(0xff)
 	}
-
-	return true
+	return b.String()
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// alertQuery filters, sorts and pages the alerts listed by /api/v1/alerts
+type alertQuery struct {
+	statuses     map[string]bool // firing and/or resolved, any if empty
+	acknowledged *bool
+	env          string
+	matchers     []labelMatcher
+	sort         string // board, received, starts_at, severity or name
+	descending   bool
+	limit        int // 0 for all
+	offset       int
+}
+
+// labelMatcher is an Alertmanager style label selector: key=value, key!=value,
+// key=~regex or key!~regex
+type labelMatcher struct {
+	key    string
+	op     string
+	value  string
+	regexp *regexp.Regexp
+}
+
+// Sort orders of the alerts API; board is the order shown on the dashboard
+var alertSortOrders = map[string]bool{"board": true, "received": true, "starts_at": true, "severity": true, "name": true}
+
+// parseAlertQuery reads the query parameters of /api/v1/alerts
+func parseAlertQuery(values url.Values) (alertQuery, error) {
+	query := alertQuery{env: values.Get("env"), sort: "board"}
+
+	for _, status := range splitList(values["status"]) {
+		if status != "firing" && status != "resolved" {
+			return query, fmt.Errorf("status must be firing or resolved, got %q", status)
+		}
+		if query.statuses == nil {
+			query.statuses = make(map[string]bool)
+		}
+		query.statuses[status] = true
+	}
+
+	if value := values.Get("acknowledged"); value != "" {
+		acknowledged, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("acknowledged must be true or false, got %q", value)
+		}
+		query.acknowledged = &acknowledged
+	}
+
+	for _, selector := range values["label"] {
+		matcher, err := parseLabelMatcher(selector)
+		if err != nil {
+			return query, err
+		}
+		query.matchers = append(query.matchers, matcher)
+	}
+
+	if value := values.Get("sort"); value != "" {
+		query.sort = value
+		if !alertSortOrders[value] {
+			return query, fmt.Errorf("unknown sort order %q", value)
+		}
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		query.descending = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+
+	for name, target := range map[string]*int{"limit": &query.limit, "offset": &query.offset} {
+		if value := values.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return query, fmt.Errorf("%s must be a non-negative number, got %q", name, value)
+			}
+			*target = n
+		}
+	}
+	return query, nil
+}
+
+// splitList returns the comma separated values of repeated parameters
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseLabelMatcher parses a selector such as severity=critical or
+// instance=~"db-.*"
+func parseLabelMatcher(selector string) (labelMatcher, error) {
+	i := strings.IndexAny(selector, "=!")
+	if i <= 0 {
+		return labelMatcher{}, fmt.Errorf("invalid label selector %q, expected e.g. severity=critical", selector)
+	}
+	matcher := labelMatcher{key: strings.TrimSpace(selector[:i])}
+	rest := selector[i:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			matcher.op = op
+			matcher.value = strings.Trim(strings.TrimSpace(rest[len(op):]), `"`)
+			break
+		}
+	}
+	if matcher.op == "" {
+		return matcher, fmt.Errorf("invalid label selector %q, expected e.g. severity=critical", selector)
+	}
+	if matcher.op == "=~" || matcher.op == "!~" {
+		re, err := regexp.Compile("^(?:" + matcher.value + ")$")
+		if err != nil {
+			return matcher, fmt.Errorf("invalid regular expression in label selector %q: %v", selector, err)
+		}
+		matcher.regexp = re
+	}
+	return matcher, nil
+}
+
+// matches checks the selector against labels; a missing label is empty
+func (m labelMatcher) matches(labels map[string]string) bool {
+	value := labels[m.key]
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.regexp.MatchString(value)
+	default:
+		return !m.regexp.MatchString(value)
+	}
+}
+
+// apply returns the page of matching alerts, in board order when asked, and
+// how many alerts matched in all
+func (q alertQuery) apply(alerts []AlertEntryWithAck, environmentLabel string) ([]AlertEntryWithAck, int) {
+	matched := make([]AlertEntryWithAck, 0, len(alerts))
+	for _, entry := range alerts {
+		if len(q.statuses) > 0 && !q.statuses[entry.Alert.Status] {
+			continue
+		}
+		if q.acknowledged != nil && entry.IsAcknowledged != *q.acknowledged {
+			continue
+		}
+		if q.env != "" && !inEnvironment(entry.Alert, environmentLabel, q.env) {
+			continue
+		}
+		if !q.matchesLabels(entry.Alert.Labels) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	less := func(i, j int) bool { return false }
+	switch q.sort {
+	case "received":
+		less = func(i, j int) bool { return matched[i].Timestamp.Before(matched[j].Timestamp) }
+	case "starts_at":
+		less = func(i, j int) bool { return matched[i].Alert.StartsAt.Before(matched[j].Alert.StartsAt) }
+	case "severity":
+		// Critical first
+		less = func(i, j int) bool {
+			return severityLevel(alertSeverity(matched[i].Alert)) == StatusLevelCritical &&
+				severityLevel(alertSeverity(matched[j].Alert)) != StatusLevelCritical
+		}
+	case "name":
+		less = func(i, j int) bool { return alertDisplayName(matched[i].Alert) < alertDisplayName(matched[j].Alert) }
+	}
+	sort.SliceStable(matched, less)
+	if q.descending {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	total := len(matched)
+	if q.offset >= total {
+		return []AlertEntryWithAck{}, total
+	}
+	matched = matched[q.offset:]
+	if q.limit > 0 && q.limit < len(matched) {
+		matched = matched[:q.limit]
+	}
+	return matched, total
+}
+
+// matchesLabels checks all label selectors
+func (q alertQuery) matchesLabels(labels map[string]string) bool {
+	for _, matcher := range q.matchers {
+		if !matcher.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultAllClearDebounce = time.Minute
+
+// AllClearConfig announces when the board goes green again: the last
+// unacknowledged firing alert was acknowledged, resolved or cleared
+type AllClearConfig struct {
+	Notify   bool          `yaml:"notify"`   // Send "Board is green again" through the notifiers (optional, default: false)
+	Chime    bool          `yaml:"chime"`    // Play a short chime on the dashboards (optional, default: false)
+	Debounce time.Duration `yaml:"debounce"` // How long the board must stay green first, so flapping alerts don't spam (optional, default: 1m)
+}
+
+// allClearWatch follows the board between alarm and green, announcing green
+// once it held for the debounce time
+type allClearWatch struct {
+	config   AllClearConfig
+	announce func(alarmFor time.Duration)
+
+	mu         sync.Mutex
+	alarmSince time.Time   // when the board went into alarm, zero while green
+	pending    *time.Timer // announces the all clear once the debounce passed
+}
+
+func newAllClearWatch(config *AllClearConfig, announce func(alarmFor time.Duration)) *allClearWatch {
+	if config == nil || (!config.Notify && !config.Chime) {
+		return nil
+	}
+	watch := &allClearWatch{config: *config, announce: announce}
+	if watch.config.Debounce <= 0 {
+		watch.config.Debounce = defaultAllClearDebounce
+	}
+	return watch
+}
+
+// observe records whether the board is in alarm, scheduling the all clear
+// when it turns green and calling it off when the alarm comes back first
+func (w *allClearWatch) observe(alarm bool, now time.Time) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case alarm && w.pending != nil:
+		// Flapped back before the debounce passed, still the same alarm
+		w.pending.Stop()
+		w.pending = nil
+	case alarm && w.alarmSince.IsZero():
+		w.alarmSince = now
+	case !alarm && !w.alarmSince.IsZero() && w.pending == nil:
+		alarmFor := now.Sub(w.alarmSince)
+		var timer *time.Timer
+		timer = time.AfterFunc(w.config.Debounce, func() {
+			w.mu.Lock()
+			if w.pending != timer {
+				w.mu.Unlock()
+				return
+			}
+			w.pending = nil
+			w.alarmSince = time.Time{}
+			w.mu.Unlock()
+			w.announce(alarmFor)
+		})
+		w.pending = timer
+	}
+}
+
+// hasUnacknowledgedFiring checks if any firing alert awaits acknowledgement
+// This should be called while holding the lock
+func (a *AppState) hasUnacknowledgedFiring() bool {
+	for _, entry := range a.alerts {
+		if entry.Alert.Status == "firing" && a.acknowledged[entry.ID] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// announceAllClear tells the notifiers and dashboards the board is green again
+func (a *AppState) announceAllClear(alarmFor time.Duration) {
+	note := fmt.Sprintf("Board is green again after %s", shortDuration(alarmFor.Round(time.Second)))
+	log.Infof("All clear: %s", note)
+	if a.allClear.config.Notify {
+		a.notifier.Dispatch(NotificationEvent{
+			Kind: EventAllClear,
+			Note: note,
+		})
+	}
+	if a.allClear.config.Chime {
+		a.hub.broadcast <- a.audible([]byte(`{"type":"all-clear"}`))
+	}
+}
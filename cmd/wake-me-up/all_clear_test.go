@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllClearWatch(t *testing.T) {
+	announced := make(chan time.Duration, 10)
+	watch := newAllClearWatch(&AllClearConfig{Chime: true, Debounce: 50 * time.Millisecond}, func(alarmFor time.Duration) {
+		announced <- alarmFor
+	})
+	expect := func(want bool) {
+		t.Helper()
+		select {
+		case <-announced:
+			if !want {
+				t.Fatal("Unexpected all clear")
+			}
+		case <-time.After(150 * time.Millisecond):
+			if want {
+				t.Fatal("Expected an all clear")
+			}
+		}
+	}
+
+	// Green without an alarm before announces nothing
+	start := time.Now()
+	watch.observe(false, start)
+	expect(false)
+
+	// Flapping back within the debounce is still the same alarm
+	watch.observe(true, start)
+	watch.observe(false, start.Add(time.Minute))
+	watch.observe(true, start.Add(time.Minute))
+	expect(false)
+
+	watch.observe(false, start.Add(2*time.Minute))
+	watch.observe(false, start.Add(2*time.Minute))
+	select {
+	case alarmFor := <-announced:
+		if alarmFor != 2*time.Minute {
+			t.Errorf("Expected the alarm to have lasted 2m, got %s", alarmFor)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an all clear")
+	}
+	expect(false)
+
+	if newAllClearWatch(&AllClearConfig{Debounce: time.Second}, nil) != nil {
+		t.Error("Expected no watch without notify or chime")
+	}
+}
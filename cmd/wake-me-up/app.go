@@ -2,13 +2,19 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,11 +22,65 @@ import (
 
 type AppState struct {
 	mu           sync.RWMutex
-	alerts       []AlertEntry
+	alerts       []AlertEntry // oldest first, new alerts are appended
 	maxSize      int
 	config       *Config
-	acknowledged map[string]bool // alert ID -> acknowledged
-	hub          *Hub            // WebSocket hub for real-time updates
+	acknowledged map[string]*Acknowledgement // alert ID -> who acknowledged it
+	hub          *Hub                        // WebSocket hub for real-time updates
+
+	seq                uint64        // state sequence number, bumped on every change
+	broadcastSeq       uint64        // sequence number of the last broadcast update
+	tombstones         []Tombstone   // recently removed alerts, oldest first
+	tombstoneRetention time.Duration // how long tombstones are kept
+
+	gone         map[string]time.Time // label fingerprint -> when an alert with it was resolved or cleared
+	refireWindow time.Duration        // how soon firing again counts as re-fired
+
+	banner      *Banner     // board-level message, nil if none
+	bannerTimer *time.Timer // clears the banner when it expires
+
+	lock *BoardLock // keeps clears and bulk actions off the board, nil if unlocked
+
+	devices *DeviceRegistry // named client devices
+	zones   []networkZone   // source network zones of webhooks
+
+	notifier *Dispatcher      // outbound notifications
+	browser  *browserNotifier // desktop notifications shown by board clients, nil if disabled
+
+	templates *templateSet // page templates with user overrides
+
+	incidents []*Incident // open incidents, oldest first
+	silences  []*Silence  // active silences, oldest first
+
+	followUps map[string]*FollowUp // pending acknowledgement follow-ups by alert ID
+	snoozes   map[string]*Snooze   // temporary acknowledgements by alert ID
+
+	reviews []*Review // alerts marked as needing follow-up, oldest first
+
+	delegations map[string]*Delegation // delegated acknowledge links of escalations by token
+
+	bulkPreviews map[string]*BulkPreview // bulk actions waiting to be committed, by token
+	replicas     *replicaSet             // recent deliveries and stats of the Alertmanager replicas
+	throttle     *ingestThrottle         // deliveries of alert groups held during storms
+
+	escalationAlarm *escalationAlarm // re-alarms alerts left unacknowledged, nil if disabled
+
+	suppressed *suppressionStats // alerts kept from sounding the alarm, for the daily report
+
+	labels *labelGuard // trims labels over the label limits, nil if unlimited
+
+	groups *groupTimelines // what changed between deliveries of alert groups
+
+	cluster *clusterLink // shares the board with other instances, nil when running alone
+
+	allClear *allClearWatch // announces the board going green, nil if disabled
+	mqtt     *mqttPublisher // publishes the board state for home automation, nil if disabled
+
+	persister *boardPersister // saves the board across restarts, nil if kept in memory only
+
+	history  *alertHistory  // what happened to alerts, also after they left the board
+	timeline *boardTimeline // when the board went between clear and alarm
+	search   *searchIndex   // words of the board alerts, for /api/v1/search
 }
 
 // Hub maintains the set of active clients and broadcasts messages to them
@@ -29,24 +89,115 @@ type Hub struct {
 	clients map[*Client]bool
 
 	// Inbound messages from clients
-	broadcast chan []byte
+	broadcast chan hubMessage
 
 	// Register requests from clients
 	register chan *Client
 
 	// Unregister requests from clients
 	unregister chan *Client
+
+	// Messages for the clients of a single device, or a single client
+	direct chan directMessage
+
+	// Requests for a listing of the connected clients
+	list chan chan []ClientInfo
+
+	// Requests to disconnect all clients, on shutdown
+	closeAll chan chan struct{}
+
+	// Keepalive and deadline settings for client connections
+	timing wsTiming
+}
+
+// wsTiming holds the keepalive settings of WebSocket connections
+type wsTiming struct {
+	pingInterval time.Duration // how often clients are pinged
+	pongTimeout  time.Duration // how long a client may go without answering a ping
+	writeTimeout time.Duration // how long a single write may take, plus time for its size
+
+	minThroughput   int  // bytes per second a client is expected to take at least
+	trimSlowClients bool // send slow clients only the newest of queued updates
+}
+
+var defaultWSTiming = wsTiming{
+	pingInterval:  54 * time.Second,
+	pongTimeout:   60 * time.Second,
+	writeTimeout:  10 * time.Second,
+	minThroughput: defaultMinThroughput,
+}
+
+// hubMessage is a message for all clients. The clients of the devices in
+// mutedDevices, muted by their schedule, get muted instead, or nothing if
+// it is nil, e.g. for chimes.
+type hubMessage struct {
+	message      []byte
+	muted        []byte
+	mutedDevices map[string]bool
+}
+
+// directMessage is a message for the clients of a single device, or for a
+// single client if set
+type directMessage struct {
+	deviceToken string
+	client      *Client
+	message     []byte
+	delivered   chan int // number of clients the message was queued for
+}
+
+// matches tells if a client is a recipient of the message
+func (d directMessage) matches(client *Client) bool {
+	if d.client != nil {
+		return client == d.client
+	}
+	return client.deviceToken == d.deviceToken
 }
 
 // Client is a middleman between the websocket connection and the hub
 type Client struct {
 	hub *Hub
 
+	// The board the client follows, for resync requests
+	state *AppState
+
 	// The websocket connection
 	conn *websocket.Conn
 
 	// Buffered channel of outbound messages
 	send chan []byte
+
+	// Token of the registered device this client runs on, if any
+	deviceToken string
+
+	remoteAddr  string
+	userAgent   string
+	connectedAt time.Time
+
+	// Keepalive state, updated by the pong handler
+	lastPong atomic.Int64 // unix nanoseconds of the last pong
+	rtt      atomic.Int64 // round trip time of the last ping, in nanoseconds
+
+	// Set when the last write used more than half of its deadline
+	slow atomic.Bool
+
+	// Browser notification permission reported by the client
+	notificationPermission atomic.Value // string
+
+	disconnectOnce sync.Once
+}
+
+// ClientInfo describes a connected WebSocket client
+type ClientInfo struct {
+	DeviceToken string    `json:"deviceToken,omitempty"`
+	DeviceName  string    `json:"deviceName,omitempty"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastPong    time.Time `json:"lastPong"`
+	RTTMillis   float64   `json:"rttMillis"`
+	Slow        bool      `json:"slow"` // last write took more than half its deadline
+
+	NotificationPermission string `json:"notificationPermission,omitempty"` // granted, denied, default or unsupported
 }
 
 // UpdateMessage represents a message sent over WebSocket
@@ -54,22 +205,67 @@ type UpdateMessage struct {
 	Type              string              `json:"type"`
 	Alerts            []AlertEntryWithAck `json:"alerts,omitempty"`
 	HasUnacknowledged bool                `json:"hasUnacknowledged,omitempty"`
+	Level             string              `json:"level"`
+	Theme             *StatusTheme        `json:"theme,omitempty"`
+	Seq               uint64              `json:"seq"`
+	Checksum          string              `json:"checksum"`           // of the board alerts, see stateChecksum
+	Instance          string              `json:"instance,omitempty"` // in cluster mode, the instance the seq belongs to
+	Tombstones        []Tombstone         `json:"tombstones,omitempty"`
+	Banner            *Banner             `json:"banner,omitempty"`
+	Lock              *BoardLock          `json:"lock,omitempty"`
+	ZoneLabel         string              `json:"zoneLabel,omitempty"`
+	EnvironmentLabel  string              `json:"environmentLabel,omitempty"`
+	Environments      []EnvironmentTab    `json:"environments,omitempty"` // set when alerts carry the environment label
+	Incidents         []Incident          `json:"incidents,omitempty"`
+	Rendered          map[string]string   `json:"rendered,omitempty"` // Server-rendered blocks, set when templates are overridden
+	Sound             *SoundDirective     `json:"sound,omitempty"`
+	LabelWarning      *LabelWarning       `json:"labelWarning,omitempty"` // labels were trimmed lately, see label_limits
+}
+
+// Acknowledgement records who acknowledged an alert, when and why. It is
+// replaced, never changed, once on the board.
+type Acknowledgement struct {
+	By      string    `json:"by,omitempty"` // empty if unknown
+	At      time.Time `json:"at"`
+	Comment string    `json:"comment,omitempty"`
+	Silence string    `json:"silence,omitempty"` // ID of the silence that acknowledged it
+
+	AtText string `json:"atText,omitempty"` // formatted time, only set in updates
 }
 
 // AlertEntryWithAck includes the acknowledged status
 type AlertEntryWithAck struct {
-	ID             string    `json:"id"`
-	Timestamp      time.Time `json:"timestamp"`
-	Alert          Alert     `json:"alert"`
-	IsAcknowledged bool      `json:"isAcknowledged"`
+	ID              string           `json:"id"`
+	Timestamp       time.Time        `json:"timestamp"`
+	Alert           Alert            `json:"alert"`
+	Decoration      string           `json:"decoration,omitempty"` // icons and prefixes of the decorations matching it
+	Severity        string           `json:"severity,omitempty"`   // normalized severity label
+	SeverityColor   string           `json:"severityColor,omitempty"`
+	IsAcknowledged  bool             `json:"isAcknowledged"`
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"` // who acknowledged it
+	NeedsAck        bool             `json:"needsAck,omitempty"`        // counts as unacknowledged, see resolved_requires_ack
+	IncidentID      string           `json:"incidentId,omitempty"`
+	Refired         bool             `json:"refired,omitempty"`
+	Rule            *AlertRule       `json:"rule,omitempty"` // alerting rule it came from, see alert_rules
+	Receiver        string           `json:"receiver,omitempty"`
+	ExternalURL     string           `json:"externalURL,omitempty"`
+	Replicas        []string         `json:"replicas,omitempty"`
+	FollowUp        *FollowUp        `json:"followUp,omitempty"`  // reminder set when acknowledging
+	Snooze          *Snooze          `json:"snooze,omitempty"`    // acknowledged until the snooze ends
+	Review          *Review          `json:"review,omitempty"`    // marked as needing follow-up
+	AgeBucket       int              `json:"ageBucket,omitempty"` // number of age_thresholds the unacknowledged alert passed
+	AgeText         string           `json:"ageText,omitempty"`   // the last threshold passed, e.g. "over 15m"
+
+	// Times formatted as configured, so all clients show the same
+	TimestampText string `json:"timestampText"`
+	StartsAtText  string `json:"startsAtText"`
+	EndsAtText    string `json:"endsAtText,omitempty"`
 }
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow connections from any origin
-	},
+	CheckOrigin:     originAllowed, // The board's own origin and allowed_origins
 }
 
 func NewAppState(maxSize int) *AppState {
@@ -77,20 +273,39 @@ func NewAppState(maxSize int) *AppState {
 	go hub.run()
 
 	return &AppState{
-		alerts:       make([]AlertEntry, 0),
-		maxSize:      maxSize,
-		acknowledged: make(map[string]bool),
-		hub:          hub,
+		alerts:             make([]AlertEntry, 0),
+		maxSize:            maxSize,
+		acknowledged:       make(map[string]*Acknowledgement),
+		hub:                hub,
+		tombstoneRetention: defaultTombstoneRetention,
+		gone:               make(map[string]time.Time),
+		refireWindow:       defaultRefireWindow,
+		devices:            newDeviceRegistry(),
+		followUps:          make(map[string]*FollowUp),
+		snoozes:            make(map[string]*Snooze),
+		delegations:        make(map[string]*Delegation),
+		bulkPreviews:       make(map[string]*BulkPreview),
+		replicas:           newReplicaSet(),
+		throttle:           newIngestThrottle(),
+		suppressed:         newSuppressionStats(),
+		history:            newAlertHistory(),
+		timeline:           newBoardTimeline(),
+		search:             newSearchIndex(),
+		groups:             newGroupTimelines(),
 	}
 }
 
 // newHub creates a new Hub
 func newHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan hubMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		direct:     make(chan directMessage),
+		list:       make(chan chan []ClientInfo),
+		closeAll:   make(chan chan struct{}),
 		clients:    make(map[*Client]bool),
+		timing:     defaultWSTiming,
 	}
 }
 
@@ -107,39 +322,286 @@ func (h *Hub) run() {
 				close(client.send)
 			}
 
-		case message := <-h.broadcast:
+		case broadcast := <-h.broadcast:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if chaos.killClient() {
+					// The read loop sees the closed connection and unregisters the client
+					client.disconnected(DisconnectChaos)
+					client.conn.Close()
+					continue
+				}
+				message := broadcast.message
+				if broadcast.mutedDevices[client.deviceToken] {
+					if message = broadcast.muted; message == nil {
+						continue
+					}
 				}
+				h.queue(client, message)
 			}
+
+		case direct := <-h.direct:
+			delivered := 0
+			for client := range h.clients {
+				if direct.matches(client) && h.queue(client, direct.message) {
+					delivered++
+				}
+			}
+			direct.delivered <- delivered
+
+		case reply := <-h.list:
+			infos := make([]ClientInfo, 0, len(h.clients))
+			for client := range h.clients {
+				infos = append(infos, ClientInfo{
+					DeviceToken: client.deviceToken,
+					RemoteAddr:  client.remoteAddr,
+					UserAgent:   client.userAgent,
+					ConnectedAt: client.connectedAt,
+					LastPong:    time.Unix(0, client.lastPong.Load()),
+					RTTMillis:   float64(client.rtt.Load()) / float64(time.Millisecond),
+					Slow:        client.slow.Load(),
+				})
+				if permission, ok := client.notificationPermission.Load().(string); ok {
+					infos[len(infos)-1].NotificationPermission = permission
+				}
+			}
+			reply <- infos
+
+		case done := <-h.closeAll:
+			// Tell the clients the server is going away, so they reconnect
+			// rather than take the dropped connection for a network problem
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			for client := range h.clients {
+				client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(h.timing.writeTimeout))
+				client.disconnected(DisconnectShutdown)
+				delete(h.clients, client)
+				close(client.send)
+			}
+			close(done)
 		}
+		wsClientsConnected.Set(float64(len(h.clients)))
+	}
+}
+
+// queue hands a message to a client, dropping the client if it can't keep up
+func (h *Hub) queue(client *Client, message []byte) bool {
+	select {
+	case client.send <- message:
+		return true
+	default:
+		client.disconnected(DisconnectSlowConsumer)
+		close(client.send)
+		delete(h.clients, client)
+		return false
 	}
 }
 
+// sendToDevice sends a message to every client of a device and returns how
+// many clients it was queued for
+func (h *Hub) sendToDevice(deviceToken string, message []byte) int {
+	delivered := make(chan int, 1)
+	h.direct <- directMessage{deviceToken: deviceToken, message: message, delivered: delivered}
+	return <-delivered
+}
+
+// sendToClient sends a message to a single client, if still connected
+func (h *Hub) sendToClient(client *Client, message []byte) bool {
+	delivered := make(chan int, 1)
+	h.direct <- directMessage{client: client, message: message, delivered: delivered}
+	return <-delivered > 0
+}
+
+// closeClients disconnects all clients with a close message
+func (h *Hub) closeClients() {
+	done := make(chan struct{})
+	h.closeAll <- done
+	<-done
+}
+
+// listClients returns the connected clients
+func (h *Hub) listClients() []ClientInfo {
+	reply := make(chan []ClientInfo, 1)
+	h.list <- reply
+	return <-reply
+}
+
 // broadcastUpdate sends an update to all connected clients
 func (a *AppState) broadcastUpdate() {
+	a.mu.Lock()
+	since := a.broadcastSeq
+	a.broadcastSeq = a.seq
+	if a.persister != nil && since != a.seq {
+		a.persister.queue(a.storedBoard())
+	}
+	alarm := a.hasUnacknowledgedFiring()
+	a.mu.Unlock()
+	now := time.Now()
+	a.allClear.observe(alarm, now)
+	a.timeline.observe(alarm, now)
+	a.notifier.BoardChanged(a.boardView)
+	a.mqtt.stateChanged()
+
+	message := a.updateMessage(since)
+	broadcast := hubMessage{mutedDevices: a.devices.MutedDevices(now)}
+	var err error
+	broadcast.message, err = json.Marshal(message)
+	if err == nil && broadcast.mutedDevices != nil {
+		message.Sound = mutedSound(message.Sound)
+		broadcast.muted, err = json.Marshal(message)
+	}
+	if err != nil {
+		log.Errorf("Error marshaling update message: %v", err)
+		broadcastErrors.WithLabelValues("marshal").Inc()
+		return
+	}
+	if chaos.dropBroadcast() {
+		return
+	}
+
+	select {
+	case a.hub.broadcast <- broadcast:
+	default:
+		// Non-blocking send
+		broadcastErrors.WithLabelValues("dropped").Inc()
+	}
+}
+
+// buildUpdate builds a full state update message for the clients of a device,
+// including the tombstones of alerts removed after the given sequence number
+func (a *AppState) buildUpdate(since uint64, deviceToken string) ([]byte, error) {
+	message := a.updateMessage(since)
+	if a.devices.Muted(deviceToken, time.Now()) {
+		message.Sound = mutedSound(message.Sound)
+	}
+	return json.Marshal(message)
+}
+
+// updateMessage returns a full state update, including the tombstones of
+// alerts removed after the given sequence number
+func (a *AppState) updateMessage(since uint64) UpdateMessage {
 	a.mu.RLock()
-	alerts := make([]AlertEntry, len(a.alerts))
-	copy(alerts, a.alerts)
-	hasUnacknowledged := a.HasUnacknowledgedAlerts()
-	acknowledged := make(map[string]bool)
-	for k, v := range a.acknowledged {
-		acknowledged[k] = v
+	alerts := a.alertsNewestFirst()
+	level := a.statusLevel()
+	theme := a.statusTheme()
+	acknowledged := a.acknowledgementList()
+	seq := a.seq
+	checksum := a.stateChecksum()
+	tombstones := a.tombstonesSince(since)
+	var banner *Banner
+	if a.banner != nil {
+		copied := *a.banner
+		copied.ExpiresText = formatTime(copied.ExpiresAt)
+		banner = &copied
+	}
+	var lock *BoardLock
+	if a.lock != nil {
+		copied := *a.lock
+		lock = &copied
 	}
+	incidents := a.incidentList()
+	followUps := a.followUpList()
+	snoozes := a.snoozeList()
+	reviews := a.reviewList()
+	environments := a.environmentTabs()
+	sound := a.soundDirective(time.Now())
 	a.mu.RUnlock()
 
+	alertsWithAck := boardAlerts(alerts, acknowledged, followUps, snoozes, reviews)
+
+	message := UpdateMessage{
+		Type:              "update",
+		Alerts:            alertsWithAck,
+		HasUnacknowledged: level != StatusLevelOK,
+		Level:             level,
+		Theme:             theme,
+		Seq:               seq,
+		Checksum:          checksum,
+		Instance:          clusterInstance,
+		Tombstones:        tombstones,
+		Banner:            banner,
+		Lock:              lock,
+		Incidents:         incidents,
+		Environments:      environments,
+		Sound:             sound,
+		LabelWarning:      a.labels.warning(time.Now()),
+	}
+	if environments != nil {
+		message.EnvironmentLabel = a.environmentLabel()
+	}
+	if len(a.zones) > 0 {
+		message.ZoneLabel = a.config.NetworkZoneLabel
+		if message.ZoneLabel == "" {
+			message.ZoneLabel = defaultNetworkZoneLabel
+		}
+	}
+	if a.templates != nil && a.templates.Overridden() {
+		cards := make([]AlertTemplateData, len(alertsWithAck))
+		for i, entry := range alertsWithAck {
+			cards[i] = alertTemplateData(AlertEntry{
+				ID:          entry.ID,
+				Timestamp:   entry.Timestamp,
+				Alert:       entry.Alert,
+				IncidentID:  entry.IncidentID,
+				Rule:        entry.Rule,
+				Receiver:    entry.Receiver,
+				ExternalURL: entry.ExternalURL,
+			}, entry.IsAcknowledged)
+			cards[i].setAcknowledgement(entry.Acknowledgement)
+			cards[i].FollowUp = entry.FollowUp
+			cards[i].Snooze = entry.Snooze
+			cards[i].Review = entry.Review
+		}
+		message.Rendered = a.templates.renderBlocks(banner, cards)
+	}
+	return message
+}
+
+// boardAlerts converts entries to the board order: firing first, then
+// acknowledged, then resolved, newest first within each
+func boardAlerts(alerts []AlertEntry, acknowledged map[string]Acknowledgement, followUps map[string]FollowUp, snoozes map[string]Snooze, reviews map[string]Review) []AlertEntryWithAck {
 	// Convert to AlertEntryWithAck format
+	now := time.Now()
 	alertsWithAck := make([]AlertEntryWithAck, len(alerts))
 	for i, entry := range alerts {
+		ack, isAcknowledged := acknowledged[entry.ID]
+		bucket := ageBucket(entry, isAcknowledged, now)
 		alertsWithAck[i] = AlertEntryWithAck{
 			ID:             entry.ID,
 			Timestamp:      entry.Timestamp,
 			Alert:          entry.Alert,
-			IsAcknowledged: acknowledged[entry.ID],
+			Decoration:     alertDecoration(entry.Alert),
+			Severity:       alertSeverity(entry.Alert),
+			SeverityColor:  severityColor(alertSeverity(entry.Alert)),
+			IsAcknowledged: isAcknowledged,
+			NeedsAck:       needsAck(entry.Alert.Status, isAcknowledged),
+			IncidentID:     entry.IncidentID,
+			Refired:        entry.Refired,
+			Rule:           entry.Rule,
+			Receiver:       entry.Receiver,
+			ExternalURL:    entry.ExternalURL,
+			Replicas:       entry.Replicas,
+			TimestampText:  timeFormat.Board(entry.Timestamp),
+			StartsAtText:   timeFormat.Board(entry.Alert.StartsAt),
+			AgeBucket:      bucket,
+			AgeText:        ageText(bucket),
+		}
+		if entry.Alert.EndsAt != nil {
+			alertsWithAck[i].EndsAtText = timeFormat.Board(*entry.Alert.EndsAt)
+		}
+		if isAcknowledged {
+			ack.AtText = timeFormat.Board(ack.At)
+			alertsWithAck[i].Acknowledgement = &ack
+		}
+		if followUp, ok := followUps[entry.ID]; ok {
+			followUp.DueText = timeFormat.Board(followUp.DueAt)
+			alertsWithAck[i].FollowUp = &followUp
+		}
+		if snooze, ok := snoozes[entry.ID]; ok {
+			snooze.UntilText = timeFormat.Board(snooze.Until)
+			alertsWithAck[i].Snooze = &snooze
+		}
+		if review, ok := reviews[entry.ID]; ok {
+			review.MarkedText = timeFormat.Board(review.MarkedAt)
+			alertsWithAck[i].Review = &review
 		}
 	}
 
@@ -155,26 +617,41 @@ func (a *AppState) broadcastUpdate() {
 			return iPriority < jPriority
 		}
 
+		// Alerts left unacknowledged the longest bubble up
+		if iEntry.AgeBucket != jEntry.AgeBucket {
+			return iEntry.AgeBucket > jEntry.AgeBucket
+		}
+
 		return iEntry.Timestamp.After(jEntry.Timestamp)
 	})
 
-	message := UpdateMessage{
-		Type:              "update",
-		Alerts:            alertsWithAck,
-		HasUnacknowledged: hasUnacknowledged,
-	}
+	return alertsWithAck
+}
 
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		log.Errorf("Error marshaling update message: %v", err)
-		return
-	}
+// GetBoardAlerts returns the alerts with their acknowledged status, in board order
+func (a *AppState) GetBoardAlerts() []AlertEntryWithAck {
+	a.mu.RLock()
+	alerts := a.alertsNewestFirst()
+	acknowledged := a.acknowledgementList()
+	followUps := a.followUpList()
+	snoozes := a.snoozeList()
+	reviews := a.reviewList()
+	a.mu.RUnlock()
+	return boardAlerts(alerts, acknowledged, followUps, snoozes, reviews)
+}
 
-	select {
-	case a.hub.broadcast <- jsonData:
-	default:
-		// Non-blocking send
+// boardView returns the board for the notifiers keeping their messages in sync
+func (a *AppState) boardView() boardView {
+	view := boardView{Alerts: make(map[string]AlertEntryWithAck), Removed: make(map[string]string)}
+	for _, entry := range a.GetBoardAlerts() {
+		view.Alerts[entry.ID] = entry
+	}
+	a.mu.RLock()
+	for _, tombstone := range a.tombstones {
+		view.Removed[tombstone.ID] = tombstone.Reason
 	}
+	a.mu.RUnlock()
+	return view
 }
 
 // readPump pumps messages from the websocket connection to the hub
@@ -184,26 +661,58 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	timing := c.hub.timing
+	c.conn.SetReadDeadline(time.Now().Add(timing.pongTimeout))
+	c.conn.SetPongHandler(func(payload string) error {
+		now := time.Now()
+		c.lastPong.Store(now.UnixNano())
+		// Pings carry their send time, so the pong tells the round trip time
+		if sent, err := strconv.ParseInt(payload, 10, 64); err == nil {
+			c.rtt.Store(now.UnixNano() - sent)
+		}
+		c.conn.SetReadDeadline(now.Add(timing.pongTimeout))
 		return nil
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Errorf("WebSocket error: %v", err)
 			}
+			c.disconnected(readErrorReason(err))
 			break
 		}
+		c.handleMessage(data)
+	}
+}
+
+// handleMessage handles a message sent by the client: its browser
+// notification permission, or a request for a fresh snapshot
+func (c *Client) handleMessage(data []byte) {
+	var message struct {
+		Type       string `json:"type"`
+		Permission string `json:"permission"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Debugf("Ignoring invalid message from WebSocket client %s: %v", c.remoteAddr, err)
+		return
+	}
+	switch message.Type {
+	case "notification-permission":
+		switch message.Permission {
+		case "granted", "denied", "default", "unsupported":
+			c.notificationPermission.Store(message.Permission)
+		}
+	case "resync":
+		c.resync()
 	}
 }
 
 // writePump pumps messages from the hub to the websocket connection
 func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
+	timing := c.hub.timing
+	ticker := time.NewTicker(timing.pingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -212,32 +721,40 @@ func (c *Client) writePump() {
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
+				c.conn.SetWriteDeadline(time.Now().Add(timing.writeTimeout))
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			// Add queued messages to the current websocket message
+			batch := [][]byte{message}
+			for n := len(c.send); n > 0; n-- {
+				batch = append(batch, <-c.send)
+			}
+			if timing.trimSlowClients && c.slow.Load() {
+				batch = coalesceUpdates(batch)
 			}
-			w.Write(message)
 
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+			if err := c.writeBatch(batch, timing); err != nil {
+				broadcastErrors.WithLabelValues("write").Inc()
+				c.disconnected(writeErrorReason(err))
+				return
 			}
 
-			if err := w.Close(); err != nil {
+		case now := <-ticker.C:
+			// Reap clients that stopped answering pings instead of waiting
+			// for the read deadline, which some proxies keep extending
+			if since := now.Sub(time.Unix(0, c.lastPong.Load())); since > timing.pongTimeout {
+				log.Infof("Reaping WebSocket client %s: no pong for %s", c.remoteAddr, since.Round(time.Second))
+				c.disconnected(DisconnectPongTimeout)
 				return
 			}
 
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			c.conn.SetWriteDeadline(now.Add(timing.writeTimeout))
+			payload := []byte(strconv.FormatInt(now.UnixNano(), 10))
+			if err := c.conn.WriteMessage(websocket.PingMessage, payload); err != nil {
+				c.disconnected(writeErrorReason(err))
 				return
 			}
 		}
@@ -252,148 +769,152 @@ func serveWebSocket(hub *Hub, state *AppState, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
-	client.hub.register <- client
+	// Reconnecting clients pass the last sequence number they saw, so the
+	// initial state carries the tombstones of alerts removed in the meantime
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || r.URL.Query().Get("instance") != clusterInstance {
+		// Sequence numbers of another instance of the cluster mean nothing
+		// here, so the client gets all tombstones
+		since = 0
+	}
 
-	// Send initial state (will be sent via broadcastUpdate in a moment)
+	client := &Client{
+		hub:         hub,
+		state:       state,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		deviceToken: r.URL.Query().Get("device"),
+		remoteAddr:  getClientIP(r),
+		userAgent:   r.UserAgent(),
+		connectedAt: time.Now(),
+	}
+	client.lastPong.Store(client.connectedAt.UnixNano())
+	if client.deviceToken != "" {
+		if !state.devices.Touch(client.deviceToken) {
+			// Unknown devices connect anonymously
+			client.deviceToken = ""
+		}
+	}
+
+	// Queue the initial state before registering, so it is the first message sent
+	snapshot, err := state.buildUpdate(since, client.deviceToken)
+	if err != nil {
+		log.Errorf("Error marshaling initial state: %v", err)
+	} else {
+		client.send <- snapshot
+	}
+	client.hub.register <- client
 
 	// Start client pumps
 	go client.writePump()
 	go client.readPump()
+}
 
-	// Send initial state after client is registered
-	go func() {
-		time.Sleep(100 * time.Millisecond) // Small delay to ensure client is registered
-		state.broadcastUpdate()
-	}()
+func (a *AppState) AddWebhook(payload WebhookPayload) IngestResult {
+	if a.throttle.hold(payload, a.flushThrottled) {
+		return IngestResult{Alerts: []AlertOutcome{}, Coalesced: true}
+	}
+	return a.addWebhook(payload)
 }
 
-func (a *AppState) AddWebhook(payload WebhookPayload) {
+// addWebhook ingests a delivery that is not held back by the throttle
+func (a *AppState) addWebhook(payload WebhookPayload) IngestResult {
+	chaos.delayIngestion()
+	claim := payload
+	if a.replicas.window > 0 {
+		// The replicas of an HA pair send the same payload but for their URL
+		claim.ExternalURL = ""
+	}
+	if !a.cluster.firstDelivery(claim) {
+		log.Infof("Ignoring a delivery of %d alerts already received by another instance", len(payload.Alerts))
+		return IngestResult{Alerts: []AlertOutcome{}, Duplicate: true}
+	}
+	now := time.Now()
+	a.labels.apply(&payload, now)
+	ids := newEntryIDs(len(payload.Alerts), now)
+	result := a.ingest(payload, now, ids, false)
+	a.cluster.publish(clusterOp{Type: clusterOpWebhook, Time: now, Payload: &payload, IDs: ids})
+	return result
+}
+
+// ingest puts the alerts of a payload on the board, with the IDs given by
+// payload index. Alerts replicated from another instance were notified there
+// already, and are skipped if they are on the board already.
+func (a *AppState) ingest(payload WebhookPayload, now time.Time, ids []string, replicated bool) IngestResult {
+	prepared := prepareWebhook(payload, now, ids)
 	a.mu.Lock()
-	timestamp := time.Now()
-	baseID := timestamp.UnixNano()
-
-	// Track which resolved alerts actually matched and removed firing alerts
-	matchedResolvedAlerts := make([]Alert, 0)
-
-	// If this webhook contains resolved alerts, remove matching firing alerts
-	if payload.Status == "resolved" || hasResolvedAlerts(payload.Alerts) {
-		matchedResolvedAlerts = a.removeMatchingFiringAlerts(payload.Alerts)
-	}
-
-	// Extract each alert and store it individually
-	// For resolved alerts, only add them if they matched a firing alert
-	for i, alert := range payload.Alerts {
-		// Skip resolved alerts that didn't match any firing alert
-		if alert.Status == "resolved" {
-			// Check if this resolved alert matched a firing alert
-			matched := false
-			for _, matchedAlert := range matchedResolvedAlerts {
-				if alertsMatch(alert, matchedAlert) {
-					matched = true
-					break
-				}
-			}
-			// If it didn't match, skip it
-			if !matched {
-				log.Debugf("Ignoring resolved alert that didn't match any firing alert: %v", alert.Labels)
-				continue
-			}
-		}
+	if replicated && a.hasAnyEntry(prepared.entries) {
+		a.mu.Unlock()
+		return IngestResult{Alerts: []AlertOutcome{}}
+	}
+	a.groups.record(payload, now)
+	plan := a.planPrepared(prepared)
+	chime := a.attachToIncidents(plan.Created, now)
+	silenced := a.silenceNew(plan.Created, now)
+	a.applyPlan(plan)
+	a.escalationAlarm.armNew(plan.Created, now)
+	a.mu.Unlock()
 
-		alertEntry := AlertEntry{
-			ID:        fmt.Sprintf("%d-%d", baseID, i),
-			Timestamp: timestamp,
-			Alert:     alert,
+	incidentOf := make(map[string]string)
+	for _, entry := range plan.Created {
+		if entry.IncidentID != "" {
+			incidentOf[entry.ID] = entry.IncidentID
 		}
-		a.alerts = append([]AlertEntry{alertEntry}, a.alerts...)
 	}
-
-	// Keep only the most recent alerts
-	if len(a.alerts) > a.maxSize {
-		a.alerts = a.alerts[:a.maxSize]
+	for i := range plan.Outcomes {
+		plan.Outcomes[i].IncidentID = incidentOf[plan.Outcomes[i].ID]
 	}
-	a.mu.Unlock()
 
 	// Broadcast update to all WebSocket clients
 	a.broadcastUpdate()
-}
-
-// hasResolvedAlerts checks if any alerts in the payload are resolved
-func hasResolvedAlerts(alerts []Alert) bool {
-	for _, alert := range alerts {
-		if alert.Status == "resolved" {
-			return true
-		}
+	if chime {
+		a.chime()
 	}
-	return false
-}
 
-// removeMatchingFiringAlerts removes matching firing alerts and returns the resolved alerts that actually matched
-// This should be called while holding the lock
-func (a *AppState) removeMatchingFiringAlerts(resolvedAlerts []Alert) []Alert {
-	// Extract only resolved alerts
-	var resolved []Alert
-	for _, alert := range resolvedAlerts {
-		if alert.Status == "resolved" {
-			resolved = append(resolved, alert)
+	// Alerts grouped under an incident are not notified again, silenced
+	// alerts not at all. Resolved entries all resolved a firing alert.
+	var firing, resolved []AlertEntry
+	for _, entry := range plan.Created {
+		switch {
+		case entry.Alert.Status == "firing" && entry.IncidentID == "" && !silenced[entry.ID]:
+			firing = append(firing, entry)
+		case entry.Alert.Status == "resolved":
+			resolved = append(resolved, entry)
 		}
 	}
-
-	if len(resolved) == 0 {
-		return []Alert{}
+	if !replicated {
+		a.notifier.Dispatch(NotificationEvent{Kind: EventFiring, Alerts: firing})
+		a.notifier.Dispatch(NotificationEvent{Kind: EventResolved, Alerts: resolved})
 	}
+	a.notifyBrowsers(firing)
+	return plan.result()
+}
 
-	// Track which resolved alerts actually matched firing alerts
-	matchedResolvedAlerts := make([]Alert, 0)
-
-	// Filter out alerts that match resolved alerts
-	var filtered []AlertEntry
-	for _, entry := range a.alerts {
-		shouldRemove := false
-		var matchedResolvedAlert Alert
-
-		// Only remove firing alerts that match resolved alerts
-		if entry.Alert.Status == "firing" {
-			for _, resolvedAlert := range resolved {
-				if alertsMatch(resolvedAlert, entry.Alert) {
-					shouldRemove = true
-					matchedResolvedAlert = resolvedAlert
-					log.Debugf("Removing firing alert %s - matches resolved alert with labels: %v", entry.ID, resolvedAlert.Labels)
-					break
-				}
-			}
-		}
-
-		// Keep the alert if it shouldn't be removed
-		if !shouldRemove {
-			filtered = append(filtered, entry)
-		} else {
-			// Also remove from acknowledged map if present
-			delete(a.acknowledged, entry.ID)
-			// Track that this resolved alert matched
-			matchedResolvedAlerts = append(matchedResolvedAlerts, matchedResolvedAlert)
+// hasAnyEntry tells if any of the entries is on the board
+// This should be called while holding the lock
+func (a *AppState) hasAnyEntry(entries []AlertEntry) bool {
+	for _, entry := range entries {
+		if _, ok := a.alertByID(entry.ID); ok {
+			return true
 		}
 	}
-
-	a.alerts = filtered
-	return matchedResolvedAlerts
+	return false
 }
 
 func (a *AppState) GetAlerts() []AlertEntry {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	result := make([]AlertEntry, len(a.alerts))
-	copy(result, a.alerts)
+	result := a.alertsNewestFirst()
+	now := time.Now()
 
 	// Sort alerts: firing first, then acknowledged, then resolved
 	sort.Slice(result, func(i, j int) bool {
 		iEntry := result[i]
 		jEntry := result[j]
 
-		iAcknowledged := a.acknowledged[iEntry.ID]
-		jAcknowledged := a.acknowledged[jEntry.ID]
+		iAcknowledged := a.acknowledged[iEntry.ID] != nil
+		jAcknowledged := a.acknowledged[jEntry.ID] != nil
 
 		// Get priority: firing=0, acknowledged=1, resolved=2
 		iPriority := getAlertPriority(iEntry.Alert.Status, iAcknowledged)
@@ -403,6 +924,13 @@ func (a *AppState) GetAlerts() []AlertEntry {
 			return iPriority < jPriority
 		}
 
+		// Then alerts left unacknowledged the longest
+		iBucket := ageBucket(iEntry, iAcknowledged, now)
+		jBucket := ageBucket(jEntry, jAcknowledged, now)
+		if iBucket != jBucket {
+			return iBucket > jBucket
+		}
+
 		// If same priority, sort by timestamp (newest first)
 		return iEntry.Timestamp.After(jEntry.Timestamp)
 	})
@@ -410,11 +938,33 @@ func (a *AppState) GetAlerts() []AlertEntry {
 	return result
 }
 
+// alertsNewestFirst returns a copy of the board, newest alert first
+// This should be called while holding the lock
+func (a *AppState) alertsNewestFirst() []AlertEntry {
+	result := make([]AlertEntry, len(a.alerts))
+	for i, entry := range a.alerts {
+		result[len(result)-1-i] = entry
+	}
+	return result
+}
+
+// resolvedRequiresAck makes resolved alerts count as unacknowledged until
+// someone acknowledges them, set by resolved_requires_ack
+var resolvedRequiresAck bool
+
+// needsAck reports whether an alert counts as unacknowledged
+func needsAck(status string, acknowledged bool) bool {
+	if acknowledged {
+		return false
+	}
+	return status == "firing" || (resolvedRequiresAck && status == "resolved")
+}
+
 // getAlertPriority returns a numeric priority for sorting
 // Lower number = higher priority (shown first)
 func getAlertPriority(status string, acknowledged bool) int {
-	if status == "firing" && !acknowledged {
-		return 0 // Firing (unacknowledged) - highest priority
+	if needsAck(status, acknowledged) {
+		return 0 // Unacknowledged - highest priority
 	}
 	if status == "firing" && acknowledged {
 		return 1 // Acknowledged - middle priority
@@ -425,61 +975,243 @@ func getAlertPriority(status string, acknowledged bool) int {
 func (a *AppState) HasUnacknowledgedAlerts() bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
+	return a.hasUnacknowledgedAlerts()
+}
 
+// hasUnacknowledgedAlerts is HasUnacknowledgedAlerts without locking
+// This should be called while holding the lock
+func (a *AppState) hasUnacknowledgedAlerts() bool {
 	for _, entry := range a.alerts {
-		if a.acknowledged[entry.ID] {
-			continue
-		}
-		if entry.Alert.Status == "firing" {
+		if needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil) {
 			return true
 		}
 	}
 	return false
 }
 
+// StatusLevel returns the board status level: critical if any unacknowledged
+// firing alert has a critical severity, warning if any other alert is
+// unacknowledged
+func (a *AppState) StatusLevel() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.statusLevel()
+}
+
+// statusLevel is StatusLevel without locking
+// This should be called while holding the lock
+func (a *AppState) statusLevel() string {
+	level := StatusLevelOK
+	for _, entry := range a.alerts {
+		if !needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil) {
+			continue
+		}
+		// A resolved alert awaiting a glance is no emergency
+		if entry.Alert.Status == "firing" && severityLevel(alertSeverity(entry.Alert)) == StatusLevelCritical {
+			return StatusLevelCritical
+		}
+		level = StatusLevelWarning
+	}
+	return level
+}
+
 func (a *AppState) IsAcknowledged(alertID string) bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.acknowledged[alertID]
+	return a.acknowledged[alertID] != nil
+}
+
+// GetAcknowledgement returns a copy of who acknowledged an alert, or nil if
+// it isn't acknowledged
+func (a *AppState) GetAcknowledgement(alertID string) *Acknowledgement {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	ack := a.acknowledged[alertID]
+	if ack == nil {
+		return nil
+	}
+	copied := *ack
+	copied.AtText = timeFormat.Board(copied.At)
+	return &copied
+}
+
+// acknowledgementList returns copies of the acknowledgements by alert ID
+// This should be called while holding the lock
+func (a *AppState) acknowledgementList() map[string]Acknowledgement {
+	acknowledged := make(map[string]Acknowledgement, len(a.acknowledged))
+	for id, ack := range a.acknowledged {
+		acknowledged[id] = *ack
+	}
+	return acknowledged
 }
 
-func (a *AppState) Acknowledge(alertID string) {
+func (a *AppState) Acknowledge(alertID, actor string) {
+	a.AcknowledgeAll([]string{alertID}, nil, actor, "")
+}
+
+// AcknowledgeAll acknowledges several alerts at once on behalf of an actor,
+// empty if unknown, with an optional comment. With a version, it fails with
+// errVersionConflict if the board changed since the client saw it.
+func (a *AppState) AcknowledgeAll(alertIDs []string, version *uint64, actor, comment string) error {
+	if err := a.acknowledge(alertIDs, version, actor, comment); err != nil {
+		return err
+	}
+	a.cluster.publish(clusterOp{Type: clusterOpAcknowledge, IDs: alertIDs, Actor: actor, Comment: comment})
+	return nil
+}
+
+// acknowledge acknowledges alerts on this instance only. Acknowledging an
+// acknowledged alert again with an actor or comment replaces who acknowledged
+// it, e.g. to take it over or explain.
+func (a *AppState) acknowledge(alertIDs []string, version *uint64, actor, comment string) error {
 	a.mu.Lock()
-	a.acknowledged[alertID] = true
+	if err := a.checkVersion(version); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	now := time.Now()
+	unsnoozed := false
+	for _, alertID := range alertIDs {
+		if a.acknowledged[alertID] == nil {
+			if entry, ok := a.alertByID(alertID); ok {
+				a.recordAck(entry, now, actor)
+			}
+		}
+		if a.acknowledged[alertID] == nil || actor != "" || comment != "" {
+			a.acknowledged[alertID] = &Acknowledgement{By: actor, At: now, Comment: comment}
+		}
+		a.escalationAlarm.disarm(alertID)
+		// Acknowledged for good now
+		if a.cancelSnooze(alertID) {
+			unsnoozed = true
+		}
+	}
+	a.seq++
 	a.mu.Unlock()
-	log.Infof("Alert %s acknowledged", alertID)
+	log.Infof("Alerts acknowledged: %s", strings.Join(alertIDs, ", "))
+	if unsnoozed {
+		a.saveSnoozes()
+	}
 
 	// Broadcast update to all WebSocket clients
 	a.broadcastUpdate()
+	return nil
 }
 
-func (a *AppState) ClearAcknowledgedAndResolved() int {
-	a.mu.Lock()
+// errVersionConflict is returned when a client acts on an outdated board
+var errVersionConflict = errors.New("the board changed since the given version")
 
-	var filtered []AlertEntry
-	clearedCount := 0
+// checkVersion fails unless the board is still at the sequence number a
+// client last saw; a nil version skips the check
+// This should be called while holding the lock
+func (a *AppState) checkVersion(version *uint64) error {
+	if version != nil && *version != a.seq {
+		return errVersionConflict
+	}
+	return nil
+}
+
+// parseIfVersion returns the optional if_version parameter, the state
+// sequence number the client last saw
+func parseIfVersion(r *http.Request) (*uint64, error) {
+	value := r.URL.Query().Get("if_version")
+	if value == "" {
+		return nil, nil
+	}
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'if_version': %v", err)
+	}
+	// In cluster mode, sequence numbers are per instance; a version seen on
+	// another instance can't be checked here
+	if instance := r.URL.Query().Get("instance"); instance != clusterInstance {
+		log.Debugf("Skipping the version check of a client of instance %q", instance)
+		return nil, nil
+	}
+	return &version, nil
+}
 
+// How often orphaned acknowledgements are removed
+const ackCleanupInterval = 5 * time.Minute
+
+// pruneAcknowledged forgets the acknowledgements of alerts that are no longer
+// on the board and returns how many were removed.
+// This should be called while holding the lock
+func (a *AppState) pruneAcknowledged() int {
+	present := make(map[string]bool, len(a.alerts))
 	for _, entry := range a.alerts {
-		isAcknowledged := a.acknowledged[entry.ID]
+		present[entry.ID] = true
+	}
+	pruned := 0
+	for id := range a.acknowledged {
+		if !present[id] {
+			delete(a.acknowledged, id)
+			pruned++
+		}
+	}
+	return pruned
+}
 
-		// Keep only firing alerts that are not acknowledged
-		if entry.Alert.Status == "firing" && !isAcknowledged {
-			filtered = append(filtered, entry)
-		} else {
-			// Remove acknowledged or resolved alerts
-			delete(a.acknowledged, entry.ID)
-			clearedCount++
+// runAckCleanup periodically removes orphaned acknowledgements, such as those
+// of unknown IDs sent to the acknowledge endpoint
+func (a *AppState) runAckCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.mu.Lock()
+		pruned := a.pruneAcknowledged()
+		a.mu.Unlock()
+		if pruned > 0 {
+			log.Debugf("Removed %d orphaned acknowledgements", pruned)
 		}
 	}
+}
 
-	a.alerts = filtered
-	log.Debugf("Cleared %d acknowledged/resolved alerts", clearedCount)
+// ClearAcknowledgedAndResolved removes acknowledged and resolved alerts. With
+// a version, it fails with errVersionConflict if the board changed since the
+// client saw it.
+func (a *AppState) ClearAcknowledgedAndResolved(version *uint64) (int, error) {
+	a.mu.Lock()
+	if err := a.checkVersion(version); err != nil {
+		a.mu.Unlock()
+		return 0, err
+	}
+
+	// Keep only alerts that are not acknowledged yet
+	cleared := a.clearAlerts(func(entry AlertEntry) bool {
+		return !needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil)
+	})
+	log.Debugf("Cleared %d acknowledged/resolved alerts", len(cleared))
 	a.mu.Unlock()
 
 	// Broadcast update to all WebSocket clients
 	a.broadcastUpdate()
+	if len(cleared) > 0 {
+		a.cluster.publish(clusterOp{Type: clusterOpClear, IDs: cleared})
+	}
 
-	return clearedCount
+	return len(cleared), nil
+}
+
+// clearAlerts removes the alerts selected and returns their IDs
+// This should be called while holding the lock
+func (a *AppState) clearAlerts(clear func(AlertEntry) bool) []string {
+	var filtered []AlertEntry
+	var cleared []string
+	now := time.Now()
+	for _, entry := range a.alerts {
+		if !clear(entry) {
+			filtered = append(filtered, entry)
+			continue
+		}
+		delete(a.acknowledged, entry.ID)
+		a.addTombstone(entry.ID, "cleared")
+		a.recordHistory(HistoryCleared, entry, now)
+		a.recordGone(entry, now)
+		cleared = append(cleared, entry.ID)
+	}
+	a.alerts = filtered
+	return cleared
 }
 
 // soundHandler serves the sound file
@@ -491,14 +1223,11 @@ func soundHandler(state *AppState) http.HandlerFunc {
 		}
 
 		soundPath := state.config.SoundEffectFilePath
-		// Convert relative path to absolute if needed
-		if !filepath.IsAbs(soundPath) {
-			wd, err := os.Getwd()
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to get working directory: %v", err), http.StatusInternalServerError)
-				return
-			}
-			soundPath = filepath.Join(wd, soundPath)
+		if path := severitySound(strings.ToLower(r.URL.Query().Get("severity"))); path != "" {
+			soundPath = path
+		}
+		if r.URL.Query().Get("variant") == soundVariantRefired && state.config.RefireSoundFilePath != "" {
+			soundPath = state.config.RefireSoundFilePath
 		}
 
 		// Check if file exists
@@ -532,15 +1261,39 @@ func statusHandler(state *AppState) http.HandlerFunc {
 			return
 		}
 
-		hasUnacknowledged := state.HasUnacknowledgedAlerts()
+		level := state.StatusLevel()
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{
-			"hasUnacknowledged": hasUnacknowledged,
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"hasUnacknowledged": level != StatusLevelOK,
+			"level":             level,
 		})
 	}
 }
 
+// alertsHandler lists the alerts on the board, in board order unless sorted
+// otherwise, filtered and paged by the query parameters (see alertQuery). The
+// number of matching alerts is sent in X-Total-Count.
+func alertsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query, err := parseAlertQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		alerts, total := query.apply(state.GetBoardAlerts(), state.environmentLabel())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		json.NewEncoder(w).Encode(alerts)
+	}
+}
+
 func webhookHandler(state *AppState) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -548,18 +1301,30 @@ func webhookHandler(state *AppState) http.HandlerFunc {
 			return
 		}
 
-		var payload WebhookPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		payload, ok := decodeWebhook(w, r, state)
+		if !ok {
 			return
 		}
 
-		state.AddWebhook(payload)
+		state.tagSourceZone(&payload, getClientIP(r))
+		result := state.AddWebhook(payload)
+		webhooksReceived.WithLabelValues("alertmanager").Inc()
 		log.Infof("Received webhook: %d alerts, status: %s from IP: %s", len(payload.Alerts), payload.Status, getClientIP(r))
+		writeWebhookResult(w, r, state, result)
+	}
+}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+// writeWebhookResult answers a webhook. Senders that want to verify what
+// happened to their alerts get the per-alert outcomes, Alertmanager gets the
+// plain OK it ignores anyway.
+func writeWebhookResult(w http.ResponseWriter, r *http.Request, state *AppState, result IngestResult) {
+	if state.config.WebhookResponse == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
 	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
 }
 
 func acknowledgeHandler(state *AppState) http.HandlerFunc {
@@ -569,18 +1334,125 @@ func acknowledgeHandler(state *AppState) http.HandlerFunc {
 			return
 		}
 
-		alertID := r.URL.Query().Get("id")
-		if alertID == "" {
+		// Several alerts can be acknowledged at once with repeated 'id' parameters
+		alertIDs := r.URL.Query()["id"]
+		if len(alertIDs) == 0 || slices.Contains(alertIDs, "") {
 			http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
 			return
 		}
+		version, err := parseIfVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Who acknowledges is told by an authenticating proxy if there is
+		// one, or else by the client
+		actor := requestActor(r, strings.TrimSpace(r.URL.Query().Get("by")))
+		comment := strings.TrimSpace(r.URL.Query().Get("comment"))
+		details := map[string]string{"alertId": strings.Join(alertIDs, ",")}
+		if comment != "" {
+			details["comment"] = comment
+		}
 
-		state.Acknowledge(alertID)
+		// Optionally remind the acknowledger at a follow-up time if the
+		// alerts are still firing then
+		var dueAt time.Time
+		note := strings.TrimSpace(r.URL.Query().Get("note"))
+		notifier := r.URL.Query().Get("notifier")
+		if value := r.URL.Query().Get("followUp"); value != "" {
+			if dueAt, err = parseFollowUp(value, time.Now()); err == nil {
+				err = state.checkFollowUpNotifier(notifier)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			details["followUp"] = dueAt.Format(time.RFC3339)
+			details["note"] = note
+		}
+
+		// Several ids are a bulk acknowledgement, which waits for the board lock
+		if len(alertIDs) > 1 && refuseLocked(w, state) {
+			return
+		}
+		if err := state.AcknowledgeAll(alertIDs, version, actor, comment); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		audit.RecordRequest(r, AuditAcknowledge, 3, "Alert acknowledged", details)
+		if !dueAt.IsZero() {
+			for _, alertID := range alertIDs {
+				if err := state.SetFollowUp(alertID, note, dueAt, notifier); err != nil {
+					http.Error(w, fmt.Sprintf("Acknowledged, but no follow-up for %s: %v", alertID, err), http.StatusBadRequest)
+					return
+				}
+			}
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}
 }
 
+// bulkAcknowledgeRequest is the body of POST /api/v1/alerts/acknowledge
+type bulkAcknowledgeRequest struct {
+	IDs     []string `json:"ids"`
+	All     bool     `json:"all"`     // every alert awaiting acknowledgement instead
+	Env     string   `json:"env"`     // with all, only the alerts of an environment
+	By      string   `json:"by"`      // who acknowledges, unless told by an authenticating proxy
+	Comment string   `json:"comment"` // e.g. what is being done about them
+}
+
+// bulkAcknowledgeHandler acknowledges a list of alerts, or all of them, with
+// a single broadcast
+func bulkAcknowledgeHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request bulkAcknowledgeRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.All == (len(request.IDs) > 0) || slices.Contains(request.IDs, "") {
+			http.Error(w, "Expected either a list of 'ids' or 'all': true", http.StatusBadRequest)
+			return
+		}
+		if refuseLocked(w, state) {
+			return
+		}
+		version, err := parseIfVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		alertIDs := request.IDs
+		if request.All {
+			environmentLabel := state.environmentLabel()
+			alertIDs = []string{}
+			for _, entry := range state.GetBoardAlerts() {
+				if entry.NeedsAck && (request.Env == "" || inEnvironment(entry.Alert, environmentLabel, request.Env)) {
+					alertIDs = append(alertIDs, entry.ID)
+				}
+			}
+		}
+		if len(alertIDs) > 0 {
+			actor := requestActor(r, strings.TrimSpace(request.By))
+			if err := state.AcknowledgeAll(alertIDs, version, actor, strings.TrimSpace(request.Comment)); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			audit.RecordRequest(r, AuditAcknowledge, 3, "Alerts acknowledged", map[string]string{"alertIds": strings.Join(alertIDs, ",")})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"acknowledged": alertIDs})
+	}
+}
+
 func clearHandler(state *AppState) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -588,7 +1460,20 @@ func clearHandler(state *AppState) http.HandlerFunc {
 			return
 		}
 
-		clearedCount := state.ClearAcknowledgedAndResolved()
+		if refuseLocked(w, state) {
+			return
+		}
+		version, err := parseIfVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		clearedCount, err := state.ClearAcknowledgedAndResolved(version)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		audit.RecordRequest(r, AuditClear, 4, "Acknowledged and resolved alerts cleared", map[string]string{"count": strconv.Itoa(clearedCount)})
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(fmt.Sprintf("Cleared %d alerts", clearedCount)))
 	}
@@ -604,7 +1489,15 @@ func wsHandler(state *AppState) http.HandlerFunc {
 type TemplateData struct {
 	StatusClass string
 	StatusText  string
-	Alerts      []AlertTemplateData
+	StatusColor string // background from a matching status theme, if any
+	Kiosk       bool   // wall display mode, shows QR codes for acknowledging from a phone
+	Browser     BrowserSettings
+	// Environment tabs, and the selected one, empty for all
+	Environments []EnvironmentTab
+	Environment  string
+	Banner       *Banner
+	Lock         *BoardLock // clears and bulk actions are disabled while set
+	Alerts       []AlertTemplateData
 }
 
 // AlertTemplateData holds data for a single alert in the template
@@ -614,10 +1507,40 @@ type AlertTemplateData struct {
 	StatusClass   string
 	StatusText    string
 	ShowAckButton bool
-	AlertName     string
-	Labels        []LabelData
-	StartsAt      string
-	EndsAt        string
+	IncidentID    string
+	Refired       bool // fired again soon after being resolved or cleared
+	// ShowIncidentButton offers to start an incident from a firing alert
+	ShowIncidentButton bool
+	Receiver           string
+	AlertmanagerURL    string // Alertmanager UI that sent the alert
+	AlertmanagerHost   string
+	AlertLink          string           // the alert in the Alertmanager UI
+	Acknowledgement    *Acknowledgement // who acknowledged it
+	FollowUp           *FollowUp
+	Snooze             *Snooze // acknowledged until the snooze ends
+	Review             *Review // marked as needing follow-up
+	AgeText            string  // e.g. "over 15m" once an unacknowledged alert passed an age threshold
+	AlertName          string
+	Decoration         string // icons and prefixes shown before the name
+	Severity           string
+	SeverityColor      string // badge color of the severity, see severities
+	Labels             []LabelData
+	Summary            string      // summary annotation
+	Description        string      // description annotation
+	RunbookURL         string      // runbook_url annotation
+	Annotations        []LabelData // any other annotations
+	Rule               *AlertRule  // alerting rule it came from, see alert_rules
+	StartsAt           string
+	EndsAt             string
+}
+
+// setAcknowledgement shows who acknowledged the alert, and shows it as
+// silenced if a silence did
+func (d *AlertTemplateData) setAcknowledgement(ack *Acknowledgement) {
+	d.Acknowledgement = ack
+	if ack != nil && ack.Silence != "" && d.StatusClass == "acknowledged" {
+		d.StatusClass, d.StatusText = "silenced", "Silenced"
+	}
 }
 
 // LabelData holds label key-value pairs for the template
@@ -626,98 +1549,143 @@ type LabelData struct {
 	Value string
 }
 
+// alertTemplateData converts an alert entry to the data its card is rendered from
+func alertTemplateData(entry AlertEntry, isAcknowledged bool) AlertTemplateData {
+	alert := entry.Alert
+
+	// Determine status class and text
+	statusClass := "resolved"
+	statusText := "Resolved"
+
+	if alert.Status == "firing" {
+		if isAcknowledged {
+			statusClass = "acknowledged"
+			statusText = "Acknowledged"
+		} else {
+			statusClass = "firing"
+			statusText = "Firing"
+		}
+	} else if alert.Status == "resolved" {
+		statusClass = "resolved"
+		statusText = "Resolved"
+	}
+
+	// Extract alertname if it exists
+	alertName := ""
+	if name, exists := alert.Labels["alertname"]; exists {
+		alertName = name
+	}
+
+	// Prepare labels
+	labels := make([]LabelData, 0)
+	if len(alert.Labels) > 0 {
+		labelKeys := make([]string, 0, len(alert.Labels))
+		for k := range alert.Labels {
+			labelKeys = append(labelKeys, k)
+		}
+		sort.Strings(labelKeys)
+		for _, k := range labelKeys {
+			labels = append(labels, LabelData{Key: k, Value: alert.Labels[k]})
+		}
+	}
+
+	// The well-known annotations get their own place on the card
+	annotations := make([]LabelData, 0)
+	annotationKeys := make([]string, 0, len(alert.Annotations))
+	for k := range alert.Annotations {
+		switch k {
+		case "summary", "description", "runbook_url":
+		default:
+			annotationKeys = append(annotationKeys, k)
+		}
+	}
+	sort.Strings(annotationKeys)
+	for _, k := range annotationKeys {
+		annotations = append(annotations, LabelData{Key: k, Value: alert.Annotations[k]})
+	}
+
+	// Format timestamps
+	endsAt := ""
+	if alert.EndsAt != nil {
+		endsAt = timeFormat.Board(*alert.EndsAt)
+	}
+
+	// Link back to the Alertmanager that sent the alert
+	amURL := alertmanagerURL(entry.ExternalURL)
+	amHost := ""
+	if u, err := url.Parse(amURL); err == nil {
+		amHost = u.Host
+	}
+
+	return AlertTemplateData{
+		ID:                 entry.ID,
+		Timestamp:          timeFormat.Board(entry.Timestamp),
+		StatusClass:        statusClass,
+		StatusText:         statusText,
+		ShowAckButton:      needsAck(alert.Status, isAcknowledged),
+		AgeText:            ageText(ageBucket(entry, isAcknowledged, time.Now())),
+		IncidentID:         entry.IncidentID,
+		Refired:            entry.Refired,
+		ShowIncidentButton: alert.Status == "firing" && entry.IncidentID == "",
+		Receiver:           entry.Receiver,
+		AlertmanagerURL:    amURL,
+		AlertmanagerHost:   amHost,
+		AlertLink:          alertmanagerAlertLink(entry.ExternalURL, alert.Labels),
+		AlertName:          alertName,
+		Decoration:         alertDecoration(alert),
+		Severity:           alertSeverity(alert),
+		SeverityColor:      severityColor(alertSeverity(alert)),
+		Labels:             labels,
+		Summary:            alert.Annotations["summary"],
+		Description:        alert.Annotations["description"],
+		RunbookURL:         alert.Annotations["runbook_url"],
+		Annotations:        annotations,
+		Rule:               entry.Rule,
+		StartsAt:           timeFormat.Board(alert.StartsAt),
+		EndsAt:             endsAt,
+	}
+}
+
 func indexHandler(state *AppState) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		alerts := state.GetAlerts()
-		hasUnacknowledged := state.HasUnacknowledgedAlerts()
+		level := state.StatusLevel()
 
 		// Prepare template data
 		templateData := TemplateData{
-			StatusClass: getStatusClass(hasUnacknowledged),
-			StatusText:  getStatusText(hasUnacknowledged),
-			Alerts:      make([]AlertTemplateData, 0),
+			StatusClass:  getStatusClass(level),
+			StatusText:   getStatusText(level),
+			Kiosk:        r.URL.Query().Has("kiosk"),
+			Browser:      browserSettings(state.config.Browser, state.config.WebPush != nil),
+			Environments: state.EnvironmentTabs(),
+			Environment:  r.URL.Query().Get("env"),
+			Banner:       state.GetBanner(),
+			Lock:         state.GetBoardLock(),
+			Alerts:       make([]AlertTemplateData, 0),
+		}
+		if theme := state.StatusTheme(); theme != nil {
+			if theme.Text != "" {
+				templateData.StatusText = theme.Text
+			}
+			templateData.StatusColor = theme.Color
 		}
 
 		// Convert alerts to template data
+		label := state.environmentLabel()
 		for _, entry := range alerts {
-			isAcknowledged := state.IsAcknowledged(entry.ID)
-			alert := entry.Alert
-
-			// Determine status class and text
-			statusClass := "resolved"
-			statusText := "Resolved"
-
-			if alert.Status == "firing" {
-				if isAcknowledged {
-					statusClass = "acknowledged"
-					statusText = "Acknowledged"
-				} else {
-					statusClass = "firing"
-					statusText = "Firing"
-				}
-			} else if alert.Status == "resolved" {
-				statusClass = "resolved"
-				statusText = "Resolved"
-			}
-
-			// Extract alertname if it exists
-			alertName := ""
-			if name, exists := alert.Labels["alertname"]; exists {
-				alertName = name
-			}
-
-			// Prepare labels
-			labels := make([]LabelData, 0)
-			if len(alert.Labels) > 0 {
-				labelKeys := make([]string, 0, len(alert.Labels))
-				for k := range alert.Labels {
-					labelKeys = append(labelKeys, k)
-				}
-				sort.Strings(labelKeys)
-				for _, k := range labelKeys {
-					labels = append(labels, LabelData{Key: k, Value: alert.Labels[k]})
-				}
-			}
-
-			// Format timestamps
-			endsAt := ""
-			if alert.EndsAt != nil {
-				endsAt = alert.EndsAt.Format("2006-01-02 15:04:05")
-			}
-
-			alertData := AlertTemplateData{
-				ID:            entry.ID,
-				Timestamp:     entry.Timestamp.Format("2006-01-02 15:04:05"),
-				StatusClass:   statusClass,
-				StatusText:    statusText,
-				ShowAckButton: alert.Status == "firing" && !isAcknowledged,
-				AlertName:     alertName,
-				Labels:        labels,
-				StartsAt:      alert.StartsAt.Format("2006-01-02 15:04:05"),
-				EndsAt:        endsAt,
+			if !inEnvironment(entry.Alert, label, templateData.Environment) {
+				continue
 			}
-
-			templateData.Alerts = append(templateData.Alerts, alertData)
-		}
-
-		// Parse and execute template
-		// Resolve template path relative to working directory
-		wd, err := os.Getwd()
-		if err != nil {
-			log.Errorf("Error getting working directory: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		templatePath := filepath.Join(wd, "templates", "index.html")
-		tmpl, err := template.ParseFiles(templatePath)
-		if err != nil {
-			log.Errorf("Error parsing template: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+			card := alertTemplateData(entry, state.IsAcknowledged(entry.ID))
+			card.setAcknowledgement(state.GetAcknowledgement(entry.ID))
+			card.FollowUp = state.GetFollowUp(entry.ID)
+			card.Snooze = state.GetSnooze(entry.ID)
+			card.Review = state.GetReview(entry.ID)
+			templateData.Alerts = append(templateData.Alerts, card)
 		}
 
 		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, templateData); err != nil {
+		if err := state.templates.Execute(w, "index.html", templateData); err != nil {
 			log.Errorf("Error executing template: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ppastorf/wake-me-up/static"
+)
+
+// Relative asset paths of the config (static_dir, templates_dir and the
+// sounds) are resolved against asset_dir when it's set. Otherwise they are
+// looked up next to the executable first, then in the working directory, so
+// the binary also finds its assets when run from cron or another directory.
+// Without a static_dir set or found, the embedded static files are served.
+
+const defaultStaticDir = "static"
+
+// assetBaseDirs returns the directories relative asset paths are looked up in
+func assetBaseDirs(assetDir string) []string {
+	if assetDir != "" {
+		return []string{assetDir}
+	}
+	var dirs []string
+	if executable, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+			executable = resolved
+		}
+		dirs = append(dirs, filepath.Dir(executable))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd)
+	}
+	return dirs
+}
+
+// findAsset returns the absolute path of an asset that exists, trying the
+// base directories in order for relative paths
+func findAsset(assetDir, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	var tried []string
+	for _, dir := range assetBaseDirs(assetDir) {
+		candidate, err := filepath.Abs(filepath.Join(dir, path))
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		tried = append(tried, candidate)
+	}
+	return "", fmt.Errorf("%s not found, tried %s", path, strings.Join(tried, ", "))
+}
+
+// resolveAssets makes the asset paths of the config absolute and checks that
+// they exist, so a wrong path fails at startup instead of serving 404s
+func resolveAssets(config *Config) error {
+	embedded := config.StaticDir == ""
+	if embedded {
+		config.StaticDir = defaultStaticDir
+	}
+	type assetPath struct {
+		key  string
+		path *string
+	}
+	paths := []assetPath{
+		{"static_dir", &config.StaticDir},
+		{"templates_dir", &config.TemplatesDir},
+		{"sound_effect_file_path", &config.SoundEffectFilePath},
+		{"refire_sound_file_path", &config.RefireSoundFilePath},
+	}
+	severities := make([]string, 0, len(config.Severities))
+	for severity, style := range config.Severities {
+		if style != nil {
+			severities = append(severities, severity)
+		}
+	}
+	sort.Strings(severities)
+	for _, severity := range severities {
+		paths = append(paths, assetPath{"severities." + severity + ".sound_file_path", &config.Severities[severity].SoundFilePath})
+	}
+	for _, p := range paths {
+		if *p.path == "" {
+			continue
+		}
+		resolved, err := findAsset(config.AssetDir, *p.path)
+		if err != nil && embedded && p.path == &config.StaticDir {
+			config.StaticDir = ""
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.key, err)
+		}
+		*p.path = resolved
+	}
+	if info, err := os.Stat(config.StaticDir); err == nil && !info.IsDir() {
+		return fmt.Errorf("static_dir: %s is not a directory", config.StaticDir)
+	}
+	return nil
+}
+
+// staticAssets returns the static files of a resolved static_dir, the
+// embedded ones if it is empty
+func staticAssets(dir string) fs.FS {
+	if dir == "" {
+		return static.FS
+	}
+	return os.DirFS(dir)
+}
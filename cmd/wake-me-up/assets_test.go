@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveAssets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "static"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sounds"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sounds", "siren1.wav"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{AssetDir: dir, SoundEffectFilePath: "sounds/siren1.wav"}
+	if err := resolveAssets(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.StaticDir != filepath.Join(dir, "static") || config.SoundEffectFilePath != filepath.Join(dir, "sounds", "siren1.wav") {
+		t.Errorf("Expected the paths resolved against asset_dir, got %s and %s", config.StaticDir, config.SoundEffectFilePath)
+	}
+
+	// Without a static directory the embedded files are served, unless one
+	// was configured
+	empty := t.TempDir()
+	config = &Config{AssetDir: empty}
+	if err := resolveAssets(config); err != nil || config.StaticDir != "" {
+		t.Errorf("Expected the embedded static files, got %q %v", config.StaticDir, err)
+	}
+	config = &Config{AssetDir: empty, StaticDir: "static"}
+	if err := resolveAssets(config); err == nil {
+		t.Error("Expected a missing static_dir to fail")
+	}
+
+	config = &Config{AssetDir: dir, SoundEffectFilePath: "sounds/siren1.wav", RefireSoundFilePath: "sounds/missing.wav"}
+	if err := resolveAssets(config); err == nil || !strings.Contains(err.Error(), "refire_sound_file_path") {
+		t.Errorf("Expected a missing sound to fail, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// The audit log keeps audit events in a file of JSON lines, each record
+// carrying the hash of the one before it. Editing, removing or reordering a
+// record breaks the chain from there on, which `wake-me-up audit verify`
+// reports. Rewriting the whole chain from a changed record on can only be
+// told by comparing it with a hash archived elsewhere, which is what
+// `wake-me-up audit export` and /api/v1/audit are for.
+
+// maxAuditLine bounds a record when reading the log back
+const maxAuditLine = 1 << 20
+
+// AuditRecord is an audit event in the chain
+type AuditRecord struct {
+	Seq uint64 `json:"seq"` // from 1
+	AuditEvent
+	PrevHash string `json:"prevHash"` // empty for the first record
+	Hash     string `json:"hash"`     // SHA-256 of PrevHash and the record without Hash
+}
+
+// computeHash hashes the record with its Hash left out
+func (r AuditRecord) computeHash() string {
+	r.Hash = ""
+	body, _ := json.Marshal(r)
+	sum := sha256.Sum256(append([]byte(r.PrevHash+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// auditChainSink appends audit events to the hash-chained log
+type auditChainSink struct {
+	path string
+
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+func newAuditChainSink(path string) (*auditChainSink, error) {
+	sink := &auditChainSink{path: path}
+	// Go on from the last record, whether or not the chain before it holds:
+	// verifying is up to `audit verify`, a broken chain stays broken
+	last, skipped, openLine, err := scanAuditTail(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		log.Warnf("Audit log %s has unreadable lines %v, torn by a crash or too long, going on from record %d", path, skipped, last.Seq)
+	}
+	sink.seq, sink.lastHash = last.Seq, last.Hash
+	sink.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if openLine {
+		// End the torn record, so the next one starts on a line of its own
+		if _, err := sink.file.Write([]byte("\n")); err != nil {
+			sink.file.Close()
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
+func (s *auditChainSink) Name() string {
+	return "audit log " + s.path
+}
+
+// Send appends the event to the chain and syncs it to disk
+func (s *auditChainSink) Send(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := AuditRecord{Seq: s.seq + 1, AuditEvent: event, PrevHash: s.lastHash}
+	record.Hash = record.computeHash()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.seq, s.lastHash = record.Seq, record.Hash
+	return nil
+}
+
+// readAuditChain calls fn with each record of the log and its line, in order
+func readAuditChain(path string, fn func(record AuditRecord, line []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLine)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		if err := fn(record, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// scanAuditTail finds the last readable record of the log for appending,
+// skipping the lines it can't read: a record torn by a crash mid-write or one
+// over maxAuditLine. It returns their line numbers, and whether the log ends
+// in the middle of a line.
+func scanAuditTail(path string) (last AuditRecord, skipped []int, openLine bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return last, nil, false, err
+	}
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for n := 1; ; n++ {
+		line, tooLong, readErr := readAuditLine(reader)
+		if readErr != nil && readErr != io.EOF {
+			return last, skipped, false, readErr
+		}
+		openLine = readErr == io.EOF && (tooLong || len(line) > 0)
+		if tooLong {
+			skipped = append(skipped, n)
+		} else if len(bytes.TrimSpace(line)) > 0 {
+			var record AuditRecord
+			if json.Unmarshal(line, &record) != nil {
+				skipped = append(skipped, n)
+			} else {
+				last = record
+			}
+		}
+		if readErr == io.EOF {
+			return last, skipped, openLine, nil
+		}
+	}
+}
+
+// readAuditLine reads a line, dropping it past maxAuditLine
+func readAuditLine(reader *bufio.Reader) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line) > maxAuditLine+1 {
+				line, tooLong = nil, true
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
+
+// AuditChainStatus is the result of verifying the audit log
+type AuditChainStatus struct {
+	Records  uint64 `json:"records"`
+	HeadHash string `json:"headHash"` // hash of the last record, to archive
+}
+
+// verifyAuditChain checks every record's hash and link to the one before,
+// stopping at the first broken record
+func verifyAuditChain(path string) (AuditChainStatus, error) {
+	var status AuditChainStatus
+	err := readAuditChain(path, func(record AuditRecord, line []byte) error {
+		switch {
+		case record.Seq != status.Records+1:
+			return fmt.Errorf("record %d: expected sequence number %d, records were removed or reordered", record.Seq, status.Records+1)
+		case record.PrevHash != status.HeadHash:
+			return fmt.Errorf("record %d: previous hash does not match record %d", record.Seq, status.Records)
+		case record.computeHash() != record.Hash:
+			return fmt.Errorf("record %d: hash does not match its content, it was modified", record.Seq)
+		}
+		status.Records, status.HeadHash = record.Seq, record.Hash
+		return nil
+	})
+	return status, err
+}
+
+// writeAuditChain writes the records from one sequence number to another as
+// they are in the log. Verify the chain first: records appended since are
+// left out by passing the verified count as to.
+func writeAuditChain(path string, from, to uint64, w io.Writer) error {
+	return readAuditChain(path, func(record AuditRecord, line []byte) error {
+		if record.Seq < from || record.Seq > to {
+			return nil
+		}
+		_, err := w.Write(append(line, '\n'))
+		return err
+	})
+}
+
+// auditExportHandler serves the verified audit log for archiving, from the
+// record in ?from on, with the hash of the last record in X-Audit-Head-Hash
+func auditExportHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if path == "" {
+			http.Error(w, "Audit log not configured", http.StatusNotFound)
+			return
+		}
+		from := uint64(1)
+		if raw := r.URL.Query().Get("from"); raw != "" {
+			var err error
+			if from, err = strconv.ParseUint(raw, 10, 64); err != nil {
+				http.Error(w, "Invalid 'from', expected a sequence number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Verify first, so a broken chain is an error rather than a truncated body
+		status, err := verifyAuditChain(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Errorf("Audit log %s does not verify: %v", path, err)
+			http.Error(w, "Audit log does not verify: "+err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Audit-Records", strconv.FormatUint(status.Records, 10))
+		w.Header().Set("X-Audit-Head-Hash", status.HeadHash)
+		if status.Records == 0 {
+			return
+		}
+		if err := writeAuditChain(path, from, status.Records, w); err != nil {
+			log.Errorf("Error exporting audit log: %v", err)
+		}
+	}
+}
+
+// runAuditCommand runs `wake-me-up audit verify|export`, returning the exit
+// code
+func runAuditCommand(args []string, stdout, stderr io.Writer) int {
+	usage := "Usage: wake-me-up audit verify|export [-config path] [-file path] [-from seq]"
+	if len(args) == 0 || (args[0] != "verify" && args[0] != "export") {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("audit "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	config := flags.String("config", *configPath, "Path to config.yaml, to find audit_log.")
+	file := flags.String("file", "", "Audit log to read instead of the audit_log of the config.")
+	from := flags.Uint64("from", 1, "First record to export.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	path := *file
+	if path == "" {
+		parsed, err := ParseConfig(*config)
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to parse config: %v\n", err)
+			return 1
+		}
+		if path = parsed.AuditLog; path == "" {
+			fmt.Fprintf(stderr, "No audit_log in %s, use -file\n", *config)
+			return 1
+		}
+	}
+
+	status, err := verifyAuditChain(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: chain broken after %d records: %v\n", path, status.Records, err)
+		return 1
+	}
+	if args[0] == "verify" {
+		fmt.Fprintf(stdout, "%s: %d records OK, head hash %s\n", path, status.Records, status.HeadHash)
+		return 0
+	}
+	if err := writeAuditChain(path, *from, status.Records, stdout); err != nil {
+		fmt.Fprintf(stderr, "Failed to export %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Exported %s up to record %d, head hash %s\n", path, status.Records, status.HeadHash)
+	return 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := newAuditChainSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sink.Send(AuditEvent{Time: now, Type: AuditAcknowledge, Severity: 3, Actor: "alice", Message: "Alert acknowledged", Fields: map[string]string{"alertId": "1"}})
+	sink.Send(AuditEvent{Time: now, Type: AuditClear, Severity: 4, Message: "Alerts cleared"})
+	sink.file.Close()
+
+	// A restart goes on with the chain
+	sink, err = newAuditChainSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Send(AuditEvent{Time: now, Type: AuditServerStarted, Message: "Server started"})
+	sink.file.Close()
+	status, err := verifyAuditChain(path)
+	if err != nil || status.Records != 3 || status.HeadHash != sink.lastHash {
+		t.Fatalf("Expected 3 chained records, got %+v %v", status, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runAuditCommand([]string{"export", "-file", path, "-from", "2"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected the export to succeed, got %d: %s", code, stderr.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"seq":2`) {
+		t.Errorf("Expected records 2 and 3 exported, got %q", stdout.String())
+	}
+	rec := httptest.NewRecorder()
+	auditExportHandler(path)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit?from=3", nil))
+	if rec.Header().Get("X-Audit-Head-Hash") != status.HeadHash || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("Expected the last record with the head hash, got %v %q", rec.Header(), rec.Body.String())
+	}
+
+	// A record torn by a crash is skipped, the chain goes on from the one
+	// before it and verify still reports it
+	data, _ := os.ReadFile(path)
+	torn := append(append([]byte{}, data...), `{"seq":4,"type":"acknow`...)
+	os.WriteFile(path, torn, 0o600)
+	sink, err = newAuditChainSink(path)
+	if err != nil {
+		t.Fatalf("Expected a torn last record tolerated, got %v", err)
+	}
+	if sink.seq != 3 || sink.lastHash != status.HeadHash {
+		t.Errorf("Expected the chain to go on from record 3, got %d", sink.seq)
+	}
+	sink.Send(AuditEvent{Time: now, Type: AuditServerStarted, Message: "Server started"})
+	sink.file.Close()
+	if _, err := verifyAuditChain(path); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected verify to report the torn record, got %v", err)
+	}
+	if sink, err := newAuditChainSink(path); err != nil {
+		t.Errorf("Expected a restart past the torn record, got %v", err)
+	} else {
+		sink.file.Close()
+	}
+	if last, skipped, _, _ := scanAuditTail(path); last.Seq != 4 || len(skipped) != 1 || skipped[0] != 4 {
+		t.Errorf("Expected record 4 after the torn line, got %d %v", last.Seq, skipped)
+	}
+	os.WriteFile(path, append(append([]byte{}, data...), bytes.Repeat([]byte("x"), maxAuditLine+10)...), 0o600)
+	if sink, err := newAuditChainSink(path); err != nil || sink.seq != 3 {
+		t.Errorf("Expected a line over the limit skipped, got %v", err)
+	} else {
+		sink.file.Close()
+	}
+
+	// Changing the actor of the first record breaks the chain
+	os.WriteFile(path, bytes.Replace(data, []byte(`"actor":"alice"`), []byte(`"actor":"mallory"`), 1), 0o600)
+	if _, err := verifyAuditChain(path); err == nil || !strings.Contains(err.Error(), "record 1") {
+		t.Errorf("Expected the modified record reported, got %v", err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := runAuditCommand([]string{"verify", "-file", path}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "chain broken") {
+		t.Errorf("Expected verify to fail, got %d: %s", code, stderr.String())
+	}
+	rec = httptest.NewRecorder()
+	auditExportHandler(path)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected a broken chain refused, got %d", rec.Code)
+	}
+
+	// Dropping a record breaks it too
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(lines[0]+lines[2]), 0o600)
+	if _, err := verifyAuditChain(path); err == nil || !strings.Contains(err.Error(), "removed") {
+		t.Errorf("Expected the missing record reported, got %v", err)
+	}
+}
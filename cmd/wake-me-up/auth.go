@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -14,6 +18,7 @@ func authMiddleware(config *Config, handler http.HandlerFunc) http.HandlerFunc {
 			clientIP := getClientIP(r)
 			if !isIPAllowed(clientIP, config.AllowedIPs) {
 				log.Warnf("Rejected webhook from unauthorized IP: %s", clientIP)
+				audit.RecordRequest(r, AuditAuthFailure, 7, "Webhook from unauthorized IP", map[string]string{"reason": "ip_not_allowed"})
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
@@ -32,6 +37,7 @@ func authMiddleware(config *Config, handler http.HandlerFunc) http.HandlerFunc {
 
 			if apiKey != config.WebhookAPIKey {
 				log.Warnf("Rejected webhook with invalid API key from IP: %s", getClientIP(r))
+				audit.RecordRequest(r, AuditAuthFailure, 7, "Webhook with invalid API key", map[string]string{"reason": "invalid_api_key"})
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
@@ -40,6 +46,7 @@ func authMiddleware(config *Config, handler http.HandlerFunc) http.HandlerFunc {
 		// Check HTTPS requirement if configured
 		if config.RequireHTTPS && r.TLS == nil {
 			log.Warnf("Rejected non-HTTPS webhook request from IP: %s", getClientIP(r))
+			audit.RecordRequest(r, AuditAuthFailure, 5, "Non-HTTPS webhook request", map[string]string{"reason": "https_required"})
 			http.Error(w, "HTTPS required", http.StatusBadRequest)
 			return
 		}
@@ -49,29 +56,39 @@ func authMiddleware(config *Config, handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// getClientIP extracts the client IP from the request
-// Handles X-Forwarded-For and X-Real-IP headers for proxies
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies/load balancers)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			ip := strings.TrimSpace(ips[0])
-			if ip != "" {
-				return ip
-			}
+// trustedProxies are the networks whose forwarding headers are honored
+var trustedProxies []*net.IPNet
+
+// setTrustedProxies parses the trusted_proxies config
+func setTrustedProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		ipNet, err := parseNetwork(cidr)
+		if err != nil {
+			return fmt.Errorf("trusted_proxies: %w", err)
 		}
+		nets = append(nets, ipNet)
 	}
+	trustedProxies = nets
+	return nil
+}
 
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+// isTrustedProxy checks if an IP belongs to a trusted proxy
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Fall back to RemoteAddr
+// remoteIP returns the IP of the direct peer of the connection
+func remoteIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return r.RemoteAddr
@@ -79,6 +96,51 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
+// fromTrustedProxy checks if the request was sent by a trusted proxy, so its
+// forwarding headers can be believed
+func fromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(remoteIP(r))
+}
+
+// getClientIP extracts the client IP from the request
+// Forwarding headers are only honored when the request comes from a trusted
+// proxy, otherwise anyone could spoof their address past the IP allow-list
+func getClientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	// Walk X-Forwarded-For from the right: each trusted proxy appended the
+	// address it received the request from, so the first untrusted hop is
+	// the client. Hops left of it may have been forged by the client.
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			// Garbage in the chain, stop at the last hop we could verify
+			return peer
+		}
+		if !isTrustedProxy(hops[i]) || i == 0 {
+			return hops[i]
+		}
+		peer = hops[i]
+	}
+
+	// Check X-Real-IP header
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return peer
+}
+
 // isIPAllowed checks if an IP is in the allowed list
 // Supports CIDR notation (e.g., "10.0.0.0/8") and exact IPs
 func isIPAllowed(clientIP string, allowedIPs []string) bool {
@@ -108,3 +170,86 @@ func isIPAllowed(clientIP string, allowedIPs []string) bool {
 	return false
 }
 
+// BasicAuthConfig protects the board, its API and the admin endpoints with
+// HTTP basic auth, leaving the webhooks to webhook_api_key
+type BasicAuthConfig struct {
+	Users map[string]string `yaml:"users"` // Usernames and their passwords
+	Realm string            `yaml:"realm"` // Shown by browsers asking for the credentials (optional, default: wake-me-up)
+}
+
+// basicAuth is the basic_auth config, nil leaving the board open
+var basicAuth *BasicAuthConfig
+
+// basicAuthExempt are the routes served without basic auth: the webhooks,
+// which have their own API key, the links carrying a signed token and the
+// buttons, which have their own tokens
+var basicAuthExempt = map[string]bool{
+	"/webhook":               true,
+	"/webhook/generic":       true,
+	"/webhook/slack-actions": true,
+	"/api/v1/ingest/dry-run": true,
+	"/acknowledge/link":      true,
+	"/acknowledge/delegated": true,
+	"/api/v1/buttons/":       true,
+	"/manifest.webmanifest":  true,
+}
+
+// setBasicAuth checks and applies the basic_auth config
+func setBasicAuth(config *BasicAuthConfig) error {
+	if config == nil {
+		basicAuth = nil
+		return nil
+	}
+	if len(config.Users) == 0 {
+		return errors.New("basic_auth: no users")
+	}
+	for user, password := range config.Users {
+		if user == "" || strings.Contains(user, ":") || password == "" {
+			return fmt.Errorf("basic_auth: user %q needs a name without ':' and a password", user)
+		}
+	}
+	basicAuth = config
+	return nil
+}
+
+// basicAuthUser returns the user a request authenticated as, if any
+func basicAuthUser(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok || basicAuth == nil {
+		return user, false
+	}
+	expected, found := basicAuth.Users[user]
+	// Hash both sides so the comparison takes the same time whatever the lengths
+	got, want := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(expected))
+	return user, subtle.ConstantTimeCompare(got[:], want[:]) == 1 && found
+}
+
+// basicAuthMiddleware asks for the basic_auth credentials, if configured. The
+// exempt routes are told by the mux's pattern, as "/" serves any path.
+func basicAuthMiddleware(mux *http.ServeMux, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basicAuth == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if _, pattern := mux.Handler(r); basicAuthExempt[pattern] || isAppIcon(pattern) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if user, ok := basicAuthUser(r); !ok {
+			// Browsers first ask without credentials, only wrong ones are worth a log
+			if _, _, sent := r.BasicAuth(); sent {
+				log.Warnf("Rejected invalid credentials of %q from IP: %s", user, getClientIP(r))
+				audit.RecordRequest(r, AuditAuthFailure, 7, "Invalid basic auth credentials", map[string]string{"reason": "invalid_credentials", "user": user})
+			}
+			realm := basicAuth.Realm
+			if realm == "" {
+				realm = "wake-me-up"
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	if err := setTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer setTrustedProxies(nil)
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"untrusted peer", "198.51.100.7", []string{"203.0.113.5"}, "203.0.113.6", "198.51.100.7"},
+		{"trusted peer without headers", "10.0.0.1", nil, "", "10.0.0.1"},
+		{"client behind one proxy", "10.0.0.1", []string{"203.0.113.5"}, "", "203.0.113.5"},
+		{"spoofed leftmost hop", "10.0.0.1", []string{"1.2.3.4, 203.0.113.5"}, "", "203.0.113.5"},
+		{"spoofed hop before trusted proxies", "10.0.0.1", []string{"1.2.3.4, 203.0.113.5, 10.0.0.2"}, "", "203.0.113.5"},
+		{"every hop trusted", "10.0.0.1", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"unparsable last hop", "10.0.0.1", []string{"203.0.113.5, not-an-ip"}, "", "10.0.0.1"},
+		{"unparsable hop before a trusted proxy", "10.0.0.1", []string{"not-an-ip, 10.0.0.2"}, "", "10.0.0.2"},
+		{"hops over several headers", "10.0.0.1", []string{"1.2.3.4", "203.0.113.5, 10.0.0.2"}, "", "203.0.113.5"},
+		{"X-Real-IP from a trusted proxy", "10.0.0.1", nil, "203.0.113.5", "203.0.113.5"},
+		{"unparsable X-Real-IP", "10.0.0.1", nil, "not-an-ip", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.peer + ":12345"
+			for _, header := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			if got := getClientIP(r); got != test.want {
+				t.Errorf("Expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	if err := setBasicAuth(&BasicAuthConfig{Users: map[string]string{"alice": ""}}); err == nil {
+		t.Error("Expected a user without password refused")
+	}
+	if err := setBasicAuth(&BasicAuthConfig{Users: map[string]string{"alice": "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer setBasicAuth(nil)
+
+	mux := http.NewServeMux()
+	var actor string
+	mux.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		actor = requestActor(r, "someone")
+	})
+	handler := basicAuthMiddleware(mux, mux)
+	request := func(path, user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request("/clear", "", ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected credentials asked for, got %d", rec.Code)
+	}
+	if rec := request("/clear", "alice", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password refused, got %d", rec.Code)
+	}
+	if rec := request("/clear", "mallory", "secret"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown user refused, got %d", rec.Code)
+	}
+	if rec := request("/clear", "alice", "secret"); rec.Code != http.StatusOK || actor != "alice" {
+		t.Errorf("Expected alice let in as the actor, got %d %q", rec.Code, actor)
+	}
+	if rec := request("/webhook", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the webhook left to its API key, got %d", rec.Code)
+	}
+	// Paths falling through to "/" are not exempt, even if named like one
+	if rec := request("/webhook/generic", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unregistered exempt path protected, got %d", rec.Code)
+	}
+}
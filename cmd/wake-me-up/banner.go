@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const bannerFile = "banner.json"
+
+// Banner is a board-level message shown to everyone, e.g. a maintenance notice
+type Banner struct {
+	Message   string     `json:"message"`
+	SetAt     time.Time  `json:"setAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	ExpiresText string `json:"expiresText,omitempty"` // formatted expiry, only set in updates
+}
+
+// expired checks if the banner expiry time has passed
+func (b *Banner) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// GetBanner returns a copy of the current banner, or nil if none is set
+func (a *AppState) GetBanner() *Banner {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.banner == nil {
+		return nil
+	}
+	banner := *a.banner
+	return &banner
+}
+
+// SetBanner replaces the board banner and broadcasts it; a nil banner clears it
+func (a *AppState) SetBanner(banner *Banner) {
+	a.mu.Lock()
+	a.setBanner(banner)
+	a.mu.Unlock()
+
+	if err := a.saveBanner(banner); err != nil {
+		log.Errorf("Failed to persist banner: %v", err)
+	}
+	if banner != nil {
+		log.Infof("Banner set: %q", banner.Message)
+	} else {
+		log.Infof("Banner cleared")
+	}
+
+	// Broadcast update to all WebSocket clients
+	a.broadcastUpdate()
+}
+
+// setBanner replaces the banner and schedules its expiry
+// This should be called while holding the lock
+func (a *AppState) setBanner(banner *Banner) {
+	if a.bannerTimer != nil {
+		a.bannerTimer.Stop()
+		a.bannerTimer = nil
+	}
+	a.banner = banner
+	a.seq++
+
+	if banner != nil && banner.ExpiresAt != nil {
+		set := banner
+		a.bannerTimer = time.AfterFunc(time.Until(*banner.ExpiresAt), func() {
+			a.mu.RLock()
+			current := a.banner
+			a.mu.RUnlock()
+			// Only clear the banner this timer was scheduled for
+			if current == set {
+				a.SetBanner(nil)
+			}
+		})
+	}
+}
+
+// saveBanner persists the banner to the data directory
+func (a *AppState) saveBanner(banner *Banner) error {
+	path := a.dataFilePath(bannerFile)
+	if path == "" {
+		return nil
+	}
+	return saveJSON(path, banner)
+}
+
+// LoadBanner restores the persisted banner, dropping it if it expired while
+// the server was down
+func (a *AppState) LoadBanner() error {
+	path := a.dataFilePath(bannerFile)
+	if path == "" {
+		return nil
+	}
+
+	var banner *Banner
+	if _, err := loadJSON(path, &banner); err != nil {
+		return err
+	}
+	if banner == nil || banner.expired(time.Now()) {
+		return nil
+	}
+
+	a.mu.Lock()
+	a.setBanner(banner)
+	a.mu.Unlock()
+	log.Infof("Restored banner: %q", banner.Message)
+	return nil
+}
+
+// bannerRequest is the body accepted when setting the banner
+// The expiry is either an absolute time or a duration from now
+type bannerRequest struct {
+	Message   string     `json:"message"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Duration  string     `json:"duration,omitempty"`
+}
+
+// bannerHandler gets (GET), sets (POST) or clears (DELETE) the board banner
+func bannerHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.GetBanner())
+
+		case http.MethodPost:
+			var req bannerRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			req.Message = strings.TrimSpace(req.Message)
+			if req.Message == "" {
+				http.Error(w, "Missing 'message'", http.StatusBadRequest)
+				return
+			}
+
+			now := time.Now()
+			banner := &Banner{Message: req.Message, SetAt: now, ExpiresAt: req.ExpiresAt}
+			if req.Duration != "" {
+				duration, err := time.ParseDuration(req.Duration)
+				if err != nil || duration <= 0 {
+					http.Error(w, fmt.Sprintf("Invalid 'duration': %s", req.Duration), http.StatusBadRequest)
+					return
+				}
+				expiresAt := now.Add(duration)
+				banner.ExpiresAt = &expiresAt
+			}
+			if banner.expired(now) {
+				http.Error(w, "Banner expiry is in the past", http.StatusBadRequest)
+				return
+			}
+
+			state.SetBanner(banner)
+			audit.RecordRequest(r, AuditBannerChange, 3, "Banner set", map[string]string{"banner": banner.Message})
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		case http.MethodDelete:
+			state.SetBanner(nil)
+			audit.RecordRequest(r, AuditBannerChange, 3, "Banner cleared", nil)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
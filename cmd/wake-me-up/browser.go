@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Defaults of the board's browser tab
+const (
+	defaultPageTitle    = "Wake me Up!"
+	defaultFavicon      = "/static/icon.svg"
+	defaultAlarmFavicon = "/static/icon-alarm.svg"
+
+	defaultNotificationTitle = "{{.Name}}"
+	defaultNotificationBody  = "{{if .Severity}}{{.Severity}}, {{end}}firing since {{.StartsAt}}"
+)
+
+// Above this many new firing alerts in one webhook, browsers get a single
+// summary notification instead of one per alert
+const maxBrowserNotifications = 5
+
+// BrowserConfig customizes the board's browser tab and the desktop
+// notifications shown by browsers, for users who mute their device
+type BrowserConfig struct {
+	Title             string `yaml:"title"`              // Page title, prefixed with the unacknowledged count (optional, default: Wake me Up!)
+	Favicon           string `yaml:"favicon"`            // Favicon URL (optional, default: /static/icon.svg)
+	AlarmFavicon      string `yaml:"alarm_favicon"`      // Favicon while alerts are unacknowledged (optional, default: /static/icon-alarm.svg)
+	Notifications     bool   `yaml:"notifications"`      // Show a desktop notification for new firing alerts (optional, default: false)
+	NotificationTitle string `yaml:"notification_title"` // Go template of the title (optional, default: {{.Name}})
+	NotificationBody  string `yaml:"notification_body"`  // Go template of the body (optional, default: severity and start time)
+}
+
+// BrowserSettings is what the board page needs to know of BrowserConfig
+type BrowserSettings struct {
+	Title         string
+	Favicon       string
+	AlarmFavicon  string
+	Notifications bool
+	Push          bool // web_push is configured
+}
+
+// browserSettings returns the configured settings with defaults applied
+func browserSettings(config *BrowserConfig, push bool) BrowserSettings {
+	settings := BrowserSettings{Title: defaultPageTitle, Favicon: defaultFavicon, AlarmFavicon: defaultAlarmFavicon, Push: push}
+	if config == nil {
+		return settings
+	}
+	if config.Title != "" {
+		settings.Title = config.Title
+	}
+	if config.Favicon != "" {
+		settings.Favicon = config.Favicon
+	}
+	if config.AlarmFavicon != "" {
+		settings.AlarmFavicon = config.AlarmFavicon
+	}
+	settings.Notifications = config.Notifications
+	return settings
+}
+
+// BrowserNotification is pushed to the board clients, which show it through
+// the browser Notification API when the user allowed it
+type BrowserNotification struct {
+	Type               string `json:"type"` // always "notification"
+	AlertID            string `json:"alertId,omitempty"`
+	Title              string `json:"title"`
+	Body               string `json:"body"`
+	Tag                string `json:"tag"`                // replaces an earlier notification with the same tag
+	RequireInteraction bool   `json:"requireInteraction"` // stays until dismissed, set for critical alerts
+}
+
+// notificationData is what the notification templates are executed with
+type notificationData struct {
+	Name      string // alert name and instance, decorated
+	AlertName string
+	Severity  string
+	Labels    map[string]string
+	StartsAt  string
+}
+
+// browserNotifier renders desktop notifications for new firing alerts
+type browserNotifier struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// newBrowserNotifier parses the notification templates, returning nil when
+// notifications are disabled
+func newBrowserNotifier(config *BrowserConfig) (*browserNotifier, error) {
+	if config == nil || !config.Notifications {
+		return nil, nil
+	}
+	titleText, bodyText := config.NotificationTitle, config.NotificationBody
+	if titleText == "" {
+		titleText = defaultNotificationTitle
+	}
+	if bodyText == "" {
+		bodyText = defaultNotificationBody
+	}
+	title, err := template.New("title").Option("missingkey=zero").Parse(titleText)
+	if err != nil {
+		return nil, fmt.Errorf("browser.notification_title: %v", err)
+	}
+	body, err := template.New("body").Option("missingkey=zero").Parse(bodyText)
+	if err != nil {
+		return nil, fmt.Errorf("browser.notification_body: %v", err)
+	}
+
+	// Fail at startup rather than on the first alert
+	n := &browserNotifier{title: title, body: body}
+	if _, err := n.render(AlertEntry{ID: "example", Alert: Alert{Status: "firing", Labels: map[string]string{"alertname": "Example"}}}); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// render builds the notification of a firing alert
+func (n *browserNotifier) render(entry AlertEntry) (BrowserNotification, error) {
+	data := notificationData{
+		Name:      alertTitle(entry.Alert),
+		AlertName: entry.Alert.Labels["alertname"],
+		Severity:  alertSeverity(entry.Alert),
+		Labels:    entry.Alert.Labels,
+		StartsAt:  timeFormat.Absolute(entry.Alert.StartsAt),
+	}
+	var title, body strings.Builder
+	if err := n.title.Execute(&title, data); err != nil {
+		return BrowserNotification{}, fmt.Errorf("browser.notification_title: %v", err)
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return BrowserNotification{}, fmt.Errorf("browser.notification_body: %v", err)
+	}
+	return BrowserNotification{
+		Type:               "notification",
+		AlertID:            entry.ID,
+		Title:              strings.TrimSpace(title.String()),
+		Body:               strings.TrimSpace(body.String()),
+		Tag:                entry.ID,
+		RequireInteraction: severityLevel(data.Severity) == StatusLevelCritical,
+	}, nil
+}
+
+// notifyBrowsers pushes desktop notifications of new firing alerts to the
+// board clients
+func (a *AppState) notifyBrowsers(firing []AlertEntry) {
+	if a.browser == nil || len(firing) == 0 {
+		return
+	}
+
+	var notifications []BrowserNotification
+	if len(firing) > maxBrowserNotifications {
+		summary := BrowserNotification{
+			Type:  "notification",
+			Title: fmt.Sprintf("%d new alerts", len(firing)),
+			Body:  alertTitle(firing[0].Alert) + " and others",
+			Tag:   "summary",
+		}
+		for _, entry := range firing {
+			if severityLevel(alertSeverity(entry.Alert)) == StatusLevelCritical {
+				summary.RequireInteraction = true
+			}
+		}
+		notifications = append(notifications, summary)
+	} else {
+		for _, entry := range firing {
+			notification, err := a.browser.render(entry)
+			if err != nil {
+				log.Errorf("Failed to render browser notification: %v", err)
+				continue
+			}
+			notifications = append(notifications, notification)
+		}
+	}
+
+	for _, notification := range notifications {
+		message, err := json.Marshal(notification)
+		if err != nil {
+			log.Errorf("Error marshaling browser notification: %v", err)
+			continue
+		}
+		a.hub.broadcast <- hubMessage{message: message}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Bulk operations take two steps, so a matcher broader than meant shows up
+// before anything happens: a preview lists the alerts an action would apply
+// to and returns a token, and committing the token applies the action to
+// exactly those alerts. Alerts arriving in between are left alone. Tokens
+// work for bulkPreviewMaxAge from any client, so a preview can be committed
+// after a reload or from another device.
+
+const bulkPreviewMaxAge = 15 * time.Minute
+
+// Bulk actions
+const (
+	BulkAcknowledge = "acknowledge"
+	BulkSnooze      = "snooze"
+	BulkClear       = "clear"
+)
+
+// BulkPreview is a bulk action waiting to be committed
+type BulkPreview struct {
+	Token     string           `json:"token"`
+	Action    string           `json:"action"`
+	Matchers  []SilenceMatcher `json:"matchers"`
+	Duration  string           `json:"duration,omitempty"` // of snoozes
+	Comment   string           `json:"comment,omitempty"`  // left with acknowledgements
+	ExpiresAt time.Time        `json:"expiresAt"`
+	Alerts    []AlertEntry     `json:"alerts"` // the alerts it applies to
+
+	snoozeFor time.Duration
+}
+
+// bulkPreviewRequest is the body accepted by the preview endpoint
+type bulkPreviewRequest struct {
+	Matchers []SilenceMatcher `json:"matchers"`
+	Action   string           `json:"action"`
+	Duration string           `json:"duration,omitempty"`
+	Comment  string           `json:"comment,omitempty"`
+}
+
+// BulkResult reports a committed bulk action
+type BulkResult struct {
+	Action  string   `json:"action"`
+	Applied []string `json:"applied"`
+	Skipped []string `json:"skipped"` // gone or changed since the preview, e.g. acknowledged meanwhile
+}
+
+var errBulkTokenUnknown = errors.New("unknown or expired bulk token, preview again")
+
+// bulkApplies tells if an action applies to an alert
+// This should be called while holding the lock
+func (a *AppState) bulkApplies(action string, entry AlertEntry) bool {
+	switch action {
+	case BulkAcknowledge:
+		return needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil)
+	case BulkSnooze:
+		return entry.Alert.Status == "firing"
+	}
+	return true
+}
+
+// PreviewBulk lists the alerts matching all the matchers that the action
+// applies to, and keeps them for a commit
+func (a *AppState) PreviewBulk(preview *BulkPreview) error {
+	token, err := newDeviceToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	preview.Token = token
+	preview.ExpiresAt = now.Add(bulkPreviewMaxAge)
+	preview.Alerts = []AlertEntry{}
+	selector := Silence{Matchers: preview.Matchers}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range a.alertsNewestFirst() {
+		if selector.matches(entry.Alert) && a.bulkApplies(preview.Action, entry) {
+			preview.Alerts = append(preview.Alerts, entry)
+		}
+	}
+	for token, pending := range a.bulkPreviews {
+		if now.After(pending.ExpiresAt) {
+			delete(a.bulkPreviews, token)
+		}
+	}
+	a.bulkPreviews[preview.Token] = preview
+	return nil
+}
+
+// CommitBulk applies a previewed bulk action on behalf of an actor, empty if
+// unknown. A token can be committed once.
+func (a *AppState) CommitBulk(token, actor string) (BulkResult, error) {
+	a.mu.Lock()
+	preview := a.bulkPreviews[token]
+	delete(a.bulkPreviews, token)
+	if preview == nil || time.Now().After(preview.ExpiresAt) {
+		a.mu.Unlock()
+		return BulkResult{}, errBulkTokenUnknown
+	}
+	result := BulkResult{Action: preview.Action, Applied: []string{}, Skipped: []string{}}
+	for _, previewed := range preview.Alerts {
+		if entry, ok := a.alertByID(previewed.ID); ok && a.bulkApplies(preview.Action, entry) {
+			result.Applied = append(result.Applied, entry.ID)
+		} else {
+			result.Skipped = append(result.Skipped, previewed.ID)
+		}
+	}
+	a.mu.Unlock()
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+
+	switch preview.Action {
+	case BulkAcknowledge:
+		a.AcknowledgeAll(result.Applied, nil, actor, preview.Comment)
+	case BulkSnooze:
+		until := time.Now().Add(preview.snoozeFor)
+		applied := result.Applied[:0]
+		for _, id := range result.Applied {
+			if err := a.SnoozeAlert(id, until, nil, actor); err != nil {
+				result.Skipped = append(result.Skipped, id)
+				continue
+			}
+			applied = append(applied, id)
+		}
+		result.Applied = applied
+	case BulkClear:
+		result.Applied = a.ClearAlerts(result.Applied)
+	}
+	return result, nil
+}
+
+// ClearAlerts removes alerts from the board and returns the IDs of those
+// that were on it
+func (a *AppState) ClearAlerts(alertIDs []string) []string {
+	selected := make(map[string]bool, len(alertIDs))
+	for _, id := range alertIDs {
+		selected[id] = true
+	}
+	a.mu.Lock()
+	cleared := a.clearAlerts(func(entry AlertEntry) bool {
+		return selected[entry.ID]
+	})
+	a.mu.Unlock()
+
+	a.broadcastUpdate()
+	if len(cleared) > 0 {
+		a.cluster.publish(clusterOp{Type: clusterOpClear, IDs: cleared})
+	}
+	return cleared
+}
+
+// bulkPreviewHandler previews a bulk action on the alerts matching a set of
+// matchers
+func bulkPreviewHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if refuseLocked(w, state) {
+			return
+		}
+		var request bulkPreviewRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		preview := &BulkPreview{
+			Action:   request.Action,
+			Matchers: request.Matchers,
+			Comment:  strings.TrimSpace(request.Comment),
+		}
+		if len(preview.Matchers) == 0 {
+			http.Error(w, "At least one matcher is required", http.StatusBadRequest)
+			return
+		}
+		for i := range preview.Matchers {
+			if err := preview.Matchers[i].compile(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		switch preview.Action {
+		case BulkAcknowledge, BulkClear:
+		case BulkSnooze:
+			duration, err := parseSnoozeDuration(request.Duration)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			preview.Duration, preview.snoozeFor = shortDuration(duration), duration
+		default:
+			http.Error(w, fmt.Sprintf("Invalid 'action' %q, expected acknowledge, snooze or clear", preview.Action), http.StatusBadRequest)
+			return
+		}
+
+		if err := state.PreviewBulk(preview); err != nil {
+			log.Errorf("Failed to preview bulk action: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+	}
+}
+
+// bulkCommitHandler applies a previewed bulk action
+func bulkCommitHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if refuseLocked(w, state) {
+			return
+		}
+		var request struct {
+			Token string `json:"token"`
+			By    string `json:"by,omitempty"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := state.CommitBulk(request.Token, requestActor(r, strings.TrimSpace(request.By)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if len(result.Applied) > 0 {
+			auditType, message := AuditAcknowledge, "Alerts acknowledged in bulk"
+			switch result.Action {
+			case BulkSnooze:
+				auditType, message = AuditSnooze, "Alerts snoozed in bulk"
+			case BulkClear:
+				auditType, message = AuditClear, "Alerts cleared in bulk"
+			}
+			audit.RecordRequest(r, auditType, 3, message, map[string]string{"alertIds": strings.Join(result.Applied, ",")})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
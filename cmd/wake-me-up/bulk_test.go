@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBulkPreviewAndCommit(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "prod"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "staging"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "CPU", "env": "prod"}},
+	}})
+	idOf := make(map[string]string)
+	for _, entry := range state.GetAlerts() {
+		idOf[entry.Alert.Labels["alertname"]+"/"+entry.Alert.Labels["env"]] = entry.ID
+	}
+
+	matchers := []SilenceMatcher{{Name: "alertname", Value: "Disk"}}
+	preview := &BulkPreview{Action: BulkAcknowledge, Matchers: matchers}
+	if err := state.PreviewBulk(preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Alerts) != 2 || preview.Token == "" {
+		t.Fatalf("Expected the two Disk alerts previewed, got %+v", preview.Alerts)
+	}
+
+	// Changes after the preview: one alert acknowledged, a new matching one
+	state.Acknowledge(idOf["Disk/staging"], "bob")
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "dev"}},
+	}})
+
+	result, err := state.CommitBulk(preview.Token, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 1 || result.Applied[0] != idOf["Disk/prod"] || len(result.Skipped) != 1 || result.Skipped[0] != idOf["Disk/staging"] {
+		t.Errorf("Expected only the previewed alert still unacknowledged acknowledged, got %+v", result)
+	}
+	if ack := state.GetAcknowledgement(idOf["Disk/staging"]); ack == nil || ack.By != "bob" {
+		t.Errorf("Expected the acknowledgement of bob kept, got %+v", ack)
+	}
+	unacknowledged := 0
+	for _, entry := range state.GetAlerts() {
+		if !state.IsAcknowledged(entry.ID) {
+			unacknowledged++
+		}
+	}
+	if unacknowledged != 2 {
+		t.Errorf("Expected CPU and the new Disk alert left unacknowledged, got %d", unacknowledged)
+	}
+
+	if _, err := state.CommitBulk(preview.Token, "alice"); !errors.Is(err, errBulkTokenUnknown) {
+		t.Errorf("Expected a token to be committed once, got %v", err)
+	}
+
+	clearing := &BulkPreview{Action: BulkClear, Matchers: []SilenceMatcher{{Name: "env", Value: "prod"}}}
+	if err := state.PreviewBulk(clearing); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := state.CommitBulk(clearing.Token, ""); err != nil || len(result.Applied) != 2 {
+		t.Fatalf("Expected the two prod alerts cleared, got %+v, %v", result, err)
+	}
+	if alerts := state.GetAlerts(); len(alerts) != 2 {
+		t.Errorf("Expected two alerts left, got %d", len(alerts))
+	}
+}
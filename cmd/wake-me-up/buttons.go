@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hardware buttons act on the board with a single request, for macro keys
+// and USB or Wi-Fi buttons that can only call a fixed URL: a big red button
+// on the nightstand silences the board without unlocking a phone. Each button
+// has its own URL, action and token, so a lost one can be revoked alone.
+
+const (
+	ButtonAckTop    = "ack-top"    // acknowledge the alert at the top of the board
+	ButtonAckAll    = "ack-all"    // acknowledge every alert awaiting acknowledgement
+	ButtonSnoozeAll = "snooze-all" // snooze every firing alert awaiting acknowledgement
+
+	defaultButtonSnooze   = 15 * time.Minute
+	defaultButtonCooldown = 2 * time.Second
+	// Invalid tokens in a row double the wait before the next try, up to this
+	maxButtonBackoff = 5 * time.Minute
+)
+
+// ButtonConfig is a hardware button
+type ButtonConfig struct {
+	Name     string        `yaml:"name"`     // Path of the button, /api/v1/buttons/<name>
+	Action   string        `yaml:"action"`   // ack-top, ack-all or snooze-all
+	Token    string        `yaml:"token"`    // Secret the button sends as X-Button-Token
+	Duration time.Duration `yaml:"duration"` // Snooze of snooze-all (optional, default: 15m)
+	Cooldown time.Duration `yaml:"cooldown"` // Presses refused after one, e.g. a held key repeating (optional, default: 2s)
+	Actor    string        `yaml:"actor"`    // Who acknowledges (optional, default: the button's name)
+}
+
+// buttonName is a valid button name
+var buttonName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// hardwareButton is a configured button, when it was last pressed and the
+// invalid tokens sent for it
+type hardwareButton struct {
+	ButtonConfig
+
+	mu          sync.Mutex
+	lastPressed time.Time
+	failures    int       // invalid tokens in a row
+	retryAfter  time.Time // no token is checked before, after invalid ones
+}
+
+// newHardwareButtons checks the buttons config and returns the buttons by name
+func newHardwareButtons(configs []ButtonConfig) (map[string]*hardwareButton, error) {
+	buttons := make(map[string]*hardwareButton, len(configs))
+	for i, config := range configs {
+		if !buttonName.MatchString(config.Name) {
+			return nil, fmt.Errorf("buttons[%d]: name %q must be letters, digits, - or _", i, config.Name)
+		}
+		if buttons[config.Name] != nil {
+			return nil, fmt.Errorf("buttons[%d]: duplicate name %q", i, config.Name)
+		}
+		switch config.Action {
+		case ButtonAckTop, ButtonAckAll, ButtonSnoozeAll:
+		default:
+			return nil, fmt.Errorf("buttons[%d]: unknown action %q, expected ack-top, ack-all or snooze-all", i, config.Action)
+		}
+		if config.Token == "" {
+			return nil, fmt.Errorf("buttons[%d]: a token is required", i)
+		}
+		if config.Duration < 0 || config.Cooldown < 0 {
+			return nil, fmt.Errorf("buttons[%d]: duration and cooldown must not be negative", i)
+		}
+		if config.Duration == 0 {
+			config.Duration = defaultButtonSnooze
+		}
+		if config.Cooldown == 0 {
+			config.Cooldown = defaultButtonCooldown
+		}
+		if config.Actor == "" {
+			config.Actor = config.Name
+		}
+		buttons[config.Name] = &hardwareButton{ButtonConfig: config}
+	}
+	return buttons, nil
+}
+
+// authorize checks the token a request carries in X-Button-Token, never in
+// the URL where access logs would keep it. Each invalid token doubles the
+// wait before the next one is checked, so tokens can't be guessed; until
+// then it returns how long to wait.
+func (b *hardwareButton) authorize(r *http.Request, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := b.retryAfter.Sub(now); wait > 0 {
+		return false, wait
+	}
+	got, want := sha256.Sum256([]byte(r.Header.Get("X-Button-Token"))), sha256.Sum256([]byte(b.Token))
+	if subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+		b.failures = 0
+		return true, 0
+	}
+	b.failures++
+	backoff := maxButtonBackoff
+	if b.failures < 20 {
+		backoff = min(b.Cooldown<<(b.failures-1), maxButtonBackoff)
+	}
+	b.retryAfter = now.Add(backoff)
+	return false, 0
+}
+
+// setRetryAfter sets the Retry-After header, in whole seconds
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
+// press records a press, or returns how long until the button may be
+// pressed again
+func (b *hardwareButton) press(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := b.lastPressed.Add(b.Cooldown).Sub(now); wait > 0 {
+		return wait
+	}
+	b.lastPressed = now
+	return 0
+}
+
+// pressButton applies a button's action and returns the alerts it applied to
+func (a *AppState) pressButton(button *hardwareButton) []string {
+	var pending []AlertEntryWithAck
+	for _, entry := range a.GetBoardAlerts() {
+		if entry.NeedsAck {
+			pending = append(pending, entry)
+		}
+	}
+
+	if button.Action == ButtonAckTop && len(pending) > 1 {
+		pending = pending[:1]
+	}
+
+	applied := []string{}
+	switch button.Action {
+	case ButtonAckTop, ButtonAckAll:
+		for _, entry := range pending {
+			applied = append(applied, entry.ID)
+		}
+		if len(applied) > 0 {
+			a.AcknowledgeAll(applied, nil, button.Actor, "")
+		}
+	case ButtonSnoozeAll:
+		until := time.Now().Add(button.Duration)
+		for _, entry := range pending {
+			if entry.Alert.Status == "firing" && a.SnoozeAlert(entry.ID, until, nil, button.Actor) == nil {
+				applied = append(applied, entry.ID)
+			}
+		}
+	}
+	return applied
+}
+
+// buttonHandler presses the button named in the path, on GET or POST as
+// simple buttons can often only send one of them
+func buttonHandler(state *AppState, buttons map[string]*hardwareButton) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		button, ok := buttons[strings.TrimPrefix(r.URL.Path, "/api/v1/buttons/")]
+		if !ok {
+			http.Error(w, "Unknown button", http.StatusNotFound)
+			return
+		}
+		authorized, wait := button.authorize(r, time.Now())
+		if wait > 0 {
+			setRetryAfter(w, wait)
+			http.Error(w, "Too many invalid tokens", http.StatusTooManyRequests)
+			return
+		}
+		if !authorized {
+			log.Warnf("Rejected press of button %q with an invalid token from IP: %s", button.Name, getClientIP(r))
+			audit.RecordRequest(r, AuditAuthFailure, 7, "Button pressed with an invalid token", map[string]string{"reason": "invalid_button_token", "button": button.Name})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Acting on every alert is a bulk action
+		if button.Action != ButtonAckTop && refuseLocked(w, state) {
+			return
+		}
+		if wait := button.press(time.Now()); wait > 0 {
+			setRetryAfter(w, wait)
+			http.Error(w, "Pressed too often", http.StatusTooManyRequests)
+			return
+		}
+
+		applied := state.pressButton(button)
+		log.Infof("Button %q pressed: %s %d alerts", button.Name, button.Action, len(applied))
+		if len(applied) > 0 {
+			fields := map[string]string{"button": button.Name, "action": button.Action, "alertIds": strings.Join(applied, ",")}
+			if button.Action == ButtonSnoozeAll {
+				fields["duration"] = button.Duration.String()
+				audit.RecordRequest(r, AuditSnooze, 3, "Alerts snoozed by button", fields)
+			} else {
+				audit.RecordRequest(r, AuditAcknowledge, 3, "Alerts acknowledged by button", fields)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"action": button.Action, "alerts": applied})
+	}
+}
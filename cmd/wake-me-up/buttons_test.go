@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHardwareButtons(t *testing.T) {
+	if _, err := newHardwareButtons([]ButtonConfig{{Name: "red", Action: "clear", Token: "x"}}); err == nil {
+		t.Error("Expected an unknown action refused")
+	}
+	if _, err := newHardwareButtons([]ButtonConfig{{Name: "red", Action: ButtonAckAll}}); err == nil {
+		t.Error("Expected a button without token refused")
+	}
+
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "C"}},
+	}})
+	buttons, err := newHardwareButtons([]ButtonConfig{
+		{Name: "top", Action: ButtonAckTop, Token: "t1", Actor: "nightstand"},
+		{Name: "snooze", Action: ButtonSnoozeAll, Token: "t2", Cooldown: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := buttonHandler(state, buttons)
+	press := func(name, token string) (*httptest.ResponseRecorder, []string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/buttons/"+name, nil)
+		req.Header.Set("X-Button-Token", token)
+		handler(rec, req)
+		var result struct {
+			Alerts []string `json:"alerts"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec, result.Alerts
+	}
+
+	if rec, _ := press("top", "t2"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another button's token refused, got %d", rec.Code)
+	}
+	// No token is checked for a while after an invalid one, longer each time
+	if rec, _ := press("top", "t1"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected the next try refused after an invalid token, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	buttons["top"].retryAfter = time.Time{}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/buttons/top?token=t1", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a token in the URL refused, got %d", rec.Code)
+	}
+	if wait := time.Until(buttons["top"].retryAfter); wait < 3*time.Second || wait > 4*time.Second {
+		t.Errorf("Expected the wait doubled by a second invalid token, got %s", wait)
+	}
+	buttons["top"].retryAfter = time.Time{}
+	if rec, _ := press("blue", "t1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown button refused, got %d", rec.Code)
+	}
+
+	events := &auditRecorder{events: make(chan AuditEvent, 10)}
+	defer func(saved *Auditor) { audit = saved }(audit)
+	audit = newAuditor([]AuditSink{events})
+	top := state.GetBoardAlerts()[0].ID
+	rec, applied := press("top", "t1")
+	if rec.Code != http.StatusOK || len(applied) != 1 || applied[0] != top {
+		t.Fatalf("Expected the top alert acknowledged, got %d %v", rec.Code, applied)
+	}
+	if event := events.next(t); event.Type != AuditAcknowledge || event.Fields["alertIds"] != top {
+		t.Errorf("Expected an acknowledgement audit event, got %+v", event)
+	}
+	if ack := state.GetBoardAlerts()[2].Acknowledgement; ack == nil || ack.By != "nightstand" {
+		t.Errorf("Expected the acknowledgement by the button's actor, got %+v", ack)
+	}
+
+	// Bulk actions wait for the board lock
+	state.SetBoardLock(&BoardLock{By: "alice"})
+	if rec, _ := press("snooze", "t2"); rec.Code != http.StatusLocked {
+		t.Errorf("Expected snooze-all refused while locked, got %d", rec.Code)
+	}
+	state.SetBoardLock(nil)
+
+	if rec, applied := press("snooze", "t2"); rec.Code != http.StatusOK || len(applied) != 2 {
+		t.Fatalf("Expected the other alerts snoozed, got %d %v", rec.Code, applied)
+	}
+	for _, entry := range state.GetBoardAlerts() {
+		if entry.ID != top && (entry.Snooze == nil || time.Until(entry.Snooze.Until) < 14*time.Minute) {
+			t.Errorf("Expected %s snoozed for 15m, got %+v", entry.ID, entry.Snooze)
+		}
+	}
+	if event := events.next(t); event.Type != AuditSnooze || event.Fields["duration"] != "15m0s" {
+		t.Errorf("Expected a snooze audit event with the duration, got %+v", event)
+	}
+	if rec, _ := press("snooze", "t2"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a press within the cooldown refused, got %d", rec.Code)
+	}
+}
+
+// auditRecorder is an audit sink keeping the events for a test
+type auditRecorder struct {
+	events chan AuditEvent
+}
+
+func (r *auditRecorder) Name() string { return "recorder" }
+
+func (r *auditRecorder) Send(event AuditEvent) error {
+	r.events <- event
+	return nil
+}
+
+// next waits for the next event
+func (r *auditRecorder) next(t *testing.T) AuditEvent {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an audit event")
+		return AuditEvent{}
+	}
+}
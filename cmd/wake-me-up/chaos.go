@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChaosConfig injects faults, so operators can check that clients reconcile
+// and no alert is lost when things fail. Not meant for production; every
+// setting can also be given as a WAKE_ME_UP_CHAOS_* environment variable.
+type ChaosConfig struct {
+	DropBroadcasts int           `yaml:"drop_broadcasts"` // Percentage of board updates not sent to clients (WAKE_ME_UP_CHAOS_DROP_BROADCASTS)
+	IngestDelay    time.Duration `yaml:"ingest_delay"`    // Delay before a webhook is applied (WAKE_ME_UP_CHAOS_INGEST_DELAY)
+	KillClients    int           `yaml:"kill_clients"`    // Percentage of broadcasts that drop a client's connection instead (WAKE_ME_UP_CHAOS_KILL_CLIENTS)
+	StorageErrors  int           `yaml:"storage_errors"`  // Percentage of state saves that fail (WAKE_ME_UP_CHAOS_STORAGE_ERRORS)
+}
+
+// chaos holds the faults to inject, none by default
+var chaos ChaosConfig
+
+// errChaosStorage is the error of a simulated storage failure
+var errChaosStorage = errors.New("simulated storage error (chaos.storage_errors)")
+
+// setChaos applies the chaos config, with environment variables taking
+// precedence over config.yaml
+func setChaos(config *ChaosConfig) error {
+	var settings ChaosConfig
+	if config != nil {
+		settings = *config
+	}
+
+	for name, target := range map[string]*int{
+		"DROP_BROADCASTS": &settings.DropBroadcasts,
+		"KILL_CLIENTS":    &settings.KillClients,
+		"STORAGE_ERRORS":  &settings.StorageErrors,
+	} {
+		if value := os.Getenv("WAKE_ME_UP_CHAOS_" + name); value != "" {
+			percent, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("WAKE_ME_UP_CHAOS_%s: %v", name, err)
+			}
+			*target = percent
+		}
+	}
+	if value := os.Getenv("WAKE_ME_UP_CHAOS_INGEST_DELAY"); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("WAKE_ME_UP_CHAOS_INGEST_DELAY: %v", err)
+		}
+		settings.IngestDelay = delay
+	}
+
+	for name, percent := range map[string]int{
+		"drop_broadcasts": settings.DropBroadcasts,
+		"kill_clients":    settings.KillClients,
+		"storage_errors":  settings.StorageErrors,
+	} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("chaos.%s must be a percentage between 0 and 100, got %d", name, percent)
+		}
+	}
+	if settings.IngestDelay < 0 {
+		return fmt.Errorf("chaos.ingest_delay must not be negative, got %s", settings.IngestDelay)
+	}
+
+	chaos = settings
+	if enabled := chaos.describe(); enabled != "" {
+		log.Warnf("Fault injection enabled: %s", enabled)
+	}
+	return nil
+}
+
+// describe lists the enabled faults, empty if none
+func (c ChaosConfig) describe() string {
+	var faults []string
+	if c.DropBroadcasts > 0 {
+		faults = append(faults, fmt.Sprintf("dropping %d%% of broadcasts", c.DropBroadcasts))
+	}
+	if c.IngestDelay > 0 {
+		faults = append(faults, fmt.Sprintf("delaying ingestion by %s", c.IngestDelay))
+	}
+	if c.KillClients > 0 {
+		faults = append(faults, fmt.Sprintf("killing clients on %d%% of broadcasts", c.KillClients))
+	}
+	if c.StorageErrors > 0 {
+		faults = append(faults, fmt.Sprintf("failing %d%% of saves", c.StorageErrors))
+	}
+	return strings.Join(faults, ", ")
+}
+
+// inject reports whether a fault with the given percentage strikes now
+func (c ChaosConfig) inject(kind string, percent int) bool {
+	if percent <= 0 || rand.IntN(100) >= percent {
+		return false
+	}
+	chaosFaults.WithLabelValues(kind).Inc()
+	return true
+}
+
+// dropBroadcast reports whether a board update should not be sent
+func (c ChaosConfig) dropBroadcast() bool {
+	if !c.inject("drop_broadcast", c.DropBroadcasts) {
+		return false
+	}
+	log.Warnf("Chaos: dropping board update")
+	return true
+}
+
+// killClient reports whether a client should be disconnected instead of
+// being sent a message
+func (c ChaosConfig) killClient() bool {
+	return c.inject("kill_client", c.KillClients)
+}
+
+// delayIngestion holds up a webhook before it is applied
+func (c ChaosConfig) delayIngestion() {
+	if c.IngestDelay > 0 {
+		chaosFaults.WithLabelValues("ingest_delay").Inc()
+		time.Sleep(c.IngestDelay)
+	}
+}
+
+// storageError returns a simulated error for a state save, or nil
+func (c ChaosConfig) storageError() error {
+	if c.inject("storage_error", c.StorageErrors) {
+		return errChaosStorage
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Several instances can run behind a load balancer, so a single host isn't a
+// single point of failure for the alarm. The instances share the board
+// through Redis: changes are published to the others over pub/sub, the board
+// snapshot is kept in Redis for instances that start, and one instance at a
+// time holds the lease for the background duties. See docs/scaling.md.
+
+// StorageRedis keeps the board in the Redis server of the cluster
+const StorageRedis = "redis"
+
+const (
+	defaultClusterChannel = "wake-me-up"
+	defaultDedupWindow    = 30 * time.Second
+
+	leaderLeaseTTL          = 15 * time.Second
+	leaderRenewInterval     = 5 * time.Second
+	clusterResubscribeDelay = 5 * time.Second
+	clusterOpBuffer         = 1024
+)
+
+// Changes of the board replicated between instances
+const (
+	clusterOpWebhook     = "webhook"
+	clusterOpAcknowledge = "acknowledge"
+	clusterOpClear       = "clear"
+	clusterOpDelegate    = "delegate"
+	clusterOpSnooze      = "snooze"
+	clusterOpLock        = "lock"
+)
+
+// clusterInstance names this instance in cluster mode, empty otherwise
+var clusterInstance string
+
+// ClusterConfig runs the app as one of several instances sharing the board
+type ClusterConfig struct {
+	Redis       string        `yaml:"redis"`        // host:port of the Redis server shared by the instances
+	Password    string        `yaml:"password"`     // Redis password (optional)
+	Channel     string        `yaml:"channel"`      // Pub/sub channel and prefix of the Redis keys (optional, default: wake-me-up)
+	Instance    string        `yaml:"instance"`     // Name of this instance, unique in the cluster (optional, default: hostname-pid)
+	DedupWindow time.Duration `yaml:"dedup_window"` // Identical webhook deliveries within it are ingested once (optional, default: 30s)
+}
+
+// clusterOp is a change of the board an instance made, for the others to
+// apply
+type clusterOp struct {
+	Instance string          `json:"instance"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Payload  *WebhookPayload `json:"payload,omitempty"` // webhook
+	IDs      []string        `json:"ids,omitempty"`     // acknowledge, clear, delegate, snooze, and webhook by payload index
+	Actor    string          `json:"actor,omitempty"`   // acknowledge and snooze
+	Comment  string          `json:"comment,omitempty"` // acknowledge
+	Token    string          `json:"token,omitempty"`   // delegate
+	Until    *time.Time      `json:"until,omitempty"`   // snooze
+	Lock     *BoardLock      `json:"lock,omitempty"`    // lock, nil unlocking
+}
+
+// clusterLink connects the instance to the others, nil when running alone
+type clusterLink struct {
+	config ClusterConfig
+	client *redisClient
+	ops    chan clusterOp
+	leader atomic.Bool
+
+	mu         sync.Mutex
+	subscriber *redisConn
+	closed     bool
+}
+
+func newClusterLink(config *ClusterConfig) (*clusterLink, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Redis == "" {
+		return nil, fmt.Errorf("cluster: redis address is required")
+	}
+	c := &clusterLink{
+		config: *config,
+		client: &redisClient{addr: config.Redis, password: config.Password},
+		ops:    make(chan clusterOp, clusterOpBuffer),
+	}
+	if c.config.Channel == "" {
+		c.config.Channel = defaultClusterChannel
+	}
+	if c.config.Instance == "" {
+		hostname, _ := os.Hostname()
+		c.config.Instance = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if c.config.DedupWindow <= 0 {
+		c.config.DedupWindow = defaultDedupWindow
+	}
+	if _, err := c.client.do("PING"); err != nil {
+		return nil, fmt.Errorf("cluster: %v", err)
+	}
+	go c.subscribe()
+	go c.runLeaderLease()
+	return c, nil
+}
+
+// key returns a Redis key of the cluster
+func (c *clusterLink) key(name string) string {
+	return c.config.Channel + ":" + name
+}
+
+// publish sends a change of the board to the other instances
+func (c *clusterLink) publish(op clusterOp) {
+	if c == nil {
+		return
+	}
+	op.Instance = c.config.Instance
+	if op.Time.IsZero() {
+		op.Time = time.Now()
+	}
+	data, err := json.Marshal(op)
+	if err != nil {
+		log.Errorf("Cluster: failed to encode %s: %v", op.Type, err)
+		return
+	}
+	if _, err := c.client.do("PUBLISH", c.config.Channel, string(data)); err != nil {
+		clusterErrors.WithLabelValues("publish").Inc()
+		log.Errorf("Cluster: failed to publish %s to the other instances: %v", op.Type, err)
+	}
+}
+
+// subscribe receives the changes of the other instances, resubscribing when
+// the connection drops. Changes published meanwhile are missed; instances
+// catch up with the next webhook deliveries of the groups concerned.
+func (c *clusterLink) subscribe() {
+	for {
+		err := c.receive()
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+		clusterErrors.WithLabelValues("subscribe").Inc()
+		log.Errorf("Cluster: subscription lost, retrying in %s: %v", clusterResubscribeDelay, err)
+		time.Sleep(clusterResubscribeDelay)
+	}
+}
+
+// receive subscribes and queues the changes of other instances until the
+// connection fails
+func (c *clusterLink) receive() error {
+	conn, err := dialRedis(c.config.Redis, c.config.Password)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.subscriber = conn
+	c.mu.Unlock()
+
+	if err := conn.send("SUBSCRIBE", c.config.Channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := readRedisReply(conn.reader)
+		if err != nil {
+			return err
+		}
+		message, ok := reply.([]interface{})
+		if !ok || len(message) != 3 || message[0] != "message" {
+			continue
+		}
+		data, _ := message[2].(string)
+		var op clusterOp
+		if err := json.Unmarshal([]byte(data), &op); err != nil {
+			log.Warnf("Cluster: ignoring malformed message: %v", err)
+			continue
+		}
+		if op.Instance != c.config.Instance {
+			c.ops <- op
+		}
+	}
+}
+
+// saveBoardLock keeps the board lock in Redis for the instances starting
+// later, removing it when nil
+func (c *clusterLink) saveBoardLock(lock *BoardLock) {
+	if c == nil {
+		return
+	}
+	var err error
+	if lock == nil {
+		_, err = c.client.do("DEL", c.key("lock"))
+	} else if data, jsonErr := json.Marshal(lock); jsonErr != nil {
+		err = jsonErr
+	} else {
+		_, err = c.client.do("SET", c.key("lock"), string(data))
+	}
+	if err != nil {
+		clusterErrors.WithLabelValues("lock").Inc()
+		log.Errorf("Cluster: failed to save the board lock: %v", err)
+	}
+}
+
+// loadBoardLock returns the board lock kept in Redis, nil if unlocked
+func (c *clusterLink) loadBoardLock() (*BoardLock, error) {
+	reply, err := c.client.do("GET", c.key("lock"))
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, _ := reply.(string)
+	var lock BoardLock
+	if err := json.Unmarshal([]byte(data), &lock); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", c.key("lock"), err)
+	}
+	return &lock, nil
+}
+
+// runCluster applies the changes of the other instances
+func (a *AppState) runCluster() {
+	for op := range a.cluster.ops {
+		a.applyClusterOp(op)
+	}
+}
+
+// applyClusterOp applies a change another instance made. Changes already on
+// the board, e.g. from the snapshot loaded at start, are skipped.
+func (a *AppState) applyClusterOp(op clusterOp) {
+	log.Debugf("Cluster: applying %s from %s", op.Type, op.Instance)
+	switch op.Type {
+	case clusterOpWebhook:
+		if op.Payload != nil {
+			ids := op.IDs
+			if len(ids) != len(op.Payload.Alerts) {
+				// From an instance of an earlier version
+				ids = legacyEntryIDs(len(op.Payload.Alerts), op.Time)
+			}
+			a.ingest(*op.Payload, op.Time, ids, true)
+		}
+	case clusterOpAcknowledge:
+		a.acknowledge(op.IDs, nil, op.Actor, op.Comment)
+	case clusterOpClear:
+		cleared := make(map[string]bool, len(op.IDs))
+		for _, id := range op.IDs {
+			cleared[id] = true
+		}
+		a.mu.Lock()
+		a.clearAlerts(func(entry AlertEntry) bool { return cleared[entry.ID] })
+		a.mu.Unlock()
+		a.broadcastUpdate()
+	case clusterOpDelegate:
+		a.mu.Lock()
+		a.delegations[op.Token] = &Delegation{Token: op.Token, AlertIDs: op.IDs, CreatedAt: op.Time}
+		a.mu.Unlock()
+	case clusterOpSnooze:
+		for _, id := range op.IDs {
+			if op.Until != nil {
+				a.snooze(id, *op.Until, nil, op.Actor)
+			}
+		}
+	case clusterOpLock:
+		a.setBoardLock(op.Lock)
+	default:
+		log.Warnf("Cluster: ignoring unknown change %q from %s", op.Type, op.Instance)
+	}
+}
+
+// firstDelivery tells if a webhook payload wasn't delivered to any instance
+// within the dedup window, e.g. by a load balancer retrying elsewhere. If
+// Redis can't tell, the payload is ingested rather than lost.
+func (c *clusterLink) firstDelivery(payload WebhookPayload) bool {
+	if c == nil {
+		return true
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return true
+	}
+	sum := sha256.Sum256(data)
+	key := c.key("delivery:" + hex.EncodeToString(sum[:]))
+	reply, err := c.client.do("SET", key, c.config.Instance, "NX", "PX", strconv.FormatInt(c.config.DedupWindow.Milliseconds(), 10))
+	if err != nil {
+		clusterErrors.WithLabelValues("dedup").Inc()
+		log.Errorf("Cluster: failed to check for duplicate delivery: %v", err)
+		return true
+	}
+	return reply != nil
+}
+
+// leaderScript takes or renews the lease if it's free or already ours
+const leaderScript = `local holder = redis.call('GET', KEYS[1])
+if holder == false or holder == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+
+// releaseScript gives up the lease if it's ours
+const releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// runLeaderLease keeps taking or renewing the lease for the background
+// duties: escalations, polling Alertmanager and posting reports
+func (c *clusterLink) runLeaderLease() {
+	ticker := time.NewTicker(leaderRenewInterval)
+	defer ticker.Stop()
+	for {
+		c.renewLease()
+		<-ticker.C
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+	}
+}
+
+func (c *clusterLink) renewLease() {
+	reply, err := c.client.do("EVAL", leaderScript, "1", c.key("leader"), c.config.Instance,
+		strconv.FormatInt(leaderLeaseTTL.Milliseconds(), 10))
+	// Without Redis, instances can't agree on a leader; the duties rather
+	// run twice than not at all
+	leader := err != nil || reply == int64(1)
+	if err != nil {
+		clusterErrors.WithLabelValues("lease").Inc()
+		log.Errorf("Cluster: failed to renew the leader lease, acting as leader: %v", err)
+	}
+	if c.leader.Swap(leader) != leader {
+		if leader {
+			log.Infof("Cluster: %s is now the leader", c.config.Instance)
+		} else {
+			log.Infof("Cluster: %s is no longer the leader", c.config.Instance)
+		}
+	}
+}
+
+// isLeader tells if this instance runs the background duties, always true
+// when running alone
+func (c *clusterLink) isLeader() bool {
+	return c == nil || c.leader.Load()
+}
+
+// Close gives up the lease and disconnects
+func (c *clusterLink) Close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.closed = true
+	if c.subscriber != nil {
+		c.subscriber.Close()
+	}
+	c.mu.Unlock()
+	if c.leader.Load() {
+		c.client.do("EVAL", releaseScript, "1", c.key("leader"), c.config.Instance)
+	}
+	c.client.Close()
+}
+
+// redisStore keeps the board snapshot in Redis, for instances that start
+type redisStore struct {
+	client *redisClient
+	key    string
+}
+
+func openRedisStore(config *ClusterConfig) (*redisStore, error) {
+	if config == nil || config.Redis == "" {
+		return nil, fmt.Errorf("storage redis needs the cluster section")
+	}
+	channel := config.Channel
+	if channel == "" {
+		channel = defaultClusterChannel
+	}
+	return &redisStore{client: &redisClient{addr: config.Redis, password: config.Password}, key: channel + ":board"}, nil
+}
+
+func (s *redisStore) Load() (StoredBoard, error) {
+	board := StoredBoard{Acknowledged: make(map[string]*Acknowledgement)}
+	reply, err := s.client.do("GET", s.key)
+	if err != nil || reply == nil {
+		return board, err
+	}
+	data, _ := reply.(string)
+	if err := json.Unmarshal([]byte(data), &board); err != nil {
+		return board, fmt.Errorf("decoding %s: %w", s.key, err)
+	}
+	return board, nil
+}
+
+func (s *redisStore) Save(board StoredBoard) error {
+	data, err := json.Marshal(board)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.do("SET", s.key, string(data))
+	return err
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisReplies(t *testing.T) {
+	if got := string(encodeRedisCommand("SET", "key", "a b")); got != "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\na b\r\n" {
+		t.Errorf("Unexpected command encoding %q", got)
+	}
+
+	reader := bufio.NewReader(strings.NewReader("+OK\r\n$-1\r\n:1\r\n*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$4\r\n{\r\n}\r\n-ERR wrong\r\n"))
+	var replies []interface{}
+	for i := 0; i < 4; i++ {
+		reply, err := readRedisReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	want := []interface{}{"OK", nil, int64(1), []interface{}{"message", "ch", "{\r\n}"}}
+	if !reflect.DeepEqual(replies, want) {
+		t.Errorf("Expected %#v, got %#v", want, replies)
+	}
+	if _, err := readRedisReply(reader); err == nil || err.Error() != "redis: ERR wrong" {
+		t.Errorf("Expected the error reply, got %v", err)
+	}
+}
+
+func TestClusterOpsApplyOnce(t *testing.T) {
+	state := NewAppState(100)
+	received := time.Now()
+	op := clusterOp{Instance: "other", Type: clusterOpWebhook, Time: received, Payload: &WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+	}}}
+
+	// Replaying a delivery, e.g. one in the snapshot loaded at start, adds nothing
+	state.applyClusterOp(op)
+	state.applyClusterOp(op)
+	alerts := state.GetAlerts()
+	if len(alerts) != 2 {
+		t.Fatalf("Expected the 2 alerts once, got %d", len(alerts))
+	}
+	first, second := alerts[0].ID, alerts[1].ID
+
+	state.applyClusterOp(clusterOp{Type: clusterOpAcknowledge, IDs: []string{first}})
+	if !state.IsAcknowledged(first) || state.IsAcknowledged(second) {
+		t.Fatal("Expected the replicated acknowledgement applied")
+	}
+
+	state.applyClusterOp(clusterOp{Type: clusterOpClear, IDs: []string{first}})
+	if alerts := state.GetAlerts(); len(alerts) != 1 || alerts[0].ID != second {
+		t.Fatalf("Expected only the cleared alert removed, got %+v", alerts)
+	}
+
+	state.applyClusterOp(clusterOp{Type: clusterOpDelegate, Time: received, IDs: []string{second}, Token: "token"})
+	state.mu.RLock()
+	pending := state.pendingDelegatedAlerts(state.delegations["token"], received)
+	state.mu.RUnlock()
+	if len(pending) != 1 {
+		t.Fatalf("Expected the replicated delegation to cover the alert, got %+v", pending)
+	}
+
+	state.applyClusterOp(clusterOp{Type: clusterOpLock, Lock: &BoardLock{By: "alice", Reason: "db outage"}})
+	if lock := state.GetBoardLock(); lock == nil || lock.By != "alice" {
+		t.Fatalf("Expected the replicated board lock, got %+v", lock)
+	}
+	state.applyClusterOp(clusterOp{Type: clusterOpLock})
+	if state.GetBoardLock() != nil {
+		t.Fatal("Expected the replicated unlock")
+	}
+}
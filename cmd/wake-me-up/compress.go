@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Largest webhook body accepted after decompression, unless configured
+const defaultMaxWebhookBody = 10 << 20
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+	errUnsupportedContentType = errors.New("unsupported Content-Type, expected application/json")
+)
+
+// maxWebhookBody returns the configured webhook body limit
+func (a *AppState) maxWebhookBody() int64 {
+	if a.config != nil && a.config.MaxWebhookBody > 0 {
+		return a.config.MaxWebhookBody
+	}
+	return defaultMaxWebhookBody
+}
+
+// readWebhookBody reads a webhook body, decompressing gzip and deflate
+// encoded ones. Both the received and the decompressed size are limited, so a
+// small compressed body can't expand into an unbounded one.
+func readWebhookBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, errBodyTooLarge
+		}
+		return nil, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		ingestBytes.WithLabelValues("plain").Add(float64(len(raw)))
+		return raw, nil
+	}
+
+	body, err := decompress(encoding, raw, limit)
+	if err != nil {
+		// Proxies sometimes decompress the body but keep the header, so
+		// try once more with the body as it came in if it looks like JSON
+		if !errors.Is(err, errBodyTooLarge) && !errors.Is(err, errUnsupportedEncoding) && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			log.Debugf("Webhook body is not %s encoded as declared, reading it as plain", encoding)
+			ingestBytes.WithLabelValues("plain").Add(float64(len(raw)))
+			return raw, nil
+		}
+		return nil, err
+	}
+	ingestBytes.WithLabelValues("compressed").Add(float64(len(raw)))
+	ingestBytes.WithLabelValues("decompressed").Add(float64(len(body)))
+	return body, nil
+}
+
+// decompress decodes a body with the given Content-Encoding, reading at most
+// limit bytes of output
+func decompress(encoding string, raw []byte, limit int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(raw))
+	case "deflate":
+		// HTTP deflate is zlib wrapped, but raw deflate is common as well
+		reader, err = zlib.NewReader(bytes.NewReader(raw))
+		if errors.Is(err, zlib.ErrHeader) {
+			reader, err = flate.NewReader(bytes.NewReader(raw)), nil
+		}
+	default:
+		// The header value is logged rather than echoed back to the sender
+		log.Debugf("Webhook body has unsupported Content-Encoding %q", encoding)
+		return nil, errUnsupportedEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// bodyErrorStatus maps a readWebhookBody error to an HTTP status
+func bodyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
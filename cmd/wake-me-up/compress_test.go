@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressedWebhooks(t *testing.T) {
+	payload := `{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "Disk"}}]}`
+	compress := func(newWriter func(io.Writer) io.WriteCloser, body string) []byte {
+		var buf bytes.Buffer
+		writer := newWriter(&buf)
+		writer.Write([]byte(body))
+		writer.Close()
+		return buf.Bytes()
+	}
+	gzipWriter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zlibWriter := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	flateWriter := func(w io.Writer) io.WriteCloser {
+		writer, _ := flate.NewWriter(w, flate.BestCompression)
+		return writer
+	}
+	// Expands far past the limit, though it arrives well under it
+	bomb := compress(gzipWriter, `{"alerts": [], "padding": "`+strings.Repeat(" ", 1<<20)+`"}`)
+	if len(bomb) >= 32<<10 {
+		t.Fatalf("The compressed body is %d bytes, expected it under the limit", len(bomb))
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     int
+	}{
+		{"plain", "", []byte(payload), http.StatusOK},
+		{"gzip", "gzip", compress(gzipWriter, payload), http.StatusOK},
+		{"zlib deflate", "deflate", compress(zlibWriter, payload), http.StatusOK},
+		{"raw deflate", "deflate", compress(flateWriter, payload), http.StatusOK},
+		{"already decompressed by a proxy", "gzip", []byte(payload), http.StatusOK},
+		{"decompressed over the limit", "gzip", bomb, http.StatusRequestEntityTooLarge},
+		{"received over the limit", "", []byte(payload + strings.Repeat(" ", 64<<10)), http.StatusRequestEntityTooLarge},
+		{"unknown encoding", "br", []byte(payload), http.StatusUnsupportedMediaType},
+		{"corrupt gzip", "gzip", []byte("not gzip at all"), http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := NewAppState(100)
+			state.config = &Config{MaxWebhookBody: 32 << 10}
+			r := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			if test.encoding != "" {
+				r.Header.Set("Content-Encoding", test.encoding)
+			}
+			rec := httptest.NewRecorder()
+			webhookHandler(state)(rec, r)
+			if rec.Code != test.want {
+				t.Fatalf("Expected %d, got %d: %s", test.want, rec.Code, rec.Body.String())
+			}
+			if test.want == http.StatusOK && len(state.GetAlerts()) != 1 {
+				t.Errorf("Expected the alert on the board, got %d", len(state.GetAlerts()))
+			}
+		})
+	}
+}
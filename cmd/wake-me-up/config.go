@@ -1,29 +1,189 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	ListenPort          string   `yaml:"listen_port"`
-	LogLevel            string   `yaml:"log_level"`
-	SoundEffectFilePath string   `yaml:"sound_effect_file_path"`
-	WebhookAPIKey       string   `yaml:"webhook_api_key"` // API key for webhook authentication (optional)
-	AllowedIPs          []string `yaml:"allowed_ips"`     // IP whitelist (optional, empty = allow all)
-	RequireHTTPS        bool     `yaml:"require_https"`   // Require HTTPS (optional, default: false)
+	ListenPort            string                  `yaml:"listen_port"`
+	AdminListen           string                  `yaml:"admin_listen"`        // Address of the admin, debug and metrics endpoints, e.g. 127.0.0.1:9099 (optional, default: served on listen_port)
+	AlertMetricLabels     []string                `yaml:"alert_metric_labels"` // Alert labels splitting the alert metrics besides alertname, severity and state, e.g. [team, cluster] (optional)
+	LogLevel              string                  `yaml:"log_level"`
+	SoundEffectFilePath   string                  `yaml:"sound_effect_file_path"`
+	AssetDir              string                  `yaml:"asset_dir"`               // Base of relative static_dir, templates_dir and sound paths (optional, default: the executable's directory, then the working directory)
+	StaticDir             string                  `yaml:"static_dir"`              // Directory of the board's CSS and JS (optional, default: static)
+	ServerSound           bool                    `yaml:"server_sound"`            // Also play the alarm on the server host (optional, default: false)
+	ServerSoundInterval   time.Duration           `yaml:"server_sound_interval"`   // How often the server replays the alarm (optional, default: 30s)
+	GPIO                  *GPIOConfig             `yaml:"gpio"`                    // Status light on GPIO pins of the server host (optional)
+	MQTT                  *MQTTConfig             `yaml:"mqtt"`                    // Publish the board state to an MQTT broker for home automation (optional)
+	DataDir               string                  `yaml:"data_dir"`                // Directory for persisted state such as the banner (optional, empty = memory only)
+	Storage               string                  `yaml:"storage"`                 // Where alerts are kept: memory, sqlite, bolt or redis (optional, default: memory, redis with cluster)
+	StoragePath           string                  `yaml:"storage_path"`            // Database file of the storage (optional, default: alerts.db or alerts.bolt in data_dir)
+	WebhookAPIKey         string                  `yaml:"webhook_api_key"`         // API key for webhook authentication (optional)
+	AllowedIPs            []string                `yaml:"allowed_ips"`             // IP whitelist (optional, empty = allow all)
+	RequireHTTPS          bool                    `yaml:"require_https"`           // Require HTTPS (optional, default: false)
+	TLSCertFile           string                  `yaml:"tls_cert_file"`           // Serve HTTPS with this certificate, reloaded when it changes (optional)
+	TLSKeyFile            string                  `yaml:"tls_key_file"`            // Private key of tls_cert_file (optional)
+	TrustedProxies        []string                `yaml:"trusted_proxies"`         // Proxies whose X-Forwarded-For/X-Real-IP headers are honored (optional, empty = none)
+	AllowedOrigins        []string                `yaml:"allowed_origins"`         // Other websites that may use the board from a browser, "*" for any (optional, default: none)
+	BasicAuth             *BasicAuthConfig        `yaml:"basic_auth"`              // Credentials for the board and its API, not the webhooks (optional)
+	WebhookResponse       string                  `yaml:"webhook_response"`        // Webhook response body: text or json (optional, default: text)
+	MaxWebhookBody        int64                   `yaml:"max_webhook_body"`        // Largest webhook body in bytes, after decompression (optional, default: 10485760)
+	ContentTypeExceptions []string                `yaml:"content_type_exceptions"` // Receivers whose webhooks are accepted without Content-Type: application/json (optional)
+	AlertmanagerPoll      *AlertmanagerPollConfig `yaml:"alertmanager_poll"`       // Poll the Alertmanager API instead of or besides receiving webhooks (optional)
+	KubernetesEvents      *KubernetesEventsConfig `yaml:"kubernetes_events"`       // Alerts from the Warning events of a Kubernetes cluster (optional)
+	AlertRules            *AlertRulesConfig       `yaml:"alert_rules"`             // Prometheus alerting rules shown in the detail of their alerts (optional)
+	GenericWebhooks       []GenericWebhookConfig  `yaml:"generic_webhooks"`        // Mappings of other tools' JSON to alerts for /webhook/generic (optional)
+	LenientPayloads       bool                    `yaml:"lenient_payloads"`        // Accept numeric label values and missing or empty times from non-Alertmanager senders (optional, default: false)
+	LabelLimits           *LabelLimitsConfig      `yaml:"label_limits"`            // Trim alert labels over these limits at ingestion (optional, default: unlimited)
+
+	Environments *EnvironmentsConfig `yaml:"environments"` // Board tabs and sound policy by environment label (optional, tabs appear for the env label by default)
+
+	NetworkZones     []NetworkZoneConfig `yaml:"network_zones"`      // Tag webhooks with the zone of their source network (optional)
+	NetworkZoneLabel string              `yaml:"network_zone_label"` // Label the zone is stored in (optional, default: source_zone)
+
+	MDNS *MDNSConfig `yaml:"mdns"` // Advertise the board on the LAN as _wakemeup._tcp with mDNS/DNS-SD (optional)
+
+	Cluster *ClusterConfig `yaml:"cluster"` // Share the board with other instances behind a load balancer through Redis (optional)
+
+	ExternalURL   string `yaml:"external_url"`    // Public URL of the dashboard, used for links in notifications (optional)
+	AckLinkSecret string `yaml:"ack_link_secret"` // Key signing acknowledge links (optional, random per start if empty)
+
+	Email    *EmailConfig    `yaml:"email"`    // Send notification emails over SMTP (optional)
+	Slack    *SlackConfig    `yaml:"slack"`    // Post notifications to Slack, with acknowledge and snooze buttons (optional)
+	Telegram *TelegramConfig `yaml:"telegram"` // Send notifications to a Telegram chat through a bot (optional)
+	Pushover *PushoverConfig `yaml:"pushover"` // Push notifications to phones through Pushover (optional)
+	WebPush  *WebPushConfig  `yaml:"web_push"` // Push notifications of new firing alerts to browsers subscribed from the board (optional)
+
+	NotificationRoutes *NotificationRouteConfig `yaml:"notification_routes"` // Which notifiers get which alerts, like Alertmanager routes (optional, default: all notifiers get every alert)
+
+	Escalations       []EscalationConfig       `yaml:"escalations"`        // Actions for alerts left unacknowledged (optional)
+	EscalationActions map[string]*ActionConfig `yaml:"escalation_actions"` // Wake-on-LAN and smart plug actions by name (optional)
+	EscalationAlarm   *EscalationAlarmConfig   `yaml:"escalation_alarm"`   // Louder alarm on the dashboards for alerts left unacknowledged (optional)
+
+	SIEM     *SIEMConfig `yaml:"siem"`      // Stream audit events to a syslog/CEF receiver (optional)
+	AuditLog string      `yaml:"audit_log"` // File keeping audit events as a tamper-evident hash chain, see `wake-me-up audit verify` (optional)
+
+	WebSocket *WebSocketConfig `yaml:"websocket"` // WebSocket keepalive tuning (optional)
+
+	HistoryRetention    time.Duration `yaml:"history_retention"`     // How long alert history is kept for /api/history (optional, default: 168h)
+	HistoryMemoryEvents int           `yaml:"history_memory_events"` // History events kept in memory, older ones are spilled to compressed files in data_dir (optional, default: 10000)
+	HistoryDiskBudget   int64         `yaml:"history_disk_budget"`   // Bytes the spilled history may take, the oldest files are dropped beyond it (optional, default: 268435456)
+	TimelineRetention   time.Duration `yaml:"timeline_retention"`    // How long board state transitions are kept for /api/v1/timeline (optional, default: 2160h)
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // How long requests in flight may take to finish on SIGTERM/SIGINT (optional, default: 10s)
+
+	TombstoneRetention time.Duration `yaml:"tombstone_retention"` // How long removed alert IDs are kept for reconnecting clients (optional, default: 15m)
+
+	ReplicaDedupWindow time.Duration `yaml:"replica_dedup_window"` // Alerts delivered again by another Alertmanager replica within it are ingested once (optional, default: 0, disabled)
+	IngestThrottle     time.Duration `yaml:"ingest_throttle"`      // Deliveries of an alert group arriving within it of the last one ingested are merged and ingested once it has passed (optional, default: 0, disabled)
+
+	IDFormat string `yaml:"id_format"` // ulid, or timestamp for the UnixNano-index IDs of earlier versions (optional, default: ulid)
+
+	ResolvedRequiresAck bool `yaml:"resolved_requires_ack"` // Resolved alerts count as unacknowledged until acknowledged (optional, default: false)
+
+	RefireWindow        time.Duration `yaml:"refire_window"`          // Alerts firing again this soon after being resolved or cleared are marked re-fired (optional, default: 1h)
+	RefireSoundFilePath string        `yaml:"refire_sound_file_path"` // Sound played while re-fired alerts are unacknowledged (optional, default: sound_effect_file_path)
+
+	Severities map[string]*SeverityConfig `yaml:"severities"` // Sound and badge color by severity label value, e.g. critical (optional)
+
+	AllClear *AllClearConfig `yaml:"all_clear"` // Announce when the board goes green again (optional)
+
+	SoundPolicy *SoundPolicyConfig `yaml:"sound_policy"` // When browsers loop, play once or stop the alarm (optional, default: loop while unacknowledged)
+
+	IncidentChimeInterval time.Duration `yaml:"incident_chime_interval"` // How often alerts joining an open incident may chime (optional, default: 10m)
+
+	AgeThresholds []time.Duration `yaml:"age_thresholds"` // Ages after which unacknowledged alerts move up the board, e.g. [15m, 1h] (optional)
+
+	Buttons []ButtonConfig `yaml:"buttons"` // Hardware buttons and macro keys acknowledging or snoozing with one request (optional)
+
+	TimeFormat    string `yaml:"time_format"`    // Go layout for displayed times (optional, default: 2006-01-02 15:04:05)
+	TimeZone      string `yaml:"time_zone"`      // IANA zone for displayed times (optional, default: server zone)
+	RelativeTimes bool   `yaml:"relative_times"` // Show board times as "3m ago" (optional, default: false)
+
+	Handoff *HandoffConfig `yaml:"handoff"` // Shift handoff summary settings (optional)
+
+	SuppressionReport *SuppressionReportConfig `yaml:"suppression_report"` // Daily chat report of suppressed alerts (optional)
+
+	Stats *StatsConfig `yaml:"stats"` // Attribution of acknowledgements in /stats to people and teams (optional)
+
+	Browser *BrowserConfig `yaml:"browser"` // Page title, favicon and desktop notifications of the board (optional)
+
+	StatusThemes []StatusThemeConfig `yaml:"status_themes"` // Status text/color by labels of unacknowledged alerts, first match wins (optional)
+	Decorations  []DecorationConfig  `yaml:"decorations"`   // Icons/prefixes before alert names by labels, every match applies (optional)
+
+	TemplatesDir       string `yaml:"templates_dir"`        // Directory with template block overrides (optional, empty = built-in templates only)
+	TemplateLiveReload bool   `yaml:"template_live_reload"` // Reparse templates on every render, for developing overrides (optional, default: false)
+
+	Chaos *ChaosConfig `yaml:"chaos"` // Fault injection for resilience testing, never in production (optional)
 }
 
 func ParseConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Everything can be set from the environment instead
+		return finishConfig(&Config{})
+	}
 	if err != nil {
 		return nil, err
 	}
+	return parseConfigData(data)
+}
+
+// parseConfigData parses the contents of a config file
+func parseConfigData(data []byte) (*Config, error) {
 	config := &Config{}
-	err = yaml.NewDecoder(file).Decode(config)
+	err := yaml.NewDecoder(bytes.NewReader(data)).Decode(config)
 	if err != nil {
 		return nil, err
 	}
+	return finishConfig(config)
+}
+
+// finishConfig overlays environment variables and fills in defaults
+func finishConfig(config *Config) (*Config, error) {
+	if err := applyEnvOverrides(config, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	applyConfigDefaults(config)
 	return config, nil
 }
+
+// WebSocketConfig tunes the keepalive of dashboard connections
+type WebSocketConfig struct {
+	PingInterval time.Duration `yaml:"ping_interval"` // How often clients are pinged (default: 54s)
+	PongTimeout  time.Duration `yaml:"pong_timeout"`  // How long a client may go without answering a ping (default: 60s)
+	WriteTimeout time.Duration `yaml:"write_timeout"` // How long a single write may take, before size allowance (default: 10s)
+
+	MinThroughput   int  `yaml:"min_throughput"`    // Bytes per second added to write deadlines per message size (default: 32768)
+	TrimSlowClients bool `yaml:"trim_slow_clients"` // Send slow clients only the newest of queued updates (default: false)
+}
+
+// timing returns the configured keepalive settings, using defaults for unset ones
+func (c *WebSocketConfig) timing() wsTiming {
+	timing := defaultWSTiming
+	if c.PingInterval > 0 {
+		timing.pingInterval = c.PingInterval
+	}
+	if c.PongTimeout > 0 {
+		timing.pongTimeout = c.PongTimeout
+	}
+	if c.WriteTimeout > 0 {
+		timing.writeTimeout = c.WriteTimeout
+	}
+	if c.MinThroughput > 0 {
+		timing.minThroughput = c.MinThroughput
+	}
+	timing.trimSlowClients = c.TrimSlowClients
+	// Clients answer the previous ping just before the next one is sent
+	if timing.pongTimeout <= timing.pingInterval {
+		pongTimeout := timing.pingInterval + timing.pingInterval/9
+		log.Warnf("WebSocket pong_timeout %s must be longer than ping_interval %s, using %s", timing.pongTimeout, timing.pingInterval, pongTimeout)
+		timing.pongTimeout = pongTimeout
+	}
+	return timing
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix starts the environment variables that override config fields
+const envPrefix = "WAKE_ME_UP_"
+
+// Defaults for running without a config file
+const (
+	defaultListenPort          = "8080"
+	defaultLogLevel            = "info"
+	defaultSoundEffectFilePath = "sounds/siren1.wav"
+)
+
+// applyEnvOverrides sets config fields from environment variables named after
+// their YAML keys, nested keys joined with underscores: WAKE_ME_UP_LISTEN_PORT
+// for listen_port, WAKE_ME_UP_SLACK_WEBHOOK_URL for slack.webhook_url. Lists
+// of strings are comma separated, other lists and maps are given as YAML,
+// e.g. WAKE_ME_UP_AGE_THRESHOLDS='[15m, 1h]'.
+func applyEnvOverrides(config *Config, lookup func(string) (string, bool)) error {
+	_, err := overlayEnv(reflect.ValueOf(config).Elem(), envPrefix, lookup)
+	return err
+}
+
+// overlayEnv sets the fields of a struct from the environment and tells
+// whether any was set
+func overlayEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	set := false
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		target := v.Field(i)
+
+		if value, ok := lookup(name); ok {
+			if err := setFromEnv(target, value); err != nil {
+				return set, fmt.Errorf("%s: %v", name, err)
+			}
+			set = true
+			continue
+		}
+
+		// Sections are overridden field by field, and created when needed
+		sectionType := field.Type
+		if sectionType.Kind() == reflect.Ptr {
+			sectionType = sectionType.Elem()
+		}
+		if sectionType.Kind() != reflect.Struct || sectionType == reflect.TypeOf(time.Time{}) {
+			continue
+		}
+		section := reflect.New(sectionType).Elem()
+		if target.Kind() == reflect.Ptr {
+			if !target.IsNil() {
+				section.Set(target.Elem())
+			}
+		} else {
+			section.Set(target)
+		}
+		sectionSet, err := overlayEnv(section, name+"_", lookup)
+		if err != nil {
+			return set, err
+		}
+		if sectionSet {
+			if target.Kind() == reflect.Ptr {
+				target.Set(reflect.New(sectionType))
+				target.Elem().Set(section)
+			} else {
+				target.Set(section)
+			}
+			set = true
+		}
+	}
+	return set, nil
+}
+
+// setFromEnv parses an environment variable into a config field
+func setFromEnv(target reflect.Value, value string) error {
+	switch {
+	case target.Kind() == reflect.String:
+		// Taken as is, so API keys like 0x1F or 1e3 aren't read as numbers
+		target.SetString(value)
+		return nil
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		target.Set(list)
+		return nil
+	}
+	parsed := reflect.New(target.Type())
+	if err := yaml.UnmarshalStrict([]byte(value), parsed.Interface()); err != nil {
+		return err
+	}
+	target.Set(parsed.Elem())
+	return nil
+}
+
+// applyConfigDefaults fills in what a config file would usually set, so the
+// server also runs from environment variables alone
+func applyConfigDefaults(config *Config) {
+	if config.ListenPort == "" {
+		config.ListenPort = defaultListenPort
+	}
+	if config.LogLevel == "" {
+		config.LogLevel = defaultLogLevel
+	}
+	if config.SoundEffectFilePath == "" {
+		config.SoundEffectFilePath = defaultSoundEffectFilePath
+	}
+	if config.Cluster != nil && config.Storage == "" {
+		config.Storage = StorageRedis
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	config, err := parseConfigData([]byte("listen_port: \"9000\"\nwebhook_api_key: from-file\nslack:\n  snooze_for: 2h\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"WAKE_ME_UP_WEBHOOK_API_KEY":   "1e3",
+		"WAKE_ME_UP_ALLOWED_IPS":       "10.0.0.0/8, 192.168.1.5",
+		"WAKE_ME_UP_SHUTDOWN_TIMEOUT":  "30s",
+		"WAKE_ME_UP_SERVER_SOUND":      "true",
+		"WAKE_ME_UP_SLACK_WEBHOOK_URL": "https://hooks.example.com/x",
+		"WAKE_ME_UP_AGE_THRESHOLDS":    "[15m, 1h]",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := applyEnvOverrides(config, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ListenPort != "9000" {
+		t.Errorf("Expected listen_port from the file, got %q", config.ListenPort)
+	}
+	if config.WebhookAPIKey != "1e3" {
+		t.Errorf("Expected the API key as given, got %q", config.WebhookAPIKey)
+	}
+	if !reflect.DeepEqual(config.AllowedIPs, []string{"10.0.0.0/8", "192.168.1.5"}) {
+		t.Errorf("Unexpected allowed_ips %v", config.AllowedIPs)
+	}
+	if config.ShutdownTimeout != 30*time.Second || !config.ServerSound {
+		t.Errorf("Unexpected shutdown_timeout %v / server_sound %v", config.ShutdownTimeout, config.ServerSound)
+	}
+	if config.Slack == nil || config.Slack.WebhookURL != "https://hooks.example.com/x" || config.Slack.SnoozeFor != 2*time.Hour {
+		t.Errorf("Expected slack.webhook_url merged into the file's section, got %+v", config.Slack)
+	}
+	if len(config.AgeThresholds) != 2 {
+		t.Errorf("Unexpected age_thresholds %v", config.AgeThresholds)
+	}
+	if config.Email != nil {
+		t.Error("Expected sections without variables to stay unset")
+	}
+
+	env = map[string]string{"WAKE_ME_UP_SHUTDOWN_TIMEOUT": "soon"}
+	if err := applyEnvOverrides(config, lookup); err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
+
+func TestParseConfigWithoutFile(t *testing.T) {
+	t.Setenv("WAKE_ME_UP_LISTEN_PORT", "9100")
+	config, err := ParseConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ListenPort != "9100" || config.LogLevel != defaultLogLevel || config.SoundEffectFilePath != defaultSoundEffectFilePath {
+		t.Errorf("Unexpected config %+v", config)
+	}
+}
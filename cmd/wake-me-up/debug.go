@@ -0,0 +1,25 @@
+package main
+
+import (
+	"expvar"
+)
+
+// publishDebugVars exposes state sizes on /debug/vars. Importing expvar
+// registers that handler on the default mux, so no route is added here.
+func publishDebugVars(state *AppState) {
+	expvar.Publish("alerts", expvar.Func(func() interface{} {
+		state.mu.RLock()
+		defer state.mu.RUnlock()
+		return len(state.alerts)
+	}))
+	expvar.Publish("acknowledged", expvar.Func(func() interface{} {
+		state.mu.RLock()
+		defer state.mu.RUnlock()
+		return len(state.acknowledged)
+	}))
+	expvar.Publish("tombstones", expvar.Func(func() interface{} {
+		state.mu.RLock()
+		defer state.mu.RUnlock()
+		return len(state.tombstones)
+	}))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecorationConfig adds an icon and/or prefix text to the name of alerts
+// carrying all the labels of Match, e.g. team=db -> 🛢, so the board,
+// notifications and chat show the same visual cues
+type DecorationConfig struct {
+	Match  map[string]string `yaml:"match"`
+	Icon   string            `yaml:"icon"`   // Emoji or short symbol shown before the name (optional)
+	Prefix string            `yaml:"prefix"` // Text shown before the name, e.g. [DB] (optional)
+}
+
+// decorations are the rules configured at startup, every match applies
+var decorations []DecorationConfig
+
+// setDecorations checks and applies the decoration rules, so a typo fails at
+// startup
+func setDecorations(configs []DecorationConfig) error {
+	for i, decoration := range configs {
+		if len(decoration.Match) == 0 {
+			return fmt.Errorf("decoration %d: 'match' is empty", i+1)
+		}
+		if strings.TrimSpace(decoration.Icon) == "" && strings.TrimSpace(decoration.Prefix) == "" {
+			return fmt.Errorf("decoration %d: needs 'icon' or 'prefix'", i+1)
+		}
+	}
+	decorations = configs
+	return nil
+}
+
+// alertDecoration returns the icons and prefixes of the rules matching an
+// alert in config order, empty if none match
+func alertDecoration(alert Alert) string {
+	var parts []string
+	for _, decoration := range decorations {
+		if !labelsMatch(alert.Labels, decoration.Match) {
+			continue
+		}
+		for _, part := range []string{decoration.Icon, decoration.Prefix} {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// decorate puts the decoration of an alert before a name of it
+func decorate(alert Alert, name string) string {
+	if decoration := alertDecoration(alert); decoration != "" {
+		return decoration + " " + name
+	}
+	return name
+}
+
+// alertTitle is the decorated display name of an alert, for notifications
+func alertTitle(alert Alert) string {
+	return decorate(alert, alertDisplayName(alert))
+}
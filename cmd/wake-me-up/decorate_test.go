@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestAlertDecoration(t *testing.T) {
+	if err := setDecorations([]DecorationConfig{{Match: map[string]string{"team": "db"}}}); err == nil {
+		t.Fatal("Expected a decoration without icon or prefix refused")
+	}
+	err := setDecorations([]DecorationConfig{
+		{Match: map[string]string{"team": "db"}, Icon: "🛢"},
+		{Match: map[string]string{"severity": "critical"}, Icon: "🔥", Prefix: "[P1]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setDecorations(nil)
+
+	alert := Alert{Labels: map[string]string{"alertname": "ReplicaLag", "team": "db", "severity": "critical", "instance": "db-1"}}
+	if got := alertTitle(alert); got != "🛢 🔥 [P1] ReplicaLag on db-1" {
+		t.Errorf("Expected every matching rule applied in order, got %q", got)
+	}
+	alert.Labels["severity"] = "warning"
+	if got := alertDecoration(alert); got != "🛢" {
+		t.Errorf("Expected only the team icon, got %q", got)
+	}
+	if got := alertTitle(Alert{Labels: map[string]string{"alertname": "Other"}}); got != "Other" {
+		t.Errorf("Expected undecorated alerts unchanged, got %q", got)
+	}
+}
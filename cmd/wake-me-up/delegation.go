@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How long a delegated link works at most, even if its alerts keep firing
+const delegationMaxAge = 24 * time.Hour
+
+// Delegation lets an escalation target acknowledge the alerts that triggered
+// the escalation, and nothing else, through a link with a random token. The
+// link expires once none of its alerts awaits acknowledgement anymore.
+type Delegation struct {
+	Token     string
+	AlertIDs  []string
+	CreatedAt time.Time
+}
+
+// Delegate creates a delegation for alerts and returns the link to it, or an
+// empty string when no external URL is configured to build links with
+func (a *AppState) Delegate(alerts []AlertEntry, links *ackLinker) string {
+	if links == nil || links.baseURL == "" {
+		return ""
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Errorf("Failed to create delegated acknowledge link: %v", err)
+		return ""
+	}
+	delegation := &Delegation{Token: hex.EncodeToString(token), CreatedAt: time.Now()}
+	for _, entry := range alerts {
+		delegation.AlertIDs = append(delegation.AlertIDs, entry.ID)
+	}
+
+	a.mu.Lock()
+	a.delegations[delegation.Token] = delegation
+	a.mu.Unlock()
+	a.cluster.publish(clusterOp{Type: clusterOpDelegate, Time: delegation.CreatedAt, IDs: delegation.AlertIDs, Token: delegation.Token})
+	return fmt.Sprintf("%s/acknowledge/delegated?token=%s", links.baseURL, url.QueryEscape(delegation.Token))
+}
+
+// pendingDelegatedAlerts returns the alerts of a delegation still awaiting
+// acknowledgement, none once the delegation expired
+// This should be called while holding the lock
+func (a *AppState) pendingDelegatedAlerts(delegation *Delegation, now time.Time) []AlertEntry {
+	if now.Sub(delegation.CreatedAt) >= delegationMaxAge {
+		return nil
+	}
+	var pending []AlertEntry
+	for _, id := range delegation.AlertIDs {
+		if entry, ok := a.alertByID(id); ok && entry.Alert.Status == "firing" && a.acknowledged[id] == nil {
+			pending = append(pending, entry)
+		}
+	}
+	return pending
+}
+
+// pruneDelegations forgets the delegations whose escalation resolved
+// This should be called while holding the lock
+func (a *AppState) pruneDelegations(now time.Time) {
+	for token, delegation := range a.delegations {
+		if len(a.pendingDelegatedAlerts(delegation, now)) == 0 {
+			delete(a.delegations, token)
+		}
+	}
+}
+
+// delegatedAckPage lists the delegated alerts and asks for confirmation,
+// since link previews open links on their own
+var delegatedAckPage = template.Must(template.New("delegated-ack").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Wake me Up!</title>
+    <link rel="stylesheet" href="/static/style.css">
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            {{if .Done}}
+            <h1>✓ {{len .Alerts}} alert(s) acknowledged</h1>
+            {{else if .Alerts}}
+            <h1>Acknowledge {{len .Alerts}} escalated alert(s)?</h1>
+            {{else}}
+            <h1>Nothing left to acknowledge</h1>
+            <p>The escalation resolved, its alerts were acknowledged or are gone.</p>
+            {{end}}
+            <ul>
+                {{range .Alerts}}<li>{{.Name}}{{if .Severity}} ({{.Severity}}){{end}}</li>{{end}}
+            </ul>
+            {{if and .Alerts (not .Done)}}
+            <form method="POST">
+                <button class="ack-btn" type="submit">✓ Acknowledge</button>
+            </form>
+            {{end}}
+        </div>
+    </div>
+</body>
+</html>
+`))
+
+// delegatedAlert is an alert as listed on the delegated acknowledge page
+type delegatedAlert struct {
+	Name     string
+	Severity string
+}
+
+// delegatedAckHandler acknowledges the alerts of a delegation: GET lists
+// them, POST acknowledges the ones still pending
+func delegatedAckHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		state.mu.RLock()
+		delegation, ok := state.delegations[token]
+		var pending []AlertEntry
+		if ok {
+			pending = state.pendingDelegatedAlerts(delegation, time.Now())
+		}
+		state.mu.RUnlock()
+		if !ok {
+			audit.RecordRequest(r, AuditAuthFailure, 5, "Invalid delegated acknowledge link", nil)
+			http.Error(w, "Invalid or expired link", http.StatusForbidden)
+			return
+		}
+
+		done := r.Method == http.MethodPost && len(pending) > 0
+		// Acknowledging several alerts at once waits for the board lock
+		if done && len(pending) > 1 && refuseLocked(w, state) {
+			return
+		}
+		if done {
+			ids := make([]string, len(pending))
+			for i, entry := range pending {
+				ids[i] = entry.ID
+			}
+			state.AcknowledgeAll(ids, nil, requestActor(r, "escalation link"), "")
+			audit.RecordRequest(r, AuditAcknowledge, 3, "Alerts acknowledged via delegated link", map[string]string{"alertIds": strings.Join(ids, ",")})
+		}
+
+		alerts := make([]delegatedAlert, len(pending))
+		for i, entry := range pending {
+			alerts[i] = delegatedAlert{Name: alertTitle(entry.Alert), Severity: alertSeverity(entry.Alert)}
+		}
+		w.Header().Set("Content-Type", "text/html")
+		delegatedAckPage.Execute(w, struct {
+			Done   bool
+			Alerts []delegatedAlert
+		}{done, alerts})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelegatedAcknowledge(t *testing.T) {
+	state := NewAppState(100)
+	for _, id := range []string{"a", "b", "other"} {
+		state.alerts = append(state.alerts, AlertEntry{ID: id, Timestamp: time.Now(), Alert: Alert{
+			Status: "firing",
+			Labels: map[string]string{"alertname": "Alert " + id},
+		}})
+	}
+	links, err := newAckLinker("https://wake.example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := state.Delegate(state.alerts[:2], links)
+	if !strings.HasPrefix(link, "https://wake.example.com/acknowledge/delegated?token=") {
+		t.Fatalf("Unexpected link %q", link)
+	}
+	u, _ := url.Parse(link)
+	locked := state.Delegate(state.alerts[:2], links)
+
+	handler := delegatedAckHandler(state)
+	request := func(method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(method, target, nil))
+		return recorder
+	}
+
+	if code := request(http.MethodPost, "/acknowledge/delegated?token=guess").Code; code != http.StatusForbidden {
+		t.Fatalf("Expected 403 for an unknown token, got %d", code)
+	}
+
+	// Acknowledging several alerts waits for the board lock
+	state.SetBoardLock(&BoardLock{By: "alice"})
+	lockedURL, _ := url.Parse(locked)
+	if code := request(http.MethodPost, lockedURL.RequestURI()).Code; code != http.StatusLocked || state.IsAcknowledged("a") {
+		t.Fatalf("Expected 423 for several alerts while locked, got %d", code)
+	}
+	state.SetBoardLock(nil)
+
+	// An alert acknowledged elsewhere drops out of the delegation
+	state.Acknowledge("a", "")
+	page := request(http.MethodGet, u.RequestURI()).Body.String()
+	if !strings.Contains(page, "Alert b") || strings.Contains(page, "Alert a") || strings.Contains(page, "Alert other") {
+		t.Fatalf("Expected only the pending delegated alert listed, got %s", page)
+	}
+
+	request(http.MethodPost, u.RequestURI())
+	if !state.IsAcknowledged("b") || state.IsAcknowledged("other") {
+		t.Fatal("Expected only the delegated alerts to be acknowledged")
+	}
+
+	// Once the escalation resolved, the link expires
+	state.mu.Lock()
+	state.pruneDelegations(time.Now())
+	state.mu.Unlock()
+	if code := request(http.MethodPost, u.RequestURI()).Code; code != http.StatusForbidden {
+		t.Fatalf("Expected 403 after the escalation resolved, got %d", code)
+	}
+
+	if state.Delegate(state.alerts, &ackLinker{}) != "" {
+		t.Error("Expected no link without an external URL")
+	}
+}
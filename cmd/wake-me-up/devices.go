@@ -0,0 +1,457 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const devicesFile = "devices.json"
+
+// deviceScheduleInterval is how often mute schedules are checked for devices
+// becoming muted or unmuted
+const deviceScheduleInterval = 10 * time.Second
+
+// Device is a named client device, identified by the token it stores locally
+type Device struct {
+	Token        string    `json:"token"`
+	Name         string    `json:"name"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	LastSeen     time.Time `json:"lastSeen"`
+
+	MuteSchedule *ActiveTimeConfig `json:"muteSchedule,omitempty"` // when the device never sounds, in the configured time_zone
+}
+
+// DeviceRegistry keeps the registered devices, persisted to the data directory
+type DeviceRegistry struct {
+	mu        sync.RWMutex
+	devices   map[string]*Device     // token -> device
+	schedules map[string]*activeTime // token -> parsed mute schedule
+	path      string                 // empty = memory only
+}
+
+func newDeviceRegistry() *DeviceRegistry {
+	return &DeviceRegistry{devices: make(map[string]*Device), schedules: make(map[string]*activeTime)}
+}
+
+// Load restores the registered devices from a file and keeps it up to date
+func (d *DeviceRegistry) Load(path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.path = path
+	var devices []*Device
+	if _, err := loadJSON(path, &devices); err != nil {
+		return err
+	}
+	for _, device := range devices {
+		d.devices[device.Token] = device
+		if device.MuteSchedule == nil {
+			continue
+		}
+		schedule, err := parseActiveTime(device.MuteSchedule)
+		if err != nil {
+			log.Errorf("Ignoring the mute schedule of device %q: %v", device.Name, err)
+			device.MuteSchedule = nil
+			continue
+		}
+		d.schedules[device.Token] = schedule
+	}
+	return nil
+}
+
+// save persists the registry
+// This should be called while holding the lock
+func (d *DeviceRegistry) save() {
+	if d.path == "" {
+		return
+	}
+	devices := make([]*Device, 0, len(d.devices))
+	for _, device := range d.devices {
+		devices = append(devices, device)
+	}
+	if err := saveJSON(d.path, devices); err != nil {
+		log.Errorf("Failed to persist devices: %v", err)
+	}
+}
+
+// Register names a device, creating a new token unless a known one is given
+func (d *DeviceRegistry) Register(token, name string) (Device, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	device, exists := d.devices[token]
+	if !exists {
+		newToken, err := newDeviceToken()
+		if err != nil {
+			return Device{}, err
+		}
+		device = &Device{Token: newToken, RegisteredAt: now}
+		d.devices[newToken] = device
+	}
+	device.Name = name
+	device.LastSeen = now
+	d.save()
+
+	return *device, nil
+}
+
+// Remove forgets a device
+func (d *DeviceRegistry) Remove(token string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.devices[token]; !exists {
+		return false
+	}
+	delete(d.devices, token)
+	delete(d.schedules, token)
+	d.save()
+	return true
+}
+
+// SetMuteSchedule sets when a device never sounds, or clears it if nil
+func (d *DeviceRegistry) SetMuteSchedule(token string, schedule *ActiveTimeConfig) (Device, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	device, exists := d.devices[token]
+	if !exists {
+		return Device{}, false, nil
+	}
+	if schedule == nil {
+		delete(d.schedules, token)
+	} else {
+		parsed, err := parseActiveTime(schedule)
+		if err != nil {
+			return Device{}, true, err
+		}
+		d.schedules[token] = parsed
+	}
+	device.MuteSchedule = schedule
+	d.save()
+	return *device, true, nil
+}
+
+// Muted tells if the schedule of a device mutes it at a time
+func (d *DeviceRegistry) Muted(token string, now time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	schedule, ok := d.schedules[token]
+	return ok && schedule.contains(now)
+}
+
+// MutedDevices returns the tokens of the devices muted at a time
+func (d *DeviceRegistry) MutedDevices(now time.Time) map[string]bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var muted map[string]bool
+	for token, schedule := range d.schedules {
+		if schedule.contains(now) {
+			if muted == nil {
+				muted = make(map[string]bool)
+			}
+			muted[token] = true
+		}
+	}
+	return muted
+}
+
+// Touch marks a device as seen, returning false if the token is unknown
+func (d *DeviceRegistry) Touch(token string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	device, exists := d.devices[token]
+	if exists {
+		device.LastSeen = time.Now()
+	}
+	return exists
+}
+
+// Get returns a device by token
+func (d *DeviceRegistry) Get(token string) (Device, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	device, exists := d.devices[token]
+	if !exists {
+		return Device{}, false
+	}
+	return *device, true
+}
+
+// List returns the registered devices sorted by name
+func (d *DeviceRegistry) List() []Device {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	devices := make([]Device, 0, len(d.devices))
+	for _, device := range d.devices {
+		devices = append(devices, *device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+	return devices
+}
+
+func newDeviceToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// connectedClients lists the connected clients with their device names
+func (a *AppState) connectedClients() []ClientInfo {
+	clients := a.hub.listClients()
+	for i := range clients {
+		if device, ok := a.devices.Get(clients[i].DeviceToken); ok {
+			clients[i].DeviceName = device.Name
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients
+}
+
+// DeviceStatus is a registered device with its number of connected clients
+type DeviceStatus struct {
+	Device
+	Connections int  `json:"connections"`
+	Muted       bool `json:"muted"` // by its mute schedule, right now
+}
+
+// deviceStatuses lists the registered devices with their connection counts
+func (a *AppState) deviceStatuses() []DeviceStatus {
+	connections := make(map[string]int)
+	for _, client := range a.hub.listClients() {
+		connections[client.DeviceToken]++
+	}
+
+	devices := a.devices.List()
+	muted := a.devices.MutedDevices(time.Now())
+	statuses := make([]DeviceStatus, len(devices))
+	for i, device := range devices {
+		statuses[i] = DeviceStatus{Device: device, Connections: connections[device.Token], Muted: muted[device.Token]}
+	}
+	return statuses
+}
+
+// registerDeviceHandler registers or renames a device
+func registerDeviceHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Token string `json:"token"`
+			Name  string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Missing 'name'", http.StatusBadRequest)
+			return
+		}
+
+		device, err := state.devices.Register(req.Token, req.Name)
+		if err != nil {
+			log.Errorf("Error registering device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Infof("Device registered: %q", device.Name)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(device)
+	}
+}
+
+// mutedSound is the sound directive for the clients of a muted device
+func mutedSound(sound *SoundDirective) *SoundDirective {
+	if sound == nil || sound.Action == SoundStop {
+		return sound
+	}
+	muted := *sound
+	muted.Action, muted.Interval, muted.Reason = SoundStop, 0, "device_schedule"
+	return &muted
+}
+
+// audible is a broadcast for the clients of the devices not muted right now,
+// e.g. a chime
+func (a *AppState) audible(message []byte) hubMessage {
+	return hubMessage{message: message, mutedDevices: a.devices.MutedDevices(time.Now())}
+}
+
+// sendDeviceUpdate sends the clients of a device a full update, after its
+// mute schedule changed or it became muted or unmuted
+func (a *AppState) sendDeviceUpdate(token string) {
+	a.mu.RLock()
+	since := a.seq
+	a.mu.RUnlock()
+	update, err := a.buildUpdate(since, token)
+	if err != nil {
+		log.Errorf("Error marshaling update message: %v", err)
+		return
+	}
+	a.hub.sendToDevice(token, update)
+}
+
+// runDeviceSchedules sends an update to the clients of the devices whose mute
+// schedule starts or ends
+func (a *AppState) runDeviceSchedules(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	muted := a.devices.MutedDevices(time.Now())
+	for range ticker.C {
+		now := a.devices.MutedDevices(time.Now())
+		for token := range now {
+			if !muted[token] {
+				a.sendDeviceUpdate(token)
+			}
+		}
+		for token := range muted {
+			if !now[token] {
+				a.sendDeviceUpdate(token)
+			}
+		}
+		muted = now
+	}
+}
+
+// devicesHandler lists (GET), sets the mute schedule of (PUT ?token= with
+// {"muteSchedule": ...}, null to clear) or removes (DELETE ?token=)
+// registered devices
+func devicesHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.deviceStatuses())
+
+		case http.MethodPut:
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				http.Error(w, "Missing 'token' parameter", http.StatusBadRequest)
+				return
+			}
+			var req struct {
+				MuteSchedule *ActiveTimeConfig `json:"muteSchedule"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			device, found, err := state.devices.SetMuteSchedule(token, req.MuteSchedule)
+			if !found {
+				http.Error(w, "Device not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Invalid 'muteSchedule': "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Infof("Mute schedule of device %q updated", device.Name)
+			state.sendDeviceUpdate(token)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(device)
+
+		case http.MethodDelete:
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				http.Error(w, "Missing 'token' parameter", http.StatusBadRequest)
+				return
+			}
+			if !state.devices.Remove(token) {
+				http.Error(w, "Device not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// testSoundHandler plays the alarm sound once on a single device
+func testSoundHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		device, ok := state.devices.Get(token)
+		if !ok {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		message, _ := json.Marshal(map[string]string{"type": "test-sound"})
+		delivered := state.hub.sendToDevice(token, message)
+		if delivered == 0 {
+			http.Error(w, fmt.Sprintf("Device %q is not connected", device.Name), http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("Test sound sent to %d client(s)", delivered)))
+	}
+}
+
+// clientsHandler lists the connected WebSocket clients
+func clientsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.connectedClients())
+	}
+}
+
+// ClientsTemplateData holds the data for rendering the clients admin view
+type ClientsTemplateData struct {
+	Clients []ClientInfo
+	Devices []DeviceStatus
+	Lock    *BoardLock
+}
+
+// clientsPageHandler renders the clients admin view
+func clientsPageHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := ClientsTemplateData{
+			Clients: state.connectedClients(),
+			Devices: state.deviceStatuses(),
+			Lock:    state.GetBoardLock(),
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := state.templates.Execute(w, "clients.html", data); err != nil {
+			log.Errorf("Error executing template: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
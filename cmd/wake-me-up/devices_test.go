@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceMuteSchedule(t *testing.T) {
+	state := NewAppState(100)
+	device, err := state.devices.Register("", "Bedroom tablet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(token, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		devicesHandler(state)(rec, httptest.NewRequest(http.MethodPut, "/api/v1/devices?token="+token, strings.NewReader(body)))
+		return rec
+	}
+	if rec := put("unknown", `{"muteSchedule": {"start": "22:00"}}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown device refused, got %d", rec.Code)
+	}
+	if rec := put(device.Token, `{"muteSchedule": {"start": "22:00", "days": ["someday"]}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid schedule refused, got %d", rec.Code)
+	}
+	if rec := put(device.Token, `{"muteSchedule": {"start": "22:00", "end": "07:00"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the schedule set, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	night := time.Date(2026, 10, 12, 23, 0, 0, 0, timeFormat.location)
+	day := time.Date(2026, 10, 12, 12, 0, 0, 0, timeFormat.location)
+	if !state.devices.Muted(device.Token, night) || state.devices.Muted(device.Token, day) {
+		t.Error("Expected the device muted at night only")
+	}
+	if muted := state.devices.MutedDevices(night); !muted[device.Token] || len(muted) != 1 {
+		t.Errorf("Expected the device in the muted devices, got %v", muted)
+	}
+
+	// The personalized update of a muted device stops the sound
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Disk"}}}})
+	put(device.Token, `{"muteSchedule": {}}`) // all day, every day
+	var update UpdateMessage
+	data, _ := state.buildUpdate(0, device.Token)
+	json.Unmarshal(data, &update)
+	if update.Sound == nil || update.Sound.Action != SoundStop || update.Sound.Reason != "device_schedule" {
+		t.Errorf("Expected the sound stopped on the muted device, got %+v", update.Sound)
+	}
+	data, _ = state.buildUpdate(0, "")
+	update = UpdateMessage{}
+	json.Unmarshal(data, &update)
+	if update.Sound == nil || update.Sound.Action == SoundStop {
+		t.Errorf("Expected the sound on other clients, got %+v", update.Sound)
+	}
+	if chime := state.audible([]byte(`{"type":"chime"}`)); !chime.mutedDevices[device.Token] || chime.muted != nil {
+		t.Errorf("Expected the chime skipped on the muted device, got %+v", chime)
+	}
+
+	if rec := put(device.Token, `{"muteSchedule": null}`); rec.Code != http.StatusOK || state.devices.Muted(device.Token, night) {
+		t.Errorf("Expected the schedule cleared, got %d", rec.Code)
+	}
+}
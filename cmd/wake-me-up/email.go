@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+const defaultEmailBatchWindow = time.Minute
+
+// EmailConfig configures the SMTP notifier
+type EmailConfig struct {
+	SMTPHost    string        `yaml:"smtp_host"`
+	SMTPPort    int           `yaml:"smtp_port"` // default: 587, or 465 with tls: implicit
+	Username    string        `yaml:"username"`  // optional, enables SMTP AUTH PLAIN
+	Password    string        `yaml:"password"`  // optional
+	From        string        `yaml:"from"`
+	To          []string      `yaml:"to"`
+	TLS         string        `yaml:"tls"`          // starttls (default), implicit or none
+	BatchWindow time.Duration `yaml:"batch_window"` // events within this window are sent as one email (default: 1m)
+
+	Subject        string `yaml:"subject"`         // Go template of the subject, executed with the batch (optional, default: the alert count, or the kind and name of a single alert)
+	Body           string `yaml:"body"`            // Go template of the HTML body, executed with the batch (optional, default: a card per alert)
+	NotifyResolved bool   `yaml:"notify_resolved"` // Also email when firing alerts resolve (optional, default: false)
+}
+
+// emailNotifier sends HTML emails, batching events that arrive within the
+// batch window into a single message to avoid mail storms
+type emailNotifier struct {
+	config  *EmailConfig
+	links   *ackLinker
+	from    string                 // envelope sender, the address of config.From
+	to      []string               // envelope recipients, the addresses of config.To
+	subject *texttemplate.Template // nil for the default subject
+	body    *template.Template
+
+	mu      sync.Mutex
+	pending []NotificationEvent
+	timer   *time.Timer
+}
+
+func newEmailNotifier(config *EmailConfig, links *ackLinker) (*emailNotifier, error) {
+	if config.SMTPHost == "" {
+		return nil, fmt.Errorf("missing smtp_host")
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("missing from or to addresses")
+	}
+	switch config.TLS {
+	case "":
+		config.TLS = "starttls"
+	case "starttls", "implicit", "none":
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q", config.TLS)
+	}
+	if config.SMTPPort == 0 {
+		config.SMTPPort = 587
+		if config.TLS == "implicit" {
+			config.SMTPPort = 465
+		}
+	}
+	if config.BatchWindow <= 0 {
+		config.BatchWindow = defaultEmailBatchWindow
+	}
+
+	e := &emailNotifier{config: config, links: links, body: emailTemplate}
+	// The headers keep the display names, the SMTP envelope takes bare addresses
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	e.from = from.Address
+	for _, to := range config.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("to %q: %v", to, err)
+		}
+		e.to = append(e.to, address.Address)
+	}
+	if config.Subject != "" {
+		subject, err := texttemplate.New("subject").Option("missingkey=zero").Parse(config.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("subject: %v", err)
+		}
+		e.subject = subject
+	}
+	if config.Body != "" {
+		body, err := template.New("body").Option("missingkey=zero").Parse(config.Body)
+		if err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+		e.body = body
+	}
+
+	// Fail at startup rather than on the first alert
+	example := NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{{ID: "example", Alert: Alert{Status: "firing", Labels: map[string]string{"alertname": "Example"}}}}}
+	if _, _, err := e.render([]NotificationEvent{example}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *emailNotifier) Name() string {
+	return "email"
+}
+
+// Wants takes resolutions only with notify_resolved
+func (e *emailNotifier) Wants(kind string) bool {
+	return kind != EventResolved || e.config.NotifyResolved
+}
+
+// Notify queues the event; the batch is sent when the window closes
+func (e *emailNotifier) Notify(event NotificationEvent) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending = append(e.pending, event)
+	if e.timer == nil {
+		e.timer = time.AfterFunc(e.config.BatchWindow, e.flush)
+	}
+	return nil
+}
+
+// flush sends the pending events as one email
+func (e *emailNotifier) flush() {
+	e.mu.Lock()
+	events := e.pending
+	e.pending = nil
+	e.timer = nil
+	e.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	if err := e.send(events); err != nil {
+		log.Errorf("Failed to send notification email: %v", err)
+	}
+}
+
+// emailAlert is a single alert as rendered in the email templates
+type emailAlert struct {
+	Kind        string // firing, resolved, escalated or follow-up
+	Name        string // alert name and instance, decorated
+	AlertName   string
+	Status      string
+	Note        string
+	Severity    string
+	Labels      map[string]string
+	Annotations map[string]string
+	StartsAt    string
+	EndsAt      string // of resolved alerts
+	AckLink     string
+	SourceURL   string
+}
+
+// emailData is what the email templates are executed with
+type emailData struct {
+	Alerts   []emailAlert
+	AllClear string // set when the batch ends with the board green again
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, 'Segoe UI', Roboto, sans-serif; color: #333;">
+    <h2 style="color: #764ba2;">🚨 Wake me Up!</h2>
+    {{range .Alerts}}
+    <div style="border-left: 4px solid {{if or (eq .Kind "firing") (eq .Kind "escalated")}}#ff4444{{else if eq .Kind "resolved"}}#44bb44{{else}}#ffc107{{end}}; background: #f8f9fa; padding: 12px 15px; margin: 12px 0; border-radius: 5px;">
+        <div style="font-size: 16px; font-weight: bold;">{{if .Name}}{{.Name}}{{else}}Unnamed alert{{end}}</div>
+        <div style="font-size: 12px; color: #666; margin: 4px 0;">{{.Kind}}{{if .Severity}} · {{.Severity}}{{end}} · started {{.StartsAt}}{{if .EndsAt}} · resolved {{.EndsAt}}{{end}}</div>
+        {{if .Note}}<div style="margin: 8px 0; font-style: italic;">“{{.Note}}”</div>{{end}}
+        <div style="margin: 8px 0;">
+            {{range $key, $value := .Labels}}<span style="display: inline-block; background: #e9ecef; padding: 2px 6px; border-radius: 4px; font-size: 11px; font-family: monospace; margin: 2px;">{{$key}}={{$value}}</span>{{end}}
+        </div>
+        {{if .AckLink}}<a href="{{.AckLink}}" style="display: inline-block; background: #ff9800; color: white; padding: 6px 12px; border-radius: 5px; text-decoration: none; font-weight: bold;">✓ Acknowledge</a>{{end}}
+        {{if .SourceURL}}<a href="{{.SourceURL}}" style="margin-left: 10px; font-size: 12px;">Source</a>{{end}}
+    </div>
+    {{end}}
+    {{if .AllClear}}<div style="border-left: 4px solid #44bb44; background: #f8f9fa; padding: 12px 15px; margin: 12px 0; border-radius: 5px; font-size: 16px; font-weight: bold;">✅ {{.AllClear}}</div>{{end}}
+</body>
+</html>
+`))
+
+// render builds the subject and HTML body for a batch of events
+func (e *emailNotifier) render(events []NotificationEvent) (string, string, error) {
+	var alerts []emailAlert
+	var allClear string
+	for _, event := range events {
+		if event.Kind == EventAllClear {
+			allClear = event.Note
+			continue
+		}
+		if event.Kind == EventFiring {
+			// Not green anymore
+			allClear = ""
+		}
+		for _, entry := range event.Alerts {
+			name := entry.Alert.Labels["alertname"]
+			if name != "" {
+				name = decorate(entry.Alert, name)
+			}
+			alert := emailAlert{
+				Kind:        event.Kind,
+				Name:        name,
+				AlertName:   entry.Alert.Labels["alertname"],
+				Status:      entry.Alert.Status,
+				Note:        event.Note,
+				Severity:    alertSeverity(entry.Alert),
+				Labels:      entry.Alert.Labels,
+				Annotations: entry.Alert.Annotations,
+				StartsAt:    timeFormat.Absolute(entry.Alert.StartsAt),
+				SourceURL:   entry.Alert.GeneratorURL,
+			}
+			if entry.Alert.EndsAt != nil && event.Kind == EventResolved {
+				alert.EndsAt = timeFormat.Absolute(*entry.Alert.EndsAt)
+			}
+			if event.Kind != EventResolved {
+				alert.AckLink = e.links.Link(entry.ID)
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	data := emailData{Alerts: alerts, AllClear: allClear}
+
+	subject := fmt.Sprintf("[Wake me Up] %d alert(s) need attention", len(alerts))
+	if len(alerts) == 1 && alerts[0].Name != "" {
+		subject = fmt.Sprintf("[Wake me Up] %s: %s", strings.ToUpper(alerts[0].Kind), alerts[0].Name)
+	}
+	if len(alerts) == 0 && allClear != "" {
+		subject = "[Wake me Up] " + allClear
+	}
+	if e.subject != nil {
+		var custom strings.Builder
+		if err := e.subject.Execute(&custom, data); err != nil {
+			return "", "", fmt.Errorf("subject: %v", err)
+		}
+		// A header holds a single line
+		subject = strings.Join(strings.Fields(custom.String()), " ")
+	}
+
+	var body bytes.Buffer
+	if err := e.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("body: %v", err)
+	}
+	return subject, body.String(), nil
+}
+
+func (e *emailNotifier) send(events []NotificationEvent) error {
+	subject, body, err := e.render(events)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	return e.deliver(msg.Bytes())
+}
+
+// deliver sends a raw message over SMTP using the configured TLS mode
+func (e *emailNotifier) deliver(msg []byte) error {
+	addr := net.JoinHostPort(e.config.SMTPHost, fmt.Sprint(e.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: e.config.SMTPHost}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if e.config.TLS == "implicit" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, e.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.config.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.config.Username != "" {
+		auth := smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailTemplates(t *testing.T) {
+	config := &EmailConfig{
+		SMTPHost: "smtp.example.com",
+		From:     "alerts@example.com",
+		To:       []string{"oncall@example.com"},
+		Subject: `{{range .Alerts}}[{{.Kind}}] {{.AlertName}} on {{.Labels.instance}}
+{{end}}`,
+		Body: `{{range .Alerts}}<p>{{.Annotations.summary}}{{if .EndsAt}} until {{.EndsAt}}{{end}}</p>{{end}}`,
+	}
+	email, err := newEmailNotifier(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Wants(EventResolved) || !email.Wants(EventEscalated) {
+		t.Error("Expected resolutions emailed only with notify_resolved")
+	}
+
+	endsAt := time.Date(2026, 10, 15, 14, 0, 0, 0, time.Local)
+	alert := Alert{
+		Status:      "resolved",
+		Labels:      map[string]string{"alertname": "Disk", "instance": "db-1"},
+		Annotations: map[string]string{"summary": "<97%> full"},
+		EndsAt:      &endsAt,
+	}
+	subject, body, err := email.render([]NotificationEvent{{Kind: EventResolved, Alerts: []AlertEntry{{ID: "1", Alert: alert}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[resolved] Disk on db-1" {
+		t.Errorf("Expected the subject template on one line, got %q", subject)
+	}
+	if body != "<p>&lt;97%&gt; full until "+timeFormat.Absolute(endsAt)+"</p>" {
+		t.Errorf("Expected the body template with annotations escaped, got %q", body)
+	}
+
+	_, body, err = (&emailNotifier{config: config, body: emailTemplate}).render([]NotificationEvent{{Kind: EventResolved, Alerts: []AlertEntry{{ID: "1", Alert: alert}}}})
+	if err != nil || !strings.Contains(body, "instance=db-1") || !strings.Contains(body, "#44bb44") {
+		t.Errorf("Expected the default body with labels and a green card, got %v %q", err, body)
+	}
+
+	config.Body = "{{.Missing"
+	if _, err := newEmailNotifier(config, nil); err == nil {
+		t.Error("Expected an invalid template rejected")
+	}
+}
+
+func TestEmailEnvelopeAddresses(t *testing.T) {
+	e, err := newEmailNotifier(&EmailConfig{
+		SMTPHost: "smtp.example.com",
+		From:     "Wake me Up <alerts@example.com>",
+		To:       []string{"On call <oncall@example.com>", "ops@example.com"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.from != "alerts@example.com" || len(e.to) != 2 || e.to[0] != "oncall@example.com" || e.to[1] != "ops@example.com" {
+		t.Errorf("Expected bare envelope addresses, got %q %q", e.from, e.to)
+	}
+
+	if _, err := newEmailNotifier(&EmailConfig{SMTPHost: "smtp.example.com", From: "alerts@example.com", To: []string{"not an address"}}, nil); err == nil {
+		t.Error("Expected an invalid recipient refused")
+	}
+}
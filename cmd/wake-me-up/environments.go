@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+const defaultEnvironmentLabel = "env"
+
+// Sound policies of an environment
+const (
+	SoundAlways = "always" // unacknowledged alerts sound on every board
+	SoundTab    = "tab"    // only on boards showing the environment's tab
+	SoundNever  = "never"  // never sound, the alerts are only shown
+)
+
+// EnvironmentsConfig splits the board into tabs by an environment label, so
+// one instance can serve prod next to noisier environments
+type EnvironmentsConfig struct {
+	Label string            `yaml:"label"` // Label holding the environment (optional, default: env)
+	Order []string          `yaml:"order"` // Tab order, e.g. [prod, staging, dev]; others follow alphabetically (optional)
+	Sound map[string]string `yaml:"sound"` // Sound policy by environment: always, tab or never (optional, default: always)
+}
+
+// EnvironmentTab is an environment on the board with its alert counts
+type EnvironmentTab struct {
+	Name           string `json:"name"` // empty for alerts without the label
+	Total          int    `json:"total"`
+	Unacknowledged int    `json:"unacknowledged"` // firing and not acknowledged
+	Sound          string `json:"sound"`
+}
+
+// validateEnvironments checks the sound policies, so a typo fails at startup
+func validateEnvironments(config *EnvironmentsConfig) error {
+	if config == nil {
+		return nil
+	}
+	for env, policy := range config.Sound {
+		switch policy {
+		case SoundAlways, SoundTab, SoundNever:
+		default:
+			return fmt.Errorf("environments: unknown sound policy %q for %s", policy, env)
+		}
+	}
+	return nil
+}
+
+// environmentLabel returns the label alerts are split into tabs by
+func (a *AppState) environmentLabel() string {
+	if a.config != nil && a.config.Environments != nil && a.config.Environments.Label != "" {
+		return a.config.Environments.Label
+	}
+	return defaultEnvironmentLabel
+}
+
+// environmentSound returns the sound policy of an environment
+func (a *AppState) environmentSound(env string) string {
+	if a.config != nil && a.config.Environments != nil {
+		if policy, ok := a.config.Environments.Sound[env]; ok {
+			return policy
+		}
+	}
+	return SoundAlways
+}
+
+// environmentTabs counts the alerts of every environment on the board, in
+// tab order. It returns nil when no alert carries the environment label.
+// This should be called while holding the lock
+func (a *AppState) environmentTabs() []EnvironmentTab {
+	label := a.environmentLabel()
+	tabs := make(map[string]*EnvironmentTab)
+	labelled := false
+	for _, entry := range a.alerts {
+		env, ok := entry.Alert.Labels[label]
+		labelled = labelled || ok
+		tab, exists := tabs[env]
+		if !exists {
+			tab = &EnvironmentTab{Name: env, Sound: a.environmentSound(env)}
+			tabs[env] = tab
+		}
+		tab.Total++
+		if needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil) {
+			tab.Unacknowledged++
+		}
+	}
+	if !labelled {
+		return nil
+	}
+
+	var order []string
+	if a.config != nil && a.config.Environments != nil {
+		order = a.config.Environments.Order
+	}
+	rank := func(env string) int {
+		if env == "" {
+			return len(order) + 1 // alerts without the label come last
+		}
+		if i := slices.Index(order, env); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+
+	result := make([]EnvironmentTab, 0, len(tabs))
+	for _, tab := range tabs {
+		result = append(result, *tab)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if ri, rj := rank(result[i].Name), rank(result[j].Name); ri != rj {
+			return ri < rj
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// EnvironmentTabs returns the environment tabs of the board
+func (a *AppState) EnvironmentTabs() []EnvironmentTab {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.environmentTabs()
+}
+
+// inEnvironment reports whether an alert belongs to the environment tab,
+// where an empty filter is the tab of all alerts
+func inEnvironment(alert Alert, label, env string) bool {
+	return env == "" || alert.Labels[label] == env
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How often unacknowledged alerts are checked against the escalation rules
+const escalationCheckInterval = 15 * time.Second
+
+// Retry defaults of escalation actions
+const (
+	defaultActionRetries    = 3
+	defaultActionRetryDelay = 2 * time.Second
+)
+
+// EscalationConfig runs actions when a firing alert carrying all the labels
+// of Match stays unacknowledged for After, e.g. severity=critical for 5m
+// turns on the bedroom light
+type EscalationConfig struct {
+	Match   map[string]string `yaml:"match"`
+	After   time.Duration     `yaml:"after"`
+	Actions []string          `yaml:"actions"` // names of escalation_actions
+}
+
+// ActionConfig is a physical wake-up action, or a push message to a person
+type ActionConfig struct {
+	Type string `yaml:"type"` // wol, tasmota, shelly, push or twilio
+
+	MAC       string `yaml:"mac"`       // wol: MAC address of the machine to wake
+	Broadcast string `yaml:"broadcast"` // wol: broadcast address (default: 255.255.255.255:9)
+
+	Host    string `yaml:"host"`    // tasmota/shelly: device address, e.g. 192.168.1.50
+	Command string `yaml:"command"` // tasmota: console command (default: Power On)
+	Path    string `yaml:"path"`    // shelly: API path (default: /relay/0?turn=on), e.g. /light/0?turn=on&brightness=100
+
+	URL     string            `yaml:"url"`     // push: receives the message as a plain text POST, e.g. an ntfy topic or SMS gateway
+	Headers map[string]string `yaml:"headers"` // push: extra request headers, e.g. Authorization or ntfy's Title
+
+	AccountSID string        `yaml:"account_sid"` // twilio: account placing the calls
+	AuthToken  string        `yaml:"auth_token"`  // twilio: auth token of the account
+	From       string        `yaml:"from"`        // twilio: Twilio number calling, e.g. +15005550006
+	To         string        `yaml:"to"`          // twilio: number to call
+	Repeat     time.Duration `yaml:"repeat"`      // twilio: call again this often while the alerts stay unacknowledged (default: 5m)
+	MaxCalls   int           `yaml:"max_calls"`   // twilio: calls per escalation at most (default: 3)
+	APIURL     string        `yaml:"api_url"`     // twilio: REST API (default: https://api.twilio.com)
+
+	Retries    *int          `yaml:"retries"`     // attempts after a failure, 0 for none (default: 3)
+	RetryDelay time.Duration `yaml:"retry_delay"` // wait between attempts (default: 2s)
+}
+
+// validateEscalations checks the rules and actions, so a typo fails at startup
+func validateEscalations(rules []EscalationConfig, actions map[string]*ActionConfig) error {
+	for name, action := range actions {
+		switch action.Type {
+		case "wol":
+			if mac, err := net.ParseMAC(action.MAC); err != nil || len(mac) != 6 {
+				return fmt.Errorf("escalation action %s: invalid MAC address %q", name, action.MAC)
+			}
+			if action.Broadcast == "" {
+				action.Broadcast = "255.255.255.255:9"
+			}
+		case "tasmota", "shelly":
+			if action.Host == "" {
+				return fmt.Errorf("escalation action %s: 'host' is empty", name)
+			}
+			if action.Type == "tasmota" && action.Command == "" {
+				action.Command = "Power On"
+			}
+			if action.Type == "shelly" && action.Path == "" {
+				action.Path = "/relay/0?turn=on"
+			}
+		case "push":
+			if u, err := url.Parse(action.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("escalation action %s: invalid url %q", name, action.URL)
+			}
+		case "twilio":
+			if err := validateTwilioAction(name, action); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("escalation action %s: unknown type %q", name, action.Type)
+		}
+		if action.Retries == nil {
+			retries := defaultActionRetries
+			action.Retries = &retries
+		} else if *action.Retries < 0 {
+			return fmt.Errorf("escalation action %s: 'retries' is negative", name)
+		}
+		if action.RetryDelay <= 0 {
+			action.RetryDelay = defaultActionRetryDelay
+		}
+	}
+
+	for i, rule := range rules {
+		if len(rule.Match) == 0 {
+			return fmt.Errorf("escalation %d: 'match' is empty", i+1)
+		}
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("escalation %d: 'actions' is empty", i+1)
+		}
+		for _, name := range rule.Actions {
+			if _, ok := actions[name]; !ok {
+				return fmt.Errorf("escalation %d: unknown action %q", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// escalation is what an action is run for
+type escalation struct {
+	Alerts []AlertEntry
+	After  time.Duration
+	Link   string // delegated acknowledge link of the alerts, empty without external_url
+}
+
+// message describes the escalation for push actions
+func (e escalation) message() string {
+	names := make([]string, 0, len(e.Alerts))
+	for _, entry := range e.Alerts {
+		names = append(names, alertTitle(entry.Alert))
+	}
+	text := fmt.Sprintf("Escalated: %d alert(s) unacknowledged for %s: %s", len(e.Alerts), shortDuration(e.After), strings.Join(names, ", "))
+	if e.Link != "" {
+		text += "\nAcknowledge: " + e.Link
+	}
+	return text
+}
+
+// runEscalations periodically runs the actions of rules whose alerts stayed
+// unacknowledged for too long. Each rule escalates an alert once.
+func (a *AppState) runEscalations(rules []EscalationConfig, actions map[string]*ActionConfig, links *ackLinker) {
+	escalated := make([]map[string]bool, len(rules))
+	for i := range escalated {
+		escalated[i] = make(map[string]bool)
+	}
+
+	ticker := time.NewTicker(escalationCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		a.mu.Lock()
+		a.pruneDelegations(now)
+		present := make(map[string]bool, len(a.alerts))
+		for _, entry := range a.alerts {
+			present[entry.ID] = true
+		}
+		var due [][]AlertEntry
+		for i, rule := range rules {
+			var matched []AlertEntry
+			for _, entry := range a.alerts {
+				if entry.Alert.Status != "firing" || a.acknowledged[entry.ID] != nil || escalated[i][entry.ID] {
+					continue
+				}
+				if now.Sub(entry.Timestamp) >= rule.After && labelsMatch(entry.Alert.Labels, rule.Match) {
+					matched = append(matched, entry)
+				}
+			}
+			due = append(due, matched)
+		}
+		a.mu.Unlock()
+
+		for i, rule := range rules {
+			// Forget alerts that left the board
+			for id := range escalated[i] {
+				if !present[id] {
+					delete(escalated[i], id)
+				}
+			}
+			if len(due[i]) == 0 {
+				continue
+			}
+			a.mu.Lock()
+			for _, entry := range due[i] {
+				escalated[i][entry.ID] = true
+				a.recordHandled(HistoryEscalated, entry, now, "")
+			}
+			a.mu.Unlock()
+			// In cluster mode, the leader runs the actions; the other
+			// instances only remember the alerts as escalated
+			if !a.cluster.isLeader() {
+				continue
+			}
+			log.Warnf("Escalating %d unacknowledged alerts (%s) after %s", len(due[i]), alertDisplayName(due[i][0].Alert), rule.After)
+			event := escalation{Alerts: due[i], After: rule.After}
+			for _, name := range rule.Actions {
+				switch actions[name].Type {
+				case "push":
+					if event.Link == "" {
+						event.Link = a.Delegate(due[i], links)
+					}
+				case "twilio":
+					// Calls repeat, and hang up once the alerts are acknowledged
+					go a.callUntilAcknowledged(name, actions[name], event)
+					continue
+				}
+				go runAction(name, actions[name], event)
+			}
+		}
+	}
+}
+
+// runAction runs an action, retrying on failure
+func runAction(name string, action *ActionConfig, event escalation) {
+	var err error
+	for attempt := 0; attempt <= *action.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(action.RetryDelay)
+		}
+		if err = action.run(event); err == nil {
+			escalationActions.WithLabelValues(name, "ok").Inc()
+			log.Infof("Escalation action %s ran", name)
+			return
+		}
+		log.Debugf("Escalation action %s failed (attempt %d): %v", name, attempt+1, err)
+	}
+	escalationActions.WithLabelValues(name, "failed").Inc()
+	log.Errorf("Escalation action %s failed: %v", name, err)
+}
+
+var actionClient = &http.Client{Timeout: 5 * time.Second}
+
+// run performs the action once
+func (c *ActionConfig) run(event escalation) error {
+	switch c.Type {
+	case "wol":
+		return sendMagicPacket(c.MAC, c.Broadcast)
+	case "tasmota":
+		return actionGet("http://" + c.Host + "/cm?cmnd=" + url.QueryEscape(c.Command))
+	case "shelly":
+		return actionGet("http://" + c.Host + "/" + strings.TrimPrefix(c.Path, "/"))
+	case "push":
+		return actionPush(c.URL, c.Headers, event.message())
+	}
+	return fmt.Errorf("unknown action type %q", c.Type)
+}
+
+// actionGet calls a smart device HTTP API
+func actionGet(target string) error {
+	resp, err := actionClient.Get(target)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("device returned %s", resp.Status)
+	}
+	return nil
+}
+
+// actionPush posts a message to a push or SMS gateway
+func actionPush(target string, headers map[string]string, message string) error {
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := actionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("gateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendMagicPacket broadcasts a Wake-on-LAN packet: six 0xFF bytes followed
+// by the MAC address repeated 16 times
+func sendMagicPacket(mac, broadcast string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	packet := make([]byte, 0, 102)
+	for i := 0; i < 6; i++ {
+		packet = append(packet, 0xff)
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, hw...)
+	}
+
+	conn, err := net.Dial("udp", broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
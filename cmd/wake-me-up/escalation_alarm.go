@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// EscalationAlarmConfig sounds the alarm louder on the dashboards when a
+// firing alert stays unacknowledged for too long
+type EscalationAlarmConfig struct {
+	After  time.Duration `yaml:"after"`  // How long a firing alert may stay unacknowledged, e.g. 10m
+	Repeat time.Duration `yaml:"repeat"` // Escalate again this often while it stays unacknowledged (optional, default: once)
+	Notify bool          `yaml:"notify"` // Also send the escalation through the configured notifiers (optional, default: false)
+}
+
+// escalationMessage tells the dashboards to replay the alarm louder
+type escalationMessage struct {
+	Type              string `json:"type"` // escalation
+	AlertID           string `json:"alertId"`
+	Name              string `json:"name"`
+	UnacknowledgedFor string `json:"unacknowledgedFor"`
+}
+
+// escalationAlarm keeps a timer per firing alert, by alert ID, that
+// escalates the alert when it runs out
+type escalationAlarm struct {
+	config *EscalationAlarmConfig
+	fire   func(alertID string)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// newEscalationAlarm checks the config and returns the timers, or nil if the
+// escalation alarm is disabled
+func newEscalationAlarm(config *EscalationAlarmConfig, fire func(alertID string)) (*escalationAlarm, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.After <= 0 {
+		return nil, errors.New("'after' must be positive")
+	}
+	if config.Repeat < 0 {
+		return nil, errors.New("'repeat' must be positive")
+	}
+	return &escalationAlarm{config: config, fire: fire, timers: make(map[string]*time.Timer)}, nil
+}
+
+// arm (re)starts the timer of an alert
+func (e *escalationAlarm) arm(alertID string, delay time.Duration) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if timer, ok := e.timers[alertID]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		e.mu.Lock()
+		if e.timers[alertID] != timer {
+			e.mu.Unlock()
+			return
+		}
+		delete(e.timers, alertID)
+		e.mu.Unlock()
+		e.fire(alertID)
+	})
+	e.timers[alertID] = timer
+}
+
+// disarm stops the timer of an alert, once it is acknowledged
+func (e *escalationAlarm) disarm(alertID string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if timer, ok := e.timers[alertID]; ok {
+		timer.Stop()
+		delete(e.timers, alertID)
+	}
+}
+
+// rearm starts the timer of an alert that needs acknowledging again, e.g.
+// when its snooze or silence ends
+func (e *escalationAlarm) rearm(alertID string) {
+	if e != nil {
+		e.arm(alertID, e.config.After)
+	}
+}
+
+// armNew starts the timers of new firing alerts, from when they arrived
+func (e *escalationAlarm) armNew(entries []AlertEntry, now time.Time) {
+	if e == nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Alert.Status == "firing" {
+			e.arm(entry.ID, e.config.After-now.Sub(entry.Timestamp))
+		}
+	}
+}
+
+// ArmEscalationAlarms starts the timers of the firing alerts of a restored board
+func (a *AppState) ArmEscalationAlarms() {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	a.escalationAlarm.armNew(a.alerts, time.Now())
+}
+
+// escalateUnacknowledged runs when the timer of an alert runs out. An alert
+// still firing and unacknowledged sounds the alarm louder; one acknowledged
+// automatically, e.g. by a silence, is left until its acknowledgement ends.
+func (a *AppState) escalateUnacknowledged(alertID string) {
+	config := a.escalationAlarm.config
+	a.mu.RLock()
+	entry, ok := a.alertByID(alertID)
+	acknowledged := a.acknowledged[alertID] != nil
+	a.mu.RUnlock()
+	if !ok || entry.Alert.Status != "firing" || acknowledged {
+		return
+	}
+
+	unacknowledged := time.Since(entry.Timestamp)
+	log.Warnf("Alert %s unacknowledged for %s, escalating", alertID, shortDuration(unacknowledged))
+	escalationAlarms.Inc()
+	data, err := json.Marshal(escalationMessage{
+		Type:              "escalation",
+		AlertID:           alertID,
+		Name:              alertTitle(entry.Alert),
+		UnacknowledgedFor: shortDuration(unacknowledged),
+	})
+	if err != nil {
+		log.Errorf("Error marshaling escalation message: %v", err)
+		return
+	}
+	a.hub.broadcast <- a.audible(data)
+	// In cluster mode, every instance alarms its dashboards but only the
+	// leader notifies
+	if config.Notify && a.cluster.isLeader() {
+		a.notifier.Dispatch(NotificationEvent{
+			Kind:   EventEscalated,
+			Alerts: []AlertEntry{entry},
+			Note:   "Unacknowledged for " + shortDuration(unacknowledged),
+		})
+	}
+	if config.Repeat > 0 {
+		a.escalationAlarm.arm(alertID, config.Repeat)
+	}
+}
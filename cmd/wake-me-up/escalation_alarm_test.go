@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscalationAlarm(t *testing.T) {
+	state := NewAppState(100)
+	client := &Client{hub: state.hub, send: make(chan []byte, 64)}
+	state.hub.register <- client
+
+	var err error
+	state.escalationAlarm, err = newEscalationAlarm(&EscalationAlarmConfig{After: 50 * time.Millisecond}, state.escalateUnacknowledged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "CPU"}},
+	}})
+	for _, entry := range state.GetAlerts() {
+		if entry.Alert.Labels["alertname"] == "CPU" {
+			state.Acknowledge(entry.ID, "alice")
+		}
+	}
+
+	escalated := 0
+	timeout := time.After(300 * time.Millisecond)
+	for {
+		select {
+		case message := <-client.send:
+			if !strings.Contains(string(message), `"type":"escalation"`) {
+				continue
+			}
+			if strings.Contains(string(message), "CPU") {
+				t.Fatalf("Expected the acknowledged alert not to escalate, got %s", message)
+			}
+			escalated++
+		case <-timeout:
+			if escalated != 1 {
+				t.Fatalf("Expected one escalation, got %d", escalated)
+			}
+			state.escalationAlarm.mu.Lock()
+			armed := len(state.escalationAlarm.timers)
+			state.escalationAlarm.mu.Unlock()
+			if armed != 0 {
+				t.Errorf("Expected no timer left for the acknowledged alert, got %d", armed)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const followUpsFile = "followups.json"
+
+// How long restored follow-ups that are due wait for Alertmanager to resend
+// the alerts, which are not persisted, before deciding they are gone
+const followUpRestoreDelay = 5 * time.Minute
+
+// FollowUp reminds whoever acknowledged an alert that it is still firing, at
+// a time they chose when acknowledging it ("will fix in the morning")
+type FollowUp struct {
+	AlertID  string            `json:"alertId"`
+	Labels   map[string]string `json:"labels"` // finds the alert again after a restart, when its ID changed
+	Note     string            `json:"note,omitempty"`
+	DueAt    time.Time         `json:"dueAt"`
+	Notifier string            `json:"notifier,omitempty"` // notifier to remind through, all if empty
+
+	DueText string `json:"dueText,omitempty"` // formatted due time, only set in updates
+
+	timer *time.Timer
+}
+
+// parseFollowUp reads a follow-up time given as a duration from now ("8h"),
+// a time of day in time_zone ("08:00", the next one) or an RFC 3339 time
+func parseFollowUp(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, errors.New("follow-up must be in the future")
+		}
+		return now.Add(d), nil
+	}
+	if offsets, err := parseHandoffTimes([]string{value}); err == nil {
+		return nextHandoff(now, offsets, timeFormat.location), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid follow-up %q: expected a duration, HH:MM or RFC 3339 time", value)
+	}
+	if !t.After(now) {
+		return time.Time{}, errors.New("follow-up must be in the future")
+	}
+	return t, nil
+}
+
+// GetFollowUp returns a copy of the follow-up of an alert, or nil if none is set
+func (a *AppState) GetFollowUp(alertID string) *FollowUp {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	followUp, ok := a.followUps[alertID]
+	if !ok {
+		return nil
+	}
+	copied := *followUp
+	copied.timer = nil
+	copied.DueText = timeFormat.Board(copied.DueAt)
+	return &copied
+}
+
+// followUpList returns copies of the pending follow-ups by alert ID
+// This should be called while holding the lock
+func (a *AppState) followUpList() map[string]FollowUp {
+	followUps := make(map[string]FollowUp, len(a.followUps))
+	for id, followUp := range a.followUps {
+		copied := *followUp
+		copied.timer = nil
+		followUps[id] = copied
+	}
+	return followUps
+}
+
+// checkFollowUpNotifier checks that follow-ups can be sent, optionally
+// through the given notifier only
+func (a *AppState) checkFollowUpNotifier(notifier string) error {
+	if notifier != "" && !a.notifier.Has(notifier) {
+		return fmt.Errorf("unknown notifier %q", notifier)
+	}
+	if !a.notifier.Enabled() {
+		return errors.New("no notifiers are configured")
+	}
+	return nil
+}
+
+// SetFollowUp schedules a reminder for a firing alert, replacing any earlier one
+func (a *AppState) SetFollowUp(alertID, note string, dueAt time.Time, notifier string) error {
+	if err := a.checkFollowUpNotifier(notifier); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	var labels map[string]string
+	for _, entry := range a.alerts {
+		if entry.ID == alertID && entry.Alert.Status == "firing" {
+			labels = entry.Alert.Labels
+			break
+		}
+	}
+	if labels == nil {
+		a.mu.Unlock()
+		return errors.New("alert not found or not firing")
+	}
+	a.setFollowUp(&FollowUp{AlertID: alertID, Labels: labels, Note: note, DueAt: dueAt, Notifier: notifier})
+	a.mu.Unlock()
+
+	a.saveFollowUps()
+	log.Infof("Follow-up for alert %s scheduled at %s", alertID, timeFormat.Absolute(dueAt))
+	return nil
+}
+
+// setFollowUp stores a follow-up and arms its timer
+// This should be called while holding the lock
+func (a *AppState) setFollowUp(followUp *FollowUp) {
+	if previous, ok := a.followUps[followUp.AlertID]; ok {
+		previous.timer.Stop()
+	}
+	a.followUps[followUp.AlertID] = followUp
+	a.indexAlert(followUp.AlertID)
+	a.seq++
+	followUp.timer = time.AfterFunc(time.Until(followUp.DueAt), func() {
+		a.fireFollowUp(followUp)
+	})
+}
+
+// fireFollowUp sends the reminder if the alert is still firing. Alerts are
+// looked up by ID, then by labels, since IDs change when the server restarts.
+func (a *AppState) fireFollowUp(followUp *FollowUp) {
+	a.mu.Lock()
+	// Only fire the follow-up this timer was scheduled for
+	if a.followUps[followUp.AlertID] != followUp {
+		a.mu.Unlock()
+		return
+	}
+	delete(a.followUps, followUp.AlertID)
+	a.indexAlert(followUp.AlertID)
+	a.seq++
+	var firing *AlertEntry
+	for i := range a.alerts {
+		entry := a.alerts[i]
+		if entry.Alert.Status != "firing" {
+			continue
+		}
+		if entry.ID == followUp.AlertID {
+			firing = &entry
+			break
+		}
+		if firing == nil && labelsEqual(entry.Alert.Labels, followUp.Labels) {
+			firing = &entry
+		}
+	}
+	a.mu.Unlock()
+
+	a.saveFollowUps()
+	a.broadcastUpdate()
+	if firing == nil {
+		log.Infof("Follow-up for alert %s dropped, the alert is no longer firing", followUp.AlertID)
+		return
+	}
+	log.Infof("Sending follow-up for alert %s", firing.ID)
+	a.notifier.Dispatch(NotificationEvent{
+		Kind:     EventFollowUp,
+		Alerts:   []AlertEntry{*firing},
+		Note:     followUp.Note,
+		Notifier: followUp.Notifier,
+	})
+}
+
+// labelsEqual checks if two label sets are identical
+func labelsEqual(a, b map[string]string) bool {
+	return len(a) == len(b) && labelsMatch(a, b)
+}
+
+// saveFollowUps persists the pending follow-ups to the data directory
+func (a *AppState) saveFollowUps() {
+	path := a.dataFilePath(followUpsFile)
+	if path == "" {
+		return
+	}
+	a.mu.RLock()
+	followUps := make([]FollowUp, 0, len(a.followUps))
+	for _, followUp := range a.followUpList() {
+		followUps = append(followUps, followUp)
+	}
+	a.mu.RUnlock()
+	if err := saveJSON(path, followUps); err != nil {
+		log.Errorf("Failed to persist follow-ups: %v", err)
+	}
+}
+
+// LoadFollowUps restores the pending follow-ups, holding back those that came
+// due while the server was down until the alerts had time to come back
+func (a *AppState) LoadFollowUps() error {
+	path := a.dataFilePath(followUpsFile)
+	if path == "" {
+		return nil
+	}
+
+	var followUps []FollowUp
+	if _, err := loadJSON(path, &followUps); err != nil {
+		return err
+	}
+
+	earliest := time.Now().Add(followUpRestoreDelay)
+	a.mu.Lock()
+	for i := range followUps {
+		if followUps[i].DueAt.Before(earliest) {
+			followUps[i].DueAt = earliest
+		}
+		a.setFollowUp(&followUps[i])
+	}
+	a.mu.Unlock()
+	if len(followUps) > 0 {
+		log.Infof("Restored %d pending follow-ups", len(followUps))
+	}
+	return nil
+}
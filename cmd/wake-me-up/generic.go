@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// GenericWebhookConfig maps the JSON another monitoring tool sends to alerts,
+// with Go templates evaluated against each alert object of the body
+type GenericWebhookConfig struct {
+	Name         string            `yaml:"name"`          // Selected with /webhook/generic?source=<name>
+	Receiver     string            `yaml:"receiver"`      // Shown as the receiver of the alerts (default: name)
+	AlertsPath   string            `yaml:"alerts_path"`   // Dotted path to the array of alerts, e.g. data.alerts (default: the body is one alert)
+	Status       string            `yaml:"status"`        // Template rendering firing or resolved (default: firing)
+	Labels       map[string]string `yaml:"labels"`        // Label templates, labels rendering empty are left out
+	Annotations  map[string]string `yaml:"annotations"`   // Annotation templates, like labels
+	StartsAt     string            `yaml:"starts_at"`     // Template rendering an RFC 3339 time (default: when received)
+	EndsAt       string            `yaml:"ends_at"`       // Template rendering an RFC 3339 time (optional)
+	GeneratorURL string            `yaml:"generator_url"` // Template rendering a link to the source (optional)
+}
+
+// genericFuncs are available in the templates in addition to the built-in ones
+var genericFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || fmt.Sprint(value) == "" {
+			return fallback
+		}
+		return value
+	},
+	// unixTime formats seconds since the epoch, as many tools send times
+	"unixTime": func(value interface{}) (string, error) {
+		seconds, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("unixTime: %v", err)
+		}
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC().Format(time.RFC3339Nano), nil
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// genericMapping is a parsed generic webhook mapping
+type genericMapping struct {
+	receiver     string
+	alertsPath   []string
+	status       *template.Template
+	labels       map[string]*template.Template
+	annotations  map[string]*template.Template
+	startsAt     *template.Template
+	endsAt       *template.Template
+	generatorURL *template.Template
+}
+
+// newGenericMappings parses the generic webhook mappings by name
+func newGenericMappings(configs []GenericWebhookConfig) (map[string]*genericMapping, error) {
+	mappings := make(map[string]*genericMapping, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("generic_webhooks[%d]: name is required", i)
+		}
+		if _, exists := mappings[config.Name]; exists {
+			return nil, fmt.Errorf("generic_webhooks: duplicate name %q", config.Name)
+		}
+		if len(config.Labels) == 0 {
+			return nil, fmt.Errorf("generic_webhooks %s: labels are required to tell alerts apart", config.Name)
+		}
+
+		mapping := &genericMapping{
+			receiver:    config.Receiver,
+			labels:      make(map[string]*template.Template),
+			annotations: make(map[string]*template.Template),
+		}
+		if mapping.receiver == "" {
+			mapping.receiver = config.Name
+		}
+		if config.AlertsPath != "" {
+			mapping.alertsPath = strings.Split(config.AlertsPath, ".")
+		}
+
+		var err error
+		parse := func(field, text string) *template.Template {
+			if err != nil || text == "" {
+				return nil
+			}
+			var tmpl *template.Template
+			tmpl, err = template.New(field).Funcs(genericFuncs).Parse(text)
+			if err != nil {
+				err = fmt.Errorf("generic_webhooks %s: %s: %v", config.Name, field, err)
+			}
+			return tmpl
+		}
+		mapping.status = parse("status", config.Status)
+		mapping.startsAt = parse("starts_at", config.StartsAt)
+		mapping.endsAt = parse("ends_at", config.EndsAt)
+		mapping.generatorURL = parse("generator_url", config.GeneratorURL)
+		for name, text := range config.Labels {
+			mapping.labels[name] = parse("labels."+name, text)
+		}
+		for name, text := range config.Annotations {
+			mapping.annotations[name] = parse("annotations."+name, text)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mappings[config.Name] = mapping
+	}
+	return mappings, nil
+}
+
+// renderGeneric executes a template against an alert object. Fields missing
+// from the object render empty.
+func renderGeneric(tmpl *template.Template, data interface{}) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(out.String(), "<no value>", "")), nil
+}
+
+// payload converts a body to a webhook payload
+func (m *genericMapping) payload(body []byte, now time.Time) (WebhookPayload, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Keep numbers as sent rather than in float notation
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return WebhookPayload{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	items := []interface{}{root}
+	if len(m.alertsPath) > 0 {
+		value := root
+		for _, key := range m.alertsPath {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return WebhookPayload{}, fmt.Errorf("no %s in the body", strings.Join(m.alertsPath, "."))
+			}
+			value = object[key]
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return WebhookPayload{}, fmt.Errorf("%s is not an array", strings.Join(m.alertsPath, "."))
+		}
+		items = list
+	}
+
+	payload := WebhookPayload{Status: "resolved", Receiver: m.receiver, Alerts: make([]Alert, 0, len(items))}
+	for i, item := range items {
+		alert, err := m.alert(item, now)
+		if err != nil {
+			return WebhookPayload{}, fmt.Errorf("alert %d: %v", i, err)
+		}
+		if alert.Status == "firing" {
+			payload.Status = "firing"
+		}
+		payload.Alerts = append(payload.Alerts, alert)
+	}
+	return payload, nil
+}
+
+// alert maps one alert object
+func (m *genericMapping) alert(item interface{}, now time.Time) (Alert, error) {
+	alert := Alert{Status: "firing", Labels: make(map[string]string), StartsAt: now}
+
+	status, err := renderGeneric(m.status, item)
+	if err != nil {
+		return alert, err
+	}
+	switch strings.ToLower(status) {
+	case "", "firing":
+	case "resolved":
+		alert.Status = "resolved"
+	default:
+		return alert, fmt.Errorf("status must render firing or resolved, got %q", status)
+	}
+
+	for name, tmpl := range m.labels {
+		value, err := renderGeneric(tmpl, item)
+		if err != nil {
+			return alert, err
+		}
+		if value != "" {
+			alert.Labels[name] = value
+		}
+	}
+	if len(alert.Labels) == 0 {
+		return alert, fmt.Errorf("all labels rendered empty")
+	}
+	for name, tmpl := range m.annotations {
+		value, err := renderGeneric(tmpl, item)
+		if err != nil {
+			return alert, err
+		}
+		if value != "" {
+			if alert.Annotations == nil {
+				alert.Annotations = make(map[string]string)
+			}
+			alert.Annotations[name] = value
+		}
+	}
+
+	if value, err := renderGeneric(m.startsAt, item); err != nil {
+		return alert, err
+	} else if value != "" {
+		if alert.StartsAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return alert, fmt.Errorf("starts_at: %v", err)
+		}
+	}
+	if value, err := renderGeneric(m.endsAt, item); err != nil {
+		return alert, err
+	} else if value != "" {
+		endsAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return alert, fmt.Errorf("ends_at: %v", err)
+		}
+		alert.EndsAt = &endsAt
+	}
+	if alert.GeneratorURL, err = renderGeneric(m.generatorURL, item); err != nil {
+		return alert, err
+	}
+	return alert, nil
+}
+
+// genericWebhookHandler ingests the webhooks of other monitoring tools
+// through the configured mappings, e.g. POST /webhook/generic?source=grafana
+func genericWebhookHandler(state *AppState, mappings map[string]*genericMapping) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The source can be left out when there is only one
+		source := r.URL.Query().Get("source")
+		if source == "" && len(mappings) == 1 {
+			for name := range mappings {
+				source = name
+			}
+		}
+		mapping, ok := mappings[source]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown source %q", source), http.StatusNotFound)
+			return
+		}
+
+		body, err := readWebhookBody(w, r, state.maxWebhookBody())
+		if err != nil {
+			http.Error(w, err.Error(), bodyErrorStatus(err))
+			return
+		}
+		payload, err := mapping.payload(body, time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to map the %s webhook: %v", source, err), http.StatusBadRequest)
+			return
+		}
+
+		state.tagSourceZone(&payload, getClientIP(r))
+		result := state.AddWebhook(payload)
+		webhooksReceived.WithLabelValues(source).Inc()
+		log.Infof("Received %s webhook: %d alerts, status: %s from IP: %s", source, len(payload.Alerts), payload.Status, getClientIP(r))
+		writeWebhookResult(w, r, state, result)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultGPIOBlinkInterval = 500 * time.Millisecond
+
+// GPIOConfig drives a status light, such as a tower light, from GPIO pins of
+// the machine running the server, e.g. a Raspberry Pi
+type GPIOConfig struct {
+	Green         int           `yaml:"green"`          // BCM number of the green light pin
+	Red           int           `yaml:"red"`            // BCM number of the red light pin
+	ActiveLow     bool          `yaml:"active_low"`     // Lights are on when the pin is low, as with many relay boards (optional, default: false)
+	BlinkInterval time.Duration `yaml:"blink_interval"` // How fast red blinks while alerts are unacknowledged (optional, default: 500ms)
+	SysfsBase     int           `yaml:"sysfs_base"`     // Added to pin numbers for /sys/class/gpio, e.g. 512 on recent kernels (optional, default: 0)
+}
+
+// Status light states
+const (
+	lightClear  = "clear"  // green
+	lightAlarm  = "alarm"  // blinking red: unacknowledged firing alerts
+	lightFiring = "firing" // solid red: firing alerts, all acknowledged
+)
+
+// gpioPin is an output pin
+type gpioPin interface {
+	Set(on bool) error
+}
+
+// statusLight reflects the board state on a green and a red light
+type statusLight struct {
+	green, red gpioPin
+	activeLow  bool
+	interval   time.Duration
+}
+
+func newStatusLight(config *GPIOConfig) (*statusLight, error) {
+	if config.Green <= 0 || config.Red <= 0 || config.Green == config.Red {
+		return nil, fmt.Errorf("gpio: 'green' and 'red' must be two different pins")
+	}
+	green, err := openGPIOPin(config.SysfsBase + config.Green)
+	if err != nil {
+		return nil, fmt.Errorf("gpio: green pin %d: %w", config.Green, err)
+	}
+	red, err := openGPIOPin(config.SysfsBase + config.Red)
+	if err != nil {
+		return nil, fmt.Errorf("gpio: red pin %d: %w", config.Red, err)
+	}
+	interval := config.BlinkInterval
+	if interval <= 0 {
+		interval = defaultGPIOBlinkInterval
+	}
+	return &statusLight{green: green, red: red, activeLow: config.ActiveLow, interval: interval}, nil
+}
+
+// run updates the lights every blink interval
+func (l *statusLight) run(state *AppState) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	blinkOn := false
+	failing := false
+	for range ticker.C {
+		light := state.lightState()
+		blinkOn = !blinkOn
+		err := l.set(light == lightClear, light == lightFiring || (light == lightAlarm && blinkOn))
+
+		// Log failures once rather than on every blink
+		if err != nil && !failing {
+			log.Errorf("Failed to set status light: %v", err)
+		} else if err == nil && failing {
+			log.Infof("Status light works again")
+		}
+		failing = err != nil
+	}
+}
+
+// set switches the lights, inverting the pin levels for active-low wiring
+func (l *statusLight) set(green, red bool) error {
+	if err := l.green.Set(green != l.activeLow); err != nil {
+		return err
+	}
+	return l.red.Set(red != l.activeLow)
+}
+
+// lightState returns what the status light should show
+func (a *AppState) lightState() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	light := lightClear
+	for _, entry := range a.alerts {
+		if needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil) {
+			return lightAlarm
+		}
+		if entry.Alert.Status == "firing" {
+			light = lightFiring
+		}
+	}
+	return light
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const sysfsGPIO = "/sys/class/gpio"
+
+// sysfsPin is an output pin driven through /sys/class/gpio
+type sysfsPin struct {
+	value *os.File
+}
+
+// openGPIOPin exports a pin and configures it as an output
+func openGPIOPin(number int) (gpioPin, error) {
+	dir := filepath.Join(sysfsGPIO, "gpio"+strconv.Itoa(number))
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(filepath.Join(sysfsGPIO, "export"), []byte(strconv.Itoa(number)), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// udev may take a moment to grant access to a freshly exported pin
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		if err = os.WriteFile(filepath.Join(dir, "direction"), []byte("out"), 0); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := os.OpenFile(filepath.Join(dir, "value"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sysfsPin{value: value}, nil
+}
+
+func (p *sysfsPin) Set(on bool) error {
+	level := []byte("0")
+	if on {
+		level = []byte("1")
+	}
+	_, err := p.value.WriteAt(level, 0)
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// openGPIOPin is not supported on this platform
+func openGPIOPin(number int) (gpioPin, error) {
+	return nil, fmt.Errorf("GPIO output is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alertmanager resends a whole group on every change and each
+// repeat_interval. The group timeline keeps what changed between consecutive
+// deliveries of a group, so long running groups read as a story rather than
+// a pile of identical batches.
+const (
+	maxTimelineGroups     = 200            // groups kept, the least recently delivered are forgotten first
+	maxTimelineDeliveries = 50             // deliveries kept per group
+	groupTimelineIdle     = 24 * time.Hour // groups without deliveries for longer are forgotten
+)
+
+// GroupDelivery is a delivery of an alert group and what changed since the
+// previous one
+type GroupDelivery struct {
+	Time      time.Time           `json:"time"`
+	Status    string              `json:"status"`
+	Alerts    int                 `json:"alerts"`
+	New       []map[string]string `json:"new,omitempty"`      // labels of alerts firing now that weren't before
+	Resolved  []map[string]string `json:"resolved,omitempty"` // labels of alerts firing before that resolved or left the group
+	Changed   []AnnotationChange  `json:"changed,omitempty"`  // annotations of alerts still firing that changed
+	Unchanged int                 `json:"unchanged"`          // alerts still firing as before
+}
+
+// AnnotationChange is an annotation that changed between two deliveries
+type AnnotationChange struct {
+	Labels     map[string]string `json:"labels"`
+	Annotation string            `json:"annotation"`
+	Old        string            `json:"old,omitempty"`
+	New        string            `json:"new,omitempty"`
+}
+
+// GroupTimeline is the delivery history of an alert group, oldest first
+type GroupTimeline struct {
+	GroupKey    string            `json:"groupKey"`
+	Receiver    string            `json:"receiver,omitempty"`
+	GroupLabels map[string]string `json:"groupLabels,omitempty"`
+	Deliveries  []GroupDelivery   `json:"deliveries,omitempty"`
+
+	firing map[string]Alert // fingerprint -> alert firing in the last delivery
+}
+
+// groupTimelines keeps the timelines of the groups delivered lately
+type groupTimelines struct {
+	mu     sync.Mutex
+	groups map[string]*GroupTimeline
+}
+
+func newGroupTimelines() *groupTimelines {
+	return &groupTimelines{groups: make(map[string]*GroupTimeline)}
+}
+
+// record adds a delivery to the timeline of its group; payloads without a
+// group key, e.g. from the generic webhook, have no timeline
+func (g *groupTimelines) record(payload WebhookPayload, now time.Time) {
+	if g == nil || payload.GroupKey == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	timeline, ok := g.groups[payload.GroupKey]
+	if !ok {
+		g.prune(now)
+		timeline = &GroupTimeline{GroupKey: payload.GroupKey}
+		g.groups[payload.GroupKey] = timeline
+	}
+	timeline.Receiver = payload.Receiver
+	timeline.GroupLabels = payload.GroupLabels
+
+	delivery, firing := diffDelivery(timeline.firing, payload.Alerts)
+	delivery.Time = now
+	delivery.Status = payload.Status
+	timeline.firing = firing
+	timeline.Deliveries = append(timeline.Deliveries, delivery)
+	if len(timeline.Deliveries) > maxTimelineDeliveries {
+		timeline.Deliveries = timeline.Deliveries[len(timeline.Deliveries)-maxTimelineDeliveries:]
+	}
+}
+
+// prune forgets idle groups, and the least recently delivered ones to make
+// room for a new group
+// This should be called while holding the lock
+func (g *groupTimelines) prune(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, timeline := range g.groups {
+		last := timeline.Deliveries[len(timeline.Deliveries)-1].Time
+		if now.Sub(last) > groupTimelineIdle {
+			delete(g.groups, key)
+			continue
+		}
+		if oldestKey == "" || last.Before(oldest) {
+			oldestKey, oldest = key, last
+		}
+	}
+	if len(g.groups) >= maxTimelineGroups {
+		delete(g.groups, oldestKey)
+	}
+}
+
+// diffDelivery compares the alerts of a delivery with the alerts firing in
+// the previous one and returns the changes and the alerts firing now
+func diffDelivery(previous map[string]Alert, alerts []Alert) (GroupDelivery, map[string]Alert) {
+	delivery := GroupDelivery{Alerts: len(alerts)}
+	firing := make(map[string]Alert)
+	for _, alert := range alerts {
+		if alert.Status == "firing" {
+			firing[labelFingerprint(alert.Labels)] = alert
+		}
+	}
+
+	for fingerprint, alert := range firing {
+		before, ok := previous[fingerprint]
+		if !ok {
+			delivery.New = append(delivery.New, alert.Labels)
+			continue
+		}
+		changes := annotationChanges(alert.Labels, before.Annotations, alert.Annotations)
+		if len(changes) == 0 {
+			delivery.Unchanged++
+		}
+		delivery.Changed = append(delivery.Changed, changes...)
+	}
+	for fingerprint, alert := range previous {
+		if _, ok := firing[fingerprint]; !ok {
+			delivery.Resolved = append(delivery.Resolved, alert.Labels)
+		}
+	}
+
+	sortLabelSets(delivery.New)
+	sortLabelSets(delivery.Resolved)
+	sort.SliceStable(delivery.Changed, func(i, j int) bool {
+		return labelFingerprint(delivery.Changed[i].Labels) < labelFingerprint(delivery.Changed[j].Labels)
+	})
+	return delivery, firing
+}
+
+// annotationChanges lists the annotations that differ, by name
+func annotationChanges(labels, old, new map[string]string) []AnnotationChange {
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+	var changes []AnnotationChange
+	for _, name := range sortedKeys(names) {
+		if old[name] != new[name] {
+			changes = append(changes, AnnotationChange{Labels: labels, Annotation: name, Old: old[name], New: new[name]})
+		}
+	}
+	return changes
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortLabelSets orders label sets by fingerprint, so diffs are stable
+func sortLabelSets(sets []map[string]string) {
+	sort.Slice(sets, func(i, j int) bool { return labelFingerprint(sets[i]) < labelFingerprint(sets[j]) })
+}
+
+// Timeline returns the timeline of a group, or nil if it wasn't delivered
+// lately
+func (g *groupTimelines) Timeline(groupKey string) *GroupTimeline {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	timeline, ok := g.groups[groupKey]
+	if !ok {
+		return nil
+	}
+	copied := *timeline
+	copied.Deliveries = append([]GroupDelivery(nil), timeline.Deliveries...)
+	copied.GroupLabels = maps.Clone(timeline.GroupLabels)
+	return &copied
+}
+
+// GroupSummary describes a group in the list of groups
+type GroupSummary struct {
+	GroupKey      string            `json:"groupKey"`
+	Receiver      string            `json:"receiver,omitempty"`
+	GroupLabels   map[string]string `json:"groupLabels,omitempty"`
+	Deliveries    int               `json:"deliveries"`
+	Firing        int               `json:"firing"`
+	LastDelivered time.Time         `json:"lastDelivered"`
+}
+
+// List returns the groups, the most recently delivered first
+func (g *groupTimelines) List() []GroupSummary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	summaries := make([]GroupSummary, 0, len(g.groups))
+	for _, timeline := range g.groups {
+		summaries = append(summaries, GroupSummary{
+			GroupKey:      timeline.GroupKey,
+			Receiver:      timeline.Receiver,
+			GroupLabels:   maps.Clone(timeline.GroupLabels),
+			Deliveries:    len(timeline.Deliveries),
+			Firing:        len(timeline.firing),
+			LastDelivered: timeline.Deliveries[len(timeline.Deliveries)-1].Time,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].LastDelivered.After(summaries[j].LastDelivered) })
+	return summaries
+}
+
+// groupsHandler lists the alert groups delivered lately, or with a 'key'
+// parameter returns the timeline of a group
+func groupsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var result interface{} = state.groups.List()
+		if key := r.URL.Query().Get("key"); key != "" {
+			timeline := state.groups.Timeline(key)
+			if timeline == nil {
+				http.Error(w, "Unknown group", http.StatusNotFound)
+				return
+			}
+			result = timeline
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Errorf("Error encoding group timeline: %v", err)
+		}
+	}
+}
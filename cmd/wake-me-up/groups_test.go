@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupTimelineDiffsDeliveries(t *testing.T) {
+	groups := newGroupTimelines()
+	alert := func(name, status, summary string) Alert {
+		return Alert{
+			Status:      status,
+			Labels:      map[string]string{"alertname": name},
+			Annotations: map[string]string{"summary": summary},
+		}
+	}
+	deliver := func(at time.Time, alerts ...Alert) {
+		groups.record(WebhookPayload{GroupKey: "{}:{job=\"api\"}", Status: "firing", Alerts: alerts}, at)
+	}
+
+	start := time.Now()
+	deliver(start, alert("A", "firing", "1 error"), alert("B", "firing", "down"))
+	deliver(start.Add(time.Minute), alert("A", "firing", "5 errors"), alert("B", "firing", "down"), alert("C", "firing", "slow"))
+	deliver(start.Add(2*time.Minute), alert("A", "resolved", "5 errors"), alert("C", "firing", "slow"))
+
+	timeline := groups.Timeline("{}:{job=\"api\"}")
+	if timeline == nil || len(timeline.Deliveries) != 3 {
+		t.Fatalf("Expected 3 deliveries, got %+v", timeline)
+	}
+
+	first := timeline.Deliveries[0]
+	if len(first.New) != 2 || first.Unchanged != 0 {
+		t.Errorf("Expected both alerts new in the first delivery, got %+v", first)
+	}
+
+	second := timeline.Deliveries[1]
+	if len(second.New) != 1 || second.New[0]["alertname"] != "C" || second.Unchanged != 1 {
+		t.Errorf("Expected C new and B unchanged, got %+v", second)
+	}
+	if len(second.Changed) != 1 || second.Changed[0].Annotation != "summary" || second.Changed[0].Old != "1 error" || second.Changed[0].New != "5 errors" {
+		t.Errorf("Expected the summary of A changed, got %+v", second.Changed)
+	}
+
+	// A resolved and B left the group
+	third := timeline.Deliveries[2]
+	if len(third.Resolved) != 2 || third.Resolved[0]["alertname"] != "A" || third.Resolved[1]["alertname"] != "B" || third.Unchanged != 1 {
+		t.Errorf("Expected A and B resolved, got %+v", third)
+	}
+
+	groups.record(WebhookPayload{Alerts: []Alert{alert("D", "firing", "")}}, start)
+	if list := groups.List(); len(list) != 1 || list[0].Firing != 1 {
+		t.Errorf("Expected only the grouped payloads listed, got %+v", list)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How far back resolved alerts are included in a handoff, unless configured
+const defaultHandoffWindow = 8 * time.Hour
+
+// HandoffConfig posts a shift-change summary to a chat webhook at fixed times
+type HandoffConfig struct {
+	Window     time.Duration `yaml:"window"`      // How far back resolved alerts are listed (default: 8h)
+	Times      []string      `yaml:"times"`       // Times of day to post the summary, e.g. ["08:00", "20:00"], in time_zone
+	WebhookURL string        `yaml:"webhook_url"` // Incoming webhook of Slack, Mattermost or similar, sent {"text": ...}
+}
+
+// Handoff summarizes the board for the next shift
+type Handoff struct {
+	GeneratedAt  time.Time    `json:"generatedAt"`
+	Window       string       `json:"window"`
+	Firing       []AlertEntry `json:"firing"`
+	Acknowledged []AlertEntry `json:"acknowledged"`
+	Resolved     []AlertEntry `json:"resolved"`
+	Incidents    []Incident   `json:"incidents"`
+	Banner       *Banner      `json:"banner,omitempty"`
+}
+
+// Handoff builds the shift-change summary, listing alerts resolved within
+// the window
+func (a *AppState) Handoff(window time.Duration) Handoff {
+	now := time.Now()
+	handoff := Handoff{
+		GeneratedAt:  now,
+		Window:       window.String(),
+		Firing:       []AlertEntry{},
+		Acknowledged: []AlertEntry{},
+		Resolved:     []AlertEntry{},
+	}
+
+	for _, entry := range a.GetAlerts() {
+		switch {
+		case entry.Alert.Status == "firing" && a.IsAcknowledged(entry.ID):
+			handoff.Acknowledged = append(handoff.Acknowledged, entry)
+		case entry.Alert.Status == "firing":
+			handoff.Firing = append(handoff.Firing, entry)
+		case now.Sub(entry.Timestamp) <= window:
+			handoff.Resolved = append(handoff.Resolved, entry)
+		}
+	}
+	handoff.Incidents = a.GetIncidents()
+	handoff.Banner = a.GetBanner()
+	return handoff
+}
+
+// Text renders the handoff as a short plain text message for chat
+func (h Handoff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Shift handoff (%s): %d firing, %d acknowledged, %d resolved in the last %s",
+		timeFormat.Absolute(h.GeneratedAt), len(h.Firing), len(h.Acknowledged), len(h.Resolved), h.Window)
+	if h.Banner != nil {
+		fmt.Fprintf(&b, "\nBanner: %s", h.Banner.Message)
+	}
+	for _, incident := range h.Incidents {
+		fmt.Fprintf(&b, "\nIncident in progress: %s (since %s)", incident.Title, timeFormat.Absolute(incident.StartedAt))
+	}
+	section := func(title string, entries []AlertEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:", title)
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "\n- %s (since %s)", alertTitle(entry.Alert), timeFormat.Absolute(entry.Alert.StartsAt))
+		}
+	}
+	section("Firing", h.Firing)
+	section("Acknowledged", h.Acknowledged)
+	section("Resolved", h.Resolved)
+	return b.String()
+}
+
+// alertDisplayName names an alert by its alertname and instance, if set
+func alertDisplayName(alert Alert) string {
+	name := alert.Labels["alertname"]
+	if name == "" {
+		name = "unnamed alert"
+	}
+	if instance := alert.Labels["instance"]; instance != "" {
+		name += " on " + instance
+	}
+	return name
+}
+
+// handoffWindow returns the configured handoff window
+func (a *AppState) handoffWindow() time.Duration {
+	if a.config != nil && a.config.Handoff != nil && a.config.Handoff.Window > 0 {
+		return a.config.Handoff.Window
+	}
+	return defaultHandoffWindow
+}
+
+// handoffHandler serves the handoff summary as JSON, or as HTML for
+// browsers and ?format=html. ?hours= overrides the resolved window.
+func handoffHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		window := state.handoffWindow()
+		if hours := r.URL.Query().Get("hours"); hours != "" {
+			var n float64
+			if _, err := fmt.Sscanf(hours, "%g", &n); err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid 'hours': %s", hours), http.StatusBadRequest)
+				return
+			}
+			window = time.Duration(n * float64(time.Hour))
+		}
+		handoff := state.Handoff(window)
+
+		format := r.URL.Query().Get("format")
+		if format == "html" || (format == "" && strings.Contains(r.Header.Get("Accept"), "text/html")) {
+			w.Header().Set("Content-Type", "text/html")
+			if err := state.templates.Execute(w, "handoff.html", handoff); err != nil {
+				log.Errorf("Error executing template: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handoff)
+	}
+}
+
+// parseHandoffTimes validates the configured times of day
+func parseHandoffTimes(times []string) ([]time.Duration, error) {
+	offsets := make([]time.Duration, 0, len(times))
+	for _, s := range times {
+		t, err := time.Parse("15:04", strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("handoff time %q: expected HH:MM", s)
+		}
+		offsets = append(offsets, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
+	}
+	return offsets, nil
+}
+
+// nextHandoff returns the next time of day after now, in the given zone
+func nextHandoff(now time.Time, offsets []time.Duration, location *time.Location) time.Time {
+	local := now.In(location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	var next time.Time
+	for day := 0; day < 2 && next.IsZero(); day++ {
+		for _, offset := range offsets {
+			t := midnight.AddDate(0, 0, day).Add(offset)
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+// runHandoffPoster posts the handoff summary to chat at the configured times
+func (a *AppState) runHandoffPoster(config *HandoffConfig, offsets []time.Duration) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		next := nextHandoff(time.Now(), offsets, timeFormat.location)
+		time.Sleep(time.Until(next))
+		if !a.cluster.isLeader() {
+			continue
+		}
+
+		if err := postChatMessage(client, config.WebhookURL, a.Handoff(a.handoffWindow()).Text()); err != nil {
+			log.Errorf("Failed to post shift handoff: %v", err)
+			continue
+		}
+		log.Infof("Posted shift handoff")
+	}
+}
+
+// postChatMessage sends a text message to a Slack-compatible incoming webhook
+func postChatMessage(client *http.Client, webhookURL, text string) error {
+	body, _ := json.Marshal(map[string]string{"text": text})
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("chat webhook returned %s", resp.Status)
+	}
+	return nil
+}
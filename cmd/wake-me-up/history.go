@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	historyFile = "history.jsonl"
+
+	defaultHistoryRetention = 7 * 24 * time.Hour
+	historyPruneInterval    = time.Hour
+	defaultHistoryLimit     = 500
+)
+
+// History event types
+const (
+	HistoryReceived     = "received"
+	HistoryAcknowledged = "acknowledged"
+	HistoryResolved     = "resolved" // a firing alert was replaced by its resolution
+	HistoryCleared      = "cleared"
+	HistoryEvicted      = "evicted" // pushed off a full board
+	HistoryEscalated    = "escalated"
+)
+
+// actorAutomatic acknowledges alerts without anyone acting on them, e.g.
+// alerts joining an open incident
+const actorAutomatic = "automatic"
+
+// HistoryEvent is something that happened to an alert
+type HistoryEvent struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	AlertID string            `json:"alertId"`
+	Status  string            `json:"status"` // of the alert at the time
+	Labels  map[string]string `json:"labels"`
+
+	// Of acknowledgements and escalations
+	Actor      string     `json:"actor,omitempty"`      // who acknowledged, if known
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"` // when the alert was received
+}
+
+// alertHistory keeps what happened to alerts, also after they left the
+// board, for the retention period. With a data_dir, events are appended to a
+// file in the background, which is rewritten when old events are pruned or
+// spilled to compressed segments beyond the memory limit.
+type alertHistory struct {
+	mu           sync.Mutex
+	events       []HistoryEvent // oldest first
+	flushed      int            // how many of the events are in the file
+	retention    time.Duration
+	memoryEvents int    // events kept in memory
+	diskBudget   int64  // bytes the segments may take
+	path         string // empty = memory only
+	segmentDir   string
+	segments     []historySegment // oldest first
+
+	signal chan struct{}
+	syncs  chan chan struct{}
+}
+
+func newAlertHistory() *alertHistory {
+	h := &alertHistory{
+		retention:    defaultHistoryRetention,
+		memoryEvents: defaultHistoryMemoryEvents,
+		diskBudget:   defaultHistoryDiskBudget,
+		signal:       make(chan struct{}, 1),
+		syncs:        make(chan chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// SetRetention sets how long events are kept
+func (h *alertHistory) SetRetention(retention time.Duration) {
+	h.mu.Lock()
+	h.retention = retention
+	h.mu.Unlock()
+}
+
+// SetLimits sets how many events are kept in memory and how many bytes the
+// events spilled to disk may take
+func (h *alertHistory) SetLimits(memoryEvents int, diskBudget int64) {
+	h.mu.Lock()
+	if memoryEvents > 0 {
+		h.memoryEvents = memoryEvents
+	}
+	if diskBudget > 0 {
+		h.diskBudget = diskBudget
+	}
+	h.mu.Unlock()
+}
+
+// Open loads the history file and the segments spilled next to it, and keeps
+// new events there
+func (h *alertHistory) Open(path string) error {
+	segmentDir := filepath.Join(filepath.Dir(path), historySegmentDir)
+	segments, err := loadHistorySegments(segmentDir)
+	if err != nil {
+		return err
+	}
+
+	var loaded []HistoryEvent
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		loaded, err = readHistoryEvents(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	// Events already in a segment were spilled just before a crash
+	if len(segments) > 0 {
+		last := segments[len(segments)-1].last
+		spilled := 0
+		for spilled < len(loaded) && !loaded[spilled].Time.After(last) {
+			spilled++
+		}
+		loaded = loaded[spilled:]
+	}
+
+	h.mu.Lock()
+	h.events = append(loaded, h.events...)
+	h.flushed = len(loaded)
+	h.path = path
+	h.segmentDir = segmentDir
+	h.segments = segments
+	h.mu.Unlock()
+	h.wake()
+	if len(loaded) > 0 || len(segments) > 0 {
+		log.Infof("Restored %d history events and %d spilled segments", len(loaded), len(segments))
+	}
+	return nil
+}
+
+// readHistoryEvents reads events written as JSON lines
+func readHistoryEvents(r io.Reader) ([]HistoryEvent, error) {
+	var events []HistoryEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var event HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line cut short by a crash loses only that event
+			log.Warnf("Skipping unreadable history event: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// Record adds events to the history. It never blocks on the disk, so it can
+// be called while holding the board lock.
+func (h *alertHistory) Record(events ...HistoryEvent) {
+	h.mu.Lock()
+	h.events = append(h.events, events...)
+	h.mu.Unlock()
+	h.wake()
+}
+
+// Sync writes the recorded events to the file, waiting until they are
+// written or the context ends
+func (h *alertHistory) Sync(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case h.syncs <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (h *alertHistory) wake() {
+	select {
+	case h.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run writes new events to the file, spills and prunes old ones. It is the
+// only writer of the files.
+func (h *alertHistory) run() {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.signal:
+			if err := h.flush(); err != nil {
+				log.Errorf("Failed to write history: %v", err)
+			}
+			if err := h.spill(); err != nil {
+				log.Errorf("Failed to spill history to disk: %v", err)
+			}
+		case now := <-ticker.C:
+			if err := h.prune(now); err != nil {
+				log.Errorf("Failed to prune history: %v", err)
+			}
+		case done := <-h.syncs:
+			if err := h.flush(); err != nil {
+				log.Errorf("Failed to write history: %v", err)
+			}
+			close(done)
+		}
+	}
+}
+
+// flush appends the events not yet in the file
+func (h *alertHistory) flush() error {
+	h.mu.Lock()
+	path := h.path
+	pending := append([]HistoryEvent(nil), h.events[h.flushed:]...)
+	h.mu.Unlock()
+	if path == "" || len(pending) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeHistoryEvents(file, pending); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.flushed += len(pending)
+	h.mu.Unlock()
+	return nil
+}
+
+// prune drops events older than the retention, rewriting the file, and the
+// segments holding only such events
+func (h *alertHistory) prune(now time.Time) error {
+	h.mu.Lock()
+	cutoff := now.Add(-h.retention)
+	var expiredSegments []historySegment
+	for len(h.segments) > 0 && h.segments[0].last.Before(cutoff) {
+		expiredSegments = append(expiredSegments, h.segments[0])
+		h.segments = h.segments[1:]
+	}
+	expired := 0
+	for expired < len(h.events) && h.events[expired].Time.Before(cutoff) {
+		expired++
+	}
+	h.events = append([]HistoryEvent(nil), h.events[expired:]...)
+	h.flushed = max(h.flushed-expired, 0)
+	path := h.path
+	kept := append([]HistoryEvent(nil), h.events[:h.flushed]...)
+	h.mu.Unlock()
+
+	removeHistorySegments(expiredSegments)
+	if expired == 0 || path == "" {
+		return nil
+	}
+	return rewriteHistory(path, kept)
+}
+
+// rewriteHistory atomically replaces the history file
+func rewriteHistory(path string, events []HistoryEvent) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeHistoryEvents(file, events); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeHistoryEvents writes events as JSON lines
+func writeHistoryEvents(w io.Writer, events []HistoryEvent) error {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// historyQuery selects events from the history
+type historyQuery struct {
+	Since, Until time.Time
+	Type         string
+	AlertID      string
+	AlertName    string
+	Limit        int
+}
+
+// matches reports whether an event is selected by the query
+func (q historyQuery) matches(event HistoryEvent) bool {
+	switch {
+	case !q.Since.IsZero() && event.Time.Before(q.Since),
+		!q.Until.IsZero() && event.Time.After(q.Until),
+		q.Type != "" && event.Type != q.Type,
+		q.AlertID != "" && event.AlertID != q.AlertID,
+		q.AlertName != "" && event.Labels["alertname"] != q.AlertName:
+		return false
+	}
+	return true
+}
+
+// Query returns the matching events, newest first. Events spilled to disk
+// are read back without holding the lock, so recording never waits on them.
+func (h *alertHistory) Query(q historyQuery) []HistoryEvent {
+	h.mu.Lock()
+	result := make([]HistoryEvent, 0)
+	for i := len(h.events) - 1; i >= 0 && len(result) < q.Limit; i-- {
+		if q.matches(h.events[i]) {
+			result = append(result, h.events[i])
+		}
+	}
+	segments := append([]historySegment(nil), h.segments...)
+	cutoff := time.Now().Add(-h.retention)
+	h.mu.Unlock()
+
+	return h.querySegments(segments, q, cutoff, result)
+}
+
+// recordHistory adds an event of a board alert to the history
+// This should be called while holding the lock
+func (a *AppState) recordHistory(eventType string, entry AlertEntry, now time.Time) {
+	a.history.Record(HistoryEvent{
+		Time:    now,
+		Type:    eventType,
+		AlertID: entry.ID,
+		Status:  entry.Alert.Status,
+		Labels:  entry.Alert.Labels,
+	})
+}
+
+// recordAck adds the acknowledgement of a board alert to the history
+// This should be called while holding the lock
+func (a *AppState) recordAck(entry AlertEntry, now time.Time, actor string) {
+	a.recordHandled(HistoryAcknowledged, entry, now, actor)
+}
+
+// recordHandled adds an acknowledgement or escalation to the history, with
+// the time the alert was received for response times
+// This should be called while holding the lock
+func (a *AppState) recordHandled(eventType string, entry AlertEntry, now time.Time, actor string) {
+	received := entry.Timestamp
+	a.history.Record(HistoryEvent{
+		Time:       now,
+		Type:       eventType,
+		AlertID:    entry.ID,
+		Status:     entry.Alert.Status,
+		Labels:     entry.Alert.Labels,
+		Actor:      actor,
+		ReceivedAt: &received,
+	})
+}
+
+// alertByID returns the board alert with the given ID
+// This should be called while holding the lock
+func (a *AppState) alertByID(alertID string) (AlertEntry, bool) {
+	for _, entry := range a.alerts {
+		if entry.ID == alertID {
+			return entry, true
+		}
+	}
+	return AlertEntry{}, false
+}
+
+// LoadHistory restores the history kept in data_dir and keeps it there
+func (a *AppState) LoadHistory() error {
+	path := a.dataFilePath(historyFile)
+	if path == "" {
+		return nil
+	}
+	return a.history.Open(path)
+}
+
+// historyHandler lists what happened to alerts, newest first. It takes
+// since/until (RFC 3339), type, id, alertname and limit parameters.
+func historyHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()
+		q := historyQuery{
+			Type:      params.Get("type"),
+			AlertID:   params.Get("id"),
+			AlertName: params.Get("alertname"),
+			Limit:     defaultHistoryLimit,
+		}
+		for name, target := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+			if value := params.Get(name); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid '%s' parameter: %v", name, err), http.StatusBadRequest)
+					return
+				}
+				*target = parsed
+			}
+		}
+		if value := params.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				http.Error(w, "Invalid 'limit' parameter", http.StatusBadRequest)
+				return
+			}
+			q.Limit = limit
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(state.history.Query(q)); err != nil {
+			log.Errorf("Error encoding history: %v", err)
+		}
+	}
+}
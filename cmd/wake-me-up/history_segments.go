@@ -0,0 +1,214 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	historySegmentDir = "history" // next to the history file
+
+	defaultHistoryMemoryEvents = 10000
+	defaultHistoryDiskBudget   = 256 << 20
+)
+
+// historySegment is a gzip compressed file of events spilled from memory,
+// oldest first, named after the times of its first and last event
+type historySegment struct {
+	path        string
+	first, last time.Time
+	size        int64
+}
+
+func historySegmentName(first, last time.Time) string {
+	return fmt.Sprintf("history-%d-%d.jsonl.gz", first.UnixNano(), last.UnixNano())
+}
+
+// loadHistorySegments lists the segments in a directory, oldest first
+func loadHistorySegments(dir string) ([]historySegment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []historySegment
+	for _, entry := range entries {
+		var first, last int64
+		if _, err := fmt.Sscanf(entry.Name(), "history-%d-%d.jsonl.gz", &first, &last); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, historySegment{
+			path:  filepath.Join(dir, entry.Name()),
+			first: time.Unix(0, first),
+			last:  time.Unix(0, last),
+			size:  info.Size(),
+		})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].first.Before(segments[j].first) })
+	return segments, nil
+}
+
+// writeHistorySegment writes events, oldest first, to a new segment
+func writeHistorySegment(dir string, events []HistoryEvent) (historySegment, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return historySegment{}, err
+	}
+	first, last := events[0].Time, events[len(events)-1].Time
+	path := filepath.Join(dir, historySegmentName(first, last))
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return historySegment{}, err
+	}
+	compressed := gzip.NewWriter(file)
+	if err := writeHistoryEvents(compressed, events); err != nil {
+		file.Close()
+		return historySegment{}, err
+	}
+	if err := compressed.Close(); err != nil {
+		file.Close()
+		return historySegment{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return historySegment{}, err
+	}
+	if err := file.Close(); err != nil {
+		return historySegment{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return historySegment{}, err
+	}
+	return historySegment{path: path, first: first, last: last, size: info.Size()}, nil
+}
+
+// readHistorySegment reads the events of a segment, oldest first
+func readHistorySegment(path string) ([]HistoryEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	defer compressed.Close()
+	return readHistoryEvents(compressed)
+}
+
+// removeHistorySegments deletes segment files that left the history
+func removeHistorySegments(segments []historySegment) {
+	for _, segment := range segments {
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Failed to remove history segment: %v", err)
+		}
+	}
+}
+
+// spill moves the oldest events beyond the memory limit to a segment, or
+// drops them when there is no history file. A batch is moved at a time, so
+// segments don't hold a single event each.
+func (h *alertHistory) spill() error {
+	h.mu.Lock()
+	if len(h.events) <= h.memoryEvents {
+		h.mu.Unlock()
+		return nil
+	}
+	count := len(h.events) - h.memoryEvents*3/4
+	if h.path == "" {
+		h.events = append([]HistoryEvent(nil), h.events[count:]...)
+		h.mu.Unlock()
+		return nil
+	}
+
+	// Only events in the file are spilled, and events of the same time stay
+	// together, so the events of the file newer than the last segment are
+	// exactly the ones not spilled yet
+	count = min(count, h.flushed)
+	for count > 0 && count < h.flushed && h.events[count].Time.Equal(h.events[count-1].Time) {
+		count++
+	}
+	if count == 0 || (count < len(h.events) && h.events[count].Time.Equal(h.events[count-1].Time)) {
+		h.mu.Unlock()
+		return nil
+	}
+	batch := append([]HistoryEvent(nil), h.events[:count]...)
+	dir := h.segmentDir
+	h.mu.Unlock()
+
+	segment, err := writeHistorySegment(dir, batch)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.events = append([]HistoryEvent(nil), h.events[count:]...)
+	h.flushed -= count
+	h.segments = append(h.segments, segment)
+	path := h.path
+	kept := append([]HistoryEvent(nil), h.events[:h.flushed]...)
+	evicted := h.overBudget()
+	h.mu.Unlock()
+
+	removeHistorySegments(evicted)
+	return rewriteHistory(path, kept)
+}
+
+// overBudget takes the oldest segments off the history until the rest fit
+// the disk budget, returning them for removal
+// This should be called while holding the lock
+func (h *alertHistory) overBudget() []historySegment {
+	var total int64
+	for _, segment := range h.segments {
+		total += segment.size
+	}
+	var evicted []historySegment
+	for len(h.segments) > 0 && total > h.diskBudget {
+		total -= h.segments[0].size
+		evicted = append(evicted, h.segments[0])
+		h.segments = h.segments[1:]
+	}
+	if len(evicted) > 0 {
+		log.Warnf("History exceeds its disk budget of %d bytes, dropped %d oldest segments", h.diskBudget, len(evicted))
+	}
+	return evicted
+}
+
+// querySegments adds the matching events of the segments to a result, newest
+// first, reading only the segments that can hold matches
+func (h *alertHistory) querySegments(segments []historySegment, q historyQuery, cutoff time.Time, result []HistoryEvent) []HistoryEvent {
+	for i := len(segments) - 1; i >= 0 && len(result) < q.Limit; i-- {
+		segment := segments[i]
+		if (!q.Since.IsZero() && segment.last.Before(q.Since)) || (!q.Until.IsZero() && segment.first.After(q.Until)) {
+			continue
+		}
+		events, err := readHistorySegment(segment.path)
+		if err != nil {
+			// Evicted while being queried
+			if !os.IsNotExist(err) {
+				log.Errorf("Failed to read history segment: %v", err)
+			}
+			continue
+		}
+		for j := len(events) - 1; j >= 0 && len(result) < q.Limit; j-- {
+			if !events[j].Time.Before(cutoff) && q.matches(events[j]) {
+				result = append(result, events[j])
+			}
+		}
+	}
+	return result
+}
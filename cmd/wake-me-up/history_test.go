@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistorySpillsToSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFile)
+	// Without the background writer, so the test drives flushing and spilling
+	newHistory := func() *alertHistory {
+		h := &alertHistory{retention: time.Hour, memoryEvents: 4, diskBudget: defaultHistoryDiskBudget, signal: make(chan struct{}, 1)}
+		if err := h.Open(path); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	h := newHistory()
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 10; i++ {
+		h.Record(HistoryEvent{Time: start.Add(time.Duration(i) * time.Second), Type: HistoryReceived, AlertID: fmt.Sprint(i)})
+		if err := h.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.spill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(h.events) > 4 || len(h.segments) == 0 {
+		t.Fatalf("Expected at most 4 events in memory and spilled segments, got %d and %d", len(h.events), len(h.segments))
+	}
+
+	// Queries read through to the segments, also after a restart
+	for _, h := range []*alertHistory{h, newHistory()} {
+		events := h.Query(historyQuery{Limit: 100})
+		if len(events) != 10 || events[0].AlertID != "9" || events[9].AlertID != "0" {
+			t.Fatalf("Expected all 10 events newest first, got %+v", events)
+		}
+		if events := h.Query(historyQuery{Until: start.Add(1500 * time.Millisecond), Limit: 100}); len(events) != 2 {
+			t.Fatalf("Expected the 2 oldest events, got %+v", events)
+		}
+	}
+
+	// Beyond the disk budget the oldest segments go
+	h.mu.Lock()
+	h.diskBudget = h.segments[len(h.segments)-1].size
+	removeHistorySegments(h.overBudget())
+	h.mu.Unlock()
+	if events := h.Query(historyQuery{Limit: 100}); len(events) == 10 || events[len(events)-1].AlertID == "0" {
+		t.Fatalf("Expected the oldest events to be dropped, got %+v", events)
+	}
+}
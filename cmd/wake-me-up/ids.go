@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Board entries, incidents, silences and reviews get IDs that sort by
+// creation time as plain strings, without collisions between the instances
+// of a cluster. Everywhere but here IDs are opaque, so the IDs of earlier
+// versions (UnixNano-index) restored from storage keep working.
+
+// ID formats
+const (
+	IDFormatULID      = "ulid"
+	IDFormatTimestamp = "timestamp" // UnixNano-index, as before ULIDs
+)
+
+// IDGenerator makes new IDs
+type IDGenerator interface {
+	NewID(now time.Time) string
+}
+
+// idGenerator makes the IDs of the instance, see id_format
+var idGenerator IDGenerator = &ulidGenerator{}
+
+// setIDFormat picks the ID generator
+func setIDFormat(format string) error {
+	switch format {
+	case "", IDFormatULID:
+		idGenerator = &ulidGenerator{}
+	case IDFormatTimestamp:
+		idGenerator = &timestampGenerator{}
+	default:
+		return fmt.Errorf("invalid id_format %q, expected ulid or timestamp", format)
+	}
+	return nil
+}
+
+// newEntryIDs makes the IDs of the entries of a payload
+func newEntryIDs(count int, now time.Time) []string {
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = idGenerator.NewID(now)
+	}
+	return ids
+}
+
+// legacyEntryIDs are the IDs instances of earlier versions give the entries
+// of a payload, derived from its timestamp
+func legacyEntryIDs(count int, timestamp time.Time) []string {
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%d-%d", timestamp.UnixNano(), i)
+	}
+	return ids
+}
+
+// crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator makes ULIDs: 48 bits of milliseconds and 80 random bits, in
+// 26 characters. IDs made within the same millisecond increment the random
+// part, so they still sort in the order they were made.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func (g *ulidGenerator) NewID(now time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := uint64(now.UnixMilli())
+	// The clock going back keeps the last time, not to sort before older IDs
+	ms = max(ms, g.lastMs)
+	if ms == g.lastMs && g.increment() {
+		return encodeULID(ms, g.entropy)
+	}
+	if ms == g.lastMs {
+		// 2^80 IDs in a millisecond: borrow the next one
+		ms++
+	}
+	if _, err := rand.Read(g.entropy[:]); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+	g.lastMs = ms
+	return encodeULID(ms, g.entropy)
+}
+
+// increment adds one to the random part, false when it overflowed
+func (g *ulidGenerator) increment() bool {
+	for i := len(g.entropy) - 1; i >= 0; i-- {
+		g.entropy[i]++
+		if g.entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bits of a ULID in base32, five bits per
+// character from the end
+func encodeULID(ms uint64, entropy [10]byte) string {
+	hi := ms<<16 | uint64(entropy[0])<<8 | uint64(entropy[1])
+	var lo uint64
+	for _, b := range entropy[2:] {
+		lo = lo<<8 | uint64(b)
+	}
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// timestampGenerator makes the IDs of earlier versions, numbering the IDs
+// made at the same nanosecond
+type timestampGenerator struct {
+	mu    sync.Mutex
+	last  int64
+	count int
+}
+
+func (g *timestampGenerator) NewID(now time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nanos := now.UnixNano()
+	if nanos != g.last {
+		g.last, g.count = nanos, 0
+	}
+	id := fmt.Sprintf("%d-%d", nanos, g.count)
+	g.count++
+	return id
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestULIDGenerator(t *testing.T) {
+	if id := encodeULID(1469918176385, [10]byte{}); id != "01ARYZ6S410000000000000000" {
+		t.Errorf("Expected the time encoded as in the ULID spec, got %s", id)
+	}
+
+	generator := &ulidGenerator{}
+	now := time.UnixMilli(1469918176385)
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, generator.NewID(now))
+	}
+	ids = append(ids, generator.NewID(now.Add(-time.Second)), generator.NewID(now.Add(time.Millisecond)))
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("Expected IDs to sort in the order they were made, got %v", ids)
+	}
+	for i, id := range ids {
+		if len(id) != 26 || (i > 0 && id == ids[i-1]) {
+			t.Fatalf("Expected unique 26 character IDs, got %v", ids)
+		}
+	}
+	if !strings.HasPrefix(ids[0], "01ARYZ6S41") || !strings.HasPrefix(ids[len(ids)-1], "01ARYZ6S42") {
+		t.Errorf("Expected the milliseconds in the first 10 characters, got %s and %s", ids[0], ids[len(ids)-1])
+	}
+
+	generator.entropy = [10]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if id := generator.NewID(now); !strings.HasPrefix(id, "01ARYZ6S43") {
+		t.Errorf("Expected an overflow to borrow the next millisecond, got %s", id)
+	}
+}
+
+func TestIDFormat(t *testing.T) {
+	defer setIDFormat("")
+	if err := setIDFormat("uuid"); err == nil {
+		t.Error("Expected an unknown format rejected")
+	}
+	if err := setIDFormat(IDFormatTimestamp); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 1700000000000000000)
+	if ids := newEntryIDs(2, now); ids[0] != "1700000000000000000-0" || ids[1] != "1700000000000000000-1" {
+		t.Errorf("Expected the IDs of earlier versions, got %v", ids)
+	}
+	if ids := legacyEntryIDs(2, now); ids[1] != "1700000000000000000-1" {
+		t.Errorf("Expected legacy IDs by payload index, got %v", ids)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const incidentsFile = "incidents.json"
+
+// How often an incident chimes for new related alerts, unless configured
+const defaultIncidentChimeInterval = 10 * time.Minute
+
+// Incident groups the alerts of a long-running outage. While it is open,
+// new alerts matching it are acknowledged on arrival and only chime once per
+// interval instead of sounding the alarm.
+type Incident struct {
+	ID            string            `json:"id"`
+	Title         string            `json:"title"`
+	Matchers      map[string]string `json:"matchers"`
+	StartedAt     time.Time         `json:"startedAt"`
+	ChimeInterval string            `json:"chimeInterval"`
+	LastChime     time.Time         `json:"lastChime"`
+}
+
+// matches checks if an alert carries all the labels of the incident
+func (i *Incident) matches(alert Alert) bool {
+	return len(i.Matchers) > 0 && labelsMatch(alert.Labels, i.Matchers)
+}
+
+// chimeDue reports whether enough time passed since the last chime, and
+// records a chime if so
+func (i *Incident) chimeDue(now time.Time) bool {
+	interval, err := time.ParseDuration(i.ChimeInterval)
+	if err != nil {
+		interval = defaultIncidentChimeInterval
+	}
+	if now.Sub(i.LastChime) < interval {
+		return false
+	}
+	i.LastChime = now
+	return true
+}
+
+// incidentFor returns the open incident an alert belongs to, or nil
+// This should be called while holding the lock
+func (a *AppState) incidentFor(alert Alert) *Incident {
+	for _, incident := range a.incidents {
+		if incident.matches(alert) {
+			return incident
+		}
+	}
+	return nil
+}
+
+// attachToIncidents assigns new firing alerts to the open incidents they
+// match and acknowledges them. It returns whether a chime is due.
+// This should be called while holding the lock
+func (a *AppState) attachToIncidents(entries []AlertEntry, now time.Time) bool {
+	chime := false
+	for i := range entries {
+		if entries[i].Alert.Status != "firing" {
+			continue
+		}
+		incident := a.incidentFor(entries[i].Alert)
+		if incident == nil {
+			continue
+		}
+		entries[i].IncidentID = incident.ID
+		a.acknowledged[entries[i].ID] = &Acknowledgement{At: now, Comment: "Incident: " + incident.Title}
+		a.suppressed.record(SuppressionIncident, incident.Title, entries[i].Alert)
+		log.Debugf("Alert %s joined incident %s", entries[i].ID, incident.ID)
+		if incident.chimeDue(now) {
+			chime = true
+		}
+	}
+	return chime
+}
+
+// GetIncidents returns copies of the open incidents
+func (a *AppState) GetIncidents() []Incident {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.incidentList()
+}
+
+// incidentList returns copies of the open incidents
+// This should be called while holding the lock
+func (a *AppState) incidentList() []Incident {
+	incidents := make([]Incident, len(a.incidents))
+	for i, incident := range a.incidents {
+		incidents[i] = *incident
+		incidents[i].Matchers = make(map[string]string, len(incident.Matchers))
+		for k, v := range incident.Matchers {
+			incidents[i].Matchers[k] = v
+		}
+	}
+	return incidents
+}
+
+// StartIncident opens an incident from a firing alert. The alert's values of
+// the given labels become the incident matchers, and every firing alert on
+// the board that matches is acknowledged and grouped under it.
+func (a *AppState) StartIncident(alertID, title string, labels []string, chimeInterval time.Duration) (*Incident, error) {
+	if len(labels) == 0 {
+		labels = []string{"alertname"}
+	}
+
+	a.mu.Lock()
+	var source *AlertEntry
+	for i := range a.alerts {
+		if a.alerts[i].ID == alertID {
+			source = &a.alerts[i]
+			break
+		}
+	}
+	if source == nil {
+		a.mu.Unlock()
+		return nil, errors.New("alert not found")
+	}
+	if source.IncidentID != "" {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("alert already belongs to incident %s", source.IncidentID)
+	}
+
+	matchers := make(map[string]string, len(labels))
+	for _, name := range labels {
+		value, ok := source.Alert.Labels[name]
+		if !ok {
+			a.mu.Unlock()
+			return nil, fmt.Errorf("alert has no label %q", name)
+		}
+		matchers[name] = value
+	}
+	if title == "" {
+		title = source.Alert.Labels["alertname"]
+	}
+
+	now := time.Now()
+	incident := &Incident{
+		ID:            "inc-" + idGenerator.NewID(now),
+		Title:         title,
+		Matchers:      matchers,
+		StartedAt:     now,
+		ChimeInterval: chimeInterval.String(),
+		LastChime:     now,
+	}
+	a.incidents = append(a.incidents, incident)
+	for i := range a.alerts {
+		entry := &a.alerts[i]
+		if entry.IncidentID == "" && entry.Alert.Status == "firing" && incident.matches(entry.Alert) {
+			entry.IncidentID = incident.ID
+			if a.acknowledged[entry.ID] == nil {
+				a.recordAck(*entry, now, actorAutomatic)
+			}
+			a.acknowledged[entry.ID] = &Acknowledgement{At: now, Comment: "Incident: " + incident.Title}
+		}
+	}
+	a.seq++
+	started := *incident
+	a.mu.Unlock()
+
+	a.saveIncidents()
+	log.Infof("Incident %s started: %q (%v)", started.ID, started.Title, started.Matchers)
+
+	// Broadcast update to all WebSocket clients
+	a.broadcastUpdate()
+	return &started, nil
+}
+
+// CloseIncident closes an incident, so matching alerts sound the alarm again.
+// Alerts already grouped under it stay acknowledged.
+func (a *AppState) CloseIncident(id string) bool {
+	a.mu.Lock()
+	found := false
+	for i, incident := range a.incidents {
+		if incident.ID == id {
+			a.incidents = append(a.incidents[:i], a.incidents[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found {
+		for i := range a.alerts {
+			if a.alerts[i].IncidentID == id {
+				a.alerts[i].IncidentID = ""
+			}
+		}
+		a.seq++
+	}
+	a.mu.Unlock()
+
+	if !found {
+		return false
+	}
+	a.saveIncidents()
+	log.Infof("Incident %s closed", id)
+
+	// Broadcast update to all WebSocket clients
+	a.broadcastUpdate()
+	return true
+}
+
+// chime tells the dashboards to play the alarm once
+func (a *AppState) chime() {
+	a.hub.broadcast <- a.audible([]byte(`{"type":"chime"}`))
+}
+
+// saveIncidents persists the open incidents to the data directory
+func (a *AppState) saveIncidents() {
+	path := a.dataFilePath(incidentsFile)
+	if path == "" {
+		return
+	}
+	if err := saveJSON(path, a.GetIncidents()); err != nil {
+		log.Errorf("Failed to persist incidents: %v", err)
+	}
+}
+
+// LoadIncidents restores the incidents that were open at shutdown
+func (a *AppState) LoadIncidents() error {
+	path := a.dataFilePath(incidentsFile)
+	if path == "" {
+		return nil
+	}
+
+	var incidents []Incident
+	if _, err := loadJSON(path, &incidents); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	for i := range incidents {
+		a.incidents = append(a.incidents, &incidents[i])
+	}
+	a.mu.Unlock()
+	if len(incidents) > 0 {
+		log.Infof("Restored %d open incidents", len(incidents))
+	}
+	return nil
+}
+
+// incidentRequest is the body accepted when starting an incident
+type incidentRequest struct {
+	AlertID       string   `json:"alertId"`
+	Title         string   `json:"title"`
+	Labels        []string `json:"labels,omitempty"`
+	ChimeInterval string   `json:"chimeInterval,omitempty"`
+}
+
+// incidentsHandler lists (GET), starts (POST) or closes (DELETE ?id=) incidents
+func incidentsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.GetIncidents())
+
+		case http.MethodPost:
+			var req incidentRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if req.AlertID == "" {
+				http.Error(w, "Missing 'alertId'", http.StatusBadRequest)
+				return
+			}
+
+			chimeInterval := state.config.IncidentChimeInterval
+			if chimeInterval <= 0 {
+				chimeInterval = defaultIncidentChimeInterval
+			}
+			if req.ChimeInterval != "" {
+				interval, err := time.ParseDuration(req.ChimeInterval)
+				if err != nil || interval <= 0 {
+					http.Error(w, fmt.Sprintf("Invalid 'chimeInterval': %s", req.ChimeInterval), http.StatusBadRequest)
+					return
+				}
+				chimeInterval = interval
+			}
+
+			incident, err := state.StartIncident(req.AlertID, strings.TrimSpace(req.Title), req.Labels, chimeInterval)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			audit.RecordRequest(r, AuditIncidentChange, 3, "Incident started", map[string]string{"incidentId": incident.ID, "title": incident.Title})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(incident)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "Missing incident ID", http.StatusBadRequest)
+				return
+			}
+			if !state.CloseIncident(id) {
+				http.Error(w, "Incident not found", http.StatusNotFound)
+				return
+			}
+			audit.RecordRequest(r, AuditIncidentChange, 3, "Incident closed", map[string]string{"incidentId": id})
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
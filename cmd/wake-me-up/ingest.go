@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// ingestPlan describes how a webhook payload changes the board, so it can be
+// applied to the state or just reported back by the dry-run endpoint
+type ingestPlan struct {
+	Created  []AlertEntry     // new entries, newest first
+	Resolved map[string]Alert // firing entry ID -> resolved alert that removes it
+	Dropped  []Alert          // resolved alerts that matched no firing alert
+	Outcomes []AlertOutcome   // per payload alert outcome, in payload order
+
+	Replica    string   // Alertmanager replica that sent the payload
+	Duplicates []string // IDs of the entries that alerts delivered first by another replica created
+}
+
+// AlertOutcome reports what happened to a single alert of a payload
+type AlertOutcome struct {
+	Alert    Alert    `json:"alert"`
+	Outcome  string   `json:"outcome"`            // created, dropped or duplicate
+	ID       string   `json:"id,omitempty"`       // ID of the created entry, or of the entry it duplicates
+	Resolves []string `json:"resolves,omitempty"` // IDs of the firing entries it resolves
+
+	IncidentID string `json:"incidentId,omitempty"` // open incident the created entry joined
+}
+
+// preparedPayload is a payload with its entries built and resolved alerts
+// indexed, which needs no lock, so concurrent webhooks only serialize on the
+// matching against the board
+type preparedPayload struct {
+	payload  WebhookPayload
+	entries  []AlertEntry   // candidate entries, by payload index
+	resolves map[string]int // fingerprint -> index of the first resolved alert carrying it
+}
+
+// prepareWebhook builds the entries of a payload with their IDs, by payload
+// index, and indexes its resolved alerts
+func prepareWebhook(payload WebhookPayload, timestamp time.Time, ids []string) preparedPayload {
+	prepared := preparedPayload{
+		payload:  payload,
+		entries:  make([]AlertEntry, len(payload.Alerts)),
+		resolves: make(map[string]int),
+	}
+	for i, alert := range payload.Alerts {
+		prepared.entries[i] = AlertEntry{
+			ID:          ids[i],
+			Timestamp:   timestamp,
+			Alert:       alert,
+			Receiver:    payload.Receiver,
+			ExternalURL: payload.ExternalURL,
+			fingerprint: labelFingerprint(alert.Labels),
+			deliveryKey: deliveryKey(payload.GroupKey, alert),
+		}
+		if alert.Status == "firing" {
+			prepared.entries[i].Rule = alertRules.lookup(alert)
+		}
+		fingerprint := prepared.entries[i].fingerprint
+		if alert.Status != "resolved" || fingerprint == "" {
+			continue
+		}
+		if _, ok := prepared.resolves[fingerprint]; !ok {
+			prepared.resolves[fingerprint] = i
+		}
+	}
+	return prepared
+}
+
+// planWebhook computes the changes a payload makes without applying them
+// This should be called while holding the lock
+func (a *AppState) planWebhook(payload WebhookPayload, timestamp time.Time) ingestPlan {
+	return a.planPrepared(prepareWebhook(payload, timestamp, newEntryIDs(len(payload.Alerts), timestamp)))
+}
+
+// planPrepared matches a prepared payload against the board in a single pass
+// This should be called while holding the lock
+func (a *AppState) planPrepared(prepared preparedPayload) ingestPlan {
+	alerts := prepared.payload.Alerts
+	plan := ingestPlan{
+		Resolved: make(map[string]Alert),
+		Outcomes: make([]AlertOutcome, 0, len(alerts)),
+		Replica:  payloadReplica(prepared.payload),
+	}
+
+	// Alerts another replica delivered first only count for that delivery
+	duplicateOf := make(map[int]string)
+	for i, entry := range prepared.entries {
+		if original, ok := a.replicas.duplicateOf(entry.deliveryKey, entry.Timestamp); ok {
+			duplicateOf[i] = original
+		}
+	}
+
+	// Resolved alerts remove the firing alerts whose labels match exactly
+	resolves := make(map[int][]string)
+	matched := make(map[string]bool)
+	if len(prepared.resolves) > 0 {
+		for _, entry := range a.alerts {
+			if entry.Alert.Status != "firing" {
+				continue
+			}
+			fingerprint := entry.labelFingerprint()
+			if i, ok := prepared.resolves[fingerprint]; ok && duplicateOf[i] == "" {
+				plan.Resolved[entry.ID] = alerts[i]
+				resolves[i] = append(resolves[i], entry.ID)
+				matched[fingerprint] = true
+			}
+		}
+	}
+
+	// Extract each alert and store it individually
+	// For resolved alerts, only add them if they matched a firing alert
+	for i, alert := range alerts {
+		outcome := AlertOutcome{Alert: alert, Resolves: resolves[i]}
+		entry := prepared.entries[i]
+
+		if original, ok := duplicateOf[i]; ok {
+			plan.Duplicates = append(plan.Duplicates, original)
+			outcome.Outcome = "duplicate"
+			outcome.ID = original
+			plan.Outcomes = append(plan.Outcomes, outcome)
+			continue
+		}
+
+		if alert.Status == "resolved" && !matched[entry.fingerprint] {
+			plan.Dropped = append(plan.Dropped, alert)
+			outcome.Outcome = "dropped"
+			plan.Outcomes = append(plan.Outcomes, outcome)
+			continue
+		}
+
+		plan.Created = append(plan.Created, entry)
+		outcome.Outcome = "created"
+		outcome.ID = entry.ID
+		plan.Outcomes = append(plan.Outcomes, outcome)
+	}
+
+	return plan
+}
+
+// applyPlan applies a planned payload to the board
+// This should be called while holding the lock
+func (a *AppState) applyPlan(plan ingestPlan) {
+	now := time.Now()
+	for _, alert := range plan.Dropped {
+		log.Debugf("Ignoring resolved alert that didn't match any firing alert: %v", alert.Labels)
+	}
+	a.replicas.observe(plan, now)
+	for _, entryID := range plan.Duplicates {
+		a.addReplica(entryID, plan.Replica)
+	}
+
+	// Someone already saw the alerts resolving acknowledged ones
+	seen := make(map[string]*Acknowledgement)
+	if len(plan.Resolved) > 0 {
+		filtered := make([]AlertEntry, 0, len(a.alerts)+len(plan.Created))
+		for _, entry := range a.alerts {
+			if resolvedBy, ok := plan.Resolved[entry.ID]; ok {
+				log.Debugf("Removing firing alert %s - matches resolved alert with labels: %v", entry.ID, resolvedBy.Labels)
+				if ack := a.acknowledged[entry.ID]; ack != nil {
+					seen[entry.labelFingerprint()] = ack
+				}
+				delete(a.acknowledged, entry.ID)
+				a.addTombstone(entry.ID, "resolved")
+				a.recordHistory(HistoryResolved, entry, now)
+				a.recordGone(entry, now)
+				continue
+			}
+			filtered = append(filtered, entry)
+		}
+		a.alerts = filtered
+	}
+
+	a.markRefired(plan.Created, now)
+	if resolvedRequiresAck {
+		for _, entry := range plan.Created {
+			if ack := seen[entry.labelFingerprint()]; entry.Alert.Status == "resolved" && ack != nil {
+				a.acknowledged[entry.ID] = ack
+			}
+		}
+	}
+
+	// The board is kept oldest first, so new alerts are appended and the
+	// oldest evicted from the front without copying the rest
+	a.alerts = append(a.alerts, plan.Created...)
+	a.seq++
+	for _, entry := range plan.Created {
+		a.search.add(entry.ID, a.searchFields(entry))
+		a.recordHistory(HistoryReceived, entry, now)
+		if a.acknowledged[entry.ID] != nil {
+			// Joined an open incident or silenced
+			a.recordAck(entry, now, actorAutomatic)
+		}
+	}
+
+	// Keep only the most recent alerts
+	if excess := len(a.alerts) - a.maxSize; excess > 0 {
+		for _, evicted := range a.alerts[:excess] {
+			delete(a.acknowledged, evicted.ID)
+			a.addTombstone(evicted.ID, "evicted")
+			a.recordHistory(HistoryEvicted, evicted, now)
+		}
+		clear(a.alerts[:excess])
+		a.alerts = a.alerts[excess:]
+	}
+}
+
+// IngestResult summarizes what a payload did to the board
+type IngestResult struct {
+	Alerts   []AlertOutcome `json:"alerts"`
+	Created  int            `json:"created"`
+	Resolved int            `json:"resolved"`
+	Dropped  int            `json:"dropped"`
+
+	Duplicates int  `json:"duplicates,omitempty"` // alerts another Alertmanager replica delivered first, see replica_dedup_window
+	Duplicate  bool `json:"duplicate,omitempty"`  // already received by another instance of the cluster
+	Coalesced  bool `json:"coalesced,omitempty"`  // held, to be ingested with the next deliveries of its group at the end of ingest_throttle
+}
+
+// result summarizes the plan
+func (p ingestPlan) result() IngestResult {
+	return IngestResult{
+		Alerts:     p.Outcomes,
+		Created:    len(p.Created),
+		Resolved:   len(p.Resolved),
+		Dropped:    len(p.Dropped),
+		Duplicates: len(p.Duplicates),
+	}
+}
+
+// decodeWebhook reads and decodes a webhook body, writing the error response
+// if it can't. Bodies must be sent as application/json, except from the
+// receivers listed in content_type_exceptions: senders posting forms or text
+// are rejected with 415 up front instead of failing on confusing JSON errors.
+func decodeWebhook(w http.ResponseWriter, r *http.Request, state *AppState) (WebhookPayload, bool) {
+	var payload WebhookPayload
+	isJSON := isJSONContentType(r.Header.Get("Content-Type"))
+	if !isJSON && len(state.config.ContentTypeExceptions) == 0 {
+		http.Error(w, errUnsupportedContentType.Error(), http.StatusUnsupportedMediaType)
+		return payload, false
+	}
+
+	body, err := readWebhookBody(w, r, state.maxWebhookBody())
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return payload, false
+	}
+
+	payload, err = decodePayload(body, state.config.LenientPayloads, time.Now())
+	if err != nil {
+		if !isJSON {
+			http.Error(w, errUnsupportedContentType.Error(), http.StatusUnsupportedMediaType)
+			return payload, false
+		}
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return payload, false
+	}
+	if !isJSON && !state.contentTypeException(payload.Receiver) {
+		http.Error(w, errUnsupportedContentType.Error(), http.StatusUnsupportedMediaType)
+		return payload, false
+	}
+	return payload, true
+}
+
+// contentTypeException checks if a receiver may send webhooks without the
+// application/json content type
+func (a *AppState) contentTypeException(receiver string) bool {
+	for _, exception := range a.config.ContentTypeExceptions {
+		if exception == receiver {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONContentType checks for application/json, with any parameters such as charset
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// DryRunResult is returned by the ingest dry-run endpoint
+type DryRunResult struct {
+	Receiver string `json:"receiver"`
+	IngestResult
+}
+
+// dryRunHandler runs a payload through ingestion and reports the outcome
+// without changing the board
+func dryRunHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		receiver := r.URL.Query().Get("receiver")
+		if receiver == "" {
+			receiver = "alertmanager"
+		}
+		if receiver != "alertmanager" {
+			http.Error(w, fmt.Sprintf("Unknown receiver: %s", receiver), http.StatusBadRequest)
+			return
+		}
+
+		payload, ok := decodeWebhook(w, r, state)
+		if !ok {
+			return
+		}
+
+		state.tagSourceZone(&payload, getClientIP(r))
+
+		state.mu.RLock()
+		plan := state.planWebhook(payload, time.Now())
+		state.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DryRunResult{Receiver: receiver, IngestResult: plan.result()})
+	}
+}
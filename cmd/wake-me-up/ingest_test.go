@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// alertPayload builds a payload of n alerts with the given status, labelled
+// instance-<offset+i>
+func alertPayload(status string, offset, n int) WebhookPayload {
+	payload := WebhookPayload{Status: status, Receiver: "test", Alerts: make([]Alert, n)}
+	for i := range payload.Alerts {
+		payload.Alerts[i] = Alert{
+			Status:   status,
+			Labels:   map[string]string{"alertname": "Bench", "instance": fmt.Sprintf("instance-%d", offset+i)},
+			StartsAt: time.Now(),
+		}
+	}
+	return payload
+}
+
+func TestAddWebhookResolvesAndEvicts(t *testing.T) {
+	state := NewAppState(3)
+	state.AddWebhook(alertPayload("firing", 0, 2))
+	state.AddWebhook(alertPayload("firing", 2, 2))
+
+	// The oldest alert is evicted, newest first on the board
+	alerts := state.GetAlerts()
+	if len(alerts) != 3 || alerts[0].Alert.Labels["instance"] != "instance-3" || alerts[2].Alert.Labels["instance"] != "instance-1" {
+		t.Fatalf("Unexpected board after eviction: %v", alerts)
+	}
+
+	result := state.AddWebhook(alertPayload("resolved", 1, 2))
+	if result.Resolved != 2 || result.Created != 2 || result.Dropped != 0 {
+		t.Fatalf("Expected two resolved alerts, got %+v", result)
+	}
+	if got := result.Alerts[0].Resolves; len(got) != 1 || got[0] != alerts[2].ID {
+		t.Fatalf("instance-1 should resolve %s, got %v", alerts[2].ID, got)
+	}
+
+	result = state.AddWebhook(alertPayload("resolved", 0, 1))
+	if result.Dropped != 1 {
+		t.Fatalf("Resolving an evicted alert should be dropped, got %+v", result)
+	}
+}
+
+func BenchmarkPlanWebhook(b *testing.B) {
+	state := NewAppState(5000)
+	state.AddWebhook(alertPayload("firing", 0, 5000))
+	payload := alertPayload("resolved", 2500, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.mu.RLock()
+		state.planWebhook(payload, time.Now())
+		state.mu.RUnlock()
+	}
+}
+
+// BenchmarkAddWebhookParallel sends concurrent bursts of firing and
+// resolving payloads against a full board
+func BenchmarkAddWebhookParallel(b *testing.B) {
+	state := NewAppState(1000)
+	state.AddWebhook(alertPayload("firing", 0, 1000))
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			offset := int(next.Add(10)) % 2000
+			state.AddWebhook(alertPayload("firing", offset, 10))
+			state.AddWebhook(alertPayload("resolved", offset, 10))
+		}
+	})
+}
+
+func TestRefiredAlerts(t *testing.T) {
+	state := NewAppState(10)
+	state.AddWebhook(alertPayload("firing", 0, 2))
+	state.AddWebhook(alertPayload("resolved", 0, 1))
+
+	// instance-0 went away and fires again, instance-2 is brand new
+	state.AddWebhook(alertPayload("firing", 0, 1))
+	state.AddWebhook(alertPayload("firing", 2, 1))
+	refired := make(map[string]bool)
+	for _, entry := range state.GetAlerts() {
+		if entry.Alert.Status == "firing" {
+			refired[entry.Alert.Labels["instance"]] = entry.Refired
+		}
+	}
+	if !refired["instance-0"] || refired["instance-1"] || refired["instance-2"] {
+		t.Fatalf("Expected only instance-0 to be re-fired, got %v", refired)
+	}
+
+	// Outside the window it counts as new again
+	state.mu.Lock()
+	state.refireWindow = time.Millisecond
+	state.mu.Unlock()
+	state.AddWebhook(alertPayload("resolved", 1, 1))
+	time.Sleep(5 * time.Millisecond)
+	state.AddWebhook(alertPayload("firing", 1, 1))
+	if alerts := state.GetAlerts(); alerts[0].Refired {
+		t.Fatalf("Expected %s outside the window not to be re-fired", alerts[0].ID)
+	}
+}
+
+func TestResolvedRequiresAck(t *testing.T) {
+	resolvedRequiresAck = true
+	defer func() { resolvedRequiresAck = false }()
+
+	state := NewAppState(10)
+	state.AddWebhook(alertPayload("firing", 0, 2))
+	alerts := state.GetAlerts()
+	acked := alerts[0].Alert.Labels["instance"]
+	state.Acknowledge(alerts[0].ID, "")
+	state.AddWebhook(alertPayload("resolved", 0, 2))
+
+	// The resolution of the acknowledged alert was seen, the other one wasn't
+	if !state.HasUnacknowledgedAlerts() || state.StatusLevel() != StatusLevelWarning {
+		t.Fatalf("Expected the unseen resolution to count as unacknowledged")
+	}
+	if _, err := state.ClearAcknowledgedAndResolved(nil); err != nil {
+		t.Fatal(err)
+	}
+	alerts = state.GetAlerts()
+	if len(alerts) != 1 || alerts[0].Alert.Labels["instance"] == acked {
+		t.Fatalf("Expected only the unseen resolution to stay on the board, got %v", alerts)
+	}
+
+	state.Acknowledge(alerts[0].ID, "")
+	if state.HasUnacknowledgedAlerts() {
+		t.Fatalf("Expected no unacknowledged alerts after acknowledging the resolution")
+	}
+}
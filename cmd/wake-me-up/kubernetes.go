@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultKubernetesInterval     = 30 * time.Second
+	defaultKubernetesResolveAfter = 10 * time.Minute
+	defaultKubernetesReceiver     = "kubernetes-events"
+	defaultKubernetesSeverity     = "warning"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// KubernetesEventsConfig turns the Warning events of a Kubernetes cluster
+// into alerts, for small clusters without a Prometheus stack
+type KubernetesEventsConfig struct {
+	Kubeconfig    string        `yaml:"kubeconfig"`     // Path of a kubeconfig (optional, default: the in-cluster service account)
+	Context       string        `yaml:"context"`        // Context of the kubeconfig (optional, default: its current-context)
+	Namespace     string        `yaml:"namespace"`      // Only events of this namespace (optional, default: all namespaces)
+	FieldSelector string        `yaml:"field_selector"` // Field selector the events must match too, e.g. involvedObject.kind=Pod (optional)
+	LabelSelector string        `yaml:"label_selector"` // Label selector of the events (optional)
+	Reasons       []string      `yaml:"reasons"`        // Only events with these reasons, e.g. BackOff, FailedScheduling (optional, default: all)
+	Interval      time.Duration `yaml:"interval"`       // How often to list the events (optional, default: 30s)
+	ResolveAfter  time.Duration `yaml:"resolve_after"`  // Resolve an alert once its object had no such event for this long (optional, default: 10m)
+	Receiver      string        `yaml:"receiver"`       // Receiver shown on the board (optional, default: kubernetes-events)
+	Severity      string        `yaml:"severity"`       // Severity label of the alerts (optional, default: warning)
+}
+
+// kubeEvent is an event of the Kubernetes core v1 API
+type kubeEvent struct {
+	Metadata struct {
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"involvedObject"`
+	Reason         string     `json:"reason"`
+	Message        string     `json:"message"`
+	Type           string     `json:"type"`
+	Count          int        `json:"count"`
+	FirstTimestamp *time.Time `json:"firstTimestamp"`
+	LastTimestamp  *time.Time `json:"lastTimestamp"`
+	EventTime      *time.Time `json:"eventTime"`
+}
+
+// lastSeen is when the event last happened; events of newer clients only
+// carry eventTime
+func (e kubeEvent) lastSeen() time.Time {
+	switch {
+	case e.LastTimestamp != nil && !e.LastTimestamp.IsZero():
+		return *e.LastTimestamp
+	case e.EventTime != nil && !e.EventTime.IsZero():
+		return *e.EventTime
+	}
+	return e.Metadata.CreationTimestamp
+}
+
+// firstSeen is when the event first happened
+func (e kubeEvent) firstSeen() time.Time {
+	if e.FirstTimestamp != nil && !e.FirstTimestamp.IsZero() {
+		return *e.FirstTimestamp
+	}
+	return e.lastSeen()
+}
+
+// kubeAPI is the address and credentials of a Kubernetes API server
+type kubeAPI struct {
+	server    string
+	client    *http.Client
+	token     string
+	tokenFile string // read on every request, service account tokens rotate
+	username  string
+	password  string
+}
+
+// kubeconfig is the part of a kubeconfig file used to reach the API server
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			Username              string      `yaml:"username"`
+			Password              string      `yaml:"password"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeconfigData reads inline base64 data, or a file relative to the kubeconfig
+func kubeconfigData(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	return os.ReadFile(file)
+}
+
+// loadKubeconfig reads the server and credentials of a kubeconfig context
+func loadKubeconfig(path, contextName string) (*kubeAPI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	var clusterName, userName string
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in %s", contextName, path)
+	}
+
+	dir := filepath.Dir(path)
+	api := &kubeAPI{}
+	tlsConfig := &tls.Config{}
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		api.server = c.Cluster.Server
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := kubeconfigData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: certificate authority: %v", clusterName, err)
+		}
+		if ca != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("cluster %s: no certificates in the certificate authority", clusterName)
+			}
+		}
+	}
+	if api.server == "" {
+		return nil, fmt.Errorf("cluster %q not found in %s", clusterName, path)
+	}
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil {
+			return nil, fmt.Errorf("user %s: exec credential plugins are not supported, use a token or client certificate", userName)
+		}
+		api.token, api.username, api.password = u.User.Token, u.User.Username, u.User.Password
+		if u.User.TokenFile != "" {
+			api.tokenFile = u.User.TokenFile
+			if !filepath.IsAbs(api.tokenFile) {
+				api.tokenFile = filepath.Join(dir, api.tokenFile)
+			}
+		}
+		cert, err := kubeconfigData(u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: client certificate: %v", userName, err)
+		}
+		key, err := kubeconfigData(u.User.ClientKeyData, u.User.ClientKey, dir)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: client key: %v", userName, err)
+		}
+		if cert != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %v", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	api.client = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return api, nil
+}
+
+// inClusterAPI reaches the API server with the pod's service account
+func inClusterAPI() (*kubeAPI, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster, set kubeconfig")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in the service account CA")
+	}
+	return &kubeAPI{
+		server:    "https://" + net.JoinHostPort(host, port),
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+	}, nil
+}
+
+// get fetches a path of the API server as JSON
+func (k *kubeAPI) get(path string, query url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(k.server, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	token := k.token
+	if k.tokenFile != "" {
+		data, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case k.username != "":
+		req.SetBasicAuth(k.username, k.password)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kubernetes API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// kubernetesEventsPoller feeds the Warning events of a cluster to the board
+// as alerts, one per object and reason, resolving those that stopped recurring
+type kubernetesEventsPoller struct {
+	config       *KubernetesEventsConfig
+	api          *kubeAPI
+	path         string
+	query        url.Values
+	reasons      map[string]bool
+	resolveAfter time.Duration
+	receiver     string
+	severity     string
+
+	firing map[string]Alert // fingerprint -> alert fed to the board as firing
+	seeded bool
+}
+
+func newKubernetesEventsPoller(config *KubernetesEventsConfig) (*kubernetesEventsPoller, error) {
+	if config.Interval < 0 || config.ResolveAfter < 0 {
+		return nil, errors.New("interval and resolve_after must be positive")
+	}
+	var api *kubeAPI
+	var err error
+	if config.Kubeconfig != "" {
+		api, err = loadKubeconfig(config.Kubeconfig, config.Context)
+	} else {
+		api, err = inClusterAPI()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &kubernetesEventsPoller{
+		config:       config,
+		api:          api,
+		path:         "/api/v1/events",
+		query:        url.Values{},
+		resolveAfter: config.ResolveAfter,
+		receiver:     config.Receiver,
+		severity:     config.Severity,
+		firing:       make(map[string]Alert),
+	}
+	if config.Namespace != "" {
+		p.path = "/api/v1/namespaces/" + url.PathEscape(config.Namespace) + "/events"
+	}
+	fieldSelector := "type=Warning"
+	if config.FieldSelector != "" {
+		fieldSelector += "," + config.FieldSelector
+	}
+	p.query.Set("fieldSelector", fieldSelector)
+	if config.LabelSelector != "" {
+		p.query.Set("labelSelector", config.LabelSelector)
+	}
+	if len(config.Reasons) > 0 {
+		p.reasons = make(map[string]bool, len(config.Reasons))
+		for _, reason := range config.Reasons {
+			p.reasons[reason] = true
+		}
+	}
+	if p.resolveAfter == 0 {
+		p.resolveAfter = defaultKubernetesResolveAfter
+	}
+	if p.receiver == "" {
+		p.receiver = defaultKubernetesReceiver
+	}
+	if p.severity == "" {
+		p.severity = defaultKubernetesSeverity
+	}
+	return p, nil
+}
+
+// fetch returns the Warning events matching the selectors
+func (p *kubernetesEventsPoller) fetch() ([]kubeEvent, error) {
+	var list struct {
+		Items []kubeEvent `json:"items"`
+	}
+	if err := p.api.get(p.path, p.query, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// eventAlert is the alert of the object and reason of an event
+func (p *kubernetesEventsPoller) eventAlert(event kubeEvent) Alert {
+	return Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": event.Reason,
+			"namespace": event.InvolvedObject.Namespace,
+			"kind":      event.InvolvedObject.Kind,
+			"object":    event.InvolvedObject.Name,
+			"severity":  p.severity,
+		},
+		Annotations: map[string]string{"summary": event.Message},
+		StartsAt:    event.firstSeen(),
+	}
+}
+
+// reconcile turns the listed events into a payload of the alerts whose
+// events started recurring and of those whose events stopped for
+// resolve_after, as the object recovered
+func (p *kubernetesEventsPoller) reconcile(events []kubeEvent, now time.Time) WebhookPayload {
+	payload := WebhookPayload{Status: "resolved", Receiver: p.receiver}
+	current := make(map[string]Alert)
+	for _, event := range events {
+		if event.Type != "Warning" || (p.reasons != nil && !p.reasons[event.Reason]) {
+			continue
+		}
+		if now.Sub(event.lastSeen()) >= p.resolveAfter {
+			continue
+		}
+		alert := p.eventAlert(event)
+		fingerprint := labelFingerprint(alert.Labels)
+		if known, ok := current[fingerprint]; ok && known.StartsAt.Before(alert.StartsAt) {
+			alert.StartsAt = known.StartsAt
+		}
+		current[fingerprint] = alert
+	}
+	for fingerprint, alert := range current {
+		if _, known := p.firing[fingerprint]; !known {
+			payload.Status = "firing"
+			payload.Alerts = append(payload.Alerts, alert)
+		}
+	}
+	for fingerprint, alert := range p.firing {
+		if _, ok := current[fingerprint]; !ok {
+			endsAt := now
+			alert.Status = "resolved"
+			alert.EndsAt = &endsAt
+			payload.Alerts = append(payload.Alerts, alert)
+		}
+	}
+	p.firing = current
+	return payload
+}
+
+// seed takes the event alerts already firing on the board as known, so a
+// restart with a restored board doesn't add them again
+func (p *kubernetesEventsPoller) seed(state *AppState) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	for _, entry := range state.alerts {
+		if entry.Receiver == p.receiver && entry.Alert.Status == "firing" {
+			p.firing[entry.labelFingerprint()] = entry.Alert
+		}
+	}
+}
+
+// poll lists the events once and applies the changes to the board
+func (p *kubernetesEventsPoller) poll(state *AppState) error {
+	events, err := p.fetch()
+	if err != nil {
+		// Keep what is known, a failed list says nothing about the objects
+		return err
+	}
+	if !p.seeded {
+		p.seed(state)
+		p.seeded = true
+	}
+	payload := p.reconcile(events, time.Now())
+	if len(payload.Alerts) == 0 {
+		return nil
+	}
+	result := state.AddWebhook(payload)
+	webhooksReceived.WithLabelValues("kubernetes_events").Inc()
+	log.Infof("Kubernetes events: %d alerts created, %d resolved", result.Created, result.Resolved)
+	return nil
+}
+
+// runKubernetesEvents lists the cluster events at the configured interval
+func (a *AppState) runKubernetesEvents(poller *kubernetesEventsPoller) {
+	interval := poller.config.Interval
+	if interval == 0 {
+		interval = defaultKubernetesInterval
+	}
+	for {
+		if a.cluster.isLeader() {
+			if err := poller.poll(a); err != nil {
+				log.Errorf("Failed to list Kubernetes events: %v", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
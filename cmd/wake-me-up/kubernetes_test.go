@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKubernetesEvents(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	event := func(kind, name, reason, eventType string, age time.Duration) map[string]interface{} {
+		last := now.Add(-age)
+		return map[string]interface{}{
+			"involvedObject": map[string]string{"kind": kind, "namespace": "shop", "name": name},
+			"reason":         reason,
+			"message":        reason + " of " + name,
+			"type":           eventType,
+			"firstTimestamp": last.Add(-time.Minute),
+			"lastTimestamp":  last,
+		}
+	}
+	events := []map[string]interface{}{
+		event("Pod", "web-1", "BackOff", "Warning", time.Minute),
+		event("Pod", "web-1", "BackOff", "Warning", 2*time.Minute),
+		event("Pod", "web-2", "BackOff", "Warning", time.Hour), // recovered
+		event("Pod", "web-1", "Unhealthy", "Warning", time.Minute),
+		event("Pod", "web-1", "Started", "Normal", 0),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/shop/events" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if got := r.URL.Query().Get("fieldSelector"); got != "type=Warning" {
+			t.Errorf("Unexpected field selector %q", got)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": events})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	kubeconfig := fmt.Sprintf(`current-context: test
+contexts:
+- name: test
+  context: {cluster: test, user: test}
+clusters:
+- name: test
+  cluster: {server: %q}
+users:
+- name: test
+  user: {token: secret}
+`, server.URL)
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	poller, err := newKubernetesEventsPoller(&KubernetesEventsConfig{Kubeconfig: path, Namespace: "shop", Reasons: []string{"BackOff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewAppState(100)
+	if err := poller.poll(state); err != nil {
+		t.Fatal(err)
+	}
+	alerts := state.GetAlerts()
+	if len(alerts) != 1 || alerts[0].Alert.Labels["object"] != "web-1" || alerts[0].Alert.Labels["alertname"] != "BackOff" {
+		t.Fatalf("Expected one BackOff alert of web-1, got %+v", alerts)
+	}
+	if !alerts[0].Alert.StartsAt.Equal(now.Add(-3 * time.Minute)) {
+		t.Errorf("Expected the alert to start with the first event, got %s", alerts[0].Alert.StartsAt)
+	}
+
+	// No BackOff for resolve_after: the pod recovered
+	state.AddWebhook(poller.reconcile(nil, now.Add(defaultKubernetesResolveAfter)))
+	alerts = state.GetAlerts()
+	if len(alerts) != 1 || alerts[0].Alert.Status != "resolved" {
+		t.Fatalf("Expected the alert resolved, got %+v", alerts)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// How long the board warns about trimmed labels after the last violation
+const labelWarningDuration = time.Hour
+
+// Label keys tracked for max_values_per_key at most, so exploding keys can't
+// grow the tracking itself without bound
+const maxTrackedLabelKeys = 1000
+
+// Labels kept first when an alert has more than max_labels
+var preferredLabels = []string{"alertname", "severity"}
+
+// LabelLimitsConfig guards the board against label explosions, e.g. a
+// request_id label making every alert unique. Labels over a limit are
+// trimmed at ingestion; 0 disables a limit.
+type LabelLimitsConfig struct {
+	MaxLabels       int `yaml:"max_labels"`         // Labels kept per alert, alertname and severity first, then by name (optional)
+	MaxValueLength  int `yaml:"max_value_length"`   // Characters kept of a label value (optional)
+	MaxValuesPerKey int `yaml:"max_values_per_key"` // Distinct values of a label key, labels with new values beyond it are dropped (optional)
+}
+
+// LabelWarning tells the board that labels were trimmed recently
+type LabelWarning struct {
+	Message    string    `json:"message"`
+	Keys       []string  `json:"keys"`       // label keys that were trimmed
+	Violations int       `json:"violations"` // labels trimmed since the warning appeared
+	LastAt     time.Time `json:"lastAt"`
+}
+
+// labelGuard applies the label limits and remembers the values seen per key
+type labelGuard struct {
+	limits LabelLimitsConfig
+
+	mu         sync.Mutex
+	values     map[string]map[string]bool // label key -> distinct values accepted
+	keys       map[string]bool            // label keys trimmed since the warning appeared
+	violations int
+	lastAt     time.Time
+}
+
+func newLabelGuard(config *LabelLimitsConfig) (*labelGuard, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.MaxLabels < 0 || config.MaxValueLength < 0 || config.MaxValuesPerKey < 0 {
+		return nil, fmt.Errorf("limits can't be negative")
+	}
+	return &labelGuard{limits: *config, values: make(map[string]map[string]bool), keys: make(map[string]bool)}, nil
+}
+
+// apply trims the labels of a payload's alerts over the limits. Firing and
+// resolved alerts are trimmed alike, so they still match each other.
+func (g *labelGuard) apply(payload *WebhookPayload, now time.Time) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range payload.Alerts {
+		if payload.Alerts[i].Labels != nil {
+			payload.Alerts[i].Labels = g.trim(payload.Alerts[i].Labels, now)
+		}
+	}
+}
+
+// trim returns the labels within the limits
+// This should be called while holding the lock
+func (g *labelGuard) trim(labels map[string]string, now time.Time) map[string]string {
+	trimmed := make(map[string]string, len(labels))
+	for _, key := range labelKeyOrder(labels) {
+		value := labels[key]
+		if g.limits.MaxLabels > 0 && len(trimmed) >= g.limits.MaxLabels {
+			g.violation("labels", key, now)
+			continue
+		}
+		if g.limits.MaxValueLength > 0 && utf8.RuneCountInString(value) > g.limits.MaxValueLength {
+			value = string([]rune(value)[:g.limits.MaxValueLength]) + "…"
+			g.violation("value_length", key, now)
+		}
+		if g.limits.MaxValuesPerKey > 0 && !g.knownValue(key, value) {
+			g.violation("values_per_key", key, now)
+			continue
+		}
+		trimmed[key] = value
+	}
+	return trimmed
+}
+
+// knownValue tells if a value may be kept, remembering it while the key has
+// fewer distinct values than allowed
+// This should be called while holding the lock
+func (g *labelGuard) knownValue(key, value string) bool {
+	values, ok := g.values[key]
+	if !ok {
+		if len(g.values) >= maxTrackedLabelKeys {
+			return true
+		}
+		values = make(map[string]bool)
+		g.values[key] = values
+	}
+	if values[value] {
+		return true
+	}
+	if len(values) >= g.limits.MaxValuesPerKey {
+		return false
+	}
+	values[value] = true
+	return true
+}
+
+// violation counts a label trimmed for a limit
+// This should be called while holding the lock
+func (g *labelGuard) violation(limit, key string, now time.Time) {
+	labelLimitViolations.WithLabelValues(limit).Inc()
+	if now.Sub(g.lastAt) >= labelWarningDuration {
+		// The last warning expired, start over
+		clear(g.keys)
+		g.violations = 0
+		log.Warnf("Trimming alert labels over the label_limits, starting with %q (%s)", key, limit)
+	}
+	if len(g.keys) < maxTrackedLabelKeys {
+		g.keys[key] = true
+	}
+	g.violations++
+	g.lastAt = now
+}
+
+// warning returns the warning to show on the board, or nil if no labels were
+// trimmed lately
+func (g *labelGuard) warning(now time.Time) *LabelWarning {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.violations == 0 || now.Sub(g.lastAt) >= labelWarningDuration {
+		return nil
+	}
+	keys := make([]string, 0, len(g.keys))
+	for key := range g.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &LabelWarning{
+		Message:    fmt.Sprintf("Alert labels over the label limits were trimmed: %s", strings.Join(keys, ", ")),
+		Keys:       keys,
+		Violations: g.violations,
+		LastAt:     g.lastAt,
+	}
+}
+
+// labelKeyOrder returns the label keys in the order they are kept
+func labelKeyOrder(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for _, key := range preferredLabels {
+		if _, ok := labels[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	rest := make([]string, 0, len(labels))
+	for key := range labels {
+		if !slices.Contains(preferredLabels, key) {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
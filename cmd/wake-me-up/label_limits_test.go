@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLabelGuard(t *testing.T) {
+	guard, err := newLabelGuard(&LabelLimitsConfig{MaxLabels: 3, MaxValueLength: 12, MaxValuesPerKey: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if guard.warning(now) != nil {
+		t.Fatal("Expected no warning before any violation")
+	}
+
+	alert := func(status, requestID string) Alert {
+		return Alert{Status: status, Labels: map[string]string{
+			"zone":       "a",
+			"alertname":  "HighLatency",
+			"severity":   "critical",
+			"request_id": requestID,
+			"path":       "/very/long/path",
+		}}
+	}
+	payload := WebhookPayload{}
+	for i := 0; i < 3; i++ {
+		payload.Alerts = append(payload.Alerts, alert("firing", fmt.Sprintf("req-%d", i)))
+	}
+	guard.apply(&payload, now)
+
+	// alertname and severity come first, then path (shortened) over request_id and zone
+	first := payload.Alerts[0].Labels
+	if len(first) != 3 || first["alertname"] != "HighLatency" || first["severity"] != "critical" || first["path"] != "/very/long/p…" {
+		t.Fatalf("Unexpected labels %v", first)
+	}
+
+	// The third distinct value of a key is dropped, known values are kept
+	guard.limits.MaxLabels = 0
+	payload = WebhookPayload{Alerts: []Alert{alert("firing", "req-0"), alert("firing", "req-1"), alert("firing", "req-2")}}
+	guard.apply(&payload, now)
+	for i, want := range []bool{true, true, false} {
+		if _, ok := payload.Alerts[i].Labels["request_id"]; ok != want {
+			t.Errorf("Alert %d: expected request_id kept %v, got %v", i, want, payload.Alerts[i].Labels)
+		}
+	}
+
+	// Resolved alerts are trimmed the same, so they match their firing alert
+	resolved := WebhookPayload{Alerts: []Alert{alert("resolved", "req-2")}}
+	guard.apply(&resolved, now)
+	if labelFingerprint(resolved.Alerts[0].Labels) != labelFingerprint(payload.Alerts[2].Labels) {
+		t.Errorf("Expected matching fingerprints, got %v and %v", resolved.Alerts[0].Labels, payload.Alerts[2].Labels)
+	}
+
+	warning := guard.warning(now)
+	if warning == nil || len(warning.Keys) != 3 {
+		t.Fatalf("Expected a warning for path, request_id and zone, got %+v", warning)
+	}
+	if guard.warning(now.Add(labelWarningDuration)) != nil {
+		t.Error("Expected the warning to expire")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const boardLockFile = "lock.json"
+
+// BoardLock keeps clears and bulk actions off the board during an incident,
+// when many hands are on the same dashboard. Acknowledging single alerts
+// still works.
+type BoardLock struct {
+	By       string    `json:"by,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	LockedAt time.Time `json:"lockedAt"`
+}
+
+// GetBoardLock returns a copy of the board lock, or nil if the board is not
+// locked
+func (a *AppState) GetBoardLock() *BoardLock {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.lock == nil {
+		return nil
+	}
+	lock := *a.lock
+	return &lock
+}
+
+// SetBoardLock locks the board, or unlocks it if nil, on every instance
+func (a *AppState) SetBoardLock(lock *BoardLock) {
+	a.setBoardLock(lock)
+	a.cluster.saveBoardLock(lock)
+	a.cluster.publish(clusterOp{Type: clusterOpLock, Lock: lock})
+}
+
+// setBoardLock locks or unlocks the board on this instance only, and
+// broadcasts it
+func (a *AppState) setBoardLock(lock *BoardLock) {
+	a.mu.Lock()
+	a.lock = lock
+	a.seq++
+	a.mu.Unlock()
+
+	if path := a.dataFilePath(boardLockFile); path != "" {
+		if err := saveJSON(path, lock); err != nil {
+			log.Errorf("Failed to persist board lock: %v", err)
+		}
+	}
+	if lock != nil {
+		log.Infof("Board locked by %q: %q", lock.By, lock.Reason)
+	} else {
+		log.Infof("Board unlocked")
+	}
+	a.broadcastUpdate()
+}
+
+// LoadBoardLock restores the persisted board lock, so a restart during an
+// incident keeps the board locked
+func (a *AppState) LoadBoardLock() error {
+	path := a.dataFilePath(boardLockFile)
+	if path == "" {
+		return nil
+	}
+	var lock *BoardLock
+	if _, err := loadJSON(path, &lock); err != nil {
+		return err
+	}
+	if lock != nil {
+		a.mu.Lock()
+		a.lock = lock
+		a.mu.Unlock()
+		log.Infof("Restored board lock set by %q", lock.By)
+	}
+	return nil
+}
+
+// LoadClusterBoardLock takes the board lock of the other instances from
+// Redis, over the one restored from data_dir
+func (a *AppState) LoadClusterBoardLock() error {
+	if a.cluster == nil {
+		return nil
+	}
+	lock, err := a.cluster.loadBoardLock()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.lock = lock
+	a.mu.Unlock()
+	if lock != nil {
+		log.Infof("Board locked by %q on the cluster", lock.By)
+	}
+	return nil
+}
+
+// refuseLocked answers 423 Locked if the board is locked, for the handlers of
+// clears and bulk actions
+func refuseLocked(w http.ResponseWriter, state *AppState) bool {
+	lock := state.GetBoardLock()
+	if lock == nil {
+		return false
+	}
+	message := "Board is locked"
+	if lock.By != "" {
+		message += " by " + lock.By
+	}
+	if lock.Reason != "" {
+		message += ": " + lock.Reason
+	}
+	http.Error(w, message, http.StatusLocked)
+	return true
+}
+
+// boardLockHandler gets (GET), sets (POST with {"by", "reason"}) or lifts
+// (DELETE) the board lock
+func boardLockHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.GetBoardLock())
+
+		case http.MethodPost:
+			var req struct {
+				By     string `json:"by"`
+				Reason string `json:"reason"`
+			}
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil && err != io.EOF {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			lock := &BoardLock{
+				By:       requestActor(r, strings.TrimSpace(req.By)),
+				Reason:   strings.TrimSpace(req.Reason),
+				LockedAt: time.Now(),
+			}
+			state.SetBoardLock(lock)
+			audit.RecordRequest(r, AuditBoardLock, 4, "Board locked", map[string]string{"by": lock.By, "reason": lock.Reason})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(lock)
+
+		case http.MethodDelete:
+			if state.GetBoardLock() == nil {
+				http.Error(w, "Board is not locked", http.StatusNotFound)
+				return
+			}
+			state.SetBoardLock(nil)
+			audit.RecordRequest(r, AuditBoardLock, 4, "Board unlocked", nil)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBoardLock(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Disk"}}}})
+	state.Acknowledge(state.GetAlerts()[0].ID, "bob")
+	request := func(handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, "/", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := request(boardLockHandler(state), http.MethodPost, `{"by": "alice", "reason": "db outage"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the board locked, got %d", rec.Code)
+	}
+	var update UpdateMessage
+	data, _ := state.buildUpdate(0, "")
+	json.Unmarshal(data, &update)
+	if update.Lock == nil || update.Lock.By != "alice" || update.Lock.Reason != "db outage" {
+		t.Errorf("Expected the lock in board updates, got %+v", update.Lock)
+	}
+
+	refused := map[string]*httptest.ResponseRecorder{
+		"clear":        request(clearHandler(state), http.MethodPost, ""),
+		"bulk ack":     request(bulkAcknowledgeHandler(state), http.MethodPost, `{"all": true}`),
+		"bulk preview": request(bulkPreviewHandler(state), http.MethodPost, `{"action": "clear", "matchers": [{"name": "alertname", "value": "Disk"}]}`),
+		"bulk commit":  request(bulkCommitHandler(state), http.MethodPost, `{"token": "x"}`),
+		"multi ack":    httptest.NewRecorder(),
+	}
+	acknowledgeHandler(state)(refused["multi ack"], httptest.NewRequest(http.MethodPost, "/acknowledge?id=a&id=b", nil))
+	for name, rec := range refused {
+		if rec.Code != http.StatusLocked || !strings.Contains(rec.Body.String(), "locked by alice: db outage") {
+			t.Errorf("Expected %s refused while locked, got %d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+	if len(state.GetAlerts()) != 1 {
+		t.Error("Expected the alert left on the board")
+	}
+
+	if rec := request(boardLockHandler(state), http.MethodDelete, ""); rec.Code != http.StatusOK || state.GetBoardLock() != nil {
+		t.Fatalf("Expected the board unlocked, got %d", rec.Code)
+	}
+	if rec := request(clearHandler(state), http.MethodPost, ""); rec.Code != http.StatusOK || len(state.GetAlerts()) != 0 {
+		t.Errorf("Expected the clear to go through once unlocked, got %d", rec.Code)
+	}
+}
@@ -1,22 +1,28 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var configPath = flag.String("config", "/etc/wake-me-up/config/config.yaml", "Path to config.yaml.")
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAuditCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
 	flag.Parse()
 
 	config, err := ParseConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to parse config: %v\n", err)
-		os.Exit(1)
+		// Rather than exiting, let the config be fixed from a browser
+		config = runRecoveryMode(*configPath, err)
 	}
 
 	err = InitLogger(config.LogLevel)
@@ -25,40 +31,450 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := InitAudit(config); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize audit log: %v\n", err)
+		os.Exit(1)
+	}
+
 	log.Infof("Starting Wake Me Up")
-	log.Infof("Config file '%s' loaded successfully", *configPath)
+	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+		log.Warnf("Config file '%s' not found, using defaults and environment variables", *configPath)
+	} else {
+		log.Infof("Config file '%s' loaded successfully", *configPath)
+	}
 	log.Debugf("Parsed config: %+v", config)
+	audit.Record(AuditEvent{
+		Type:     AuditConfigLoaded,
+		Severity: 3,
+		Message:  "Config file loaded",
+		Fields:   map[string]string{"path": *configPath},
+	})
+
+	if err := setTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setAllowedOrigins(config.AllowedOrigins); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setBasicAuth(config.BasicAuth); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setTimeFormat(config); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setSoundPolicy(config.SoundPolicy); err != nil {
+		log.Fatalf("Invalid sound_policy: %v", err)
+	}
+	if err := validateStatusThemes(config.StatusThemes); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setDecorations(config.Decorations); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := validateEnvironments(config.Environments); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	setStats(config.Stats)
+	if err := setAgeThresholds(config.AgeThresholds); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := setChaos(config.Chaos); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := resolveAssets(config); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if config.StaticDir != "" {
+		log.Infof("Serving static files from '%s'", config.StaticDir)
+	} else {
+		log.Infof("Serving the embedded static files")
+	}
+	if err := setSeverities(config.Severities); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if config.AlertRules != nil {
+		alertRules, err = newAlertRuleCatalog(config.AlertRules)
+		if err != nil {
+			log.Fatalf("Invalid config: alert_rules: %v", err)
+		}
+		// Prometheus may come up later, the rules are reloaded in the background
+		if err := alertRules.reload(); err != nil {
+			log.Errorf("Failed to load alert rules: %v", err)
+		}
+		go runAlertRules(alertRules)
+	}
+	switch config.WebhookResponse {
+	case "", "text", "json":
+	default:
+		log.Fatalf("Invalid config: webhook_response must be text or json, got %q", config.WebhookResponse)
+	}
+
+	if err := setIDFormat(config.IDFormat); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
 
 	AppState := NewAppState(100)
 	AppState.config = config
+	zones, err := parseNetworkZones(config.NetworkZones)
+	if err != nil {
+		log.Fatalf("Invalid network_zones: %v", err)
+	}
+	AppState.zones = zones
+	AppState.allClear = newAllClearWatch(config.AllClear, AppState.announceAllClear)
+	AppState.labels, err = newLabelGuard(config.LabelLimits)
+	if err != nil {
+		log.Fatalf("Invalid label_limits: %v", err)
+	}
+
+	AppState.templates, err = newTemplateSet(config.TemplatesDir, config.TemplateLiveReload)
+	if err != nil {
+		log.Fatalf("Invalid templates: %v", err)
+	}
+	if config.TemplatesDir != "" {
+		log.Infof("Using template overrides from '%s'", config.TemplatesDir)
+	}
+
+	if config.WebSocket != nil {
+		AppState.hub.timing = config.WebSocket.timing()
+	}
+	if config.TombstoneRetention > 0 {
+		AppState.tombstoneRetention = config.TombstoneRetention
+	}
+	resolvedRequiresAck = config.ResolvedRequiresAck
+	AppState.replicas.window = config.ReplicaDedupWindow
+	AppState.throttle.window = config.IngestThrottle
+	if config.RefireWindow > 0 {
+		AppState.refireWindow = config.RefireWindow
+	}
+	if config.HistoryRetention > 0 {
+		AppState.history.SetRetention(config.HistoryRetention)
+	}
+	AppState.history.SetLimits(config.HistoryMemoryEvents, config.HistoryDiskBudget)
+	if config.TimelineRetention > 0 {
+		AppState.timeline.SetRetention(config.TimelineRetention)
+	}
+
+	if config.DataDir != "" {
+		if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+			log.Fatalf("Failed to create data directory: %v", err)
+		}
+		if err := AppState.LoadBanner(); err != nil {
+			log.Errorf("Failed to restore banner: %v", err)
+		}
+		if err := AppState.LoadBoardLock(); err != nil {
+			log.Errorf("Failed to restore the board lock: %v", err)
+		}
+		if err := AppState.LoadIncidents(); err != nil {
+			log.Errorf("Failed to restore incidents: %v", err)
+		}
+		if err := AppState.LoadHistory(); err != nil {
+			log.Errorf("Failed to restore history: %v", err)
+		}
+		if err := AppState.LoadTimeline(); err != nil {
+			log.Errorf("Failed to restore the board timeline: %v", err)
+		}
+		if err := AppState.devices.Load(filepath.Join(config.DataDir, devicesFile)); err != nil {
+			log.Errorf("Failed to restore devices: %v", err)
+		}
+	}
+
+	// Subscribe to the other instances before loading the board, so no
+	// change is missed in between
+	AppState.cluster, err = newClusterLink(config.Cluster)
+	if err != nil {
+		log.Fatalf("Failed to join the cluster: %v", err)
+	}
+	if AppState.cluster != nil {
+		clusterInstance = AppState.cluster.config.Instance
+		log.Infof("Joined the cluster on %s as %s", config.Cluster.Redis, clusterInstance)
+		if err := AppState.LoadClusterBoardLock(); err != nil {
+			log.Errorf("Failed to restore the board lock of the cluster: %v", err)
+		}
+	}
+
+	store, storeFile, err := openStore(config)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	if store != nil {
+		board, err := store.Load()
+		if err != nil {
+			log.Fatalf("Failed to restore alerts: %v", err)
+		}
+		AppState.RestoreBoard(board)
+		AppState.persister = newBoardPersister(store)
+		log.Infof("Alerts are stored in %s (%s), restored %d", config.Storage, storeFile, len(board.Alerts))
+	}
 
-	// Apply authentication middleware to webhook endpoint if configured
+	links, err := newAckLinker(config.ExternalURL, config.AckLinkSecret)
+	if err != nil {
+		log.Fatalf("Failed to set up acknowledge links: %v", err)
+	}
+	notifiers, err := setupNotifiers(config, links)
+	if err != nil {
+		log.Fatalf("Failed to set up notifiers: %v", err)
+	}
+	routes, err := newNotificationRoutes(config.NotificationRoutes, notifiers)
+	if err != nil {
+		log.Fatalf("Invalid notification_routes: %v", err)
+	}
+	AppState.notifier = newDispatcher(notifiers, routes)
+	for _, notifier := range notifiers {
+		log.Infof("Notifications enabled via %s", notifier.Name())
+	}
+	AppState.browser, err = newBrowserNotifier(config.Browser)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if AppState.browser != nil {
+		log.Infof("Browser notifications enabled")
+	}
+	if err := AppState.LoadFollowUps(); err != nil {
+		log.Errorf("Failed to restore follow-ups: %v", err)
+	}
+	if err := AppState.LoadSnoozes(); err != nil {
+		log.Errorf("Failed to restore snoozes: %v", err)
+	}
+	if err := AppState.LoadSilences(); err != nil {
+		log.Errorf("Failed to restore silences: %v", err)
+	}
+	AppState.escalationAlarm, err = newEscalationAlarm(config.EscalationAlarm, AppState.escalateUnacknowledged)
+	if err != nil {
+		log.Fatalf("Invalid config: escalation_alarm: %v", err)
+	}
+	AppState.ArmEscalationAlarms()
+	if err := AppState.LoadReviews(); err != nil {
+		log.Errorf("Failed to restore the follow-up list: %v", err)
+	}
+	AppState.StartTimeline()
+
+	if config.GPIO != nil {
+		light, err := newStatusLight(config.GPIO)
+		if err != nil {
+			log.Fatalf("Failed to set up status light: %v", err)
+		}
+		go light.run(AppState)
+		log.Infof("Status light enabled on GPIO %d (green) and %d (red)", config.GPIO.Green, config.GPIO.Red)
+	}
+	if config.MQTT != nil {
+		publisher, err := newMQTTPublisher(config.MQTT, AppState.mqttState)
+		if err != nil {
+			log.Fatalf("Invalid config: mqtt: %v", err)
+		}
+		AppState.mqtt = publisher
+		go publisher.run()
+		log.Infof("Publishing the board state to MQTT broker %s", config.MQTT.Broker)
+	}
+	if config.ServerSound {
+		sound, err := newServerSound(config.SoundEffectFilePath, config.ServerSoundInterval)
+		if err != nil {
+			log.Fatalf("Failed to set up server sound: %v", err)
+		}
+		go sound.run(AppState)
+		log.Infof("Server-side sound playback enabled (every %s while alerts are unacknowledged)", sound.interval)
+	}
+
+	if AppState.cluster != nil {
+		go AppState.runCluster()
+	}
+	go AppState.runAckCleanup(ackCleanupInterval)
+	if len(config.Escalations) > 0 {
+		if err := validateEscalations(config.Escalations, config.EscalationActions); err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		go AppState.runEscalations(config.Escalations, config.EscalationActions, links)
+		log.Infof("Escalation enabled with %d rules", len(config.Escalations))
+	}
+	if config.RelativeTimes {
+		go AppState.refreshRelativeTimes()
+	}
+	go AppState.runDerivedStateUpdates()
+	go AppState.runStateChecksums(stateChecksumInterval)
+	go AppState.runDeviceSchedules(deviceScheduleInterval)
+	if config.Handoff != nil && config.Handoff.WebhookURL != "" && len(config.Handoff.Times) > 0 {
+		offsets, err := parseHandoffTimes(config.Handoff.Times)
+		if err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		go AppState.runHandoffPoster(config.Handoff, offsets)
+		log.Infof("Shift handoff is posted to chat at %s", strings.Join(config.Handoff.Times, ", "))
+	}
+	if report := config.SuppressionReport; report != nil && report.WebhookURL != "" && report.Time != "" {
+		offsets, err := parseHandoffTimes([]string{report.Time})
+		if err != nil {
+			log.Fatalf("Invalid config: suppression_report: %v", err)
+		}
+		go AppState.runSuppressionReporter(report, offsets)
+		log.Infof("Suppression report is posted to chat daily at %s", report.Time)
+	}
+	if config.AlertmanagerPoll != nil {
+		poller, err := newAlertmanagerPoller(config.AlertmanagerPoll)
+		if err != nil {
+			log.Fatalf("Invalid config: alertmanager_poll: %v", err)
+		}
+		go AppState.runAlertmanagerPoller(poller)
+		log.Infof("Polling Alertmanager at %s", config.AlertmanagerPoll.URL)
+	}
+	if config.KubernetesEvents != nil {
+		poller, err := newKubernetesEventsPoller(config.KubernetesEvents)
+		if err != nil {
+			log.Fatalf("Invalid config: kubernetes_events: %v", err)
+		}
+		go AppState.runKubernetesEvents(poller)
+		log.Infof("Watching Kubernetes events at %s", poller.api.server)
+	}
+	publishDebugVars(AppState)
+
+	genericMappings, err := newGenericMappings(config.GenericWebhooks)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	// Apply authentication middleware to webhook endpoints if configured
 	webhookHandlerFunc := webhookHandler(AppState)
+	dryRunHandlerFunc := dryRunHandler(AppState)
+	genericHandlerFunc := genericWebhookHandler(AppState, genericMappings)
 	if config.WebhookAPIKey != "" || len(config.AllowedIPs) > 0 || config.RequireHTTPS {
 		webhookHandlerFunc = authMiddleware(config, webhookHandlerFunc)
+		dryRunHandlerFunc = authMiddleware(config, dryRunHandlerFunc)
+		genericHandlerFunc = authMiddleware(config, genericHandlerFunc)
 		log.Infof("Webhook authentication enabled (API Key: %v, IP Whitelist: %v, Require HTTPS: %v)",
 			config.WebhookAPIKey != "", len(config.AllowedIPs) > 0, config.RequireHTTPS)
 	}
 
 	// Serve static files (CSS, JS)
-	// Resolve static directory path relative to working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("Failed to get working directory: %v", err)
+	staticFS := staticAssets(config.StaticDir)
+
+	// Admin and debug endpoints can be kept off the public port, so a reverse
+	// proxy exposes only the board and webhooks
+	mux := http.NewServeMux()
+	adminMux := mux
+	if config.AdminListen != "" {
+		adminMux = http.NewServeMux()
+	}
+	adminMux.Handle("/debug/vars", expvar.Handler())
+	if err := registerMetrics(AppState, adminMux); err != nil {
+		log.Fatalf("Invalid config: %v", err)
 	}
-	staticDir := filepath.Join(wd, "static")
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir))))
+	adminMux.HandleFunc("/api/v1/devices", devicesHandler(AppState))
+	adminMux.HandleFunc("/api/v1/devices/test-sound", testSoundHandler(AppState))
+	adminMux.HandleFunc("/api/v1/clients", clientsHandler(AppState))
+	adminMux.HandleFunc("/admin/clients", clientsPageHandler(AppState))
+	adminMux.HandleFunc("/api/v1/audit", auditExportHandler(config.AuditLog))
+	adminMux.HandleFunc("/api/v1/lock", boardLockHandler(AppState))
 
-	http.HandleFunc("/webhook", webhookHandlerFunc)
-	http.HandleFunc("/acknowledge", acknowledgeHandler(AppState))
-	http.HandleFunc("/clear", clearHandler(AppState))
-	http.HandleFunc("/sound", soundHandler(AppState))
-	http.HandleFunc("/status", statusHandler(AppState))
-	http.HandleFunc("/ws", wsHandler(AppState))
-	http.HandleFunc("/", indexHandler(AppState))
+	staticHandler := http.StripPrefix("/static/", http.FileServerFS(staticFS))
+	mux.Handle("/static/", staticHandler)
+	if adminMux != mux {
+		// For the styles of the admin pages
+		adminMux.Handle("/static/", staticHandler)
+	}
+
+	mux.HandleFunc("/webhook", webhookHandlerFunc)
+	mux.HandleFunc("/api/v1/ingest/dry-run", dryRunHandlerFunc)
+	if len(genericMappings) > 0 {
+		mux.HandleFunc("/webhook/generic", genericHandlerFunc)
+	}
+	mux.HandleFunc("/acknowledge", acknowledgeHandler(AppState))
+	mux.HandleFunc("/acknowledge/link", ackLinkHandler(AppState, links))
+	mux.HandleFunc("/acknowledge/delegated", delegatedAckHandler(AppState))
+	mux.HandleFunc("/snooze", snoozeHandler(AppState))
+	if config.Slack != nil && config.Slack.SigningSecret != "" {
+		// Authenticated by Slack's request signature rather than the webhook API key
+		mux.HandleFunc("/webhook/slack-actions", slackActionsHandler(AppState, config.Slack))
+	}
+	mux.HandleFunc("/api/v1/alerts", alertsHandler(AppState))
+	mux.HandleFunc("/api/v1/alerts/acknowledge", bulkAcknowledgeHandler(AppState))
+	mux.HandleFunc("/api/v1/bulk/preview", bulkPreviewHandler(AppState))
+	mux.HandleFunc("/api/v1/bulk/commit", bulkCommitHandler(AppState))
+	mux.HandleFunc("/api/v1/groups", groupsHandler(AppState))
+	mux.HandleFunc("/api/v1/stats", statsHandler(AppState))
+	mux.HandleFunc("/stats", statsPageHandler(AppState))
+	mux.HandleFunc("/api/v1/timeline", timelineHandler(AppState))
+	mux.HandleFunc("/api/v1/snapshot.png", snapshotHandler(AppState))
+	mux.HandleFunc("/api/v1/replicas", replicasHandler(AppState))
+	mux.HandleFunc("/api/history", historyHandler(AppState))
+	mux.HandleFunc("/api/v1/search", searchHandler(AppState))
+	mux.HandleFunc("/api/v1/alerts/qr", qrCodeHandler(AppState, links))
+	mux.HandleFunc("/clear", clearHandler(AppState))
+	mux.HandleFunc("/sound", soundHandler(AppState))
+	mux.HandleFunc("/status", statusHandler(AppState))
+	mux.HandleFunc("/api/v1/banner", bannerHandler(AppState))
+	mux.HandleFunc("/api/v1/incidents", incidentsHandler(AppState))
+	mux.HandleFunc("/api/v1/silences", silencesHandler(AppState))
+	mux.HandleFunc("/api/v1/silences/export", silencesExportHandler(AppState))
+	mux.HandleFunc("/api/v1/silences/import", silencesImportHandler(AppState))
+	mux.HandleFunc("/api/v1/reviews", reviewsHandler(AppState))
+	mux.HandleFunc("/reviews", reviewsPageHandler(AppState))
+	mux.HandleFunc("/api/v1/handoff", handoffHandler(AppState))
+	mux.HandleFunc("/api/v1/suppression-report", suppressionReportHandler(AppState))
+	mux.HandleFunc("/api/v1/assets", assetManifestHandler(AppState, staticFS))
+	mux.HandleFunc("/api/v1/devices/register", registerDeviceHandler(AppState))
+	if len(config.Buttons) > 0 {
+		buttons, err := newHardwareButtons(config.Buttons)
+		if err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		mux.HandleFunc("/api/v1/buttons/", buttonHandler(AppState, buttons))
+	}
+	for _, notifier := range notifiers {
+		if push, ok := notifier.(*webPushNotifier); ok {
+			mux.HandleFunc("/api/v1/push", webPushHandler(push))
+		}
+	}
+	mux.HandleFunc("/manifest.webmanifest", webManifestHandler(AppState))
+	mux.HandleFunc("/sw.js", serviceWorkerHandler(staticFS))
+	for _, icon := range appIcons {
+		mux.HandleFunc(icon.path, appIconHandler(icon.size))
+	}
+	mux.HandleFunc("/ws", wsHandler(AppState))
+	mux.HandleFunc("/", indexHandler(AppState))
+
+	var certs *certReloader
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		if certs, err = newCertReloader(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			log.Fatalf("Invalid TLS certificate: %v", err)
+		}
+		log.Infof("Serving HTTPS with the certificate from %s", config.TLSCertFile)
+	}
 
 	log.Infof("Starting server on port %s", config.ListenPort)
-	if err := http.ListenAndServe(":"+config.ListenPort, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	audit.Record(AuditEvent{
+		Type:     AuditServerStarted,
+		Severity: 3,
+		Message:  "Server started",
+		Fields:   map[string]string{"port": config.ListenPort},
+	})
+	var adminServer *http.Server
+	if config.AdminListen != "" {
+		adminServer = newServer(config.AdminListen, basicAuthMiddleware(adminMux, originMiddleware(instrumentHandler(adminMux))), certs)
+		go func() {
+			log.Infof("Starting admin server on %s", config.AdminListen)
+			if err := serve(adminServer); err != nil {
+				log.Fatalf("Failed to start admin server: %v", err)
+			}
+		}()
 	}
+	server := newServer(":"+config.ListenPort, basicAuthMiddleware(mux, originMiddleware(instrumentHandler(mux))), certs)
+	go func() {
+		if err := serve(server); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	var advertiser *mdnsAdvertiser
+	if config.MDNS != nil {
+		if advertiser, err = newMDNSAdvertiser(config.MDNS, config.ListenPort, certs != nil, config.ExternalURL); err != nil {
+			log.Errorf("Failed to advertise the board with mDNS: %v", err)
+		} else {
+			log.Infof("Advertising the board with mDNS as %s", advertiser.instance)
+			go advertiser.Run()
+		}
+	}
+
+	waitForShutdownSignal()
+	advertiser.Close()
+	AppState.mqtt.Close()
+	AppState.Shutdown(config.ShutdownTimeout, server, adminServer)
+	AppState.cluster.Close()
 }
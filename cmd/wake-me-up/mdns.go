@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS-SD service type of the board
+const mdnsService = "_wakemeup._tcp.local."
+
+// Service type enumeration, so generic browsers list the board's type too
+const mdnsServicesMeta = "_services._dns-sd._udp.local."
+
+// TTL of the advertised records, in seconds
+const mdnsTTL = 120
+
+// DNS record types and class used by the advertisement
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN         = 1
+	dnsClassCacheFlush = 0x8000 // unique records replace cached ones
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// MDNSConfig advertises the board on the LAN with mDNS/DNS-SD, so phones and
+// companion apps find it without typing addresses
+type MDNSConfig struct {
+	Name      string `yaml:"name"`      // Instance name shown when browsing (optional, default: Wake Me Up on <hostname>)
+	Path      string `yaml:"path"`      // Base path of the board (optional, default: path of external_url, or /)
+	Interface string `yaml:"interface"` // Network interface to advertise on (optional, default: all)
+}
+
+// mdnsAdvertiser answers mDNS queries for the board's service
+type mdnsAdvertiser struct {
+	conn  *net.UDPConn
+	iface *net.Interface
+
+	instance string // e.g. "Wake Me Up on pi._wakemeup._tcp.local."
+	host     string // e.g. "pi.local."
+	port     uint16
+	txt      []string
+}
+
+// newMDNSAdvertiser joins the mDNS group to advertise a board served on a port
+func newMDNSAdvertiser(config *MDNSConfig, listenPort string, https bool, externalURL string) (*mdnsAdvertiser, error) {
+	port, err := strconv.ParseUint(listenPort, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("can't advertise listen_port %q: %v", listenPort, err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	hostname = strings.ToLower(strings.Split(hostname, ".")[0])
+
+	m := &mdnsAdvertiser{host: hostname + ".local.", port: uint16(port)}
+	name := config.Name
+	if name == "" {
+		name = "Wake Me Up on " + hostname
+	}
+	// The instance name is a single label, dots included
+	m.instance = strings.ReplaceAll(name, ".", "\\.") + "." + mdnsService
+
+	path := config.Path
+	if path == "" {
+		if u, err := url.Parse(externalURL); err == nil && u.Path != "" {
+			path = u.Path
+		} else {
+			path = "/"
+		}
+	}
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	m.txt = []string{"path=" + path, "scheme=" + scheme}
+
+	if config.Interface != "" {
+		if m.iface, err = net.InterfaceByName(config.Interface); err != nil {
+			return nil, err
+		}
+	}
+	if m.conn, err = net.ListenMulticastUDP("udp4", m.iface, mdnsGroup); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run announces the service and answers queries until Close
+func (m *mdnsAdvertiser) Run() {
+	go func() {
+		// Announced twice, a second apart, as RFC 6762 asks
+		for i := 0; i < 2; i++ {
+			m.send(m.records(mdnsTTL))
+			time.Sleep(time.Second)
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errorf("mDNS: %v", err)
+			}
+			return
+		}
+		if m.queried(buf[:n]) {
+			log.Debugf("mDNS: answering query from %s", from)
+			m.send(m.records(mdnsTTL))
+		}
+	}
+}
+
+// Close withdraws the advertisement and leaves the group
+func (m *mdnsAdvertiser) Close() {
+	if m == nil {
+		return
+	}
+	m.send(m.records(0))
+	m.conn.Close()
+}
+
+// send multicasts a response with the given records
+func (m *mdnsAdvertiser) send(records []dnsRecord) {
+	if _, err := m.conn.WriteToUDP(encodeDNSResponse(records), mdnsGroup); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Errorf("mDNS: failed to send response: %v", err)
+	}
+}
+
+// queried tells if a message is a query for any of the advertised names
+func (m *mdnsAdvertiser) queried(message []byte) bool {
+	questions, err := parseDNSQuestions(message)
+	if err != nil {
+		log.Debugf("mDNS: ignoring malformed message: %v", err)
+		return false
+	}
+	for _, q := range questions {
+		switch {
+		case strings.EqualFold(q.name, mdnsService) || strings.EqualFold(q.name, mdnsServicesMeta):
+			if q.qtype == dnsTypePTR || q.qtype == dnsTypeANY {
+				return true
+			}
+		case strings.EqualFold(q.name, m.instance):
+			if q.qtype == dnsTypeSRV || q.qtype == dnsTypeTXT || q.qtype == dnsTypeANY {
+				return true
+			}
+		case strings.EqualFold(q.name, m.host):
+			if q.qtype == dnsTypeA || q.qtype == dnsTypeANY {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// records returns the advertisement: the service pointer, the instance's
+// port and path, and the host addresses; a TTL of 0 withdraws them
+func (m *mdnsAdvertiser) records(ttl uint32) []dnsRecord {
+	srv := make([]byte, 6)
+	binary.BigEndian.PutUint16(srv[4:], m.port)
+	var txt []byte
+	for _, entry := range m.txt {
+		txt = append(txt, byte(len(entry)))
+		txt = append(txt, entry...)
+	}
+
+	records := []dnsRecord{
+		{name: mdnsServicesMeta, rtype: dnsTypePTR, ttl: ttl, data: encodeDNSName(mdnsService)},
+		{name: mdnsService, rtype: dnsTypePTR, ttl: ttl, data: encodeDNSName(m.instance)},
+		{name: m.instance, rtype: dnsTypeSRV, unique: true, ttl: ttl, data: append(srv, encodeDNSName(m.host)...)},
+		{name: m.instance, rtype: dnsTypeTXT, unique: true, ttl: ttl, data: txt},
+	}
+	for _, ip := range m.addresses() {
+		records = append(records, dnsRecord{name: m.host, rtype: dnsTypeA, unique: true, ttl: ttl, data: ip})
+	}
+	return records
+}
+
+// addresses returns the IPv4 addresses the board is reachable on, looked up
+// on every response as interfaces come and go
+func (m *mdnsAdvertiser) addresses() []net.IP {
+	ifaces := []net.Interface{}
+	if m.iface != nil {
+		ifaces = append(ifaces, *m.iface)
+	} else if all, err := net.Interfaces(); err == nil {
+		ifaces = all
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				if ip := ipNet.IP.To4(); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+		}
+	}
+	return ips
+}
+
+// dnsRecord is a resource record of an mDNS response
+type dnsRecord struct {
+	name   string
+	rtype  uint16
+	unique bool // sets the cache-flush bit
+	ttl    uint32
+	data   []byte
+}
+
+// dnsQuestion is a question of an mDNS query
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+}
+
+// encodeDNSResponse builds an authoritative response carrying the records
+func encodeDNSResponse(records []dnsRecord) []byte {
+	message := make([]byte, 12)
+	binary.BigEndian.PutUint16(message[2:], 0x8400)
+	binary.BigEndian.PutUint16(message[6:], uint16(len(records)))
+	for _, record := range records {
+		class := uint16(dnsClassIN)
+		if record.unique {
+			class |= dnsClassCacheFlush
+		}
+		message = append(message, encodeDNSName(record.name)...)
+		message = binary.BigEndian.AppendUint16(message, record.rtype)
+		message = binary.BigEndian.AppendUint16(message, class)
+		message = binary.BigEndian.AppendUint32(message, record.ttl)
+		message = binary.BigEndian.AppendUint16(message, uint16(len(record.data)))
+		message = append(message, record.data...)
+	}
+	return message
+}
+
+// encodeDNSName encodes a dotted name; "\." keeps a dot within a label
+func encodeDNSName(name string) []byte {
+	var encoded []byte
+	var label []byte
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name):
+			i++
+			label = append(label, name[i])
+		case name[i] == '.':
+			encoded = append(encoded, byte(len(label)))
+			encoded = append(encoded, label...)
+			label = label[:0]
+		default:
+			label = append(label, name[i])
+		}
+	}
+	if len(label) > 0 {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+// parseDNSQuestions returns the questions of a query, nothing for responses
+func parseDNSQuestions(message []byte) ([]dnsQuestion, error) {
+	if len(message) < 12 {
+		return nil, errors.New("short header")
+	}
+	if message[2]&0x80 != 0 {
+		return nil, nil
+	}
+	count := int(binary.BigEndian.Uint16(message[4:]))
+	offset := 12
+	questions := make([]dnsQuestion, 0, count)
+	for i := 0; i < count; i++ {
+		name, next, err := parseDNSName(message, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(message) {
+			return nil, errors.New("short question")
+		}
+		questions = append(questions, dnsQuestion{name: name, qtype: binary.BigEndian.Uint16(message[next:])})
+		offset = next + 4
+	}
+	return questions, nil
+}
+
+// parseDNSName reads a possibly compressed name at an offset, returning it
+// dotted, with dots within labels escaped, and the offset after it
+func parseDNSName(message []byte, offset int) (string, int, error) {
+	var name strings.Builder
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(message) {
+			return "", 0, errors.New("name out of bounds")
+		}
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return name.String(), next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(message) || jumps > 10 {
+				return "", 0, errors.New("bad name pointer")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(message[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(message) {
+				return "", 0, errors.New("label out of bounds")
+			}
+			name.WriteString(strings.ReplaceAll(string(message[offset+1:offset+1+length]), ".", "\\."))
+			name.WriteByte('.')
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// dnsQuery builds a query with a single question
+func dnsQuery(name string, qtype uint16) []byte {
+	message := make([]byte, 12)
+	binary.BigEndian.PutUint16(message[4:], 1)
+	message = append(message, encodeDNSName(name)...)
+	message = binary.BigEndian.AppendUint16(message, qtype)
+	return binary.BigEndian.AppendUint16(message, dnsClassIN)
+}
+
+func TestMDNSAdvertisement(t *testing.T) {
+	m := &mdnsAdvertiser{
+		iface:    &net.Interface{Name: "none"},
+		instance: "Wake Me Up on pi\\.lan." + mdnsService,
+		host:     "pi.local.",
+		port:     8080,
+		txt:      []string{"path=/board", "scheme=http"},
+	}
+
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+		want  bool
+	}{
+		{mdnsService, dnsTypePTR, true},
+		{"_WakeMeUp._tcp.local.", dnsTypePTR, true},
+		{mdnsServicesMeta, dnsTypePTR, true},
+		{m.instance, dnsTypeSRV, true},
+		{m.host, dnsTypeA, true},
+		{"_http._tcp.local.", dnsTypePTR, false},
+		{m.host, dnsTypeSRV, false},
+	} {
+		if got := m.queried(dnsQuery(q.name, q.qtype)); got != q.want {
+			t.Errorf("Query for %s type %d: expected %v, got %v", q.name, q.qtype, q.want, got)
+		}
+	}
+
+	// Responses aren't answered
+	response := encodeDNSResponse(m.records(mdnsTTL))
+	if m.queried(response) {
+		t.Error("Expected responses to be ignored")
+	}
+
+	// Names round-trip, with the dot kept within the instance label
+	offset := 12
+	var names []string
+	for i := 0; i < int(binary.BigEndian.Uint16(response[6:])); i++ {
+		name, next, err := parseDNSName(response, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+		offset = next + 8
+		offset += 2 + int(binary.BigEndian.Uint16(response[offset:]))
+	}
+	if len(names) != 4 || names[2] != m.instance {
+		t.Fatalf("Unexpected records %v", names)
+	}
+	if _, err := parseDNSQuestions(response[:20]); err != nil {
+		t.Errorf("Expected a response to be skipped without parsing, got %v", err)
+	}
+	if _, err := parseDNSQuestions(dnsQuery(mdnsService, dnsTypePTR)[:20]); err == nil {
+		t.Error("Expected an error for a truncated query")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics on /metrics, to monitor the monitor
+var (
+	webhooksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_webhooks_received_total",
+		Help: "Webhooks accepted, by source: alertmanager, alertmanager_poll or the generic webhook source.",
+	}, []string{"source"})
+
+	webhooksCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wakemeup_webhooks_coalesced_total",
+		Help: "Webhook deliveries merged into a later delivery of their alert group rather than ingested on their own, see ingest_throttle.",
+	})
+
+	wsClientsConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wakemeup_websocket_clients",
+		Help: "WebSocket clients connected.",
+	})
+
+	broadcastErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_broadcast_errors_total",
+		Help: "Board updates not delivered, by reason: marshal, dropped (hub busy) or write (to a client).",
+	}, []string{"reason"})
+
+	resyncRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wakemeup_resync_requests_total",
+		Help: "Full snapshots sent to WebSocket clients that found their board out of date.",
+	})
+
+	wsDisconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_websocket_disconnects_total",
+		Help: "WebSocket client disconnects, by reason: closed, slow_consumer, pong_timeout, network_error, chaos or shutdown.",
+	}, []string{"reason"})
+
+	ingestBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_ingest_bytes_total",
+		Help: "Webhook body bytes, by kind: plain as received, compressed as received and decompressed.",
+	}, []string{"kind"})
+
+	escalationActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_escalation_actions_total",
+		Help: "Escalation action runs, by action name and outcome: ok or failed.",
+	}, []string{"action", "outcome"})
+
+	chaosFaults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_chaos_faults_total",
+		Help: "Faults injected by the chaos settings, by kind.",
+	}, []string{"kind"})
+
+	escalationAlarms = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wakemeup_escalation_alarms_total",
+		Help: "Louder alarms sent to the dashboards for alerts left unacknowledged, see escalation_alarm.",
+	})
+
+	labelLimitViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_label_limit_violations_total",
+		Help: "Alert labels trimmed at ingestion, by limit: labels, value_length or values_per_key.",
+	}, []string{"limit"})
+
+	clusterErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wakemeup_cluster_errors_total",
+		Help: "Failed Redis operations in cluster mode, by operation: publish, subscribe, dedup or lease.",
+	}, []string{"operation"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wakemeup_http_request_duration_seconds",
+		Help:    "HTTP request latencies, by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler", "code"})
+
+	alertsDesc = prometheus.NewDesc("wakemeup_alerts", "Alerts on the board, by state: firing, acknowledged or resolved.", []string{"state"}, nil)
+)
+
+// metricLabelName is a valid Prometheus label name
+var metricLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// alertsCollector reports the alerts on the board when scraped: their count
+// by state, and their count, oldest start and oldest arrival on the board by
+// alertname, severity and state, so the board can be charted and alerted on, e.g. for criticals left
+// unacknowledged. Alert IDs are left out as every alert would make new
+// series.
+type alertsCollector struct {
+	state  *AppState
+	labels []string // alert labels the series are further split by
+
+	countDesc, oldestDesc, arrivedDesc *prometheus.Desc
+}
+
+func newAlertsCollector(state *AppState, labels []string) (*alertsCollector, error) {
+	for _, label := range labels {
+		if !metricLabelName.MatchString(label) || strings.HasPrefix(label, "__") {
+			return nil, fmt.Errorf("alert_metric_labels: %q is not a valid label name", label)
+		}
+		if slices.Contains([]string{"alertname", "severity", "state"}, label) {
+			return nil, fmt.Errorf("alert_metric_labels: %q is always set", label)
+		}
+	}
+	variable := append([]string{"alertname", "severity", "state"}, labels...)
+	return &alertsCollector{
+		state:       state,
+		labels:      labels,
+		countDesc:   prometheus.NewDesc("wakemeup_alerts_by_name", "Alerts on the board by alertname, severity and state: firing, acknowledged or resolved.", variable, nil),
+		oldestDesc:  prometheus.NewDesc("wakemeup_alerts_oldest_start_time_seconds", "Unix time the oldest alert on the board of an alertname, severity and state started firing.", variable, nil),
+		arrivedDesc: prometheus.NewDesc("wakemeup_alerts_oldest_arrival_time_seconds", "Unix time the alert of an alertname, severity and state longest on the board arrived on it.", variable, nil),
+	}, nil
+}
+
+func (c *alertsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- alertsDesc
+	ch <- c.countDesc
+	ch <- c.oldestDesc
+	ch <- c.arrivedDesc
+}
+
+// alertGroup is the alerts of a series
+type alertGroup struct {
+	labels  []string
+	count   int
+	oldest  time.Time
+	arrived time.Time // earliest arrival on the board
+}
+
+func (c *alertsCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[string]int{"firing": 0, "acknowledged": 0, "resolved": 0}
+	groups := make(map[string]*alertGroup)
+	c.state.mu.RLock()
+	for _, entry := range c.state.alerts {
+		state := "resolved"
+		if entry.Alert.Status == "firing" {
+			state = "firing"
+			if c.state.acknowledged[entry.ID] != nil {
+				state = "acknowledged"
+			}
+		}
+		counts[state]++
+
+		labels := []string{entry.Alert.Labels["alertname"], alertSeverity(entry.Alert), state}
+		for _, name := range c.labels {
+			labels = append(labels, entry.Alert.Labels[name])
+		}
+		startsAt := entry.Alert.StartsAt
+		if startsAt.IsZero() {
+			startsAt = entry.Timestamp
+		}
+		key := strings.Join(labels, "\xff")
+		group, ok := groups[key]
+		if !ok {
+			group = &alertGroup{labels: labels, oldest: startsAt, arrived: entry.Timestamp}
+			groups[key] = group
+		}
+		group.count++
+		if startsAt.Before(group.oldest) {
+			group.oldest = startsAt
+		}
+		if entry.Timestamp.Before(group.arrived) {
+			group.arrived = entry.Timestamp
+		}
+	}
+	c.state.mu.RUnlock()
+
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(alertsDesc, prometheus.GaugeValue, float64(count), state)
+	}
+	for _, group := range groups {
+		ch <- prometheus.MustNewConstMetric(c.countDesc, prometheus.GaugeValue, float64(group.count), group.labels...)
+		ch <- prometheus.MustNewConstMetric(c.oldestDesc, prometheus.GaugeValue, float64(group.oldest.UnixNano())/1e9, group.labels...)
+		ch <- prometheus.MustNewConstMetric(c.arrivedDesc, prometheus.GaugeValue, float64(group.arrived.UnixNano())/1e9, group.labels...)
+	}
+}
+
+// registerMetrics adds the board metrics and the /metrics endpoint, which
+// speaks OpenMetrics to scrapers asking for it
+func registerMetrics(state *AppState, mux *http.ServeMux) error {
+	collector, err := newAlertsCollector(state, state.config.AlertMetricLabels)
+	if err != nil {
+		return err
+	}
+	prometheus.MustRegister(collector)
+	handler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler))
+	return nil
+}
+
+// instrumentHandler records request latencies by the route pattern of the
+// mux rather than the path, which keeps the handler label bounded as "/"
+// serves any path. WebSocket connections last as long as the client stays,
+// so they are left out.
+func instrumentHandler(mux *http.ServeMux) http.Handler {
+	var routes sync.Map // pattern -> instrumented handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "/ws" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if pattern == "" {
+			pattern = "none"
+		}
+		handler, ok := routes.Load(pattern)
+		if !ok {
+			observer := httpRequestDuration.MustCurryWith(prometheus.Labels{"handler": pattern})
+			handler, _ = routes.LoadOrStore(pattern, promhttp.InstrumentHandlerDuration(observer, mux))
+		}
+		handler.(http.Handler).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAlertMetrics(t *testing.T) {
+	if _, err := newAlertsCollector(NewAppState(100), []string{"severity"}); err == nil {
+		t.Error("Expected a reserved label refused")
+	}
+	if _, err := newAlertsCollector(NewAppState(100), []string{"team-name"}); err == nil {
+		t.Error("Expected an invalid label name refused")
+	}
+
+	state := NewAppState(100)
+	startsAt := time.Unix(1700000000, 0)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", StartsAt: startsAt, Labels: map[string]string{"alertname": "DiskFull", "severity": "critical", "team": "db", "instance": "a"}},
+		{Status: "firing", StartsAt: startsAt.Add(time.Minute), Labels: map[string]string{"alertname": "DiskFull", "severity": "critical", "team": "db", "instance": "b"}},
+		{Status: "firing", StartsAt: startsAt, Labels: map[string]string{"alertname": "HighLoad", "severity": "warning"}},
+	}})
+	for _, entry := range state.GetAlerts() {
+		if entry.Alert.Labels["alertname"] == "HighLoad" {
+			state.Acknowledge(entry.ID, "bob")
+		}
+	}
+
+	collector, err := newAlertsCollector(state, []string{"team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() == "wakemeup_alerts" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if _, ok := labels["id"]; ok || labels["severity"] == "" {
+				t.Errorf("Unexpected labels on %s: %v", family.GetName(), labels)
+			}
+			values[family.GetName()+" "+labels["alertname"]+" "+labels["state"]+" "+labels["team"]] = metric.GetGauge().GetValue()
+		}
+	}
+	if len(values) != 6 {
+		t.Errorf("Expected a series per alertname and state, got %v", values)
+	}
+	for series, value := range map[string]float64{
+		"wakemeup_alerts_by_name DiskFull firing db":                       2,
+		"wakemeup_alerts_by_name HighLoad acknowledged ":                   1,
+		"wakemeup_alerts_oldest_start_time_seconds DiskFull firing db":     1700000000,
+		"wakemeup_alerts_oldest_start_time_seconds HighLoad acknowledged ": 1700000000,
+	} {
+		if got, ok := values[series]; !ok || got != value {
+			t.Errorf("Expected %s = %v, got %v", series, value, got)
+		}
+	}
+	// Alerts that started firing long ago arrived on the board just now
+	if arrived := values["wakemeup_alerts_oldest_arrival_time_seconds DiskFull firing db"]; time.Since(time.Unix(int64(arrived), 0)) > time.Minute {
+		t.Errorf("Expected the arrival on the board, got %v", arrived)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The board state is published to an MQTT broker for home automation, e.g.
+// to turn a smart light red while alerts are unacknowledged. A minimal MQTT
+// 3.1.1 client publishes retained messages at QoS 0, so subscribers get the
+// current state as soon as they connect, and a last will marks the board
+// offline when the connection drops.
+
+const (
+	defaultMQTTTopicPrefix = "wake-me-up"
+	defaultMQTTKeepAlive   = 60 * time.Second
+	mqttDialTimeout        = 10 * time.Second
+	maxMQTTBackoff         = time.Minute
+
+	// The broker only sends acknowledgements, a bigger packet is refused
+	// before its body is allocated
+	maxMQTTPacket = 64 << 10
+)
+
+// MQTTConfig publishes the board state to an MQTT broker
+type MQTTConfig struct {
+	Broker      string            `yaml:"broker"`       // host:port of the broker, e.g. localhost:1883
+	TLS         bool              `yaml:"tls"`          // Connect with TLS, usually on port 8883 (optional, default: false)
+	ClientID    string            `yaml:"client_id"`    // (optional, default: wake-me-up-<hostname>)
+	Username    string            `yaml:"username"`     // (optional)
+	Password    string            `yaml:"password"`     // Only with a username (optional)
+	TopicPrefix string            `yaml:"topic_prefix"` // Prefix of the topics (optional, default: wake-me-up)
+	Topics      map[string]string `yaml:"topics"`       // Topics replacing <topic_prefix>/<name> for alerts, firing, unacknowledged, has_unacknowledged, level, state and availability (optional)
+	KeepAlive   time.Duration     `yaml:"keep_alive"`   // How often the connection is checked (optional, default: 60s)
+}
+
+// mqttState is the board state published over MQTT
+type mqttState struct {
+	Alerts            int    `json:"alerts"` // on the board
+	Firing            int    `json:"firing"`
+	Unacknowledged    int    `json:"unacknowledged"`
+	HasUnacknowledged bool   `json:"hasUnacknowledged"`
+	Level             string `json:"level"`
+}
+
+// mqttTopicNames are the names of the published topics, "state" carrying the
+// whole state as JSON and "availability" online or offline
+var mqttTopicNames = []string{"alerts", "firing", "unacknowledged", "has_unacknowledged", "level", "state", "availability"}
+
+// messages returns the payload of each topic name but availability
+func (s mqttState) messages() map[string]string {
+	state, _ := json.Marshal(s)
+	return map[string]string{
+		"alerts":             strconv.Itoa(s.Alerts),
+		"firing":             strconv.Itoa(s.Firing),
+		"unacknowledged":     strconv.Itoa(s.Unacknowledged),
+		"has_unacknowledged": strconv.FormatBool(s.HasUnacknowledged),
+		"level":              s.Level,
+		"state":              string(state),
+	}
+}
+
+// mqttState returns the state published over MQTT
+func (a *AppState) mqttState() mqttState {
+	state := mqttState{Level: a.StatusLevel()}
+	state.HasUnacknowledged = state.Level != StatusLevelOK
+	for _, entry := range a.GetBoardAlerts() {
+		state.Alerts++
+		if entry.Alert.Status == "firing" {
+			state.Firing++
+		}
+		if entry.NeedsAck {
+			state.Unacknowledged++
+		}
+	}
+	return state
+}
+
+// mqttPublisher keeps a connection to the broker and publishes the state when
+// it changes, reconnecting with backoff
+type mqttPublisher struct {
+	config  *MQTTConfig
+	topics  map[string]string // by name
+	state   func() mqttState
+	changed chan struct{} // at most one pending change
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newMQTTPublisher(config *MQTTConfig, state func() mqttState) (*mqttPublisher, error) {
+	if config.Broker == "" {
+		return nil, errors.New("missing broker")
+	}
+	if _, _, err := net.SplitHostPort(config.Broker); err != nil {
+		return nil, fmt.Errorf("broker: expected host:port, got %q", config.Broker)
+	}
+	if config.Password != "" && config.Username == "" {
+		// MQTT 3.1.1 §3.1.2.9: the password flag requires the user name flag
+		return nil, errors.New("password: requires a username")
+	}
+	if config.ClientID == "" {
+		hostname, _ := os.Hostname()
+		config.ClientID = "wake-me-up-" + hostname
+	}
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = defaultMQTTTopicPrefix
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = defaultMQTTKeepAlive
+	}
+	if config.KeepAlive < time.Second || config.KeepAlive > 65535*time.Second {
+		return nil, fmt.Errorf("keep_alive: expected 1s to 18h, got %s", config.KeepAlive)
+	}
+
+	topics := make(map[string]string, len(mqttTopicNames))
+	for _, name := range mqttTopicNames {
+		topics[name] = config.TopicPrefix + "/" + name
+	}
+	for name, topic := range config.Topics {
+		if _, ok := topics[name]; !ok {
+			return nil, fmt.Errorf("topics: unknown topic %q", name)
+		}
+		if topic == "" {
+			return nil, fmt.Errorf("topics.%s: empty topic", name)
+		}
+		topics[name] = topic
+	}
+	return &mqttPublisher{
+		config:  config,
+		topics:  topics,
+		state:   state,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// stateChanged tells the publisher to publish what changed, coalescing the
+// changes arriving while one is pending
+func (p *mqttPublisher) stateChanged() {
+	if p == nil {
+		return
+	}
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Close marks the board offline and disconnects from the broker
+func (p *mqttPublisher) Close() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	select {
+	case <-p.stopped:
+	case <-time.After(mqttDialTimeout):
+	}
+}
+
+// run connects to the broker until closed
+func (p *mqttPublisher) run() {
+	defer close(p.stopped)
+	backoff := time.Second
+	for {
+		conn, err := p.connect()
+		if err == nil {
+			log.Infof("Connected to MQTT broker %s", p.config.Broker)
+			backoff = time.Second
+			err = p.session(conn)
+			conn.Close()
+			if err == nil {
+				return
+			}
+		}
+		log.Errorf("MQTT broker %s: %v, reconnecting in %s", p.config.Broker, err, backoff)
+		select {
+		case <-p.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxMQTTBackoff)
+	}
+}
+
+// connect opens a session with the last will marking the board offline
+func (p *mqttPublisher) connect() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	var conn net.Conn
+	var err error
+	if p.config.TLS {
+		host, _, _ := net.SplitHostPort(p.config.Broker)
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.config.Broker, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", p.config.Broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(mqttDialTimeout))
+	connect := encodeMQTTConnect(p.config, p.topics["availability"], "offline")
+	if _, err := conn.Write(connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	packetType, body, err := readMQTTPacket(bufio.NewReader(conn))
+	if err == nil && (packetType != mqttConnAck || len(body) != 2) {
+		err = fmt.Errorf("expected CONNACK, got packet type %d", packetType)
+	}
+	if err == nil && body[1] != 0 {
+		err = fmt.Errorf("connection refused: %s", mqttConnAckReason(body[1]))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// session publishes the whole state, then what changes, until the connection
+// fails or the publisher is closed, which returns nil
+func (p *mqttPublisher) session(conn net.Conn) error {
+	// The broker only sends PINGRESP to a publisher at QoS 0; the connection
+	// is considered lost when it has not answered for a keep alive period
+	failed := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			conn.SetReadDeadline(time.Now().Add(p.config.KeepAlive * 3 / 2))
+			if _, _, err := readMQTTPacket(reader); err != nil {
+				failed <- err
+				return
+			}
+		}
+	}()
+
+	published := make(map[string]string)
+	publish := func(name, payload string) error {
+		if published[name] == payload {
+			return nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(mqttDialTimeout))
+		if _, err := conn.Write(encodeMQTTPublish(p.topics[name], payload, true)); err != nil {
+			return err
+		}
+		published[name] = payload
+		return nil
+	}
+	publishState := func() error {
+		messages := p.state().messages()
+		for _, name := range mqttTopicNames {
+			if payload, ok := messages[name]; ok {
+				if err := publish(name, payload); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := publish("availability", "online"); err != nil {
+		return err
+	}
+	if err := publishState(); err != nil {
+		return err
+	}
+	ping := time.NewTicker(p.config.KeepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case <-p.done:
+			publish("availability", "offline")
+			conn.Write([]byte{mqttDisconnect << 4, 0})
+			return nil
+		case err := <-failed:
+			return err
+		case <-p.changed:
+			if err := publishState(); err != nil {
+				return err
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(mqttDialTimeout))
+			if _, err := conn.Write([]byte{mqttPingReq << 4, 0}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPingReq    = 12
+	mqttDisconnect = 14
+)
+
+// encodeMQTTConnect builds a CONNECT packet with a clean session and a
+// retained last will
+func encodeMQTTConnect(config *MQTTConfig, willTopic, willMessage string) []byte {
+	flags := byte(0x02 | 0x04 | 0x20) // clean session, will, will retain
+	payload := appendMQTTString(nil, config.ClientID)
+	payload = appendMQTTString(payload, willTopic)
+	payload = appendMQTTString(payload, willMessage)
+	if config.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, config.Username)
+	}
+	if config.Password != "" {
+		flags |= 0x40
+		payload = appendMQTTString(payload, config.Password)
+	}
+
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(config.KeepAlive/time.Second))
+	return encodeMQTTPacket(mqttConnect<<4, append(body, payload...))
+}
+
+// encodeMQTTPublish builds a PUBLISH packet at QoS 0
+func encodeMQTTPublish(topic, payload string, retain bool) []byte {
+	header := byte(mqttPublish << 4)
+	if retain {
+		header |= 0x01
+	}
+	return encodeMQTTPacket(header, append(appendMQTTString(nil, topic), payload...))
+}
+
+// encodeMQTTPacket prefixes a packet body with its fixed header
+func encodeMQTTPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func appendMQTTString(buf []byte, value string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(value)))
+	return append(buf, value...)
+}
+
+// readMQTTPacket reads a packet and returns its type and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 3 && digit&0x80 != 0 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxMQTTPacket {
+		return 0, nil, fmt.Errorf("packet of %d bytes over the %d bytes accepted", length, maxMQTTPacket)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// mqttConnAckReason explains a CONNACK return code
+func mqttConnAckReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
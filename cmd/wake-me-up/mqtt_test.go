@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMQTTPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	state := NewAppState(100)
+	publisher, err := newMQTTPublisher(&MQTTConfig{
+		Broker:   listener.Addr().String(),
+		ClientID: "board",
+		Username: "home",
+		Password: "secret",
+		Topics:   map[string]string{"has_unacknowledged": "home/alarm"},
+	}, state.mqttState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.mqtt = publisher
+	go publisher.run()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	packetType, body, err := readMQTTPacket(reader)
+	if err != nil || packetType != mqttConnect {
+		t.Fatalf("Expected CONNECT, got %d %v", packetType, err)
+	}
+	if flags := body[7]; flags != 0x02|0x04|0x20|0x80|0x40 {
+		t.Errorf("Expected a clean session with a retained will and credentials, got flags %#x", flags)
+	}
+	conn.Write([]byte{mqttConnAck << 4, 2, 0, 0})
+
+	// Retained publishes, by topic
+	published := make(map[string]string)
+	read := func(count int) {
+		for i := 0; i < count; i++ {
+			header, err := reader.ReadByte()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.UnreadByte()
+			packetType, body, err := readMQTTPacket(reader)
+			if err != nil || packetType != mqttPublish || header&0x01 == 0 {
+				t.Fatalf("Expected a retained PUBLISH, got %#x %v", header, err)
+			}
+			length := binary.BigEndian.Uint16(body)
+			published[string(body[2:2+length])] = string(body[2+length:])
+		}
+	}
+	read(7)
+	if published["wake-me-up/availability"] != "online" || published["home/alarm"] != "false" || published["wake-me-up/alerts"] != "0" {
+		t.Fatalf("Expected the board clear and online, got %v", published)
+	}
+
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Disk", "severity": "critical"}}}})
+	// Only the topics that changed are published again: all but availability
+	read(6)
+	if published["home/alarm"] != "true" || published["wake-me-up/unacknowledged"] != "1" || published["wake-me-up/level"] != StatusLevelCritical {
+		t.Errorf("Expected the unacknowledged alert published, got %v", published)
+	}
+
+	publisher.Close()
+	read(1)
+	if published["wake-me-up/availability"] != "offline" {
+		t.Errorf("Expected the board marked offline when closing, got %v", published)
+	}
+	if packetType, _, err := readMQTTPacket(reader); err != nil || packetType != mqttDisconnect {
+		t.Errorf("Expected DISCONNECT, got %d %v", packetType, err)
+	}
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	payload := make([]byte, 321)
+	packet := encodeMQTTPublish("t", string(payload), false)
+	if packet[1] != 0xc4 || packet[2] != 0x02 {
+		t.Errorf("Expected 324 encoded as two bytes, got %#x %#x", packet[1], packet[2])
+	}
+	packetType, body, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || packetType != mqttPublish || len(body) != 324 {
+		t.Errorf("Expected the packet read back, got %d %d %v", packetType, len(body), err)
+	}
+
+	// A broker claiming the largest remaining length is refused without
+	// allocating it
+	huge := []byte{mqttPublish << 4, 0xff, 0xff, 0xff, 0x7f}
+	if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(huge))); err == nil || !strings.Contains(err.Error(), "over") {
+		t.Errorf("Expected an oversized packet refused, got %v", err)
+	}
+}
+
+func TestMQTTPasswordRequiresUsername(t *testing.T) {
+	state := func() mqttState { return mqttState{} }
+	if _, err := newMQTTPublisher(&MQTTConfig{Broker: "localhost:1883", Password: "secret"}, state); err == nil {
+		t.Error("Expected a password without a username refused")
+	}
+	if _, err := newMQTTPublisher(&MQTTConfig{Broker: "localhost:1883", Username: "board", Password: "secret"}, state); err != nil {
+		t.Errorf("Expected a username and password accepted, got %v", err)
+	}
+}
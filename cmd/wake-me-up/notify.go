@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Notification event kinds
+const (
+	EventFiring    = "firing"
+	EventFollowUp  = "follow-up" // an acknowledged alert is still firing at its follow-up time
+	EventAllClear  = "all-clear" // the board is green again, carries no alerts
+	EventEscalated = "escalated" // a firing alert stayed unacknowledged past escalation_alarm.after
+	EventResolved  = "resolved"  // firing alerts resolved, sent only to notifiers that want it
+)
+
+// NotificationEvent is an alert lifecycle event sent to outbound notifiers
+type NotificationEvent struct {
+	Kind     string
+	Time     time.Time
+	Alerts   []AlertEntry
+	Note     string // note left with the acknowledgement, for follow-ups
+	Notifier string // only send through this notifier, all if empty
+}
+
+// Notifier delivers notification events to an external channel
+type Notifier interface {
+	Name() string
+	Notify(event NotificationEvent) error
+}
+
+// kindFilter is implemented by notifiers that choose the event kinds they
+// take. The others take every kind but resolutions, which would be noise.
+type kindFilter interface {
+	Wants(kind string) bool
+}
+
+// boardWatcher is implemented by notifiers that keep their messages in sync
+// with the board, e.g. to drop the buttons of alerts acknowledged elsewhere
+type boardWatcher interface {
+	Watching() bool // whether any message may still change
+	BoardChanged(view boardView)
+}
+
+// boardView is the board as seen by board watchers
+type boardView struct {
+	Alerts  map[string]AlertEntryWithAck // by ID
+	Removed map[string]string            // tombstone reasons by ID: resolved, cleared or evicted
+}
+
+// truncateRunes cuts text to a number of characters, ending it with an
+// ellipsis when cut
+func truncateRunes(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
+
+// wants tells if a notifier takes events of a kind
+func wants(notifier Notifier, kind string) bool {
+	if filter, ok := notifier.(kindFilter); ok {
+		return filter.Wants(kind)
+	}
+	return kind != EventResolved
+}
+
+// Dispatcher fans notification events out to the configured notifiers in the
+// background, so slow channels never delay webhook handling
+type Dispatcher struct {
+	notifiers []Notifier
+	routes    *notificationRoute // nil sends every event to all notifiers
+	events    chan NotificationEvent
+
+	watchers []boardWatcher
+	changed  chan func() boardView // at most one pending board change
+}
+
+func newDispatcher(notifiers []Notifier, routes *notificationRoute) *Dispatcher {
+	d := &Dispatcher{notifiers: notifiers, routes: routes}
+	if len(notifiers) > 0 {
+		d.events = make(chan NotificationEvent, 256)
+		go d.run()
+	}
+	for _, notifier := range notifiers {
+		if watcher, ok := notifier.(boardWatcher); ok {
+			d.watchers = append(d.watchers, watcher)
+		}
+	}
+	if len(d.watchers) > 0 {
+		d.changed = make(chan func() boardView, 1)
+		go d.syncBoard()
+	}
+	return d
+}
+
+// setupNotifiers creates the notifiers enabled in the config
+func setupNotifiers(config *Config, links *ackLinker) ([]Notifier, error) {
+	var notifiers []Notifier
+	if config.Email != nil {
+		email, err := newEmailNotifier(config.Email, links)
+		if err != nil {
+			return nil, fmt.Errorf("email: %w", err)
+		}
+		notifiers = append(notifiers, email)
+	}
+	if config.Slack != nil {
+		slack, err := newSlackNotifier(config.Slack, links)
+		if err != nil {
+			return nil, fmt.Errorf("slack: %w", err)
+		}
+		notifiers = append(notifiers, slack)
+	}
+	if config.Telegram != nil {
+		telegram, err := newTelegramNotifier(config.Telegram, links)
+		if err != nil {
+			return nil, fmt.Errorf("telegram: %w", err)
+		}
+		notifiers = append(notifiers, telegram)
+	}
+	if config.Pushover != nil {
+		pushover, err := newPushoverNotifier(config.Pushover, links)
+		if err != nil {
+			return nil, fmt.Errorf("pushover: %w", err)
+		}
+		notifiers = append(notifiers, pushover)
+	}
+	if config.WebPush != nil {
+		push, err := newWebPushNotifier(config.WebPush, config.DataDir, links)
+		if err != nil {
+			return nil, fmt.Errorf("web_push: %w", err)
+		}
+		notifiers = append(notifiers, push)
+	}
+	return notifiers, nil
+}
+
+func (d *Dispatcher) run() {
+	for event := range d.events {
+		if d.routes != nil && event.Notifier == "" {
+			routeEvent(d.routes, event)
+			continue
+		}
+		for _, notifier := range d.notifiers {
+			if (event.Notifier != "" && event.Notifier != notifier.Name()) || !wants(notifier, event.Kind) {
+				continue
+			}
+			if err := notifier.Notify(event); err != nil {
+				log.Errorf("Failed to send %s notification via %s: %v", event.Kind, notifier.Name(), err)
+			}
+		}
+	}
+}
+
+// Enabled reports whether any notifier is configured
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.notifiers) > 0
+}
+
+// Has checks if a notifier with the given name is configured
+func (d *Dispatcher) Has(name string) bool {
+	if d == nil {
+		return false
+	}
+	for _, notifier := range d.notifiers {
+		if notifier.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// BoardChanged tells the board watchers that the board changed. The view is
+// only taken if a watcher has messages that may change, and changes arriving
+// while one is pending are coalesced into it.
+func (d *Dispatcher) BoardChanged(view func() boardView) {
+	if d == nil || d.changed == nil {
+		return
+	}
+	select {
+	case d.changed <- view:
+	default:
+	}
+}
+
+func (d *Dispatcher) syncBoard() {
+	for view := range d.changed {
+		var watching []boardWatcher
+		for _, watcher := range d.watchers {
+			if watcher.Watching() {
+				watching = append(watching, watcher)
+			}
+		}
+		if len(watching) == 0 {
+			continue
+		}
+		board := view()
+		for _, watcher := range watching {
+			watcher.BoardChanged(board)
+		}
+	}
+}
+
+// Dispatch queues an event, dropping it if the queue is full
+func (d *Dispatcher) Dispatch(event NotificationEvent) {
+	if d == nil || d.events == nil || (len(event.Alerts) == 0 && event.Kind != EventAllClear) {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case d.events <- event:
+	default:
+		log.Warnf("Notification queue full, dropping %s event for %d alerts", event.Kind, len(event.Alerts))
+	}
+}
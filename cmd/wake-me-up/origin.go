@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// allowedOrigins are the origins besides the server's own that may open
+// WebSocket connections and send state-changing requests, "*" allows any
+var allowedOrigins map[string]bool
+
+// setAllowedOrigins parses the allowed_origins config
+func setAllowedOrigins(origins []string) error {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			allowed[origin] = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("allowed_origins: expected an origin like https://board.example.com, got %q", origin)
+		}
+		allowed[u.Scheme+"://"+strings.ToLower(u.Host)] = true
+	}
+	allowedOrigins = allowed
+	return nil
+}
+
+// requestOrigin returns the origin a browser sent a request from, taken from
+// the Referer when there is no Origin header, or "" for non-browser clients
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+		return referer.Scheme + "://" + referer.Host
+	}
+	return ""
+}
+
+// originAllowed tells if a request comes from the board itself, an allowed
+// origin or a client that isn't a browser. Browsers send the origin of
+// cross-site requests, so another website can't act on the board through a
+// visitor's browser, e.g. POST /clear to a LAN instance.
+func originAllowed(r *http.Request) bool {
+	origin := requestOrigin(r)
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		// e.g. "null" from sandboxed frames and local files
+		return allowedOrigins["*"]
+	}
+	if allowedOrigins["*"] || allowedOrigins[u.Scheme+"://"+strings.ToLower(u.Host)] {
+		return true
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && fromTrustedProxy(r) {
+		host = forwarded
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+// originMiddleware rejects state-changing requests from other websites
+func originMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !originAllowed(r) {
+				log.Warnf("Rejected cross-origin %s %s from %s (origin %s)", r.Method, r.URL.Path, getClientIP(r), requestOrigin(r))
+				audit.RecordRequest(r, AuditAuthFailure, 6, "Cross-origin request", map[string]string{"reason": "origin_not_allowed", "origin": requestOrigin(r)})
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
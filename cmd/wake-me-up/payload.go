@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// decodePayload decodes a webhook body. Alertmanager payloads decode as they
+// are; the lenient mode additionally accepts what other senders get wrong:
+// label values and version as numbers or booleans, and empty or missing
+// times, with a missing startsAt set to the receipt time. In both modes
+// unknown fields are ignored and a zero endsAt, which Alertmanager sends for
+// firing alerts, is treated as unset.
+func decodePayload(body []byte, lenient bool, now time.Time) (WebhookPayload, error) {
+	var payload WebhookPayload
+	if lenient {
+		var loose lenientPayload
+		if err := json.Unmarshal(body, &loose); err != nil {
+			return payload, err
+		}
+		payload = loose.payload(now)
+	} else if err := json.Unmarshal(body, &payload); err != nil {
+		return payload, err
+	}
+
+	for i := range payload.Alerts {
+		if endsAt := payload.Alerts[i].EndsAt; endsAt != nil && endsAt.IsZero() {
+			payload.Alerts[i].EndsAt = nil
+		}
+	}
+	return payload, nil
+}
+
+// lenientPayload mirrors WebhookPayload with tolerant field types
+type lenientPayload struct {
+	Version           flexString            `json:"version"`
+	GroupKey          flexString            `json:"groupKey"`
+	TruncatedAlerts   int                   `json:"truncatedAlerts"`
+	Status            flexString            `json:"status"`
+	Receiver          flexString            `json:"receiver"`
+	GroupLabels       map[string]flexString `json:"groupLabels"`
+	CommonLabels      map[string]flexString `json:"commonLabels"`
+	CommonAnnotations map[string]flexString `json:"commonAnnotations"`
+	ExternalURL       flexString            `json:"externalURL"`
+	Alerts            []lenientAlert        `json:"alerts"`
+}
+
+type lenientAlert struct {
+	Status       flexString            `json:"status"`
+	Labels       map[string]flexString `json:"labels"`
+	Annotations  map[string]flexString `json:"annotations"`
+	StartsAt     flexTime              `json:"startsAt"`
+	EndsAt       flexTime              `json:"endsAt"`
+	GeneratorURL flexString            `json:"generatorURL"`
+	Fingerprint  flexString            `json:"fingerprint"`
+}
+
+// payload converts to a WebhookPayload, dating alerts without startsAt now
+func (p lenientPayload) payload(now time.Time) WebhookPayload {
+	payload := WebhookPayload{
+		Version:           string(p.Version),
+		GroupKey:          string(p.GroupKey),
+		TruncatedAlerts:   p.TruncatedAlerts,
+		Status:            string(p.Status),
+		Receiver:          string(p.Receiver),
+		GroupLabels:       flexStrings(p.GroupLabels),
+		CommonLabels:      flexStrings(p.CommonLabels),
+		CommonAnnotations: flexStrings(p.CommonAnnotations),
+		ExternalURL:       string(p.ExternalURL),
+		Alerts:            make([]Alert, len(p.Alerts)),
+	}
+	for i, loose := range p.Alerts {
+		alert := Alert{
+			Status:       string(loose.Status),
+			Labels:       flexStrings(loose.Labels),
+			Annotations:  flexStrings(loose.Annotations),
+			StartsAt:     time.Time(loose.StartsAt),
+			GeneratorURL: string(loose.GeneratorURL),
+			Fingerprint:  string(loose.Fingerprint),
+		}
+		if alert.StartsAt.IsZero() {
+			alert.StartsAt = now
+		}
+		if endsAt := time.Time(loose.EndsAt); !endsAt.IsZero() {
+			alert.EndsAt = &endsAt
+		}
+		payload.Alerts[i] = alert
+	}
+	return payload
+}
+
+// flexString decodes a JSON string, number, boolean or null as a string
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ""
+	case len(data) > 0 && data[0] == '"':
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = flexString(v)
+	case len(data) > 0 && (data[0] == '{' || data[0] == '['):
+		return fmt.Errorf("expected a string, got %s", data[:1])
+	default:
+		// Numbers and booleans keep their JSON spelling, e.g. 3 or true
+		*s = flexString(data)
+	}
+	return nil
+}
+
+// flexStrings converts a decoded label map
+func flexStrings(m map[string]flexString) map[string]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = string(v)
+	}
+	return result
+}
+
+// flexTime decodes an RFC 3339 time, treating null and "" as unset
+type flexTime time.Time
+
+func (t *flexTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) || bytes.Equal(data, []byte(`""`)) {
+		*t = flexTime{}
+		return nil
+	}
+	var v time.Time
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*t = flexTime(v)
+	return nil
+}
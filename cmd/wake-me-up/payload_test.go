@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var receivedAt = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+func TestDecodePayloadFixtures(t *testing.T) {
+	// The Alertmanager fixtures decode the same in both modes
+	fixtures, err := filepath.Glob(filepath.Join("..", "..", "test", "mock-webhook-*.json"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("No fixtures found: %v", err)
+	}
+	for _, fixture := range fixtures {
+		body, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		strict, err := decodePayload(body, false, receivedAt)
+		if err != nil {
+			t.Fatalf("%s: strict decode failed: %v", fixture, err)
+		}
+		lenient, err := decodePayload(body, true, receivedAt)
+		if err != nil {
+			t.Fatalf("%s: lenient decode failed: %v", fixture, err)
+		}
+		if len(strict.Alerts) != len(lenient.Alerts) || strict.Receiver != lenient.Receiver {
+			t.Fatalf("%s: modes disagree: %+v vs %+v", fixture, strict, lenient)
+		}
+		for i := range strict.Alerts {
+			if !labelsEqual(strict.Alerts[i].Labels, lenient.Alerts[i].Labels) || !labelsEqual(strict.Alerts[i].Annotations, lenient.Alerts[i].Annotations) ||
+				!strict.Alerts[i].StartsAt.Equal(lenient.Alerts[i].StartsAt) {
+				t.Fatalf("%s: alert %d differs: %+v vs %+v", fixture, i, strict.Alerts[i], lenient.Alerts[i])
+			}
+		}
+	}
+}
+
+func TestDecodePayloadZeroEndsAt(t *testing.T) {
+	// Alertmanager sends the zero time rather than null for firing alerts
+	body := []byte(`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "A"},
+		"startsAt": "2024-01-15T10:30:00Z", "endsAt": "0001-01-01T00:00:00Z"}]}`)
+	for _, lenient := range []bool{false, true} {
+		payload, err := decodePayload(body, lenient, receivedAt)
+		if err != nil {
+			t.Fatalf("lenient=%v: %v", lenient, err)
+		}
+		if payload.Alerts[0].EndsAt != nil {
+			t.Fatalf("lenient=%v: zero endsAt should be unset, got %v", lenient, payload.Alerts[0].EndsAt)
+		}
+	}
+}
+
+func TestDecodePayloadLenient(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		labels   map[string]string
+		startsAt time.Time
+		endsAt   *time.Time
+		strict   bool // whether the strict mode accepts it too
+	}{
+		{
+			name: "unknown fields",
+			body: `{"version": "4", "orgId": 1, "title": "[FIRING:1]", "alerts": [{"status": "firing",
+				"labels": {"alertname": "A"}, "annotations": {"summary": "s"}, "fingerprint": "abc",
+				"silenceURL": "http://grafana/silence", "startsAt": "2024-01-15T10:30:00Z"}]}`,
+			labels:   map[string]string{"alertname": "A"},
+			startsAt: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+			strict:   true,
+		},
+		{
+			name: "numeric severity and version",
+			body: `{"version": 4, "alerts": [{"status": "firing",
+				"labels": {"alertname": "A", "severity": 2, "page": true, "team": null},
+				"startsAt": "2024-01-15T10:30:00Z"}]}`,
+			labels:   map[string]string{"alertname": "A", "severity": "2", "page": "true", "team": ""},
+			startsAt: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "missing startsAt",
+			body:     `{"alerts": [{"status": "firing", "labels": {"alertname": "A"}}]}`,
+			labels:   map[string]string{"alertname": "A"},
+			startsAt: receivedAt,
+			strict:   true, // but left at the zero time
+		},
+		{
+			name:     "empty and null times",
+			body:     `{"alerts": [{"status": "firing", "labels": {"alertname": "A"}, "startsAt": "", "endsAt": null}]}`,
+			labels:   map[string]string{"alertname": "A"},
+			startsAt: receivedAt,
+		},
+		{
+			name: "resolved with endsAt",
+			body: `{"alerts": [{"status": "resolved", "labels": {"alertname": "A"},
+				"startsAt": "2024-01-15T10:30:00Z", "endsAt": "2024-01-15T11:00:00Z"}]}`,
+			labels:   map[string]string{"alertname": "A"},
+			startsAt: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+			endsAt:   timePtr(time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)),
+			strict:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := decodePayload([]byte(tt.body), true, receivedAt)
+			if err != nil {
+				t.Fatalf("Lenient decode failed: %v", err)
+			}
+			alert := payload.Alerts[0]
+			if !labelsEqual(alert.Labels, tt.labels) {
+				t.Errorf("Labels = %v, want %v", alert.Labels, tt.labels)
+			}
+			if !alert.StartsAt.Equal(tt.startsAt) {
+				t.Errorf("StartsAt = %v, want %v", alert.StartsAt, tt.startsAt)
+			}
+			if (alert.EndsAt == nil) != (tt.endsAt == nil) || (tt.endsAt != nil && !alert.EndsAt.Equal(*tt.endsAt)) {
+				t.Errorf("EndsAt = %v, want %v", alert.EndsAt, tt.endsAt)
+			}
+
+			if _, err := decodePayload([]byte(tt.body), false, receivedAt); (err == nil) != tt.strict {
+				t.Errorf("Strict decode error = %v, want accepted: %v", err, tt.strict)
+			}
+		})
+	}
+}
+
+func TestDecodePayloadLenientRejects(t *testing.T) {
+	for _, body := range []string{
+		`{not json`,
+		`{"alerts": [{"labels": {"alertname": {"nested": "object"}}}]}`,
+		`{"alerts": [{"labels": {"alertname": "A"}, "startsAt": "yesterday"}]}`,
+	} {
+		if _, err := decodePayload([]byte(body), true, receivedAt); err == nil {
+			t.Errorf("Expected an error for %s", body)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
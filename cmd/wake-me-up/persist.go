@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// dataFilePath returns the path of a state file in the data directory, or an
+// empty string when persistence is disabled
+func (a *AppState) dataFilePath(name string) string {
+	if a.config == nil || a.config.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(a.config.DataDir, name)
+}
+
+// saveJSON atomically writes a value as JSON, so a crash never leaves a
+// truncated state file behind
+func saveJSON(path string, v interface{}) error {
+	if err := chaos.storageError(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadJSON reads a value written by saveJSON, returning false if the file
+// does not exist yet
+func loadJSON(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
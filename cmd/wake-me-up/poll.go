@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	defaultPollReceiver = "alertmanager-poll"
+)
+
+// AlertmanagerPollConfig polls the Alertmanager API for alerts, for networks
+// where Alertmanager can't reach the webhook but we can reach Alertmanager
+type AlertmanagerPollConfig struct {
+	URL      string        `yaml:"url"`      // Alertmanager base URL, e.g. http://alertmanager:9093
+	Interval time.Duration `yaml:"interval"` // How often to poll (default: 30s)
+	Username string        `yaml:"username"` // Basic auth (optional)
+	Password string        `yaml:"password"`
+	Receiver string        `yaml:"receiver"` // Only alerts routed to this receiver, and the receiver shown on the board (default: all, shown as alertmanager-poll)
+	Filter   []string      `yaml:"filter"`   // Alertmanager matchers the alerts must match, e.g. severity="critical" (optional)
+}
+
+// gettableAlert is an alert of the Alertmanager v2 API
+type gettableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// alertmanagerPoller feeds the alerts firing in Alertmanager to the board,
+// resolving those that stopped firing since the last poll
+type alertmanagerPoller struct {
+	config   *AlertmanagerPollConfig
+	endpoint string
+	receiver string
+	client   *http.Client
+
+	firing map[string]Alert // fingerprint -> alert fed to the board as firing
+	seeded bool
+}
+
+func newAlertmanagerPoller(config *AlertmanagerPollConfig) (*alertmanagerPoller, error) {
+	base, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("url must be an http(s) URL, got %q", config.URL)
+	}
+	if config.Interval < 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", config.Interval)
+	}
+
+	// Silenced and inhibited alerts need no attention, like resolved ones
+	query := url.Values{"active": {"true"}, "silenced": {"false"}, "inhibited": {"false"}}
+	if config.Receiver != "" {
+		// Alertmanager takes a regex, the receiver is a name
+		query.Set("receiver", "^(?:"+regexp.QuoteMeta(config.Receiver)+")$")
+	}
+	for _, matcher := range config.Filter {
+		query.Add("filter", matcher)
+	}
+	endpoint := *base
+	endpoint.Path += "/api/v2/alerts"
+	endpoint.RawQuery = query.Encode()
+
+	receiver := config.Receiver
+	if receiver == "" {
+		receiver = defaultPollReceiver
+	}
+	return &alertmanagerPoller{
+		config:   config,
+		endpoint: endpoint.String(),
+		receiver: receiver,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		firing:   make(map[string]Alert),
+	}, nil
+}
+
+// fetch returns the alerts currently firing in Alertmanager
+func (p *alertmanagerPoller) fetch() ([]gettableAlert, error) {
+	req, err := http.NewRequest(http.MethodGet, p.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.config.Username != "" {
+		req.SetBasicAuth(p.config.Username, p.config.Password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("alertmanager returned %s", resp.Status)
+	}
+	var alerts []gettableAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		return nil, fmt.Errorf("invalid alerts: %v", err)
+	}
+	return alerts, nil
+}
+
+// reconcile turns the alerts firing in Alertmanager into a payload of those
+// that started firing and those that resolved since the last poll
+func (p *alertmanagerPoller) reconcile(alerts []gettableAlert, now time.Time) WebhookPayload {
+	payload := WebhookPayload{Status: "resolved", Receiver: p.receiver, ExternalURL: strings.TrimSuffix(p.config.URL, "/")}
+	current := make(map[string]Alert, len(alerts))
+	for _, fetched := range alerts {
+		alert := Alert{
+			Status:       "firing",
+			Labels:       fetched.Labels,
+			Annotations:  fetched.Annotations,
+			StartsAt:     fetched.StartsAt,
+			GeneratorURL: fetched.GeneratorURL,
+		}
+		fingerprint := labelFingerprint(alert.Labels)
+		current[fingerprint] = alert
+		if _, known := p.firing[fingerprint]; !known {
+			payload.Status = "firing"
+			payload.Alerts = append(payload.Alerts, alert)
+		}
+	}
+	for fingerprint, alert := range p.firing {
+		if _, ok := current[fingerprint]; !ok {
+			endsAt := now
+			alert.Status = "resolved"
+			alert.EndsAt = &endsAt
+			payload.Alerts = append(payload.Alerts, alert)
+		}
+	}
+	p.firing = current
+	return payload
+}
+
+// seed takes the polled alerts already firing on the board as known, so a
+// restart with a restored board doesn't add them again
+func (p *alertmanagerPoller) seed(state *AppState) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	for _, entry := range state.alerts {
+		if entry.Receiver == p.receiver && entry.Alert.Status == "firing" {
+			p.firing[entry.labelFingerprint()] = entry.Alert
+		}
+	}
+}
+
+// poll fetches the alerts once and applies the changes to the board
+func (p *alertmanagerPoller) poll(state *AppState) error {
+	alerts, err := p.fetch()
+	if err != nil {
+		// Keep what is known, a failed poll says nothing about the alerts
+		return err
+	}
+	if !p.seeded {
+		p.seed(state)
+		p.seeded = true
+	}
+	payload := p.reconcile(alerts, time.Now())
+	if len(payload.Alerts) == 0 {
+		return nil
+	}
+	result := state.AddWebhook(payload)
+	webhooksReceived.WithLabelValues("alertmanager_poll").Inc()
+	log.Infof("Polled Alertmanager: %d alerts created, %d resolved", result.Created, result.Resolved)
+	return nil
+}
+
+// runAlertmanagerPoller polls Alertmanager at the configured interval
+func (a *AppState) runAlertmanagerPoller(poller *alertmanagerPoller) {
+	interval := poller.config.Interval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	for {
+		if a.cluster.isLeader() {
+			if err := poller.poll(a); err != nil {
+				log.Errorf("Failed to poll Alertmanager: %v", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
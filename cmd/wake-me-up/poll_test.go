@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAlertmanagerPollerReceiver(t *testing.T) {
+	poller, err := newAlertmanagerPoller(&AlertmanagerPollConfig{URL: "http://alertmanager:9093", Receiver: "team.db+oncall"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint, _ := url.Parse(poller.endpoint)
+	if got := endpoint.Query().Get("receiver"); got != `^(?:team\.db\+oncall)$` {
+		t.Errorf("Expected the receiver matched literally, got %s", got)
+	}
+}
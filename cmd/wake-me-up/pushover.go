@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPushoverAPIURL = "https://api.pushover.net/1/messages.json"
+	defaultPushoverRetry  = time.Minute
+	defaultPushoverExpire = time.Hour
+
+	// Pushover rejects messages over 1024 characters and titles over 250
+	maxPushoverMessage = 1024
+	maxPushoverTitle   = 250
+	maxPushoverAlerts  = 10
+)
+
+// Pushover priorities, see https://pushover.net/api#priority
+const (
+	pushoverLowest    = -2
+	pushoverQuiet     = -1
+	pushoverNormal    = 0
+	pushoverEmergency = 2 // repeats until acknowledged in the app
+)
+
+// defaultPushoverPriorities map severities to priorities unless configured
+var defaultPushoverPriorities = map[string]int{"critical": 1, "warning": 0, "info": -1}
+
+// PushoverConfig sends push notifications to phones through Pushover
+type PushoverConfig struct {
+	Token          string         `yaml:"token"`           // API token of the Pushover application
+	UserKey        string         `yaml:"user_key"`        // User or group key to notify
+	Device         string         `yaml:"device"`          // Only notify this device of the user (optional, default: all)
+	Priorities     map[string]int `yaml:"priorities"`      // Priority by severity, -2 to 2 (optional, default: critical: 1, warning: 0, info: -1, others: 0)
+	Retry          time.Duration  `yaml:"retry"`           // How often emergency (2) notifications repeat until acknowledged in the app, at least 30s (optional, default: 1m)
+	Expire         time.Duration  `yaml:"expire"`          // When emergency notifications stop repeating (optional, default: 1h)
+	NotifyResolved bool           `yaml:"notify_resolved"` // Also notify, quietly, when firing alerts resolve (optional, default: false)
+	APIURL         string         `yaml:"api_url"`         // Messages API (optional, default: https://api.pushover.net/1/messages.json)
+}
+
+// pushoverNotifier sends one push notification per event
+type pushoverNotifier struct {
+	config     *PushoverConfig
+	links      *ackLinker
+	priorities map[string]int
+	client     *http.Client
+}
+
+func newPushoverNotifier(config *PushoverConfig, links *ackLinker) (*pushoverNotifier, error) {
+	if config.Token == "" || config.UserKey == "" {
+		return nil, fmt.Errorf("missing token or user_key")
+	}
+	priorities := defaultPushoverPriorities
+	if config.Priorities != nil {
+		priorities = make(map[string]int, len(config.Priorities))
+		for severity, priority := range config.Priorities {
+			if priority < pushoverLowest || priority > pushoverEmergency {
+				return nil, fmt.Errorf("priorities.%s: %d is not between -2 and 2", severity, priority)
+			}
+			priorities[strings.ToLower(severity)] = priority
+		}
+	}
+	if config.Retry == 0 {
+		config.Retry = defaultPushoverRetry
+	}
+	if config.Retry < 30*time.Second {
+		return nil, fmt.Errorf("retry must be at least 30s, got %s", config.Retry)
+	}
+	if config.Expire <= 0 {
+		config.Expire = defaultPushoverExpire
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultPushoverAPIURL
+	}
+	return &pushoverNotifier{
+		config:     config,
+		links:      links,
+		priorities: priorities,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *pushoverNotifier) Name() string {
+	return "pushover"
+}
+
+// Wants takes resolutions only with notify_resolved
+func (p *pushoverNotifier) Wants(kind string) bool {
+	return kind != EventResolved || p.config.NotifyResolved
+}
+
+// priority is the highest priority of the alerts of an event
+func (p *pushoverNotifier) priority(event NotificationEvent) int {
+	switch event.Kind {
+	case EventAllClear:
+		return pushoverNormal
+	case EventResolved:
+		return pushoverQuiet
+	}
+	priority := pushoverLowest
+	for _, entry := range event.Alerts {
+		severityPriority, ok := p.priorities[alertSeverity(entry.Alert)]
+		if !ok {
+			severityPriority = pushoverNormal
+		}
+		priority = max(priority, severityPriority)
+	}
+	return priority
+}
+
+// Notify sends the push notification of an event
+func (p *pushoverNotifier) Notify(event NotificationEvent) error {
+	resp, err := p.client.PostForm(p.config.APIURL, p.render(event))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.Status != 1 {
+		return fmt.Errorf("pushover returned %s: %s", resp.Status, strings.Join(result.Errors, ", "))
+	}
+	return nil
+}
+
+// render builds the form of the message of an event
+func (p *pushoverNotifier) render(event NotificationEvent) url.Values {
+	form := url.Values{
+		"token": {p.config.Token},
+		"user":  {p.config.UserKey},
+	}
+	if p.config.Device != "" {
+		form.Set("device", p.config.Device)
+	}
+	priority := p.priority(event)
+	form.Set("priority", strconv.Itoa(priority))
+	if priority == pushoverEmergency {
+		form.Set("retry", strconv.Itoa(int(p.config.Retry.Seconds())))
+		form.Set("expire", strconv.Itoa(int(p.config.Expire.Seconds())))
+	}
+	if !event.Time.IsZero() {
+		form.Set("timestamp", strconv.FormatInt(event.Time.Unix(), 10))
+	}
+
+	if event.Kind == EventAllClear {
+		form.Set("title", "All clear")
+		form.Set("message", truncateRunes(event.Note, maxPushoverMessage))
+		return form
+	}
+	title := fmt.Sprintf("%d alert(s) need attention", len(event.Alerts))
+	switch event.Kind {
+	case EventFollowUp:
+		title = "Still firing at its follow-up time"
+	case EventEscalated:
+		title = "Still unacknowledged"
+	case EventResolved:
+		title = fmt.Sprintf("%d alert(s) resolved", len(event.Alerts))
+	}
+	if len(event.Alerts) == 1 && event.Kind == EventFiring {
+		title = alertTitle(event.Alerts[0].Alert)
+	}
+	form.Set("title", truncateRunes(title, maxPushoverTitle))
+
+	var lines []string
+	if event.Note != "" {
+		lines = append(lines, event.Note)
+	}
+	for i, entry := range event.Alerts {
+		if i == maxPushoverAlerts {
+			lines = append(lines, fmt.Sprintf("…and %d more on the board", len(event.Alerts)-i))
+			break
+		}
+		line := alertTitle(entry.Alert)
+		if severity := alertSeverity(entry.Alert); severity != "" {
+			line += " (" + severity + ")"
+		}
+		if summary := entry.Alert.Annotations["summary"]; summary != "" {
+			line += ": " + summary
+		}
+		lines = append(lines, line)
+	}
+	form.Set("message", truncateRunes(strings.Join(lines, "\n"), maxPushoverMessage))
+
+	// A single alert can be acknowledged right from the notification
+	if len(event.Alerts) == 1 && event.Kind != EventResolved {
+		if link := p.links.Link(event.Alerts[0].ID); link != "" {
+			form.Set("url", link)
+			form.Set("url_title", "✓ Acknowledge")
+		}
+	}
+	return form
+}
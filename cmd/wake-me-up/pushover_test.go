@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPushoverNotifier(t *testing.T) {
+	var sent url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sent = r.PostForm
+		if sent.Get("token") != "app-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":0,"errors":["application token is invalid"]}`))
+			return
+		}
+		w.Write([]byte(`{"status":1}`))
+	}))
+	defer server.Close()
+
+	config := &PushoverConfig{Token: "app-token", UserKey: "user-key", Priorities: map[string]int{"Critical": 2, "warning": 0}, APIURL: server.URL}
+	pushover, err := newPushoverNotifier(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := func(severity string) AlertEntry {
+		return AlertEntry{Alert: Alert{Status: "firing", Labels: map[string]string{"alertname": "Disk", "severity": severity}}}
+	}
+
+	if err := pushover.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{alert("warning"), alert("critical")}}); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Get("user") != "user-key" || sent.Get("title") != "2 alert(s) need attention" {
+		t.Errorf("Unexpected message %v", sent)
+	}
+	if sent.Get("priority") != "2" || sent.Get("retry") != "60" || sent.Get("expire") != "3600" {
+		t.Errorf("Expected an emergency priority for the critical alert, got %v", sent)
+	}
+
+	if err := pushover.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{alert("page")}}); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Get("priority") != "0" || sent.Has("retry") || sent.Get("title") != "Disk" {
+		t.Errorf("Expected a normal priority for an unmapped severity, got %v", sent)
+	}
+
+	if _, err := newPushoverNotifier(&PushoverConfig{Token: "t", UserKey: "u", Priorities: map[string]int{"critical": 3}}, nil); err == nil {
+		t.Error("Expected an out of range priority rejected")
+	}
+
+	long := alert("warning")
+	long.Alert.Labels["alertname"] = strings.Repeat("Ä", 300)
+	long.Alert.Annotations = map[string]string{"summary": strings.Repeat("é", 2000)}
+	if err := pushover.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{long}}); err != nil {
+		t.Fatal(err)
+	}
+	if title := []rune(sent.Get("title")); len(title) != maxPushoverTitle || title[len(title)-1] != '…' {
+		t.Errorf("Expected the title cut to %d characters, got %d", maxPushoverTitle, len(title))
+	}
+	if message := []rune(sent.Get("message")); len(message) != maxPushoverMessage || message[len(message)-1] != '…' {
+		t.Errorf("Expected the message cut to %d characters, got %d", maxPushoverMessage, len(message))
+	}
+
+	config.Token = "wrong"
+	if err := pushover.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{alert("warning")}}); err == nil {
+		t.Error("Expected the API error")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// AssetManifest lists the assets the service worker caches for offline use
+// The version changes whenever any asset changes, so clients drop stale caches
+type AssetManifest struct {
+	Version string  `json:"version"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a single cacheable URL with the hash of its content
+type Asset struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// assetFile is a file to hash, in a file system
+type assetFile struct {
+	fsys fs.FS
+	name string
+}
+
+// buildAssetManifest hashes the static files and the sound effect
+func buildAssetManifest(staticFS fs.FS, soundPath string) (*AssetManifest, error) {
+	files := make(map[string]assetFile) // URL -> file
+
+	entries, err := fs.ReadDir(staticFS, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// The Go file embedding the directory is not an asset
+		if entry.IsDir() || entry.Name() == "sw.js" || path.Ext(entry.Name()) == ".go" {
+			continue
+		}
+		files["/static/"+entry.Name()] = assetFile{staticFS, entry.Name()}
+	}
+	files["/sound"] = assetFile{os.DirFS(filepath.Dir(soundPath)), filepath.Base(soundPath)}
+
+	urls := make([]string, 0, len(files))
+	for url := range files {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	manifest := &AssetManifest{Assets: make([]Asset, 0, len(urls))}
+	version := sha256.New()
+	for _, url := range urls {
+		hash, err := hashFile(files[url].fsys, files[url].name)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Assets = append(manifest.Assets, Asset{URL: url, Hash: hash})
+		version.Write([]byte(url + ":" + hash + "\n"))
+	}
+	manifest.Version = hex.EncodeToString(version.Sum(nil))[:16]
+
+	return manifest, nil
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// assetManifestHandler serves the offline cache manifest
+func assetManifestHandler(state *AppState, staticFS fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		manifest, err := buildAssetManifest(staticFS, state.config.SoundEffectFilePath)
+		if err != nil {
+			log.Errorf("Error building asset manifest: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(manifest)
+	}
+}
+
+// appIcons are the PNG renderings of the app icon: the sizes Android asks
+// for when installing, and the iOS home screen icon
+var appIcons = []struct {
+	path string
+	size int
+}{
+	{"/icon-192.png", 192},
+	{"/icon-512.png", 512},
+	{"/apple-touch-icon.png", 180},
+}
+
+func isAppIcon(path string) bool {
+	for _, icon := range appIcons {
+		if icon.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// webManifestHandler serves the web app manifest that makes the dashboard
+// installable, e.g. on a phone or tablet kept as a bedside alert display
+func webManifestHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		icons := []map[string]string{
+			{"src": "/static/icon.svg", "sizes": "any", "type": "image/svg+xml"},
+		}
+		for _, icon := range appIcons[:2] {
+			size := fmt.Sprintf("%dx%d", icon.size, icon.size)
+			// The icon fills its square, so launchers may crop it to their shape
+			icons = append(icons,
+				map[string]string{"src": icon.path, "sizes": size, "type": "image/png"},
+				map[string]string{"src": icon.path, "sizes": size, "type": "image/png", "purpose": "maskable"})
+		}
+		w.Header().Set("Content-Type", "application/manifest+json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":               "/",
+			"name":             browserSettings(state.config.Browser, false).Title,
+			"short_name":       "Wake me Up",
+			"description":      "Alertmanager alarm board",
+			"start_url":        "/",
+			"scope":            "/",
+			"display":          "standalone",
+			"display_override": []string{"fullscreen", "standalone"},
+			"orientation":      "any",
+			"background_color": "#667eea",
+			"theme_color":      "#764ba2",
+			"icons":            icons,
+		})
+	}
+}
+
+// serviceWorkerHandler serves the service worker from the root path, so its
+// scope covers the whole dashboard
+func serviceWorkerHandler(staticFS fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, staticFS, "sw.js")
+	}
+}
+
+// renderedIcons caches the PNG app icons by size
+var renderedIcons sync.Map
+
+// appIconHandler serves the app icon as a PNG of a size, for the launchers
+// that do not take the SVG one
+func appIconHandler(size int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, ok := renderedIcons.Load(size)
+		if !ok {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, renderAppIcon(size)); err != nil {
+				log.Errorf("Error encoding app icon: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			data, _ = renderedIcons.LoadOrStore(size, buf.Bytes())
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(data.([]byte))
+	}
+}
+
+// renderAppIcon draws static/icon.svg on a full square: a red disc with an
+// exclamation mark on purple
+func renderAppIcon(size int) image.Image {
+	purple := color.RGBA{0x76, 0x4b, 0xa2, 0xff}
+	red := color.RGBA{0xff, 0x44, 0x44, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	icon := image.NewRGBA(image.Rect(0, 0, size, size))
+	// In the 512 units of the SVG
+	unit := float64(size) / 512
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			ux, uy := (float64(x)+0.5)/unit, (float64(y)+0.5)/unit
+			dx, dy := ux-256, uy-256
+			switch {
+			case dx*dx+dy*dy > 150*150:
+				icon.Set(x, y, purple)
+			case ux >= 238 && ux <= 274 && uy >= 160 && uy <= 285, // the bar
+				(ux-256)*(ux-256)+(uy-322)*(uy-322) <= 20*20: // the dot
+				icon.Set(x, y, white)
+			default:
+				icon.Set(x, y, red)
+			}
+		}
+	}
+	return icon
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppastorf/wake-me-up/static"
+)
+
+func TestPWA(t *testing.T) {
+	sound := filepath.Join(t.TempDir(), "siren.wav")
+	os.WriteFile(sound, []byte("RIFF"), 0o644)
+	manifest, err := buildAssetManifest(static.FS, sound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := make(map[string]bool)
+	for _, asset := range manifest.Assets {
+		urls[asset.URL] = true
+	}
+	if !urls["/static/app.js"] || !urls["/sound"] || urls["/static/sw.js"] || urls["/static/embed.go"] {
+		t.Errorf("Expected the embedded assets and the sound without the service worker, got %v", urls)
+	}
+
+	state := NewAppState(100)
+	state.config = &Config{Browser: &BrowserConfig{Title: "Ops board"}}
+	rec := httptest.NewRecorder()
+	webManifestHandler(state)(rec, httptest.NewRequest(http.MethodGet, "/manifest.webmanifest", nil))
+	var webManifest struct {
+		Name  string              `json:"name"`
+		Icons []map[string]string `json:"icons"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &webManifest)
+	if webManifest.Name != "Ops board" || !strings.Contains(rec.Body.String(), `"src":"/icon-512.png"`) {
+		t.Errorf("Expected the configured title and the PNG icons, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	serviceWorkerHandler(static.FS)(rec, httptest.NewRequest(http.MethodGet, "/sw.js", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "addEventListener('push'") {
+		t.Errorf("Expected the embedded service worker, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	appIconHandler(192)(rec, httptest.NewRequest(http.MethodGet, "/icon-192.png", nil))
+	icon, err := png.Decode(rec.Body)
+	if err != nil || icon.Bounds().Dx() != 192 {
+		t.Fatalf("Expected a 192px PNG icon, got %v", err)
+	}
+	// Purple corners, red disc, white mark
+	if r, g, b, _ := icon.At(0, 0).RGBA(); r>>8 != 0x76 || g>>8 != 0x4b || b>>8 != 0xa2 {
+		t.Errorf("Expected a purple background, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+	if r, g, _, _ := icon.At(96, 80).RGBA(); r>>8 != 0xff || g>>8 != 0xff {
+		t.Errorf("Expected the white exclamation mark in the middle, got %v", icon.At(96, 80))
+	}
+}
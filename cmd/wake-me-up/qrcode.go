@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Size in pixels of the QR code images
+const qrCodeSize = 256
+
+// hasAlert reports whether an alert with the given ID is on the board
+func (a *AppState) hasAlert(alertID string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, entry := range a.alerts {
+		if entry.ID == alertID {
+			return true
+		}
+	}
+	return false
+}
+
+// qrCodeHandler serves a PNG QR code of an alert's acknowledge link, shown on
+// the cards in kiosk mode so it can be acknowledged from a phone
+func qrCodeHandler(state *AppState, links *ackLinker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		alertID := r.URL.Query().Get("id")
+		if alertID == "" {
+			http.Error(w, "Missing alert ID", http.StatusBadRequest)
+			return
+		}
+		if !state.hasAlert(alertID) {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		}
+
+		png, err := qrcode.Encode(links.LinkFor(r, alertID), qrcode.Medium, qrCodeSize)
+		if err != nil {
+			log.Errorf("Error generating QR code: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Write(png)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Recovery mode has no config to read its settings from
+var (
+	recoveryPort   = flag.String("recovery-port", "8080", "Port of the recovery page served when the config fails to load.")
+	bootstrapToken = flag.String("bootstrap-token", "", "Token required to upload a config in recovery mode (default: $WAKE_ME_UP_BOOTSTRAP_TOKEN, random and printed to stderr if unset).")
+)
+
+// Largest config accepted by the recovery upload
+const maxRecoveryUpload = 1 << 20
+
+// RecoveryTemplateData is the data of the recovery page
+type RecoveryTemplateData struct {
+	Path        string
+	Error       string
+	Config      string // contents of the config file once the token is given, or the rejected upload
+	UploadError string
+	Saved       bool
+}
+
+// recoveryServer serves the recovery page until a config that parses is
+// uploaded
+type recoveryServer struct {
+	path      string
+	token     string
+	templates *templateSet
+	loadErr   error
+	recovery  chan *Config // receives the uploaded config
+}
+
+// runRecoveryMode is started instead of the board when the config can't be
+// loaded, so headless devices can be fixed from a browser. It blocks until a
+// corrected config is uploaded and returns it.
+func runRecoveryMode(path string, loadErr error) *Config {
+	InitLogger("info")
+	log.Errorf("Failed to load config '%s': %v", path, loadErr)
+
+	token := *bootstrapToken
+	if token == "" {
+		token = os.Getenv("WAKE_ME_UP_BOOTSTRAP_TOKEN")
+	}
+	if token == "" {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate bootstrap token: %v", err)
+		}
+		token = hex.EncodeToString(key)
+		// Kept out of the log, which is often shipped elsewhere
+		fmt.Fprintf(os.Stderr, "Bootstrap token for this start: %s\n", token)
+		log.Warn("No bootstrap token set, generated one for this start and printed it to stderr")
+	}
+
+	templates, err := newTemplateSet("", false)
+	if err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+	s := &recoveryServer{path: path, token: token, templates: templates, loadErr: loadErr, recovery: make(chan *Config, 1)}
+
+	mux := http.NewServeMux()
+	staticDir, _ := findAsset("", defaultStaticDir)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServerFS(staticAssets(staticDir))))
+	mux.HandleFunc("/", s.pageHandler)
+	mux.HandleFunc("/api/v1/recovery", s.statusHandler)
+	mux.HandleFunc("/api/v1/recovery/config", s.uploadHandler)
+	mux.HandleFunc("/api/v1/recovery/current", s.currentHandler)
+
+	server := &http.Server{Addr: ":" + *recoveryPort, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Recovery server failed: %v", err)
+		}
+	}()
+	log.Warnf("Recovery mode: upload a corrected config at http://<host>:%s/", *recoveryPort)
+
+	config := <-s.recovery
+	// Let the success page go out before the board takes over the port
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Failed to stop recovery server: %v", err)
+	}
+	return config
+}
+
+// page renders the recovery page. The config file holds secrets, so it's
+// only shown to those giving the token, see currentHandler.
+func (s *recoveryServer) page(w http.ResponseWriter, status int, data RecoveryTemplateData) {
+	data.Path = s.path
+	data.Error = s.loadErr.Error()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.templates.Execute(w, "recovery.html", data); err != nil {
+		log.Errorf("Error rendering recovery page: %v", err)
+	}
+}
+
+// pageHandler shows the load error and the upload form on every page, so
+// the board URL a kiosk has open leads to it
+func (s *recoveryServer) pageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.page(w, http.StatusServiceUnavailable, RecoveryTemplateData{})
+}
+
+// currentHandler shows the recovery page with the config file to edit, once
+// the bootstrap token posted with the form is verified
+func (s *recoveryServer) currentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecoveryUpload)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form body", http.StatusBadRequest)
+		return
+	}
+	if !s.authorized(r.PostForm.Get("token")) {
+		log.Warnf("Rejected config display with invalid bootstrap token from IP: %s", getClientIP(r))
+		s.page(w, http.StatusUnauthorized, RecoveryTemplateData{UploadError: "Invalid bootstrap token"})
+		return
+	}
+	contents, err := os.ReadFile(s.path)
+	// Without a config file, only the environment failed to load
+	if err != nil && !os.IsNotExist(err) {
+		s.page(w, http.StatusOK, RecoveryTemplateData{UploadError: "Failed to read config: " + err.Error()})
+		return
+	}
+	s.page(w, http.StatusOK, RecoveryTemplateData{Config: string(contents)})
+}
+
+// authorized checks a bootstrap token
+func (s *recoveryServer) authorized(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// statusHandler reports the recovery mode and its load error
+func (s *recoveryServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery": true, "path": s.path, "error": s.loadErr.Error()})
+}
+
+// uploadHandler replaces the config file with an uploaded one that parses.
+// Scripts send the YAML as the body with the token in an Authorization:
+// Bearer or X-Bootstrap-Token header; the recovery page posts a form.
+func (s *recoveryServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	form := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	var token, contents string
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecoveryUpload)
+	if form {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form body", http.StatusBadRequest)
+			return
+		}
+		token, contents = r.PostForm.Get("token"), r.PostForm.Get("config")
+	} else {
+		token = r.Header.Get("X-Bootstrap-Token")
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		contents = string(body)
+	}
+
+	if !s.authorized(token) {
+		log.Warnf("Rejected config upload with invalid bootstrap token from IP: %s", getClientIP(r))
+		s.uploadFailed(w, form, http.StatusUnauthorized, contents, "Invalid bootstrap token")
+		return
+	}
+
+	config, err := parseConfigData([]byte(contents))
+	if err != nil {
+		log.Warnf("Rejected config upload from IP %s: %v", getClientIP(r), err)
+		s.uploadFailed(w, form, http.StatusBadRequest, contents, "Invalid config: "+err.Error())
+		return
+	}
+	if err := writeConfigFile(s.path, []byte(contents)); err != nil {
+		log.Errorf("Failed to write uploaded config: %v", err)
+		s.uploadFailed(w, form, http.StatusInternalServerError, contents, "Failed to write config: "+err.Error())
+		return
+	}
+	log.Infof("Corrected config uploaded from IP %s, leaving recovery mode", getClientIP(r))
+
+	if form {
+		s.page(w, http.StatusOK, RecoveryTemplateData{Saved: true})
+	} else {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+	select {
+	case s.recovery <- config:
+	default:
+		// Another upload already won
+	}
+}
+
+// uploadFailed answers a rejected upload, showing the form again with the
+// uploaded config for browsers
+func (s *recoveryServer) uploadFailed(w http.ResponseWriter, form bool, status int, contents, message string) {
+	if form {
+		s.page(w, status, RecoveryTemplateData{Config: contents, UploadError: message})
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// writeConfigFile atomically replaces the config file, keeping its mode
+func writeConfigFile(path string, contents []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
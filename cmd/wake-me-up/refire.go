@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+const defaultRefireWindow = time.Hour
+
+// Sound variant played while re-fired alerts are unacknowledged
+const soundVariantRefired = "refired"
+
+// markRefired flags new firing alerts whose labels were resolved or cleared
+// within the refire window, since recurrence often means a fix didn't hold
+// This should be called while holding the lock
+func (a *AppState) markRefired(entries []AlertEntry, now time.Time) {
+	for fingerprint, goneAt := range a.gone {
+		if now.Sub(goneAt) > a.refireWindow {
+			delete(a.gone, fingerprint)
+		}
+	}
+	for i := range entries {
+		if entries[i].Alert.Status != "firing" {
+			continue
+		}
+		if _, ok := a.gone[entries[i].labelFingerprint()]; ok && entries[i].labelFingerprint() != "" {
+			entries[i].Refired = true
+			log.Infof("Alert %s fired again within %s of going away", entries[i].ID, a.refireWindow)
+		}
+	}
+}
+
+// recordGone remembers when an alert left the board as resolved or cleared,
+// so it can be recognized if it fires again
+// This should be called while holding the lock
+func (a *AppState) recordGone(entry AlertEntry, now time.Time) {
+	if fingerprint := entry.labelFingerprint(); fingerprint != "" {
+		a.gone[fingerprint] = now
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alertmanager HA pairs deliver every notification from each replica. With
+// replica_dedup_window set, an alert delivered again within the window with
+// the same group key, fingerprint, start time and status is ingested once:
+// later copies only add their replica to the entry of the first. Replicas are
+// told apart by the external URL they send, and counted on /api/v1/replicas
+// whether or not duplicates are dropped, to notice a replica that went quiet.
+
+// unknownReplica names the deliveries without an external URL
+const unknownReplica = "unknown"
+
+// ReplicaStats counts the deliveries of an Alertmanager replica
+type ReplicaStats struct {
+	Replica      string    `json:"replica"` // external URL
+	Deliveries   int       `json:"deliveries"`
+	Alerts       int       `json:"alerts"`
+	Duplicates   int       `json:"duplicates"` // alerts another replica delivered first
+	LastDelivery time.Time `json:"lastDelivery"`
+}
+
+// replicaSet remembers which entry each recent delivery key created, and
+// what each replica delivered
+// This should be used while holding the AppState lock
+type replicaSet struct {
+	window    time.Duration // 0 disables deduplication
+	delivered map[string]replicaDelivery
+	stats     map[string]*ReplicaStats
+}
+
+// replicaDelivery is the entry a delivery key created, and when
+type replicaDelivery struct {
+	entryID string
+	at      time.Time
+}
+
+func newReplicaSet() *replicaSet {
+	return &replicaSet{delivered: make(map[string]replicaDelivery), stats: make(map[string]*ReplicaStats)}
+}
+
+// payloadReplica names the replica that sent a payload
+func payloadReplica(payload WebhookPayload) string {
+	if payload.ExternalURL == "" {
+		return unknownReplica
+	}
+	return payload.ExternalURL
+}
+
+// deliveryKey identifies an alert notification across replicas: the same
+// alert of the same group, in the same state
+func deliveryKey(groupKey string, alert Alert) string {
+	fingerprint := alert.Fingerprint
+	if fingerprint == "" {
+		fingerprint = labelFingerprint(alert.Labels)
+	}
+	return strings.Join([]string{groupKey, fingerprint, strconv.FormatInt(alert.StartsAt.UnixNano(), 10), alert.Status}, "\x00")
+}
+
+// duplicateOf returns the entry created by an earlier delivery of a key within
+// the window
+func (r *replicaSet) duplicateOf(key string, now time.Time) (string, bool) {
+	if r.window <= 0 {
+		return "", false
+	}
+	delivered, ok := r.delivered[key]
+	if !ok || now.Sub(delivered.at) >= r.window {
+		return "", false
+	}
+	return delivered.entryID, true
+}
+
+// observe counts a planned delivery of a replica, and remembers the keys of
+// the entries it created
+func (r *replicaSet) observe(plan ingestPlan, now time.Time) {
+	stats := r.stats[plan.Replica]
+	if stats == nil {
+		stats = &ReplicaStats{Replica: plan.Replica}
+		r.stats[plan.Replica] = stats
+	}
+	stats.Deliveries++
+	stats.Alerts += len(plan.Outcomes)
+	stats.Duplicates += len(plan.Duplicates)
+	stats.LastDelivery = now
+
+	if r.window <= 0 {
+		return
+	}
+	for key, delivered := range r.delivered {
+		if now.Sub(delivered.at) >= r.window {
+			delete(r.delivered, key)
+		}
+	}
+	for _, entry := range plan.Created {
+		r.delivered[entry.deliveryKey] = replicaDelivery{entryID: entry.ID, at: now}
+	}
+}
+
+// addReplica records that another replica delivered an entry too
+// This should be called while holding the lock
+func (a *AppState) addReplica(entryID, replica string) {
+	for i := range a.alerts {
+		entry := &a.alerts[i]
+		if entry.ID != entryID {
+			continue
+		}
+		if entry.ExternalURL != replica && !slices.Contains(entry.Replicas, replica) {
+			entry.Replicas = append(slices.Clone(entry.Replicas), replica)
+		}
+		return
+	}
+}
+
+// ReplicaStatsList returns the stats of the replicas, by external URL
+func (a *AppState) ReplicaStatsList() []ReplicaStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	list := make([]ReplicaStats, 0, len(a.replicas.stats))
+	for _, stats := range a.replicas.stats {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Replica < list[j].Replica })
+	return list
+}
+
+// replicasHandler lists the Alertmanager replicas that delivered webhooks
+func replicasHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.ReplicaStatsList())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplicaDedup(t *testing.T) {
+	state := NewAppState(100)
+	state.replicas.window = 5 * time.Minute
+	startsAt := time.Now().Add(-time.Minute)
+	delivery := func(replica, status string, startsAt time.Time) WebhookPayload {
+		return WebhookPayload{GroupKey: `{}:{alertname="Disk"}`, ExternalURL: replica, Alerts: []Alert{
+			{Status: status, Labels: map[string]string{"alertname": "Disk"}, StartsAt: startsAt, Fingerprint: "d41d8cd98f00b204"},
+		}}
+	}
+
+	if result := state.AddWebhook(delivery("http://am-1:9093", "firing", startsAt)); result.Created != 1 {
+		t.Fatalf("Expected the first delivery ingested, got %+v", result)
+	}
+	result := state.AddWebhook(delivery("http://am-2:9093", "firing", startsAt))
+	alerts := state.GetAlerts()
+	if result.Created != 0 || result.Duplicates != 1 || result.Alerts[0].Outcome != "duplicate" || result.Alerts[0].ID != alerts[0].ID {
+		t.Fatalf("Expected the copy of the other replica reported as a duplicate, got %+v", result)
+	}
+	if len(alerts) != 1 || len(alerts[0].Replicas) != 1 || alerts[0].Replicas[0] != "http://am-2:9093" {
+		t.Fatalf("Expected one alert delivered by both replicas, got %+v", alerts)
+	}
+
+	if result := state.AddWebhook(delivery("http://am-2:9093", "resolved", startsAt)); result.Resolved != 1 {
+		t.Errorf("Expected the first resolution to resolve the alert, got %+v", result)
+	}
+	if result := state.AddWebhook(delivery("http://am-1:9093", "resolved", startsAt)); result.Duplicates != 1 || result.Resolved != 0 {
+		t.Errorf("Expected the second resolution reported as a duplicate, got %+v", result)
+	}
+	if result := state.AddWebhook(delivery("http://am-1:9093", "firing", startsAt.Add(time.Minute))); result.Created != 1 {
+		t.Errorf("Expected the alert firing again ingested, got %+v", result)
+	}
+
+	stats := state.ReplicaStatsList()
+	if len(stats) != 2 || stats[0].Replica != "http://am-1:9093" || stats[0].Deliveries != 3 || stats[0].Duplicates != 1 || stats[1].Duplicates != 1 {
+		t.Errorf("Unexpected replica stats %+v", stats)
+	}
+
+	state.replicas.window = 0
+	state.AddWebhook(delivery("http://am-2:9093", "firing", startsAt.Add(time.Minute)))
+	if firing := len(state.GetAlerts()); firing != 3 {
+		t.Errorf("Expected copies ingested without a window, got %d alerts", firing)
+	}
+}
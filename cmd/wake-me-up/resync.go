@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Updates carry the whole board, but an update can still be missed, e.g.
+// dropped while the hub was busy, leaving a dashboard stale until the next
+// change. So every update carries a checksum of the board, and the checksum
+// is also sent on its own now and then. A client whose board doesn't match
+// asks for a fresh snapshot with a resync message.
+
+// How often the board checksum is sent to the clients
+const stateChecksumInterval = 30 * time.Second
+
+// checksumMessage tells the clients the checksum of the current board
+type checksumMessage struct {
+	Type     string `json:"type"` // checksum
+	Seq      uint64 `json:"seq"`
+	Instance string `json:"instance,omitempty"`
+	Checksum string `json:"checksum"`
+}
+
+// stateChecksum hashes the IDs, statuses and acknowledgements of the board
+// alerts, in ID order, with 32-bit FNV-1a, so browsers can compute it too:
+// one "id:status:acknowledged" line per alert, acknowledged being 0 or 1
+// This should be called while holding the lock
+func (a *AppState) stateChecksum() string {
+	lines := make([]string, len(a.alerts))
+	for i, entry := range a.alerts {
+		acked := 0
+		if a.acknowledged[entry.ID] != nil {
+			acked = 1
+		}
+		lines[i] = fmt.Sprintf("%s:%s:%d\n", entry.ID, entry.Alert.Status, acked)
+	}
+	sort.Strings(lines)
+	hash := fnv.New32a()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+	}
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// runStateChecksums periodically sends the board checksum to the clients
+func (a *AppState) runStateChecksums(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.mu.RLock()
+		message := checksumMessage{Type: "checksum", Seq: a.seq, Instance: clusterInstance, Checksum: a.stateChecksum()}
+		a.mu.RUnlock()
+		data, err := json.Marshal(message)
+		if err != nil {
+			log.Errorf("Error marshaling checksum message: %v", err)
+			continue
+		}
+		select {
+		case a.hub.broadcast <- hubMessage{message: data}:
+		default:
+			// The next one will do
+		}
+	}
+}
+
+// resync sends a client a full snapshot of the board, on its request
+func (c *Client) resync() {
+	snapshot, err := c.state.buildUpdate(0, c.deviceToken)
+	if err != nil {
+		log.Errorf("Error marshaling resync snapshot: %v", err)
+		return
+	}
+	resyncRequests.Inc()
+	log.Debugf("Resyncing WebSocket client %s", c.remoteAddr)
+	c.hub.sendToClient(c, snapshot)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestStateChecksum(t *testing.T) {
+	state := NewAppState(100)
+	state.alerts = []AlertEntry{
+		{ID: "b", Alert: Alert{Status: "firing"}},
+		{ID: "a", Alert: Alert{Status: "resolved"}},
+	}
+	state.acknowledged["b"] = &Acknowledgement{By: "alice"}
+
+	// Same value as boardChecksum in static/app.js for this board
+	if got := state.stateChecksum(); got != "70a366de" {
+		t.Errorf("Expected checksum 70a366de, got %s", got)
+	}
+	delete(state.acknowledged, "b")
+	if got := state.stateChecksum(); got == "70a366de" {
+		t.Error("Expected the checksum to change with the acknowledgement")
+	}
+}
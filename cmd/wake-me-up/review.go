@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const reviewsFile = "reviews.json"
+
+// Review marks an alert as needing follow-up once the fire is out, e.g. a 3am
+// band-aid that needs a proper fix. Reviews keep a copy of the alert, so they
+// stay on the follow-up list after the alert is cleared, until closed.
+type Review struct {
+	ID       string    `json:"id"`
+	AlertID  string    `json:"alertId"`
+	Alert    Alert     `json:"alert"`
+	Receiver string    `json:"receiver,omitempty"`
+	Note     string    `json:"note"`
+	MarkedAt time.Time `json:"markedAt"`
+
+	MarkedText string `json:"markedText,omitempty"` // formatted mark time, only set in responses
+}
+
+// reviewList returns copies of the open reviews by alert ID
+// This should be called while holding the lock
+func (a *AppState) reviewList() map[string]Review {
+	reviews := make(map[string]Review, len(a.reviews))
+	for _, review := range a.reviews {
+		reviews[review.AlertID] = *review
+	}
+	return reviews
+}
+
+// GetReviews returns copies of the open reviews, oldest first
+func (a *AppState) GetReviews() []Review {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	reviews := make([]Review, len(a.reviews))
+	for i, review := range a.reviews {
+		reviews[i] = *review
+		reviews[i].MarkedText = timeFormat.Board(review.MarkedAt)
+	}
+	return reviews
+}
+
+// GetReview returns a copy of the open review of an alert, or nil if none
+func (a *AppState) GetReview(alertID string) *Review {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, review := range a.reviews {
+		if review.AlertID == alertID {
+			copied := *review
+			copied.MarkedText = timeFormat.Board(copied.MarkedAt)
+			return &copied
+		}
+	}
+	return nil
+}
+
+// MarkForReview puts an alert on the follow-up list with a note, or updates
+// the note when it is on the list already
+func (a *AppState) MarkForReview(alertID, note string) (*Review, error) {
+	a.mu.Lock()
+	entry, ok := a.alertByID(alertID)
+	if !ok {
+		a.mu.Unlock()
+		return nil, errors.New("alert not found")
+	}
+
+	var review *Review
+	for _, existing := range a.reviews {
+		if existing.AlertID == alertID {
+			review = existing
+			break
+		}
+	}
+	now := time.Now()
+	if review == nil {
+		review = &Review{ID: "rev-" + idGenerator.NewID(now), AlertID: alertID, MarkedAt: now}
+		a.reviews = append(a.reviews, review)
+	}
+	review.Alert = entry.Alert
+	review.Receiver = entry.Receiver
+	review.Note = note
+	a.seq++
+	marked := *review
+	a.mu.Unlock()
+
+	a.saveReviews()
+	log.Infof("Alert %s marked as needing follow-up (%s)", alertID, marked.ID)
+	a.broadcastUpdate()
+	return &marked, nil
+}
+
+// CloseReview takes a review off the follow-up list
+func (a *AppState) CloseReview(id string) bool {
+	a.mu.Lock()
+	found := false
+	for i, review := range a.reviews {
+		if review.ID == id {
+			a.reviews = append(a.reviews[:i], a.reviews[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found {
+		a.seq++
+	}
+	a.mu.Unlock()
+
+	if !found {
+		return false
+	}
+	a.saveReviews()
+	log.Infof("Follow-up %s closed", id)
+	a.broadcastUpdate()
+	return true
+}
+
+// saveReviews persists the open reviews to the data directory
+func (a *AppState) saveReviews() {
+	path := a.dataFilePath(reviewsFile)
+	if path == "" {
+		return
+	}
+	if err := saveJSON(path, a.GetReviews()); err != nil {
+		log.Errorf("Failed to persist follow-up list: %v", err)
+	}
+}
+
+// LoadReviews restores the follow-up list
+func (a *AppState) LoadReviews() error {
+	path := a.dataFilePath(reviewsFile)
+	if path == "" {
+		return nil
+	}
+
+	var reviews []Review
+	if _, err := loadJSON(path, &reviews); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	for i := range reviews {
+		reviews[i].MarkedText = ""
+		a.reviews = append(a.reviews, &reviews[i])
+	}
+	a.mu.Unlock()
+	if len(reviews) > 0 {
+		log.Infof("Restored %d alerts needing follow-up", len(reviews))
+	}
+	return nil
+}
+
+// reviewRequest is the body accepted when marking an alert
+type reviewRequest struct {
+	AlertID string `json:"alertId"`
+	Note    string `json:"note"`
+}
+
+// reviewsHandler lists (GET), marks (POST) or closes (DELETE ?id=) alerts
+// needing follow-up
+func reviewsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.GetReviews())
+
+		case http.MethodPost:
+			var req reviewRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if req.AlertID == "" {
+				http.Error(w, "Missing 'alertId'", http.StatusBadRequest)
+				return
+			}
+			review, err := state.MarkForReview(req.AlertID, strings.TrimSpace(req.Note))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			audit.RecordRequest(r, AuditReviewChange, 3, "Alert marked as needing follow-up", map[string]string{"alertId": review.AlertID, "reviewId": review.ID})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(review)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "Missing follow-up ID", http.StatusBadRequest)
+				return
+			}
+			if !state.CloseReview(id) {
+				http.Error(w, "Follow-up not found", http.StatusNotFound)
+				return
+			}
+			audit.RecordRequest(r, AuditReviewChange, 3, "Follow-up closed", map[string]string{"reviewId": id})
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// reviewsPageHandler renders the follow-up list
+func reviewsPageHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if err := state.templates.Execute(w, "reviews.html", state.GetReviews()); err != nil {
+			log.Errorf("Error executing template: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
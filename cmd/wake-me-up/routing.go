@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notification routes pick the notifiers of each alert the way Alertmanager
+// routes pick receivers: an alert walks down the tree from the root, which
+// matches everything, into the first child route matching it, and further
+// into the following siblings too while the matching routes have continue
+// set. The deepest routes it reaches notify it; routes without notifiers use
+// their parent's. A route can also be limited to a time of day, and name
+// fallback notifiers tried in order when its own notifiers all fail.
+
+// NotificationRouteConfig is a route of the notification routing tree
+type NotificationRouteConfig struct {
+	Match      map[string]string          `yaml:"match"`       // Labels the alerts must have (optional)
+	MatchRE    map[string]string          `yaml:"match_re"`    // Regular expressions the label values must match in full (optional)
+	ActiveTime *ActiveTimeConfig          `yaml:"active_time"` // Only route alerts at these times of the week (optional, default: always)
+	Notifiers  []string                   `yaml:"notifiers"`   // email, slack, telegram, pushover or webpush (optional, default: the parent's, all for the root)
+	Fallback   []string                   `yaml:"fallback"`    // Notifiers tried in order while the route's notifiers all fail (optional)
+	Continue   bool                       `yaml:"continue"`    // Also try the next sibling routes once this one matched (optional, default: false)
+	Routes     []*NotificationRouteConfig `yaml:"routes"`      // Child routes, tried in order (optional)
+}
+
+// ActiveTimeConfig is a daily time range in the configured time_zone, which
+// may span midnight, on some days of the week
+type ActiveTimeConfig struct {
+	Start string   `yaml:"start" json:"start,omitempty"` // e.g. 08:00 (optional, default: 00:00)
+	End   string   `yaml:"end" json:"end,omitempty"`     // e.g. 20:00, 00:00 being midnight at the end of the day (optional, default: 00:00)
+	Days  []string `yaml:"days" json:"days,omitempty"`   // e.g. [mon, tue, wed, thu, fri] (optional, default: every day)
+}
+
+// notificationRoute is a parsed NotificationRouteConfig
+type notificationRoute struct {
+	matchers  []SilenceMatcher
+	active    *activeTime
+	notifiers []Notifier
+	fallback  []Notifier
+	continues bool
+	routes    []*notificationRoute
+}
+
+// activeTime is a parsed ActiveTimeConfig
+type activeTime struct {
+	start, end time.Duration // since midnight
+	days       map[time.Weekday]bool
+}
+
+// newNotificationRoutes builds the routing tree, nil routing every event to
+// all notifiers
+func newNotificationRoutes(config *NotificationRouteConfig, notifiers []Notifier) (*notificationRoute, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if len(config.Match) > 0 || len(config.MatchRE) > 0 || config.ActiveTime != nil || config.Continue {
+		return nil, errors.New("the root route matches every alert, it takes no match, match_re, active_time or continue")
+	}
+	byName := make(map[string]Notifier, len(notifiers))
+	for _, notifier := range notifiers {
+		byName[notifier.Name()] = notifier
+	}
+	return parseNotificationRoute(config, notifiers, byName, "notification_routes")
+}
+
+func parseNotificationRoute(config *NotificationRouteConfig, inherited []Notifier, byName map[string]Notifier, path string) (*notificationRoute, error) {
+	route := &notificationRoute{notifiers: inherited, continues: config.Continue}
+	for name, value := range config.Match {
+		route.matchers = append(route.matchers, SilenceMatcher{Name: name, Value: value})
+	}
+	for name, value := range config.MatchRE {
+		route.matchers = append(route.matchers, SilenceMatcher{Name: name, Value: value, IsRegex: true})
+	}
+	for i := range route.matchers {
+		if err := route.matchers[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	lookup := func(names []string, field string) ([]Notifier, error) {
+		var found []Notifier
+		for _, name := range names {
+			notifier, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: notifier %q is not configured", path, field, name)
+			}
+			found = append(found, notifier)
+		}
+		return found, nil
+	}
+	var err error
+	if len(config.Notifiers) > 0 {
+		if route.notifiers, err = lookup(config.Notifiers, "notifiers"); err != nil {
+			return nil, err
+		}
+	}
+	if route.fallback, err = lookup(config.Fallback, "fallback"); err != nil {
+		return nil, err
+	}
+	if config.ActiveTime != nil {
+		if route.active, err = parseActiveTime(config.ActiveTime); err != nil {
+			return nil, fmt.Errorf("%s.active_time: %v", path, err)
+		}
+	}
+
+	for i, child := range config.Routes {
+		parsed, err := parseNotificationRoute(child, route.notifiers, byName, fmt.Sprintf("%s.routes[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		route.routes = append(route.routes, parsed)
+	}
+	return route, nil
+}
+
+// weekdays are the day names accepted in active_time.days
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseActiveTime(config *ActiveTimeConfig) (*activeTime, error) {
+	active := &activeTime{}
+	var err error
+	if config.Start != "" {
+		if active.start, err = parseTimeOfDay(config.Start); err != nil {
+			return nil, fmt.Errorf("start: %v", err)
+		}
+	}
+	if config.End != "" {
+		if active.end, err = parseTimeOfDay(config.End); err != nil {
+			return nil, fmt.Errorf("end: %v", err)
+		}
+	}
+	for _, day := range config.Days {
+		name := strings.ToLower(strings.TrimSpace(day))
+		weekday, ok := weekdays[name]
+		if !ok && len(name) > 3 {
+			weekday, ok = weekdays[name[:3]]
+			ok = ok && strings.EqualFold(weekday.String(), name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("days: unknown day %q, expected e.g. mon or monday", day)
+		}
+		if active.days == nil {
+			active.days = make(map[time.Weekday]bool)
+		}
+		active.days[weekday] = true
+	}
+	return active, nil
+}
+
+// contains tells if a time falls in the active time. A range spanning midnight
+// belongs to the day it starts on.
+func (t *activeTime) contains(now time.Time) bool {
+	local := now.In(timeFormat.location)
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	day := local.Weekday()
+	switch {
+	case t.start < t.end:
+		if sinceMidnight < t.start || sinceMidnight >= t.end {
+			return false
+		}
+	case t.start > t.end:
+		if sinceMidnight < t.end {
+			day = (day + 6) % 7
+		} else if sinceMidnight < t.start {
+			return false
+		}
+	}
+	return t.days == nil || t.days[day]
+}
+
+// matches checks an alert's labels and the time against the route
+func (r *notificationRoute) matches(labels map[string]string, now time.Time) bool {
+	for i := range r.matchers {
+		if !r.matchers[i].matches(labels) {
+			return false
+		}
+	}
+	return r.active == nil || r.active.contains(now)
+}
+
+// match returns the routes notifying an alert, the route itself if none of
+// its children match
+func (r *notificationRoute) match(labels map[string]string, now time.Time) []*notificationRoute {
+	var matched []*notificationRoute
+	for _, child := range r.routes {
+		if !child.matches(labels, now) {
+			continue
+		}
+		matched = append(matched, child.match(labels, now)...)
+		if !child.continues {
+			break
+		}
+	}
+	if len(matched) == 0 {
+		return []*notificationRoute{r}
+	}
+	return matched
+}
+
+// routeEvent sends an event along the routing tree. Each route gets the
+// alerts it matched in one event, and a notifier sends an alert only once
+// per event even when several routes lead to it. The all clear carries no
+// alerts and takes the routes matching no labels.
+func routeEvent(root *notificationRoute, event NotificationEvent) {
+	var routes []*notificationRoute
+	alerts := make(map[*notificationRoute][]AlertEntry)
+	add := func(matched []*notificationRoute, entry *AlertEntry) {
+		for _, route := range matched {
+			if _, ok := alerts[route]; !ok {
+				routes = append(routes, route)
+			}
+			if entry != nil {
+				alerts[route] = append(alerts[route], *entry)
+			} else {
+				alerts[route] = nil
+			}
+		}
+	}
+	if event.Kind == EventAllClear {
+		add(root.match(nil, event.Time), nil)
+	}
+	for i := range event.Alerts {
+		add(root.match(event.Alerts[i].Alert.Labels, event.Time), &event.Alerts[i])
+	}
+
+	sent := make(map[Notifier]map[string]bool)
+	notify := func(notifier Notifier, routed NotificationEvent) (bool, bool) {
+		if !wants(notifier, routed.Kind) {
+			return false, false
+		}
+		var pending []AlertEntry
+		for _, entry := range routed.Alerts {
+			if !sent[notifier][entry.ID] {
+				pending = append(pending, entry)
+			}
+		}
+		if len(pending) == 0 && (routed.Kind != EventAllClear || sent[notifier] != nil) {
+			return true, true
+		}
+		routed.Alerts = pending
+		if err := notifier.Notify(routed); err != nil {
+			log.Errorf("Failed to send %s notification via %s: %v", routed.Kind, notifier.Name(), err)
+			return true, false
+		}
+		if sent[notifier] == nil {
+			sent[notifier] = make(map[string]bool)
+		}
+		for _, entry := range pending {
+			sent[notifier][entry.ID] = true
+		}
+		return true, true
+	}
+
+	for _, route := range routes {
+		routed := event
+		routed.Alerts = alerts[route]
+		tried, delivered := false, false
+		for _, notifier := range route.notifiers {
+			wanted, ok := notify(notifier, routed)
+			tried = tried || wanted
+			delivered = delivered || ok
+		}
+		if !tried || delivered {
+			continue
+		}
+		for _, notifier := range route.fallback {
+			if slices.Contains(route.notifiers, notifier) {
+				continue
+			}
+			if _, ok := notify(notifier, routed); ok {
+				log.Infof("Sent %s notification via fallback %s", routed.Kind, notifier.Name())
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the alerts it was sent, failing if told to
+type recordingNotifier struct {
+	name string
+	fail bool
+	sent []string
+}
+
+func (n *recordingNotifier) Name() string {
+	return n.name
+}
+
+func (n *recordingNotifier) Notify(event NotificationEvent) error {
+	if n.fail {
+		return errors.New("unavailable")
+	}
+	for _, entry := range event.Alerts {
+		n.sent = append(n.sent, entry.ID)
+	}
+	if event.Kind == EventAllClear {
+		n.sent = append(n.sent, EventAllClear)
+	}
+	return nil
+}
+
+func TestNotificationRoutes(t *testing.T) {
+	slack := &recordingNotifier{name: "slack"}
+	pushover := &recordingNotifier{name: "pushover", fail: true}
+	email := &recordingNotifier{name: "email"}
+	config := &NotificationRouteConfig{
+		Notifiers: []string{"slack"},
+		Routes: []*NotificationRouteConfig{
+			{Match: map[string]string{"team": "db"}, Continue: true, Routes: []*NotificationRouteConfig{
+				{Match: map[string]string{"severity": "critical"}, Notifiers: []string{"pushover"}, Fallback: []string{"email"}},
+			}},
+			{MatchRE: map[string]string{"team": "db|web"}, Notifiers: []string{"email"}},
+			{Match: map[string]string{"team": "web"}, Notifiers: []string{"pushover"}},
+			{Notifiers: []string{"email"}, ActiveTime: &ActiveTimeConfig{Start: "08:00", End: "20:00", Days: []string{"monday", "tue"}}},
+		},
+	}
+	root, err := newNotificationRoutes(config, []Notifier{slack, pushover, email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := func(id string, labels map[string]string) AlertEntry {
+		return AlertEntry{ID: id, Alert: Alert{Status: "firing", Labels: labels}}
+	}
+	monday := time.Date(2026, 10, 12, 9, 0, 0, 0, timeFormat.location)
+	routeEvent(root, NotificationEvent{Kind: EventFiring, Time: monday, Alerts: []AlertEntry{
+		alert("db-critical", map[string]string{"team": "db", "severity": "critical"}),
+		alert("db-warning", map[string]string{"team": "db", "severity": "warning"}),
+		alert("web", map[string]string{"team": "web"}),
+		alert("other", map[string]string{"team": "ops"}),
+	}})
+	// db-critical fails over from pushover to email, and is not emailed again
+	// through the route after the continued one
+	if want := []string{"db-critical", "db-warning", "web", "other"}; !slices.Equal(email.sent, want) {
+		t.Errorf("Expected email to get %v, got %v", want, email.sent)
+	}
+	// Only db-warning stops at the db route, web stops at the first route
+	// matching it
+	if want := []string{"db-warning"}; !slices.Equal(slack.sent, want) || len(pushover.sent) != 0 {
+		t.Errorf("Expected slack to get %v, got %v", want, slack.sent)
+	}
+
+	email.sent, slack.sent = nil, nil
+	sunday := monday.AddDate(0, 0, -1)
+	routeEvent(root, NotificationEvent{Kind: EventFiring, Time: sunday, Alerts: []AlertEntry{alert("other", map[string]string{"team": "ops"})}})
+	routeEvent(root, NotificationEvent{Kind: EventAllClear, Time: sunday})
+	if want := []string{"other", EventAllClear}; !slices.Equal(slack.sent, want) || len(email.sent) != 0 {
+		t.Errorf("Expected the root route outside the active time, got slack %v and email %v", slack.sent, email.sent)
+	}
+
+	for _, invalid := range []*NotificationRouteConfig{
+		{Notifiers: []string{"telegram"}},
+		{Routes: []*NotificationRouteConfig{{MatchRE: map[string]string{"team": "("}}}},
+		{Routes: []*NotificationRouteConfig{{ActiveTime: &ActiveTimeConfig{Days: []string{"someday"}}}}},
+		{Match: map[string]string{"team": "db"}},
+	} {
+		if _, err := newNotificationRoutes(invalid, []Notifier{slack}); err == nil {
+			t.Errorf("Expected %+v rejected", invalid)
+		}
+	}
+}
+
+func TestActiveTimeSpanningMidnight(t *testing.T) {
+	active, err := parseActiveTime(&ActiveTimeConfig{Start: "22:00", End: "06:00", Days: []string{"fri"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	friday := time.Date(2026, 10, 16, 0, 0, 0, 0, timeFormat.location)
+	for hour, want := range map[int]bool{23: true, 24 + 5: true, 24 + 23: false, 12: false, 5: false} {
+		if got := active.contains(friday.Add(time.Duration(hour) * time.Hour)); got != want {
+			t.Errorf("Expected %v %d hours into friday, got %v", want, hour, got)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultRulesInterval = 5 * time.Minute
+
+// AlertRulesConfig imports the alerting rules of Prometheus, so the detail of
+// a firing alert shows the expression that triggered it
+type AlertRulesConfig struct {
+	URL      string        `yaml:"url"`      // Prometheus base URL, e.g. http://prometheus:9090, read through /api/v1/rules (optional)
+	Username string        `yaml:"username"` // Basic auth (optional)
+	Password string        `yaml:"password"`
+	Files    []string      `yaml:"files"`    // Prometheus rule files, globs allowed, e.g. /etc/prometheus/rules/*.yml (optional)
+	Interval time.Duration `yaml:"interval"` // How often the rules are reloaded (optional, default: 5m)
+}
+
+// AlertRule is the definition of the alerting rule an alert came from
+type AlertRule struct {
+	Name        string            `json:"name"`
+	Group       string            `json:"group"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"` // how long the expression held before firing
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ruleFile is a Prometheus rule file, recording rules have no alert name
+type ruleFile struct {
+	Groups []struct {
+		Name  string `yaml:"name"`
+		Rules []struct {
+			Alert       string            `yaml:"alert"`
+			Expr        string            `yaml:"expr"`
+			For         string            `yaml:"for"`
+			Labels      map[string]string `yaml:"labels"`
+			Annotations map[string]string `yaml:"annotations"`
+		} `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+// rulesResponse is the response of the Prometheus rules API
+type rulesResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Groups []struct {
+			Name  string `json:"name"`
+			Rules []struct {
+				Type        string            `json:"type"`
+				Name        string            `json:"name"`
+				Query       string            `json:"query"`
+				Duration    float64           `json:"duration"` // seconds
+				Labels      map[string]string `json:"labels"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"rules"`
+		} `json:"groups"`
+	} `json:"data"`
+}
+
+// alertRuleCatalog holds the imported rules by alert name
+type alertRuleCatalog struct {
+	config   *AlertRulesConfig
+	endpoint string
+	client   *http.Client
+
+	mu     sync.RWMutex
+	byName map[string][]AlertRule
+}
+
+// alertRules are the imported rules, nil if not configured
+var alertRules *alertRuleCatalog
+
+func newAlertRuleCatalog(config *AlertRulesConfig) (*alertRuleCatalog, error) {
+	if config.URL == "" && len(config.Files) == 0 {
+		return nil, fmt.Errorf("needs 'url' or 'files'")
+	}
+	if config.Interval < 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", config.Interval)
+	}
+	catalog := &alertRuleCatalog{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		byName: make(map[string][]AlertRule),
+	}
+	if config.URL != "" {
+		base, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+			return nil, fmt.Errorf("url must be an http(s) URL, got %q", config.URL)
+		}
+		base.Path += "/api/v1/rules"
+		base.RawQuery = url.Values{"type": {"alert"}}.Encode()
+		catalog.endpoint = base.String()
+	}
+	return catalog, nil
+}
+
+// fetch reads the alerting rules from the Prometheus API
+func (c *alertRuleCatalog) fetch() ([]AlertRule, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("prometheus returned %s", resp.Status)
+	}
+	var response rulesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid rules: %v", err)
+	}
+	var rules []AlertRule
+	for _, group := range response.Data.Groups {
+		for _, rule := range group.Rules {
+			if rule.Type != "alerting" {
+				continue
+			}
+			imported := AlertRule{
+				Name:        rule.Name,
+				Group:       group.Name,
+				Expr:        rule.Query,
+				Labels:      rule.Labels,
+				Annotations: rule.Annotations,
+			}
+			if rule.Duration > 0 {
+				imported.For = shortDuration(time.Duration(rule.Duration * float64(time.Second)))
+			}
+			rules = append(rules, imported)
+		}
+	}
+	return rules, nil
+}
+
+// readFiles reads the alerting rules of the rule files
+func (c *alertRuleCatalog) readFiles() ([]AlertRule, error) {
+	var rules []AlertRule
+	for _, pattern := range c.config.Files {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			var file ruleFile
+			if err := yaml.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			for _, group := range file.Groups {
+				for _, rule := range group.Rules {
+					if rule.Alert == "" {
+						continue
+					}
+					rules = append(rules, AlertRule{
+						Name:        rule.Alert,
+						Group:       group.Name,
+						Expr:        strings.TrimSpace(rule.Expr),
+						For:         rule.For,
+						Labels:      rule.Labels,
+						Annotations: rule.Annotations,
+					})
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// reload replaces the rules, keeping the previous ones if a source fails
+func (c *alertRuleCatalog) reload() error {
+	rules, err := c.readFiles()
+	if err != nil {
+		return err
+	}
+	if c.endpoint != "" {
+		fetched, err := c.fetch()
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fetched...)
+	}
+	byName := make(map[string][]AlertRule)
+	for _, rule := range rules {
+		byName[rule.Name] = append(byName[rule.Name], rule)
+	}
+	c.mu.Lock()
+	c.byName = byName
+	c.mu.Unlock()
+	return nil
+}
+
+// lookup returns the rule an alert most likely came from: of the rules with
+// its alert name, the one with the most labels set on the alert. Templated
+// rule labels can't be told apart and don't count.
+func (c *alertRuleCatalog) lookup(alert Alert) *AlertRule {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var best *AlertRule
+	bestMatched := -1
+	for i, rule := range c.byName[alert.Labels["alertname"]] {
+		matched := 0
+		for name, value := range rule.Labels {
+			if strings.Contains(value, "{{") {
+				continue
+			}
+			if alert.Labels[name] != value {
+				matched = -1
+				break
+			}
+			matched++
+		}
+		if matched > bestMatched {
+			best, bestMatched = &c.byName[alert.Labels["alertname"]][i], matched
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	rule := *best
+	return &rule
+}
+
+// runAlertRules reloads the rules at the configured interval
+func runAlertRules(catalog *alertRuleCatalog) {
+	interval := catalog.config.Interval
+	if interval == 0 {
+		interval = defaultRulesInterval
+	}
+	for {
+		time.Sleep(interval)
+		if err := catalog.reload(); err != nil {
+			log.Errorf("Failed to reload alert rules: %v", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAlertRules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/rules" || r.URL.Query().Get("type") != "alert" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"groups":[{"name":"node","rules":[
+			{"type":"alerting","name":"Disk","query":"node_filesystem_avail_bytes < 1e9","duration":300,"labels":{"severity":"critical"}},
+			{"type":"recording","name":"node:load","query":"avg(node_load1)"}
+		]}]}}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	file := `groups:
+- name: node
+  rules:
+  - record: node:cpu
+    expr: avg(rate(node_cpu_seconds_total[5m]))
+  - alert: Disk
+    expr: |
+      node_filesystem_avail_bytes < 5e9
+    for: 15m
+    labels: {severity: warning}
+  - alert: Down
+    expr: up == 0
+    labels: {severity: "{{ $labels.tier }}"}
+`
+	if err := os.WriteFile(filepath.Join(dir, "node.yml"), []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := newAlertRuleCatalog(&AlertRulesConfig{URL: server.URL, Files: []string{filepath.Join(dir, "*.yml")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		labels map[string]string
+		expr   string
+		period string
+	}{
+		{map[string]string{"alertname": "Disk", "severity": "critical"}, "node_filesystem_avail_bytes < 1e9", "5m"},
+		{map[string]string{"alertname": "Disk", "severity": "warning"}, "node_filesystem_avail_bytes < 5e9", "15m"},
+		{map[string]string{"alertname": "Down", "severity": "page"}, "up == 0", ""},
+		{map[string]string{"alertname": "Disk", "severity": "info"}, "", ""},
+		{map[string]string{"alertname": "Unknown"}, "", ""},
+	} {
+		rule := catalog.lookup(Alert{Labels: tc.labels})
+		if tc.expr == "" {
+			if rule != nil {
+				t.Errorf("Expected no rule for %v, got %+v", tc.labels, rule)
+			}
+			continue
+		}
+		if rule == nil || rule.Expr != tc.expr || rule.For != tc.period || rule.Group != "node" {
+			t.Errorf("Expected %q for %s for %v, got %+v", tc.expr, tc.period, tc.labels, rule)
+		}
+	}
+
+	// Firing alerts keep the rule they fired with
+	alertRules = catalog
+	defer func() { alertRules = nil }()
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Down", "severity": "page"}},
+	}})
+	if alerts := state.GetAlerts(); alerts[0].Rule == nil || alerts[0].Rule.Expr != "up == 0" {
+		t.Errorf("Expected the rule attached to the alert, got %+v", alerts[0].Rule)
+	}
+}
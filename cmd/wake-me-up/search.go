@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const defaultSearchLimit = 50
+
+// Weights of the fields a query token can match, the best match counts
+const (
+	searchWeightAlertName  = 4
+	searchWeightLabelValue = 2
+	searchWeightNote       = 2
+	searchWeightSummary    = 2
+	searchWeightAnnotation = 1
+	searchWeightLabelName  = 1
+	searchExactBonus       = 1 // a whole word rather than a prefix
+)
+
+// searchField is a piece of text of an alert that queries match against
+type searchField struct {
+	Name   string // labels.<name>, labels, annotations.<name> or note
+	Value  string
+	weight int
+}
+
+// searchIndex is an inverted index of the board alerts, updated as alerts
+// arrive and leave so queries don't scan every label of every alert
+type searchIndex struct {
+	postings map[string]map[string]bool // token -> alert IDs
+	fields   map[string][]searchField   // alert ID -> indexed fields
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{postings: make(map[string]map[string]bool), fields: make(map[string][]searchField)}
+}
+
+// searchTokens splits text into lowercase words, so "db-01:9100" is found
+// by "db", "01" or "9100"
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// add indexes an alert, replacing what was indexed for it before
+func (s *searchIndex) add(alertID string, fields []searchField) {
+	s.remove(alertID)
+	s.fields[alertID] = fields
+	for _, field := range fields {
+		for _, token := range searchTokens(field.Value) {
+			ids, ok := s.postings[token]
+			if !ok {
+				ids = make(map[string]bool)
+				s.postings[token] = ids
+			}
+			ids[alertID] = true
+		}
+	}
+}
+
+// remove drops an alert from the index
+func (s *searchIndex) remove(alertID string) {
+	for _, field := range s.fields[alertID] {
+		for _, token := range searchTokens(field.Value) {
+			delete(s.postings[token], alertID)
+			if len(s.postings[token]) == 0 {
+				delete(s.postings, token)
+			}
+		}
+	}
+	delete(s.fields, alertID)
+}
+
+// SearchMatch is a field that matched a query, with the matched ranges of
+// its value as [start, end) offsets in UTF-16 code units, as JavaScript
+// strings index them
+type SearchMatch struct {
+	Field  string   `json:"field"`
+	Value  string   `json:"value"`
+	Ranges [][2]int `json:"ranges"`
+}
+
+// SearchResult is an alert matching a query
+type SearchResult struct {
+	ID      string        `json:"id"`
+	Score   int           `json:"score"`
+	Entry   AlertEntry    `json:"entry"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// query returns the IDs and scores of the alerts matching every query
+// token, as a whole word or a prefix
+func (s *searchIndex) query(tokens []string) map[string]int {
+	var scores map[string]int
+	for _, token := range tokens {
+		// Collect the alerts with a word starting with the token
+		matching := make(map[string]bool)
+		for word, ids := range s.postings {
+			if strings.HasPrefix(word, token) {
+				for id := range ids {
+					matching[id] = true
+				}
+			}
+		}
+
+		next := make(map[string]int)
+		for id := range matching {
+			if scores != nil {
+				if _, ok := scores[id]; !ok {
+					continue
+				}
+			}
+			next[id] = scores[id] + s.tokenScore(id, token)
+		}
+		scores = next
+		if len(scores) == 0 {
+			break
+		}
+	}
+	return scores
+}
+
+// tokenScore is the weight of the best field of an alert matching a token
+func (s *searchIndex) tokenScore(alertID, token string) int {
+	best := 0
+	for _, field := range s.fields[alertID] {
+		for _, word := range searchTokens(field.Value) {
+			if !strings.HasPrefix(word, token) {
+				continue
+			}
+			score := field.weight
+			if word == token {
+				score += searchExactBonus
+			}
+			best = max(best, score)
+		}
+	}
+	return best
+}
+
+// highlights returns the fields of an alert matching any of the tokens
+func (s *searchIndex) highlights(alertID string, tokens []string) []SearchMatch {
+	var matches []SearchMatch
+	for _, field := range s.fields[alertID] {
+		if ranges := matchRanges(field.Value, tokens); len(ranges) > 0 {
+			matches = append(matches, SearchMatch{Field: field.Name, Value: field.Value, Ranges: ranges})
+		}
+	}
+	return matches
+}
+
+// matchRanges finds the words of a text starting with one of the tokens and
+// returns the matched prefixes
+func matchRanges(text string, tokens []string) [][2]int {
+	var ranges [][2]int
+	start := -1
+	flush := func(end int) {
+		word := strings.ToLower(text[start:end])
+		longest := 0
+		for _, token := range tokens {
+			if strings.HasPrefix(word, token) && len(token) > longest {
+				longest = len(token)
+			}
+		}
+		if longest > 0 {
+			ranges = append(ranges, [2]int{utf16Len(text[:start]), utf16Len(text[:start+longest])})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			flush(i)
+		}
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return ranges
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// searchFields returns the text of an alert to index
+// This should be called while holding the lock
+func (a *AppState) searchFields(entry AlertEntry) []searchField {
+	names := make([]string, 0, len(entry.Alert.Labels))
+	for name := range entry.Alert.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := []searchField{{Name: "labels", Value: strings.Join(names, " "), weight: searchWeightLabelName}}
+	for _, name := range names {
+		weight := searchWeightLabelValue
+		if name == "alertname" {
+			weight = searchWeightAlertName
+		}
+		fields = append(fields, searchField{Name: "labels." + name, Value: entry.Alert.Labels[name], weight: weight})
+	}
+
+	annotationNames := make([]string, 0, len(entry.Alert.Annotations))
+	for name := range entry.Alert.Annotations {
+		// Links only add noise like "https" to the index
+		if !strings.HasSuffix(name, "_url") {
+			annotationNames = append(annotationNames, name)
+		}
+	}
+	sort.Strings(annotationNames)
+	for _, name := range annotationNames {
+		weight := searchWeightAnnotation
+		if name == "summary" {
+			weight = searchWeightSummary
+		}
+		fields = append(fields, searchField{Name: "annotations." + name, Value: entry.Alert.Annotations[name], weight: weight})
+	}
+	if followUp, ok := a.followUps[entry.ID]; ok && followUp.Note != "" {
+		fields = append(fields, searchField{Name: "note", Value: followUp.Note, weight: searchWeightNote})
+	}
+	return fields
+}
+
+// indexAlert (re)indexes a board alert, or drops it from the index if it
+// left the board
+// This should be called while holding the lock
+func (a *AppState) indexAlert(alertID string) {
+	if entry, ok := a.alertByID(alertID); ok {
+		a.search.add(alertID, a.searchFields(entry))
+	} else {
+		a.search.remove(alertID)
+	}
+}
+
+// Search returns the board alerts matching every word of the query, best
+// matches first
+func (a *AppState) Search(query string, limit int) []SearchResult {
+	tokens := searchTokens(query)
+	results := make([]SearchResult, 0)
+	if len(tokens) == 0 {
+		return results
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for id, score := range a.search.query(tokens) {
+		entry, ok := a.alertByID(id)
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{ID: id, Score: score, Entry: entry, Matches: a.search.highlights(id, tokens)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Entry.Timestamp.After(results[j].Entry.Timestamp)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchHandler searches the labels, annotations and notes of the board alerts, e.g.
+// GET /api/v1/search?q=disk db-01
+func searchHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query().Get("q")
+		limit := defaultSearchLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid 'limit' parameter", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		response := map[string]interface{}{"query": query, "results": state.Search(query, limit)}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Errorf("Error encoding search results: %v", err)
+		}
+	}
+}
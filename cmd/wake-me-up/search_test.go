@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchRanksAndHighlights(t *testing.T) {
+	state := NewAppState(10)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "DiskFull", "instance": "db-01:9100"}, StartsAt: time.Now()},
+		{Status: "firing", Labels: map[string]string{"alertname": "HighLatency", "instance": "db-01:9100", "device": "disk0"}, StartsAt: time.Now()},
+		{Status: "firing", Labels: map[string]string{"alertname": "DiskFull", "instance": "db-02:9100"}, StartsAt: time.Now(),
+			Annotations: map[string]string{"summary": "Volume at 97%", "runbook_url": "https://wiki/disk"}},
+	}})
+
+	// Annotations are searchable, apart from links
+	if results := state.Search("volume", 10); len(results) != 1 || results[0].Matches[0].Field != "annotations.summary" {
+		t.Fatalf("Expected the alert with the summary, got %+v", results)
+	}
+	if results := state.Search("wiki", 10); len(results) != 0 {
+		t.Fatalf("Expected links not to be indexed, got %+v", results)
+	}
+
+	results := state.Search("disk db-01", 10)
+	if len(results) != 2 {
+		t.Fatalf("Expected the two db-01 alerts, got %+v", results)
+	}
+	// A match in the alert name outranks one in another label
+	if results[0].Entry.Alert.Labels["alertname"] != "DiskFull" || results[0].Score <= results[1].Score {
+		t.Fatalf("Expected DiskFull first, got %+v", results)
+	}
+	for _, match := range results[0].Matches {
+		if match.Field == "labels.instance" {
+			if len(match.Ranges) != 2 || match.Ranges[0] != [2]int{0, 2} || match.Ranges[1] != [2]int{3, 5} {
+				t.Fatalf("Unexpected highlight of %q: %v", match.Value, match.Ranges)
+			}
+		}
+	}
+
+	// Notes are searchable, and cleared alerts leave the index
+	id := results[1].ID
+	state.mu.Lock()
+	state.setFollowUp(&FollowUp{AlertID: id, Note: "check the replica lag", DueAt: time.Now().Add(time.Hour)})
+	state.mu.Unlock()
+	if results := state.Search("replica", 10); len(results) != 1 || results[0].ID != id {
+		t.Fatalf("Expected the alert with the note, got %+v", results)
+	}
+	state.Acknowledge(id, "")
+	if _, err := state.ClearAcknowledgedAndResolved(nil); err != nil {
+		t.Fatal(err)
+	}
+	if results := state.Search("replica", 10); len(results) != 0 {
+		t.Fatalf("Expected no results after clearing, got %+v", results)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SeverityConfig is how alerts with a severity label value sound and look.
+// Whether they sound at all is up to sound_policy.severities.
+type SeverityConfig struct {
+	SoundFilePath string `yaml:"sound_file_path"` // Played while the most severe sounding alert has this severity (optional, default: sound_effect_file_path)
+	Color         string `yaml:"color"`           // Color of the severity badge on alert cards, a #hex or named CSS color (optional)
+}
+
+// severityStyles are the severities configured at startup, by lowercase value
+var severityStyles map[string]SeverityConfig
+
+// setSeverities checks and applies the severities config, after the sound
+// paths were resolved
+func setSeverities(configs map[string]*SeverityConfig) error {
+	styles := make(map[string]SeverityConfig, len(configs))
+	for severity, config := range configs {
+		if config == nil {
+			continue
+		}
+		if config.Color != "" && !themeColorPattern.MatchString(config.Color) {
+			return fmt.Errorf("severities.%s: invalid color %q", severity, config.Color)
+		}
+		styles[strings.ToLower(strings.TrimSpace(severity))] = *config
+	}
+	severityStyles = styles
+	return nil
+}
+
+// severitySound returns the sound file of a severity, empty for the default
+func severitySound(severity string) string {
+	return severityStyles[severity].SoundFilePath
+}
+
+// severityColor returns the badge color of a severity, empty for the default
+func severityColor(severity string) string {
+	return severityStyles[severity].Color
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How long requests in flight may take to finish on shutdown, unless configured
+const defaultShutdownTimeout = 10 * time.Second
+
+// waitForShutdownSignal blocks until the process is asked to stop
+func waitForShutdownSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	received := <-signals
+	signal.Stop(signals)
+	log.Infof("Received %s, shutting down", received)
+}
+
+// Shutdown stops the servers, letting webhooks in flight finish, closes the
+// WebSocket connections with a close message and writes what is still
+// pending to disk, all within the timeout
+func (a *AppState) Shutdown(timeout time.Duration, servers ...*http.Server) {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			log.Errorf("Failed to drain requests on %s: %v", server.Addr, err)
+		}
+	}
+	// Deliveries held back by ingest_throttle are saved with the board
+	a.flushAllThrottled()
+	// WebSocket connections are hijacked, so the servers don't wait for them
+	a.hub.closeClients()
+
+	if a.persister != nil {
+		a.mu.RLock()
+		board := a.storedBoard()
+		a.mu.RUnlock()
+		a.persister.Sync(ctx, board)
+	}
+	a.history.Sync(ctx)
+	a.timeline.record(BoardOffline, time.Now())
+	log.Infof("Server stopped")
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Silences work like Alertmanager's: until a silence ends, new firing alerts
+// matching it are acknowledged on arrival, so they stay listed on the board as
+// silenced but neither sound the alarm nor notify anyone. When the silence
+// ends, the alerts it silenced that are still firing need acknowledging again.
+
+const silencesFile = "silences.json"
+
+// SilenceMatcher matches a label of an alert, a missing label being empty
+type SilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex,omitempty"` // Value is a regular expression matching the whole label value
+	IsEqual *bool  `json:"isEqual,omitempty"` // false negates the matcher (optional, default: true)
+
+	re *regexp.Regexp
+}
+
+// compile checks the matcher and prepares its regular expression
+func (m *SilenceMatcher) compile() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return errors.New("matcher without a 'name'")
+	}
+	if !m.IsRegex {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + m.Value + ")$")
+	if err != nil {
+		return fmt.Errorf("matcher %s: %v", m.Name, err)
+	}
+	m.re = re
+	return nil
+}
+
+// matches checks a label set against the matcher
+func (m *SilenceMatcher) matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	matched := value == m.Value
+	if m.re != nil {
+		matched = m.re.MatchString(value)
+	}
+	if m.IsEqual != nil && !*m.IsEqual {
+		return !matched
+	}
+	return matched
+}
+
+// String formats the matcher the way Alertmanager does, e.g. env=~"prod.*"
+func (m *SilenceMatcher) String() string {
+	negated := m.IsEqual != nil && !*m.IsEqual
+	op := "="
+	switch {
+	case m.IsRegex && negated:
+		op = "!~"
+	case m.IsRegex:
+		op = "=~"
+	case negated:
+		op = "!="
+	}
+	return fmt.Sprintf("%s%s%q", m.Name, op, m.Value)
+}
+
+// Silence mutes the alerts matching all of its matchers until it ends
+type Silence struct {
+	ID        string           `json:"id"`
+	Matchers  []SilenceMatcher `json:"matchers"`
+	StartsAt  time.Time        `json:"startsAt"`
+	EndsAt    time.Time        `json:"endsAt"`
+	CreatedBy string           `json:"createdBy,omitempty"`
+	Comment   string           `json:"comment,omitempty"`
+
+	timer *time.Timer
+}
+
+// compile checks the matchers of the silence. A silence matching an alert
+// without labels would silence everything, so it is refused.
+func (s *Silence) compile() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("a silence needs at least one matcher")
+	}
+	for i := range s.Matchers {
+		if err := s.Matchers[i].compile(); err != nil {
+			return err
+		}
+	}
+	if s.matches(Alert{}) {
+		return errors.New("the matchers would silence every alert")
+	}
+	return nil
+}
+
+// matches checks if an alert matches all the matchers of the silence
+func (s *Silence) matches(alert Alert) bool {
+	for i := range s.Matchers {
+		if !s.Matchers[i].matches(alert.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the matchers of the silence, e.g. {alertname="Disk",env=~"prod.*"}
+func (s *Silence) String() string {
+	matchers := make([]string, len(s.Matchers))
+	for i := range s.Matchers {
+		matchers[i] = s.Matchers[i].String()
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// silenceAcknowledgement is the acknowledgement of an alert the silence mutes
+func (s *Silence) silenceAcknowledgement(now time.Time) *Acknowledgement {
+	return &Acknowledgement{By: s.CreatedBy, At: now, Comment: s.Comment, Silence: s.ID}
+}
+
+// silenceFor returns the silence an alert matches, or nil
+// This should be called while holding the lock
+func (a *AppState) silenceFor(alert Alert) *Silence {
+	for _, silence := range a.silences {
+		if silence.matches(alert) {
+			return silence
+		}
+	}
+	return nil
+}
+
+// silenceNew acknowledges the new firing alerts matching a silence, unless
+// they joined an incident already. It returns the IDs of the silenced alerts.
+// This should be called while holding the lock
+func (a *AppState) silenceNew(entries []AlertEntry, now time.Time) map[string]bool {
+	silenced := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Alert.Status != "firing" || a.acknowledged[entry.ID] != nil {
+			continue
+		}
+		silence := a.silenceFor(entry.Alert)
+		if silence == nil {
+			continue
+		}
+		a.acknowledged[entry.ID] = silence.silenceAcknowledgement(now)
+		a.suppressed.record(SuppressionSilence, silence.String(), entry.Alert)
+		silenced[entry.ID] = true
+		log.Debugf("Alert %s silenced by %s", entry.ID, silence.ID)
+	}
+	return silenced
+}
+
+// AddSilence starts a silence, which also silences the unacknowledged firing
+// alerts on the board that match it
+func (a *AppState) AddSilence(silence *Silence) Silence {
+	a.mu.Lock()
+	now := time.Now()
+	silence.ID = "sil-" + idGenerator.NewID(now)
+	silence.StartsAt = now
+	a.setSilence(silence)
+	for _, entry := range a.alerts {
+		if entry.Alert.Status == "firing" && a.acknowledged[entry.ID] == nil && silence.matches(entry.Alert) {
+			a.recordAck(entry, now, actorAutomatic)
+			a.acknowledged[entry.ID] = silence.silenceAcknowledgement(now)
+			a.suppressed.record(SuppressionSilence, silence.String(), entry.Alert)
+		}
+	}
+	a.seq++
+	added := *silence
+	added.timer = nil
+	a.mu.Unlock()
+
+	a.saveSilences()
+	log.Infof("Silence %s added until %s: %s", added.ID, timeFormat.Absolute(added.EndsAt), added.String())
+	a.broadcastUpdate()
+	return added
+}
+
+// setSilence stores a silence and arms its expiry
+// This should be called while holding the lock
+func (a *AppState) setSilence(silence *Silence) {
+	a.silences = append(a.silences, silence)
+	id := silence.ID
+	silence.timer = time.AfterFunc(time.Until(silence.EndsAt), func() {
+		a.ExpireSilence(id)
+	})
+}
+
+// ExpireSilence ends a silence before its time, or when its time is up. The
+// alerts it silenced that are still firing need acknowledging again.
+func (a *AppState) ExpireSilence(id string) bool {
+	a.mu.Lock()
+	found := false
+	for i, silence := range a.silences {
+		if silence.ID == id {
+			silence.timer.Stop()
+			a.silences = append(a.silences[:i], a.silences[i+1:]...)
+			found = true
+			break
+		}
+	}
+	woken := 0
+	if found {
+		for _, entry := range a.alerts {
+			if ack := a.acknowledged[entry.ID]; ack != nil && ack.Silence == id && entry.Alert.Status == "firing" {
+				delete(a.acknowledged, entry.ID)
+				a.escalationAlarm.rearm(entry.ID)
+				woken++
+			}
+		}
+		a.seq++
+	}
+	a.mu.Unlock()
+
+	if !found {
+		return false
+	}
+	a.saveSilences()
+	log.Infof("Silence %s ended, %d alerts need acknowledging again", id, woken)
+	a.broadcastUpdate()
+	if woken > 0 {
+		a.chime()
+	}
+	return true
+}
+
+// GetSilences returns copies of the active silences, ending soonest first
+func (a *AppState) GetSilences() []Silence {
+	a.mu.RLock()
+	silences := make([]Silence, len(a.silences))
+	for i, silence := range a.silences {
+		silences[i] = *silence
+		silences[i].timer = nil
+		silences[i].Matchers = append([]SilenceMatcher(nil), silence.Matchers...)
+	}
+	a.mu.RUnlock()
+	sort.SliceStable(silences, func(i, j int) bool { return silences[i].EndsAt.Before(silences[j].EndsAt) })
+	return silences
+}
+
+// saveSilences persists the active silences to the data directory
+func (a *AppState) saveSilences() {
+	path := a.dataFilePath(silencesFile)
+	if path == "" {
+		return
+	}
+	if err := saveJSON(path, a.GetSilences()); err != nil {
+		log.Errorf("Failed to persist silences: %v", err)
+	}
+}
+
+// LoadSilences restores the active silences. It's called after the board is
+// restored; silences that ended while the server was down end right away.
+func (a *AppState) LoadSilences() error {
+	path := a.dataFilePath(silencesFile)
+	if path == "" {
+		return nil
+	}
+
+	var silences []Silence
+	if _, err := loadJSON(path, &silences); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	for i := range silences {
+		if err := silences[i].compile(); err != nil {
+			log.Errorf("Dropping silence %s: %v", silences[i].ID, err)
+			continue
+		}
+		a.setSilence(&silences[i])
+	}
+	a.mu.Unlock()
+	if len(silences) > 0 {
+		log.Infof("Restored %d silences", len(silences))
+	}
+	return nil
+}
+
+// silenceRequest is the body accepted when adding a silence
+// The end is either an absolute time or a duration from now
+type silenceRequest struct {
+	Matchers  []SilenceMatcher `json:"matchers"`
+	EndsAt    *time.Time       `json:"endsAt,omitempty"`
+	Duration  string           `json:"duration,omitempty"`
+	CreatedBy string           `json:"createdBy,omitempty"`
+	Comment   string           `json:"comment,omitempty"`
+}
+
+// silencesHandler lists (GET), adds (POST) or expires (DELETE) silences
+func silencesHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state.GetSilences())
+
+		case http.MethodPost:
+			var req silenceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			silence := &Silence{
+				Matchers:  req.Matchers,
+				CreatedBy: requestActor(r, strings.TrimSpace(req.CreatedBy)),
+				Comment:   strings.TrimSpace(req.Comment),
+			}
+			switch {
+			case req.Duration != "":
+				duration, err := time.ParseDuration(req.Duration)
+				if err != nil || duration <= 0 {
+					http.Error(w, fmt.Sprintf("Invalid 'duration': %s", req.Duration), http.StatusBadRequest)
+					return
+				}
+				silence.EndsAt = time.Now().Add(duration)
+			case req.EndsAt != nil:
+				silence.EndsAt = *req.EndsAt
+			default:
+				http.Error(w, "Missing 'endsAt' or 'duration'", http.StatusBadRequest)
+				return
+			}
+			if !silence.EndsAt.After(time.Now()) {
+				http.Error(w, "Silence end is in the past", http.StatusBadRequest)
+				return
+			}
+			if err := silence.compile(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			added := state.AddSilence(silence)
+			audit.RecordRequest(r, AuditSilenceChange, 3, "Silence added", map[string]string{"silenceId": added.ID, "matchers": added.String()})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(added)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "Missing silence ID", http.StatusBadRequest)
+				return
+			}
+			if !state.ExpireSilence(id) {
+				http.Error(w, "Silence not found", http.StatusNotFound)
+				return
+			}
+			audit.RecordRequest(r, AuditSilenceChange, 3, "Silence expired", map[string]string{"silenceId": id})
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Silences move in and out in Alertmanager's API v2 format, so existing
+// tooling keeps working: `amtool silence query -o json` or GET
+// /api/v2/silences of an Alertmanager can be imported, and the export can be
+// fed to `amtool silence import`.
+
+// alertmanagerMatcher is a matcher as Alertmanager's API has it, isRegex
+// being required there
+type alertmanagerMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual *bool  `json:"isEqual,omitempty"` // absent for true in older Alertmanagers
+}
+
+// alertmanagerSilence is a silence as Alertmanager's API has it
+type alertmanagerSilence struct {
+	ID        string                     `json:"id,omitempty"`
+	Matchers  []alertmanagerMatcher      `json:"matchers"`
+	StartsAt  time.Time                  `json:"startsAt"`
+	EndsAt    time.Time                  `json:"endsAt"`
+	UpdatedAt *time.Time                 `json:"updatedAt,omitempty"`
+	CreatedBy string                     `json:"createdBy"`
+	Comment   string                     `json:"comment"`
+	Status    *alertmanagerSilenceStatus `json:"status,omitempty"`
+}
+
+// alertmanagerSilenceStatus is active, pending or expired
+type alertmanagerSilenceStatus struct {
+	State string `json:"state"`
+}
+
+// exportSilence converts a silence to Alertmanager's format
+func exportSilence(silence Silence) alertmanagerSilence {
+	exported := alertmanagerSilence{
+		ID:        silence.ID,
+		StartsAt:  silence.StartsAt,
+		EndsAt:    silence.EndsAt,
+		UpdatedAt: &silence.StartsAt,
+		CreatedBy: silence.CreatedBy,
+		Comment:   silence.Comment,
+		Status:    &alertmanagerSilenceStatus{State: "active"},
+	}
+	for _, matcher := range silence.Matchers {
+		isEqual := matcher.IsEqual == nil || *matcher.IsEqual
+		exported.Matchers = append(exported.Matchers, alertmanagerMatcher{
+			Name: matcher.Name, Value: matcher.Value, IsRegex: matcher.IsRegex, IsEqual: &isEqual,
+		})
+	}
+	return exported
+}
+
+// importSilence converts a silence from Alertmanager's format, or tells why
+// it can't be imported
+func importSilence(imported alertmanagerSilence, now time.Time) (*Silence, error) {
+	if imported.Status != nil && imported.Status.State == "expired" || !imported.EndsAt.After(now) {
+		return nil, fmt.Errorf("ended at %s", timeFormat.Absolute(imported.EndsAt))
+	}
+	if imported.StartsAt.After(now) {
+		// Silences here start when they are added
+		return nil, fmt.Errorf("starts in the future, at %s", timeFormat.Absolute(imported.StartsAt))
+	}
+	silence := &Silence{EndsAt: imported.EndsAt, CreatedBy: imported.CreatedBy, Comment: imported.Comment}
+	for _, matcher := range imported.Matchers {
+		silence.Matchers = append(silence.Matchers, SilenceMatcher{
+			Name: matcher.Name, Value: matcher.Value, IsRegex: matcher.IsRegex, IsEqual: matcher.IsEqual,
+		})
+	}
+	if err := silence.compile(); err != nil {
+		return nil, err
+	}
+	return silence, nil
+}
+
+// silenceImportKey tells apart the silences of an import from the active ones
+func silenceImportKey(silence *Silence) string {
+	return silence.String() + " " + silence.EndsAt.UTC().Format(time.RFC3339Nano)
+}
+
+// silenceImportResult is the answer to an import
+type silenceImportResult struct {
+	Imported []string            `json:"imported"` // IDs of the silences added
+	Skipped  []silenceImportSkip `json:"skipped"`
+}
+
+type silenceImportSkip struct {
+	ID     string `json:"id,omitempty"` // in the imported file
+	Reason string `json:"reason"`
+}
+
+// silencesExportHandler lists the active silences in Alertmanager's format
+func silencesExportHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		exported := []alertmanagerSilence{}
+		for _, silence := range state.GetSilences() {
+			exported = append(exported, exportSilence(silence))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exported)
+	}
+}
+
+// silencesImportHandler adds the silences of a JSON array in Alertmanager's
+// format. Silences that ended, start later, are invalid or are active here
+// already are skipped, so importing the same file twice adds nothing.
+func silencesImportHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var imported []alertmanagerSilence
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&imported); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON, expected an array of silences: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		active := make(map[string]bool)
+		for _, silence := range state.GetSilences() {
+			active[silenceImportKey(&silence)] = true
+		}
+		result := silenceImportResult{Imported: []string{}, Skipped: []silenceImportSkip{}}
+		now := time.Now()
+		for _, candidate := range imported {
+			silence, err := importSilence(candidate, now)
+			if err != nil {
+				result.Skipped = append(result.Skipped, silenceImportSkip{ID: candidate.ID, Reason: err.Error()})
+				continue
+			}
+			key := silenceImportKey(silence)
+			if active[key] {
+				result.Skipped = append(result.Skipped, silenceImportSkip{ID: candidate.ID, Reason: "already active"})
+				continue
+			}
+			active[key] = true
+			if silence.CreatedBy == "" {
+				silence.CreatedBy = requestActor(r, "")
+			}
+			result.Imported = append(result.Imported, state.AddSilence(silence).ID)
+		}
+
+		log.Infof("Imported %d silences, skipped %d", len(result.Imported), len(result.Skipped))
+		if len(result.Imported) > 0 {
+			audit.RecordRequest(r, AuditSilenceChange, 3, "Silences imported", map[string]string{
+				"silenceIds": strings.Join(result.Imported, ","), "skipped": strconv.Itoa(len(result.Skipped)),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSilence(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "prod"}},
+	}})
+	existing := state.GetAlerts()[0].ID
+
+	notEqual := false
+	silence := &Silence{
+		Matchers: []SilenceMatcher{
+			{Name: "alertname", Value: "Disk"},
+			{Name: "env", Value: "prod|staging", IsRegex: true},
+			{Name: "team", Value: "db", IsEqual: &notEqual},
+		},
+		EndsAt:    time.Now().Add(100 * time.Millisecond),
+		CreatedBy: "alice",
+	}
+	if err := silence.compile(); err != nil {
+		t.Fatal(err)
+	}
+	added := state.AddSilence(silence)
+	if got := added.String(); got != `{alertname="Disk",env=~"prod|staging",team!="db"}` {
+		t.Errorf("Unexpected matchers %s", got)
+	}
+
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "staging"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "prod", "team": "db"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "env": "dev"}},
+	}})
+	silenced := 0
+	for _, entry := range state.GetAlerts() {
+		if ack := state.GetAcknowledgement(entry.ID); ack != nil && ack.Silence == added.ID {
+			silenced++
+		}
+	}
+	if silenced != 2 {
+		t.Fatalf("Expected the existing and the new staging alert silenced, got %d", silenced)
+	}
+	if state.GetAcknowledgement(existing).By != "alice" {
+		t.Error("Expected the silence creator on the acknowledgement")
+	}
+	if report := state.suppressed.report(); len(report.Rules) != 1 || report.Rules[0].Count != 2 {
+		t.Errorf("Expected the existing and the new alert in the suppression report, got %+v", report.Rules)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if len(state.GetSilences()) != 0 || state.IsAcknowledged(existing) {
+		t.Error("Expected the silenced alerts unacknowledged once the silence ended")
+	}
+}
+
+func TestSilenceMatchingEverythingRefused(t *testing.T) {
+	silence := &Silence{Matchers: []SilenceMatcher{{Name: "env", Value: ".*", IsRegex: true}}}
+	if err := silence.compile(); err == nil {
+		t.Error("Expected a silence matching every alert refused")
+	}
+}
+
+func TestSilenceImportExport(t *testing.T) {
+	state := NewAppState(100)
+	now := time.Now().UTC()
+	// As printed by `amtool silence query -o json`
+	amtool := `[
+		{"id": "a", "status": {"state": "active"}, "createdBy": "bob", "comment": "maintenance",
+		 "startsAt": "` + now.Add(-time.Hour).Format(time.RFC3339) + `", "endsAt": "` + now.Add(time.Hour).Format(time.RFC3339) + `",
+		 "matchers": [{"name": "alertname", "value": "Disk", "isRegex": false}, {"name": "env", "value": "dev", "isRegex": false, "isEqual": false}]},
+		{"id": "b", "status": {"state": "expired"}, "startsAt": "` + now.Add(-2*time.Hour).Format(time.RFC3339) + `", "endsAt": "` + now.Add(-time.Hour).Format(time.RFC3339) + `",
+		 "matchers": [{"name": "alertname", "value": "Old", "isRegex": false}]},
+		{"id": "c", "status": {"state": "pending"}, "startsAt": "` + now.Add(time.Hour).Format(time.RFC3339) + `", "endsAt": "` + now.Add(2*time.Hour).Format(time.RFC3339) + `",
+		 "matchers": [{"name": "alertname", "value": "Later", "isRegex": false}]},
+		{"id": "d", "status": {"state": "active"}, "startsAt": "` + now.Format(time.RFC3339) + `", "endsAt": "` + now.Add(time.Hour).Format(time.RFC3339) + `",
+		 "matchers": [{"name": "env", "value": ".*", "isRegex": true}]}
+	]`
+
+	importSilences := func(body string) silenceImportResult {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		silencesImportHandler(state)(rec, httptest.NewRequest(http.MethodPost, "/api/v1/silences/import", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body)
+		}
+		var result silenceImportResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := importSilences(amtool)
+	if len(result.Imported) != 1 || len(result.Skipped) != 3 {
+		t.Fatalf("Expected only the active silence imported, got %+v", result)
+	}
+	silences := state.GetSilences()
+	if len(silences) != 1 || silences[0].String() != `{alertname="Disk",env!="dev"}` || silences[0].CreatedBy != "bob" {
+		t.Fatalf("Unexpected imported silences %+v", silences)
+	}
+	if result := importSilences(amtool); len(result.Imported) != 0 {
+		t.Errorf("Expected importing twice to add nothing, got %+v", result)
+	}
+
+	rec := httptest.NewRecorder()
+	silencesExportHandler(state)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/silences/export", nil))
+	var exported []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || exported[0]["comment"] != "maintenance" || exported[0]["status"].(map[string]interface{})["state"] != "active" {
+		t.Fatalf("Unexpected export %+v", exported)
+	}
+	// amtool requires isRegex and reads isEqual
+	matcher := exported[0]["matchers"].([]interface{})[0].(map[string]interface{})
+	if matcher["isRegex"] != false || matcher["isEqual"] != true {
+		t.Errorf("Unexpected exported matcher %+v", matcher)
+	}
+
+	rec = httptest.NewRecorder()
+	silencesImportHandler(state)(rec, httptest.NewRequest(http.MethodPost, "/api/v1/silences/import", strings.NewReader(`{"matchers": []}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a body that isn't an array refused, got %d", rec.Code)
+	}
+}
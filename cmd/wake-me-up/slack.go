@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSlackSnooze = time.Hour
+	defaultSlackAPIURL = "https://slack.com/api"
+
+	// How long messages posted with a bot token are kept in sync with the
+	// board at most
+	slackMessageMaxAge = 24 * time.Hour
+)
+
+// Slack rejects messages of more than 50 blocks; each alert takes two
+const maxSlackAlerts = 20
+
+// How old a signed Slack request may be, against replays
+const slackRequestMaxAge = 5 * time.Minute
+
+// Slack button actions
+const (
+	slackActionAcknowledge = "acknowledge"
+	slackActionSnooze      = "snooze"
+)
+
+// SlackConfig posts notifications to a Slack channel, with buttons to
+// acknowledge or snooze alerts right from Slack
+type SlackConfig struct {
+	WebhookURL    string        `yaml:"webhook_url"`    // Incoming webhook of a Slack app (optional with bot_token)
+	BotToken      string        `yaml:"bot_token"`      // Bot token of the app with chat:write; messages are then updated when their alerts are acknowledged, resolved or cleared anywhere (optional)
+	Channel       string        `yaml:"channel"`        // Channel the bot posts to, e.g. C0123456789 (required with bot_token)
+	SigningSecret string        `yaml:"signing_secret"` // Signing secret of the app; enables the buttons, which need interactivity pointed at /webhook/slack-actions (optional)
+	SnoozeFor     time.Duration `yaml:"snooze_for"`     // How long "Snooze" acknowledges an alert before reminding again (optional, default: 1h)
+	APIURL        string        `yaml:"api_url"`        // Web API used with bot_token (optional, default: https://slack.com/api)
+}
+
+// slackNotifier sends Block Kit messages to a Slack incoming webhook, or
+// through the Web API with a bot token, keeping the messages in sync with the
+// board
+type slackNotifier struct {
+	config *SlackConfig
+	links  *ackLinker
+	client *http.Client
+
+	mu       sync.Mutex
+	messages map[string]*slackMessage // posted with the bot token, by alert ID
+}
+
+// slackMessage is a message posted with the bot token, with what became of
+// its alerts as last shown
+type slackMessage struct {
+	channel  string
+	ts       string
+	event    NotificationEvent
+	states   map[string]string // by alert ID, see slackAlertState
+	postedAt time.Time
+}
+
+func newSlackNotifier(config *SlackConfig, links *ackLinker) (*slackNotifier, error) {
+	if config.WebhookURL == "" && config.BotToken == "" {
+		return nil, fmt.Errorf("missing webhook_url or bot_token")
+	}
+	if config.BotToken != "" && config.Channel == "" {
+		return nil, fmt.Errorf("missing channel for bot_token")
+	}
+	if config.SnoozeFor <= 0 {
+		config.SnoozeFor = defaultSlackSnooze
+	}
+	if config.APIURL == "" {
+		config.APIURL = defaultSlackAPIURL
+	}
+	config.APIURL = strings.TrimSuffix(config.APIURL, "/")
+	return &slackNotifier{
+		config:   config,
+		links:    links,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		messages: make(map[string]*slackMessage),
+	}, nil
+}
+
+func (s *slackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify posts one message per event, with a section and buttons per alert
+func (s *slackNotifier) Notify(event NotificationEvent) error {
+	if s.config.BotToken != "" {
+		return s.post(event)
+	}
+	body, err := json.Marshal(s.render(event, nil))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+	return nil
+}
+
+// post sends the message of an event through the Web API, and keeps it to
+// update when its alerts change
+func (s *slackNotifier) post(event NotificationEvent) error {
+	message := s.render(event, nil)
+	message["channel"] = s.config.Channel
+	var posted struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	if err := s.callAPI("chat.postMessage", message, &posted); err != nil {
+		return err
+	}
+	if event.Kind == EventAllClear {
+		return nil
+	}
+
+	tracked := &slackMessage{channel: posted.Channel, ts: posted.TS, event: event, states: make(map[string]string), postedAt: time.Now()}
+	s.mu.Lock()
+	for i, entry := range event.Alerts {
+		if i == maxSlackAlerts {
+			break
+		}
+		s.messages[entry.ID] = tracked
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Watching tells if messages posted with the bot token may still change
+func (s *slackNotifier) Watching() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages) > 0
+}
+
+// BoardChanged updates the messages whose alerts were acknowledged, snoozed,
+// resolved or cleared since they were last shown, and stops following those
+// whose alerts all left the board
+func (s *slackNotifier) BoardChanged(view boardView) {
+	now := time.Now()
+	var changed []*slackMessage
+	var rendered []map[string]interface{}
+	s.mu.Lock()
+	seen := make(map[*slackMessage]bool)
+	for _, message := range s.messages {
+		if seen[message] {
+			continue
+		}
+		seen[message] = true
+		states := make(map[string]string, len(message.states))
+		done, differs := true, false
+		for id, tracked := range s.messages {
+			if tracked != message {
+				continue
+			}
+			states[id] = slackAlertState(view, id)
+			differs = differs || states[id] != message.states[id]
+			_, onBoard := view.Alerts[id]
+			done = done && !onBoard
+		}
+		if differs {
+			message.states = states
+			changed = append(changed, message)
+			rendered = append(rendered, s.render(message.event, states))
+		}
+		if done || now.Sub(message.postedAt) >= slackMessageMaxAge {
+			for id, tracked := range s.messages {
+				if tracked == message {
+					delete(s.messages, id)
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for i, message := range changed {
+		rendered[i]["channel"] = message.channel
+		rendered[i]["ts"] = message.ts
+		if err := s.callAPI("chat.update", rendered[i], nil); err != nil {
+			log.Errorf("Failed to update Slack message %s: %v", message.ts, err)
+		}
+	}
+}
+
+// slackAlertState describes what became of a notified alert, empty while it
+// awaits acknowledgement
+func slackAlertState(view boardView, alertID string) string {
+	entry, ok := view.Alerts[alertID]
+	if !ok {
+		switch view.Removed[alertID] {
+		case "resolved":
+			return ":large_green_circle: Resolved"
+		case "cleared":
+			return ":wastebasket: Cleared from the board"
+		}
+		return "No longer on the board"
+	}
+	switch {
+	case entry.Snooze != nil:
+		return ":zzz: Snoozed until " + timeFormat.Absolute(entry.Snooze.Until)
+	case entry.IsAcknowledged && entry.Acknowledgement != nil && entry.Acknowledgement.By != "":
+		return ":white_check_mark: Acknowledged by " + strings.TrimPrefix(entry.Acknowledgement.By, "slack:")
+	case entry.IsAcknowledged:
+		return ":white_check_mark: Acknowledged"
+	}
+	return ""
+}
+
+// callAPI calls a Web API method with the bot token, decoding the reply into
+// result if set
+func (s *slackNotifier) callAPI(method string, request map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.APIURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.config.BotToken)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	// The Web API answers 200 OK with ok false on errors
+	var reply struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil || !reply.OK {
+		return fmt.Errorf("slack %s returned %s: %s", method, resp.Status, reply.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+// render builds the Block Kit message of an event, with the alerts that have
+// a state in states showing it instead of their buttons
+func (s *slackNotifier) render(event NotificationEvent, states map[string]string) map[string]interface{} {
+	if event.Kind == EventAllClear {
+		return map[string]interface{}{"text": event.Note, "blocks": []map[string]interface{}{slackText(":white_check_mark: *" + event.Note + "*")}}
+	}
+	heading := fmt.Sprintf("%d alert(s) need attention", len(event.Alerts))
+	if event.Kind == EventFollowUp {
+		heading = "Still firing at its follow-up time"
+	}
+	if event.Kind == EventEscalated {
+		heading = "Still unacknowledged"
+	}
+	blocks := []map[string]interface{}{slackText(":rotating_light: *" + heading + "*")}
+	if event.Note != "" {
+		blocks = append(blocks, slackText("> "+event.Note))
+	}
+
+	for i, entry := range event.Alerts {
+		if i == maxSlackAlerts {
+			blocks = append(blocks, slackText(fmt.Sprintf("…and %d more on the board", len(event.Alerts)-i)))
+			break
+		}
+		text := "*" + alertTitle(entry.Alert) + "*"
+		if severity := alertSeverity(entry.Alert); severity != "" {
+			text += " (" + severity + ")"
+		}
+		text += "\nFiring since " + timeFormat.Absolute(entry.Alert.StartsAt)
+		blocks = append(blocks, slackText(text))
+		if state := states[entry.ID]; state != "" {
+			blocks = append(blocks, map[string]interface{}{
+				"type":     "context",
+				"elements": []map[string]string{{"type": "mrkdwn", "text": state}},
+			})
+		} else if buttons := s.buttons(entry.ID); len(buttons) > 0 {
+			blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": buttons})
+		}
+	}
+
+	return map[string]interface{}{"text": heading, "blocks": blocks}
+}
+
+// buttons returns the buttons of an alert: interactive ones when Slack can
+// call back, otherwise a signed acknowledge link if the dashboard is reachable
+func (s *slackNotifier) buttons(alertID string) []map[string]interface{} {
+	if s.config.SigningSecret != "" {
+		return []map[string]interface{}{
+			slackButton("✓ Acknowledge", slackActionAcknowledge, alertID, "primary"),
+			slackButton("Snooze "+shortDuration(s.config.SnoozeFor), slackActionSnooze, alertID, ""),
+		}
+	}
+	if link := s.links.Link(alertID); link != "" {
+		button := slackButton("✓ Acknowledge", slackActionAcknowledge, alertID, "primary")
+		button["url"] = link
+		return []map[string]interface{}{button}
+	}
+	return nil
+}
+
+func slackText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}
+}
+
+func slackButton(text, actionID, value, style string) map[string]interface{} {
+	button := map[string]interface{}{
+		"type":      "button",
+		"text":      map[string]string{"type": "plain_text", "text": text},
+		"action_id": actionID,
+		"value":     value,
+	}
+	if style != "" {
+		button["style"] = style
+	}
+	return button
+}
+
+// verifySlackSignature checks the signature Slack adds to requests, see
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	timestamp, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+// slackInteraction is the part of a Slack block_actions payload we use
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// slackActionsHandler handles button clicks on Slack notifications,
+// acknowledging or snoozing the alert with the Slack user as the actor
+func slackActionsHandler(state *AppState, config *SlackConfig) http.HandlerFunc {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if !verifySlackSignature(config.SigningSecret, r.Header, body, time.Now()) {
+			audit.RecordRequest(r, AuditAuthFailure, 5, "Invalid Slack signature", nil)
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "Invalid form body", http.StatusBadRequest)
+			return
+		}
+		var interaction slackInteraction
+		if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		if interaction.Type != "block_actions" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		actor := "slack:" + interaction.User.Username
+		if interaction.User.Username == "" {
+			actor = "slack:" + interaction.User.ID
+		}
+		var replies []string
+		for _, action := range interaction.Actions {
+			replies = append(replies, handleSlackAction(state, config, r, actor, action.ActionID, action.Value))
+		}
+
+		// Slack wants an answer within 3 seconds; the outcome is posted to the
+		// channel separately
+		w.WriteHeader(http.StatusOK)
+		if interaction.ResponseURL != "" && len(replies) > 0 {
+			go func() {
+				if err := postSlackResponse(client, interaction.ResponseURL, strings.Join(replies, "\n")); err != nil {
+					log.Errorf("Failed to answer Slack action: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+// handleSlackAction applies one button click and returns the reply to post
+func handleSlackAction(state *AppState, config *SlackConfig, r *http.Request, actor, actionID, alertID string) string {
+	if !state.hasAlert(alertID) {
+		return fmt.Sprintf("Alert %s is no longer on the board", alertID)
+	}
+	user := strings.TrimPrefix(actor, "slack:")
+
+	switch actionID {
+	case slackActionAcknowledge:
+		state.Acknowledge(alertID, actor)
+		audit.Record(AuditEvent{
+			Type:     AuditAcknowledge,
+			Severity: 3,
+			Actor:    actor,
+			SourceIP: getClientIP(r),
+			Message:  "Alert acknowledged from Slack",
+			Fields:   map[string]string{"alertId": alertID},
+		})
+		return fmt.Sprintf(":white_check_mark: Alert %s acknowledged by %s", alertID, user)
+
+	case slackActionSnooze:
+		dueAt := time.Now().Add(config.SnoozeFor)
+		state.Acknowledge(alertID, actor)
+		if err := state.SetFollowUp(alertID, "Snoozed from Slack by "+user, dueAt, "slack"); err != nil {
+			log.Errorf("Failed to schedule Slack snooze of alert %s: %v", alertID, err)
+		}
+		audit.Record(AuditEvent{
+			Type:     AuditAcknowledge,
+			Severity: 3,
+			Actor:    actor,
+			SourceIP: getClientIP(r),
+			Message:  "Alert snoozed from Slack",
+			Fields:   map[string]string{"alertId": alertID, "followUp": dueAt.Format(time.RFC3339)},
+		})
+		return fmt.Sprintf(":zzz: Alert %s snoozed by %s until %s", alertID, user, timeFormat.Absolute(dueAt))
+	}
+	return fmt.Sprintf("Unknown action %q", actionID)
+}
+
+// postSlackResponse posts a message to the channel of an interaction, leaving
+// the original notification in place
+func postSlackResponse(client *http.Client, responseURL, text string) error {
+	body, _ := json.Marshal(map[string]interface{}{"text": text, "response_type": "in_channel", "replace_original": false})
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+	return nil
+}
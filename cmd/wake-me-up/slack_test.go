@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifySlackSignature(t *testing.T) {
+	// Example from https://api.slack.com/authentication/verifying-requests-from-slack
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c")
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", "1531420618")
+	header.Set("X-Slack-Signature", "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503")
+	sent := time.Unix(1531420618, 0)
+
+	if !verifySlackSignature(secret, header, body, sent.Add(time.Minute)) {
+		t.Fatal("Valid signature rejected")
+	}
+	if verifySlackSignature(secret, header, body, sent.Add(10*time.Minute)) {
+		t.Fatal("Replayed request accepted")
+	}
+	if verifySlackSignature(secret, header, append(body, '&'), sent) {
+		t.Fatal("Tampered body accepted")
+	}
+	if verifySlackSignature("other-secret", header, body, sent) {
+		t.Fatal("Signature of another secret accepted")
+	}
+}
+
+func TestSlackMessagesFollowTheBoard(t *testing.T) {
+	var mu sync.Mutex
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("Expected the bot token, got %q", r.Header.Get("Authorization"))
+		}
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		if strings.HasSuffix(r.URL.Path, "/chat.update") {
+			blocks, _ := json.Marshal(message["blocks"])
+			mu.Lock()
+			updates = append(updates, message["ts"].(string)+" "+string(blocks))
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1700000000.000100"}`))
+	}))
+	defer server.Close()
+
+	slack, err := newSlackNotifier(&SlackConfig{BotToken: "xoxb-test", Channel: "C123", APIURL: server.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Disk"}}}})
+	alerts := state.GetAlerts()
+	if err := slack.Notify(NotificationEvent{Kind: EventFiring, Alerts: alerts}); err != nil {
+		t.Fatal(err)
+	}
+	if !slack.Watching() {
+		t.Fatal("Expected the posted message followed")
+	}
+
+	slack.BoardChanged(state.boardView())
+	if len(updates) != 0 {
+		t.Fatalf("Expected no update while nothing changed, got %v", updates)
+	}
+	state.Acknowledge(alerts[0].ID, "web:alice")
+	slack.BoardChanged(state.boardView())
+	slack.BoardChanged(state.boardView())
+	if len(updates) != 1 || !strings.HasPrefix(updates[0], "1700000000.000100 ") || !strings.Contains(updates[0], "Acknowledged by web:alice") {
+		t.Fatalf("Expected one update of the message showing the acknowledgement, got %v", updates)
+	}
+
+	state.ClearAlerts([]string{alerts[0].ID})
+	slack.BoardChanged(state.boardView())
+	if len(updates) != 2 || !strings.Contains(updates[1], "Cleared from the board") {
+		t.Errorf("Expected the message updated when cleared, got %v", updates)
+	}
+	if slack.Watching() {
+		t.Error("Expected the message no longer followed once its alerts left the board")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons a WebSocket client was disconnected
+const (
+	DisconnectClosed       = "closed"        // the client closed the connection
+	DisconnectSlowConsumer = "slow_consumer" // the send queue filled up or a write timed out
+	DisconnectPongTimeout  = "pong_timeout"  // the client stopped answering pings
+	DisconnectNetworkError = "network_error" // any other read or write failure
+	DisconnectChaos        = "chaos"         // dropped by fault injection
+	DisconnectShutdown     = "shutdown"      // the server is shutting down
+)
+
+// Throughput assumed for slow clients when sizing write deadlines, unless configured
+const defaultMinThroughput = 32 * 1024
+
+// disconnected records why the client went away. Only the first reason
+// counts, since a failing write also makes the read side fail.
+func (c *Client) disconnected(reason string) {
+	c.disconnectOnce.Do(func() {
+		wsDisconnects.WithLabelValues(reason).Inc()
+		if reason != DisconnectClosed {
+			log.Infof("WebSocket client %s disconnected: %s", c.remoteAddr, reason)
+		}
+	})
+}
+
+// writeErrorReason tells timeouts, which mean the client can't keep up,
+// apart from other network errors
+func writeErrorReason(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return DisconnectSlowConsumer
+	}
+	return DisconnectNetworkError
+}
+
+// readErrorReason classifies the error that ended the read loop
+func readErrorReason(err error) string {
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return DisconnectClosed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return DisconnectPongTimeout
+	}
+	return DisconnectNetworkError
+}
+
+// writeBudget returns how long a write of the given size may take: the base
+// write timeout plus the time it needs at the minimum throughput
+func (t wsTiming) writeBudget(size int) time.Duration {
+	return t.writeTimeout + time.Duration(size)*time.Second/time.Duration(t.minThroughput)
+}
+
+// writeBatch writes the messages as one newline-separated WebSocket message
+// and marks the client slow if the write used more than half its budget
+func (c *Client) writeBatch(batch [][]byte, timing wsTiming) error {
+	size := len(batch) - 1
+	for _, message := range batch {
+		size += len(message)
+	}
+	budget := timing.writeBudget(size)
+
+	start := time.Now()
+	c.conn.SetWriteDeadline(start.Add(budget))
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	for i, message := range batch {
+		if i > 0 {
+			w.Write([]byte{'\n'})
+		}
+		w.Write(message)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	slow := time.Since(start) > budget/2
+	if slow != c.slow.Swap(slow) {
+		log.Debugf("WebSocket client %s slow: %v", c.remoteAddr, slow)
+	}
+	return nil
+}
+
+var updatePrefix = []byte(`{"type":"update"`)
+
+// coalesceUpdates drops all but the last state update of a batch. Updates
+// carry the full board, so a slow client only needs the newest one; other
+// messages such as sound requests are kept.
+func coalesceUpdates(batch [][]byte) [][]byte {
+	last := -1
+	for i, message := range batch {
+		if bytes.HasPrefix(message, updatePrefix) {
+			last = i
+		}
+	}
+	trimmed := batch[:0]
+	for i, message := range batch {
+		if i == last || !bytes.HasPrefix(message, updatePrefix) {
+			trimmed = append(trimmed, message)
+		}
+	}
+	return trimmed
+}
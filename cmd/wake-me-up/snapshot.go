@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Snapshots draw the board into a PNG on the server, with a built-in bitmap
+// font and no browser, for chat posts during handoffs and for e-paper
+// displays that only show bitmaps.
+
+// Snapshot size limits
+const (
+	defaultSnapshotWidth = 800
+	minSnapshotWidth     = 240
+	maxSnapshotWidth     = 3840
+	defaultSnapshotScale = 2
+	maxSnapshotScale     = 4
+	defaultSnapshotLimit = 20
+	maxSnapshotLimit     = 200
+	// Width and height together, those of a 4K screen: the limits above
+	// alone allow images of hundreds of megabytes
+	maxSnapshotPixels = 3840 * 2160
+)
+
+// snapshotOptions are the query parameters of a snapshot
+type snapshotOptions struct {
+	Width int  // in pixels
+	Scale int  // pixels per font pixel
+	Limit int  // alerts drawn, the rest are counted
+	Mono  bool // black on white only, 1 bit per pixel, for e-paper
+}
+
+// parseSnapshotOptions reads width, scale, limit and mono
+func parseSnapshotOptions(query url.Values) (snapshotOptions, error) {
+	options := snapshotOptions{Width: defaultSnapshotWidth, Scale: defaultSnapshotScale, Limit: defaultSnapshotLimit}
+	values := map[string]struct {
+		target   *int
+		min, max int
+	}{
+		"width": {&options.Width, minSnapshotWidth, maxSnapshotWidth},
+		"scale": {&options.Scale, 1, maxSnapshotScale},
+		"limit": {&options.Limit, 0, maxSnapshotLimit},
+	}
+	for name, value := range values {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < value.min || n > value.max {
+			return options, fmt.Errorf("Invalid '%s' %q, expected %d to %d", name, raw, value.min, value.max)
+		}
+		*value.target = n
+	}
+	if mono := query.Get("mono"); mono != "" {
+		var err error
+		if options.Mono, err = strconv.ParseBool(mono); err != nil {
+			return options, fmt.Errorf("Invalid 'mono' %q, expected true or false", mono)
+		}
+	}
+	return options, nil
+}
+
+// snapshotColors are the board colors, see static/style.css
+var snapshotColors = struct {
+	background, text, muted, rule      color.Color
+	critical, warning, clear           color.Color
+	firing, resolved, acked, snoozed   color.Color
+	severity, badgeText, darkBadgeText color.Color
+}{
+	background:    color.White,
+	text:          color.RGBA{0x33, 0x33, 0x33, 0xff},
+	muted:         color.RGBA{0x75, 0x75, 0x75, 0xff},
+	rule:          color.RGBA{0xe9, 0xec, 0xef, 0xff},
+	critical:      color.RGBA{0xff, 0x44, 0x44, 0xff},
+	warning:       color.RGBA{0xff, 0x98, 0x00, 0xff},
+	clear:         color.RGBA{0x2e, 0xb8, 0x2e, 0xff},
+	firing:        color.RGBA{0xff, 0x44, 0x44, 0xff},
+	resolved:      color.RGBA{0x44, 0xff, 0x44, 0xff},
+	acked:         color.RGBA{0xff, 0xc1, 0x07, 0xff},
+	snoozed:       color.RGBA{0x9e, 0x9e, 0x9e, 0xff},
+	severity:      color.RGBA{0x60, 0x7d, 0x8b, 0xff},
+	badgeText:     color.White,
+	darkBadgeText: color.RGBA{0x33, 0x33, 0x33, 0xff},
+}
+
+// snapshotCanvas draws the board, in color or black on white
+type snapshotCanvas struct {
+	img   draw.Image
+	mono  bool
+	scale int
+}
+
+// ink returns a color as drawn, black in mono
+func (c *snapshotCanvas) ink(ink color.Color) color.Color {
+	if c.mono {
+		return color.Black
+	}
+	return ink
+}
+
+func (c *snapshotCanvas) fill(rect image.Rectangle, fill color.Color) {
+	draw.Draw(c.img, rect, image.NewUniform(fill), image.Point{}, draw.Src)
+}
+
+// text writes a line of text, cut to end before maxX, and returns the x after it
+func (c *snapshotCanvas) text(x, y, maxX int, text string, ink color.Color, scale int) int {
+	return drawText(c.img, x, y, fitText(text, (maxX-x)/(cellWidth*scale)), ink, scale)
+}
+
+// badge writes text on a filled box, white on black in mono, and returns the
+// x after it
+func (c *snapshotCanvas) badge(x, y int, text string, fill, ink color.Color) int {
+	s := c.scale
+	if c.mono {
+		fill, ink = color.Black, color.White
+	}
+	width := (utf8.RuneCountInString(text)*cellWidth + 3) * s
+	c.fill(image.Rect(x, y-s, x+width, y+(glyphHeight+1)*s), fill)
+	drawText(c.img, x+2*s, y, text, ink, s)
+	return x + width + 2*s
+}
+
+// parseHexColor parses #rgb and #rrggbb colors
+func parseHexColor(value string) (color.Color, bool) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if !strings.HasPrefix(value, "#") || len(hex) != 6 {
+		return nil, false
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, false
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xff}, true
+}
+
+// snapshotLayout is the height of the parts of a snapshot
+type snapshotLayout struct {
+	line, pad, headerHeight, rowHeight int
+	shown                              int // alerts drawn
+	height                             int // of the whole image
+}
+
+// layoutSnapshot sizes a snapshot of a number of alerts
+func layoutSnapshot(alertCount int, options snapshotOptions) snapshotLayout {
+	l := snapshotLayout{line: cellHeight * options.Scale}
+	l.pad = 2 * l.line / 3
+	l.headerHeight = 2*l.pad + 2*l.line + l.line/2
+	l.rowHeight = 2*l.line + l.pad
+	l.shown = min(alertCount, options.Limit)
+	l.height = l.headerHeight + l.pad + max(l.shown, 1)*l.rowHeight + l.pad
+	if l.shown < alertCount {
+		l.height += l.line
+	}
+	return l
+}
+
+// renderSnapshot draws the status of the board and its alerts, newest first
+func renderSnapshot(alerts []AlertEntryWithAck, level string, now time.Time, options snapshotOptions) image.Image {
+	s := options.Scale
+	layout := layoutSnapshot(len(alerts), options)
+	line, pad, headerHeight, rowHeight := layout.line, layout.pad, layout.headerHeight, layout.rowHeight
+	shown, height := layout.shown, layout.height
+
+	bounds := image.Rect(0, 0, options.Width, height)
+	canvas := &snapshotCanvas{scale: s, mono: options.Mono}
+	if options.Mono {
+		canvas.img = image.NewPaletted(bounds, color.Palette{color.White, color.Black})
+	} else {
+		canvas.img = image.NewRGBA(bounds)
+	}
+	colors := snapshotColors
+	canvas.fill(bounds, colors.background)
+	right := options.Width - pad
+
+	// Header: the status of the board on its color, like the status pill
+	unacknowledged, firing := 0, 0
+	for _, entry := range alerts {
+		if entry.NeedsAck {
+			unacknowledged++
+		}
+		if entry.Alert.Status == "firing" {
+			firing++
+		}
+	}
+	headerFill, headerInk := colors.clear, colors.badgeText
+	title := "ALL CLEAR"
+	switch level {
+	case StatusLevelCritical:
+		headerFill, title = colors.critical, fmt.Sprintf("%d UNACKNOWLEDGED", unacknowledged)
+	case StatusLevelWarning:
+		headerFill, title = colors.warning, fmt.Sprintf("%d UNACKNOWLEDGED", unacknowledged)
+	}
+	if options.Mono {
+		headerFill, headerInk = color.Black, color.White
+		if level == StatusLevelOK {
+			headerFill, headerInk = color.White, color.Black
+		}
+	}
+	canvas.fill(image.Rect(0, 0, options.Width, headerHeight), headerFill)
+	canvas.text(pad, pad, right, title, headerInk, 2*s)
+	summary := fmt.Sprintf("%d alert(s) on the board, %d firing - %s", len(alerts), firing, timeFormat.Absolute(now))
+	canvas.text(pad, pad+2*line+line/4, right, summary, headerInk, s)
+	if options.Mono && level == StatusLevelOK {
+		canvas.fill(image.Rect(0, headerHeight-s, options.Width, headerHeight), color.Black)
+	}
+
+	y := headerHeight + pad
+	if len(alerts) == 0 {
+		canvas.text(pad, y+line/2, right, "No alerts", canvas.ink(colors.muted), s)
+	}
+	for _, entry := range alerts[:shown] {
+		// Status bar on the left of the card, then badges and the title
+		statusText, statusFill, statusInk := "FIRING", colors.firing, colors.badgeText
+		switch {
+		case entry.Snooze != nil:
+			statusText, statusFill = "SNOOZED", colors.snoozed
+		case entry.IsAcknowledged:
+			statusText, statusFill, statusInk = "ACKNOWLEDGED", colors.acked, colors.darkBadgeText
+		case entry.Alert.Status != "firing":
+			statusText, statusFill, statusInk = strings.ToUpper(entry.Alert.Status), colors.resolved, colors.darkBadgeText
+		}
+		canvas.fill(image.Rect(0, y-pad/2, 2*s, y+2*line), canvas.ink(statusFill))
+
+		x := canvas.badge(pad, y, statusText, statusFill, statusInk)
+		if entry.Severity != "" {
+			fill := colors.severity
+			if configured, ok := parseHexColor(entry.SeverityColor); ok {
+				fill = configured
+			}
+			x = canvas.badge(x, y, strings.ToUpper(entry.Severity), fill, colors.badgeText)
+		}
+		if entry.Refired {
+			x = canvas.badge(x, y, "RE-FIRED", color.RGBA{0x8b, 0x00, 0x00, 0xff}, colors.badgeText)
+		}
+		canvas.text(x, y, right, alertTitle(entry.Alert), canvas.ink(colors.text), s)
+
+		details := []string{"since " + timeFormat.Board(entry.Timestamp)}
+		if ack := entry.Acknowledgement; ack != nil && ack.By != "" {
+			details = append(details, "acknowledged by "+ack.By)
+		}
+		if summary := entry.Alert.Annotations["summary"]; summary != "" {
+			details = append(details, summary)
+		}
+		canvas.text(pad, y+line, right, strings.Join(details, " - "), canvas.ink(colors.muted), s)
+
+		y += rowHeight
+		canvas.fill(image.Rect(pad, y-pad/2-s/2, right, y-pad/2+(s+1)/2), canvas.ink(colors.rule))
+	}
+	if shown < len(alerts) {
+		canvas.text(pad, y, right, fmt.Sprintf("...and %d more on the board", len(alerts)-shown), canvas.ink(colors.muted), s)
+	}
+	return canvas.img
+}
+
+// snapshotHandler serves the board as a PNG image
+func snapshotHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		options, err := parseSnapshotOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		alerts := state.GetBoardAlerts()
+		if height := layoutSnapshot(len(alerts), options).height; options.Width*height > maxSnapshotPixels {
+			http.Error(w, fmt.Sprintf("Snapshot of %dx%d pixels too large, at most %d pixels: lower 'width', 'scale' or 'limit'", options.Width, height, maxSnapshotPixels), http.StatusBadRequest)
+			return
+		}
+		img := renderSnapshot(alerts, state.StatusLevel(), time.Now(), options)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(w, img); err != nil {
+			log.Errorf("Error encoding snapshot: %v", err)
+		}
+	}
+}
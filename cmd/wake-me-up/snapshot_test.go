@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk", "severity": "critical"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "CPU", "severity": "warning"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "Memory"}},
+	}})
+	handler := snapshotHandler(state)
+
+	get := func(query string) (*httptest.ResponseRecorder, image.Image) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot.png"+query, nil))
+		if rec.Code != http.StatusOK {
+			return rec, nil
+		}
+		img, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec, img
+	}
+
+	rec, img := get("?width=400&limit=2")
+	if rec.Header().Get("Content-Type") != "image/png" || img == nil {
+		t.Fatalf("Expected a PNG, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if img.Bounds().Dx() != 400 {
+		t.Errorf("Expected the requested width, got %d", img.Bounds().Dx())
+	}
+	if r, g, b, _ := img.At(1, 1).RGBA(); r>>8 != 0xff || g>>8 != 0x44 || b>>8 != 0x44 {
+		t.Errorf("Expected the header red with a critical alert unacknowledged, got %v", img.At(1, 1))
+	}
+	_, all := get("?width=400")
+	if all.Bounds().Dy() <= img.Bounds().Dy() {
+		t.Errorf("Expected a taller image with all alerts, got %d and %d", all.Bounds().Dy(), img.Bounds().Dy())
+	}
+
+	_, mono := get("?mono=true")
+	paletted, ok := mono.(*image.Paletted)
+	if !ok || len(paletted.Palette) != 2 {
+		t.Fatalf("Expected a black and white image, got %T", mono)
+	}
+	if r, g, b, _ := mono.At(1, 1).RGBA(); r|g|b != 0 {
+		t.Errorf("Expected the header black in mono, got %v", mono.At(1, 1))
+	}
+
+	for _, query := range []string{"?width=10", "?scale=0", "?limit=x", "?mono=maybe"} {
+		if rec, _ := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s rejected, got %d", query, rec.Code)
+		}
+	}
+
+	// Each limit alone is fine, together they would make a huge image
+	var many []Alert
+	for i := 0; i < 200; i++ {
+		many = append(many, Alert{Status: "firing", Labels: map[string]string{"alertname": fmt.Sprintf("Alert%d", i)}})
+	}
+	state.AddWebhook(WebhookPayload{Alerts: many})
+	if rec, _ := get("?width=3840&scale=4&limit=200"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a snapshot over the pixel limit rejected, got %d", rec.Code)
+	}
+	if rec, _ := get("?width=3840&scale=1&limit=20"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a snapshot within the pixel limit drawn, got %d", rec.Code)
+	}
+}
+
+func TestFitText(t *testing.T) {
+	if text := fitText("DiskFull on db-1", 10); text != "DiskFul..." {
+		t.Errorf("Expected the text cut with an ellipsis, got %q", text)
+	}
+	if text := fitText("Disk", 10); text != "Disk" {
+		t.Errorf("Expected short text kept, got %q", text)
+	}
+}
+
+func TestSnapshotBadgeWidth(t *testing.T) {
+	canvas := &snapshotCanvas{img: image.NewRGBA(image.Rect(0, 0, 200, 20)), scale: 1}
+	ascii := canvas.badge(0, 5, "prod", snapshotColors.severity, snapshotColors.badgeText)
+	if accented := canvas.badge(0, 5, "prød", snapshotColors.severity, snapshotColors.badgeText); accented != ascii {
+		t.Errorf("Expected badges as wide for as many characters, got %d and %d", accented, ascii)
+	}
+}
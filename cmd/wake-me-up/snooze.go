@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Snoozing acknowledges a firing alert for a while. When the snooze runs out
+// and the alert is still firing, it needs acknowledging again and the alarm
+// sounds again. Unlike a follow-up, which reminds through the notifiers, a
+// snooze brings the alert back on the board.
+
+const snoozesFile = "snoozes.json"
+
+// Snooze is a temporary acknowledgement of an alert
+type Snooze struct {
+	AlertID string    `json:"alertId"`
+	Until   time.Time `json:"until"`
+	Actor   string    `json:"actor,omitempty"`
+
+	UntilText string `json:"untilText,omitempty"` // formatted end, only set in updates
+
+	timer *time.Timer
+}
+
+var (
+	errNotFiring  = errors.New("alert not found or not firing")
+	errAlreadyAck = errors.New("alert already acknowledged")
+)
+
+// parseSnoozeDuration reads the duration of a snooze, e.g. 30m
+func parseSnoozeDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid 'duration' parameter, expected e.g. 30m: %q", value)
+	}
+	if duration <= 0 {
+		return 0, errors.New("snooze duration must be positive")
+	}
+	return duration, nil
+}
+
+// SnoozeAlert acknowledges a firing alert until the given time on behalf of
+// an actor, empty if unknown. With a version, it fails with
+// errVersionConflict if the board changed since the client saw it.
+func (a *AppState) SnoozeAlert(alertID string, until time.Time, version *uint64, actor string) error {
+	if err := a.snooze(alertID, until, version, actor); err != nil {
+		return err
+	}
+	a.cluster.publish(clusterOp{Type: clusterOpSnooze, IDs: []string{alertID}, Actor: actor, Until: &until})
+	return nil
+}
+
+// snooze snoozes an alert on this instance only, replacing any earlier snooze.
+// An alert acknowledged otherwise can't be snoozed, as the end of the snooze
+// would take its acknowledgement away.
+func (a *AppState) snooze(alertID string, until time.Time, version *uint64, actor string) error {
+	a.mu.Lock()
+	if err := a.checkVersion(version); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	entry, ok := a.alertByID(alertID)
+	if !ok || entry.Alert.Status != "firing" {
+		a.mu.Unlock()
+		return errNotFiring
+	}
+	if _, snoozed := a.snoozes[alertID]; !snoozed && a.acknowledged[alertID] != nil {
+		a.mu.Unlock()
+		return errAlreadyAck
+	}
+	if a.acknowledged[alertID] == nil {
+		a.recordAck(entry, time.Now(), actor)
+		a.acknowledged[alertID] = &Acknowledgement{By: actor, At: time.Now()}
+	}
+	a.setSnooze(&Snooze{AlertID: alertID, Until: until, Actor: actor})
+	a.escalationAlarm.disarm(alertID)
+	a.seq++
+	a.mu.Unlock()
+
+	a.saveSnoozes()
+	log.Infof("Alert %s snoozed until %s", alertID, timeFormat.Absolute(until))
+	a.broadcastUpdate()
+	return nil
+}
+
+// setSnooze stores a snooze and arms its timer
+// This should be called while holding the lock
+func (a *AppState) setSnooze(snooze *Snooze) {
+	a.cancelSnooze(snooze.AlertID)
+	a.snoozes[snooze.AlertID] = snooze
+	snooze.timer = time.AfterFunc(time.Until(snooze.Until), func() {
+		a.wakeSnoozed(snooze)
+	})
+}
+
+// cancelSnooze forgets the snooze of an alert, e.g. once it's acknowledged
+// for good, and reports whether there was one
+// This should be called while holding the lock
+func (a *AppState) cancelSnooze(alertID string) bool {
+	snooze, ok := a.snoozes[alertID]
+	if !ok {
+		return false
+	}
+	snooze.timer.Stop()
+	delete(a.snoozes, alertID)
+	return true
+}
+
+// wakeSnoozed ends a snooze: the alert is unacknowledged again if it's still
+// firing, and the dashboards chime
+func (a *AppState) wakeSnoozed(snooze *Snooze) {
+	a.mu.Lock()
+	// Only end the snooze this timer was armed for
+	if a.snoozes[snooze.AlertID] != snooze {
+		a.mu.Unlock()
+		return
+	}
+	delete(a.snoozes, snooze.AlertID)
+	entry, ok := a.alertByID(snooze.AlertID)
+	firing := ok && entry.Alert.Status == "firing"
+	if firing {
+		delete(a.acknowledged, snooze.AlertID)
+		a.escalationAlarm.rearm(snooze.AlertID)
+	}
+	a.seq++
+	a.mu.Unlock()
+
+	a.saveSnoozes()
+	a.broadcastUpdate()
+	if !firing {
+		log.Infof("Snooze of alert %s ended, the alert is no longer firing", snooze.AlertID)
+		return
+	}
+	log.Infof("Snooze of alert %s ended, the alert needs acknowledging again", snooze.AlertID)
+	a.chime()
+}
+
+// snoozeList returns copies of the pending snoozes by alert ID
+// This should be called while holding the lock
+func (a *AppState) snoozeList() map[string]Snooze {
+	snoozes := make(map[string]Snooze, len(a.snoozes))
+	for id, snooze := range a.snoozes {
+		copied := *snooze
+		copied.timer = nil
+		snoozes[id] = copied
+	}
+	return snoozes
+}
+
+// GetSnooze returns a copy of the snooze of an alert, or nil if none is set
+func (a *AppState) GetSnooze(alertID string) *Snooze {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	snooze, ok := a.snoozes[alertID]
+	if !ok {
+		return nil
+	}
+	copied := *snooze
+	copied.timer = nil
+	copied.UntilText = timeFormat.Board(copied.Until)
+	return &copied
+}
+
+// saveSnoozes persists the pending snoozes to the data directory
+func (a *AppState) saveSnoozes() {
+	path := a.dataFilePath(snoozesFile)
+	if path == "" {
+		return
+	}
+	a.mu.RLock()
+	snoozes := make([]Snooze, 0, len(a.snoozes))
+	for _, snooze := range a.snoozeList() {
+		snoozes = append(snoozes, snooze)
+	}
+	a.mu.RUnlock()
+	if err := saveJSON(path, snoozes); err != nil {
+		log.Errorf("Failed to persist snoozes: %v", err)
+	}
+}
+
+// LoadSnoozes restores the pending snoozes. It's called after the board is
+// restored; snoozes that ran out while the server was down end right away.
+func (a *AppState) LoadSnoozes() error {
+	path := a.dataFilePath(snoozesFile)
+	if path == "" {
+		return nil
+	}
+
+	var snoozes []Snooze
+	if _, err := loadJSON(path, &snoozes); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	for i := range snoozes {
+		a.setSnooze(&snoozes[i])
+	}
+	a.mu.Unlock()
+	if len(snoozes) > 0 {
+		log.Infof("Restored %d snoozes", len(snoozes))
+	}
+	return nil
+}
+
+// snoozeHandler snoozes a firing alert for a duration
+func snoozeHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		alertID := r.URL.Query().Get("id")
+		if alertID == "" {
+			http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+			return
+		}
+		duration, err := parseSnoozeDuration(r.URL.Query().Get("duration"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, err := parseIfVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		until := time.Now().Add(duration)
+		if err := state.SnoozeAlert(alertID, until, version, requestActor(r, "")); err != nil {
+			status := http.StatusConflict // also errAlreadyAck
+			if errors.Is(err, errNotFiring) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		audit.RecordRequest(r, AuditSnooze, 3, "Alert snoozed", map[string]string{"alertId": alertID, "duration": duration.String(), "until": until.Format(time.RFC3339)})
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnoozeEnds(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+	}})
+	alerts := state.GetAlerts()
+	snoozed, acked := alerts[0].ID, alerts[1].ID
+
+	if err := state.SnoozeAlert("unknown", time.Now().Add(time.Hour), nil, ""); !errors.Is(err, errNotFiring) {
+		t.Fatalf("Expected unknown alerts refused, got %v", err)
+	}
+	for _, id := range []string{snoozed, acked} {
+		if err := state.SnoozeAlert(id, time.Now().Add(50*time.Millisecond), nil, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !state.IsAcknowledged(snoozed) || state.GetSnooze(snoozed) == nil {
+		t.Fatal("Expected the snoozed alert acknowledged")
+	}
+	// Acknowledging for good ends the snooze
+	state.Acknowledge(acked, "")
+	if state.GetSnooze(acked) != nil {
+		t.Fatal("Expected the snooze cancelled by the acknowledgement")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if state.IsAcknowledged(snoozed) || state.GetSnooze(snoozed) != nil {
+		t.Error("Expected the alert unacknowledged once the snooze ended")
+	}
+	if !state.IsAcknowledged(acked) {
+		t.Error("Expected the acknowledged alert to stay acknowledged")
+	}
+}
+
+func TestSnoozeAcknowledgedRefused(t *testing.T) {
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+		{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+	}})
+	alerts := state.GetAlerts()
+	id, other := alerts[0].ID, alerts[1].ID
+
+	state.Acknowledge(id, "")
+	if err := state.SnoozeAlert(id, time.Now().Add(50*time.Millisecond), nil, "alice"); !errors.Is(err, errAlreadyAck) {
+		t.Fatalf("Expected snoozing an acknowledged alert refused, got %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !state.IsAcknowledged(id) {
+		t.Error("Expected the acknowledgement kept")
+	}
+
+	// A snoozed alert can be snoozed again
+	for i := 0; i < 2; i++ {
+		if err := state.SnoozeAlert(other, time.Now().Add(time.Hour), nil, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultServerSoundInterval = 30 * time.Second
+
+// serverSound plays the alarm on the machine running the server, for setups
+// where the host itself (e.g. a Raspberry Pi with a speaker) is the alarm
+type serverSound struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex // serializes playback so plays never overlap
+	playing bool
+}
+
+func newServerSound(path string, interval time.Duration) (*serverSound, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultServerSoundInterval
+	}
+	return &serverSound{path: abs, interval: interval}, nil
+}
+
+// run plays the sound every interval while the board has unacknowledged alerts
+func (s *serverSound) run(state *AppState) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if state.StatusLevel() != StatusLevelOK {
+			s.play()
+		}
+	}
+}
+
+// play starts playback in the background unless a previous play is still running
+func (s *serverSound) play() {
+	s.mu.Lock()
+	if s.playing {
+		s.mu.Unlock()
+		return
+	}
+	s.playing = true
+	s.mu.Unlock()
+
+	go func() {
+		if err := playSound(s.path); err != nil {
+			log.Errorf("Failed to play sound on server: %v", err)
+		}
+		s.mu.Lock()
+		s.playing = false
+		s.mu.Unlock()
+	}()
+}
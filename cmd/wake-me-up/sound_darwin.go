@@ -0,0 +1,10 @@
+//go:build darwin
+
+package main
+
+import "os/exec"
+
+// playSound plays a sound file with the built-in afplay and waits for it to end
+func playSound(path string) error {
+	return exec.Command("afplay", path).Run()
+}
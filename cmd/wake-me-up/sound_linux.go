@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// linuxPlayers are tried in order: PulseAudio/PipeWire first, then plain ALSA
+var linuxPlayers = []string{"paplay", "aplay"}
+
+// playSound plays a sound file with the first available player and waits for it to end
+func playSound(path string) error {
+	for _, player := range linuxPlayers {
+		if _, err := exec.LookPath(player); err != nil {
+			continue
+		}
+		return exec.Command(player, path).Run()
+	}
+	return fmt.Errorf("no sound player found (tried %v)", linuxPlayers)
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// playSound is not supported on this platform
+func playSound(path string) error {
+	return fmt.Errorf("server-side sound playback is not supported on %s", runtime.GOOS)
+}
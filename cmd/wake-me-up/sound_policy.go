@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sound actions, from quietest to loudest
+const (
+	SoundStop     = "stop"
+	SoundPlayOnce = "play_once"
+	SoundLoop     = "loop"
+)
+
+const (
+	defaultSoundLoopInterval  = 2 * time.Second
+	defaultSoundStormInterval = 30 * time.Second
+)
+
+var soundActionRank = map[string]int{SoundStop: 0, SoundPlayOnce: 1, SoundLoop: 2}
+
+// SoundPolicyConfig decides centrally how browsers sound the alarm, so all
+// clients behave the same
+type SoundPolicyConfig struct {
+	Severities     map[string]string `yaml:"severities"`      // Action per severity label: loop, play_once or stop (optional, default: loop)
+	LoopInterval   time.Duration     `yaml:"loop_interval"`   // Pause between plays while looping (optional, default: 2s)
+	QuietHours     *QuietHoursConfig `yaml:"quiet_hours"`     // Quieter alarm at night for non-critical alerts (optional)
+	StormThreshold int               `yaml:"storm_threshold"` // Loop slower from this many unacknowledged alerts (optional, default: off)
+	StormInterval  time.Duration     `yaml:"storm_interval"`  // Pause between plays during a storm (optional, default: 30s)
+}
+
+// QuietHoursConfig is a daily time range in the configured time_zone, which
+// may span midnight, e.g. 22:00 to 07:00
+type QuietHoursConfig struct {
+	Start  string `yaml:"start"`  // e.g. 22:00
+	End    string `yaml:"end"`    // e.g. 07:00
+	Action string `yaml:"action"` // The loudest action for non-critical alerts (optional, default: play_once)
+}
+
+// SoundDirective tells the browsers what to do with the alarm
+type SoundDirective struct {
+	Action   string `json:"action"`             // loop, play_once or stop
+	Interval int    `json:"interval,omitempty"` // seconds between plays when looping
+	Variant  string `json:"variant,omitempty"`  // sound variant to play, e.g. refired
+	Severity string `json:"severity,omitempty"` // severity of the most severe sounding alert, picks its sound
+	Key      string `json:"key,omitempty"`      // changes with each new alert, play_once plays once per key
+	Reason   string `json:"reason,omitempty"`   // why the alarm is quieter than a loop, e.g. quiet_hours
+}
+
+// soundPolicy is a parsed SoundPolicyConfig
+type soundPolicy struct {
+	severities     map[string]string
+	loopInterval   time.Duration
+	quiet          bool
+	quietStart     time.Duration // since midnight
+	quietEnd       time.Duration
+	quietAction    string
+	stormThreshold int
+	stormInterval  time.Duration
+}
+
+// currentSoundPolicy is the policy configured at startup
+var currentSoundPolicy = &soundPolicy{loopInterval: defaultSoundLoopInterval}
+
+// setSoundPolicy applies the sound_policy config
+func setSoundPolicy(config *SoundPolicyConfig) error {
+	policy := &soundPolicy{loopInterval: defaultSoundLoopInterval, stormInterval: defaultSoundStormInterval}
+	if config == nil {
+		currentSoundPolicy = policy
+		return nil
+	}
+
+	policy.severities = make(map[string]string, len(config.Severities))
+	for severity, action := range config.Severities {
+		if _, ok := soundActionRank[action]; !ok {
+			return fmt.Errorf("severities.%s: unknown action %q, expected loop, play_once or stop", severity, action)
+		}
+		policy.severities[strings.ToLower(strings.TrimSpace(severity))] = action
+	}
+	if config.LoopInterval > 0 {
+		policy.loopInterval = config.LoopInterval
+	}
+	if config.StormInterval > 0 {
+		policy.stormInterval = config.StormInterval
+	}
+	policy.stormThreshold = config.StormThreshold
+
+	if quiet := config.QuietHours; quiet != nil {
+		var err error
+		if policy.quietStart, err = parseTimeOfDay(quiet.Start); err != nil {
+			return fmt.Errorf("quiet_hours.start: %v", err)
+		}
+		if policy.quietEnd, err = parseTimeOfDay(quiet.End); err != nil {
+			return fmt.Errorf("quiet_hours.end: %v", err)
+		}
+		policy.quiet = true
+		policy.quietAction = quiet.Action
+		if policy.quietAction == "" {
+			policy.quietAction = SoundPlayOnce
+		}
+		if _, ok := soundActionRank[policy.quietAction]; !ok {
+			return fmt.Errorf("quiet_hours.action: unknown action %q, expected loop, play_once or stop", quiet.Action)
+		}
+	}
+	currentSoundPolicy = policy
+	return nil
+}
+
+// parseTimeOfDay parses a time like 22:00 to the duration since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected a time like 22:00, got %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// inQuietHours tells if a time falls in the quiet hours
+func (p *soundPolicy) inQuietHours(now time.Time) bool {
+	if !p.quiet {
+		return false
+	}
+	local := now.In(timeFormat.location)
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if p.quietStart <= p.quietEnd {
+		return sinceMidnight >= p.quietStart && sinceMidnight < p.quietEnd
+	}
+	return sinceMidnight >= p.quietStart || sinceMidnight < p.quietEnd
+}
+
+// action returns the action for an alert needing acknowledgement
+func (p *soundPolicy) action(alert Alert, quiet bool) string {
+	action, ok := p.severities[alertSeverity(alert)]
+	if !ok {
+		action = SoundLoop
+	}
+	if quiet && severityLevel(alertSeverity(alert)) != StatusLevelCritical && soundActionRank[action] > soundActionRank[p.quietAction] {
+		action = p.quietAction
+	}
+	return action
+}
+
+// soundDirective computes what the browsers do with the alarm from the
+// alerts needing acknowledgement. Snoozed alerts count as acknowledged until
+// wakeSnoozed drops the acknowledgement of those still firing at the end of
+// the snooze; acknowledging one ends its snooze and keeps it silent.
+// This should be called while holding the lock
+func (a *AppState) soundDirective(now time.Time) *SoundDirective {
+	policy := currentSoundPolicy
+	quiet := policy.inQuietHours(now)
+
+	directive := &SoundDirective{Action: SoundStop}
+	unacknowledged, quieted := 0, false
+	var newest, severityAt time.Time
+	severityCritical := false
+	for _, entry := range a.alerts {
+		if !needsAck(entry.Alert.Status, a.acknowledged[entry.ID] != nil) {
+			continue
+		}
+		unacknowledged++
+		action := policy.action(entry.Alert, quiet)
+		if action != policy.action(entry.Alert, false) {
+			quieted = true
+		}
+		if action == SoundStop {
+			continue
+		}
+		if soundActionRank[action] > soundActionRank[directive.Action] {
+			directive.Action = action
+		}
+		if entry.Refired && entry.Alert.Status == "firing" {
+			directive.Variant = soundVariantRefired
+		}
+		if !entry.Timestamp.Before(newest) {
+			newest = entry.Timestamp
+			directive.Key = entry.ID
+		}
+		// Critical alerts keep their sound over newer ones of lower severity
+		severity := alertSeverity(entry.Alert)
+		critical := severityLevel(severity) == StatusLevelCritical
+		if critical && !severityCritical || critical == severityCritical && !entry.Timestamp.Before(severityAt) {
+			directive.Severity, severityCritical, severityAt = severity, critical, entry.Timestamp
+		}
+	}
+
+	switch {
+	case directive.Action == SoundLoop && policy.stormThreshold > 0 && unacknowledged >= policy.stormThreshold:
+		directive.Interval = int(policy.stormInterval.Seconds())
+		directive.Reason = "storm"
+	case directive.Action == SoundLoop:
+		directive.Interval = int(policy.loopInterval.Seconds())
+	case quieted:
+		directive.Reason = "quiet_hours"
+	}
+	if directive.Action == SoundStop {
+		directive.Variant, directive.Key, directive.Severity = "", "", ""
+	}
+	return directive
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSoundDirective(t *testing.T) {
+	err := setSoundPolicy(&SoundPolicyConfig{
+		Severities:     map[string]string{"info": SoundStop},
+		QuietHours:     &QuietHoursConfig{Start: "22:00", End: "07:00"},
+		StormThreshold: 3,
+		StormInterval:  time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setSoundPolicy(nil)
+
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, timeFormat.location)
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, timeFormat.location)
+	state := NewAppState(100)
+	add := func(id, severity string) {
+		state.alerts = append(state.alerts, AlertEntry{ID: id, Timestamp: day.Add(time.Duration(len(state.alerts)) * time.Second), Alert: Alert{
+			Status: "firing",
+			Labels: map[string]string{"alertname": id, "severity": severity},
+		}})
+	}
+
+	check := func(now time.Time, want SoundDirective) {
+		t.Helper()
+		if got := *state.soundDirective(now); got != want {
+			t.Fatalf("Got %+v, want %+v", got, want)
+		}
+	}
+
+	check(day, SoundDirective{Action: SoundStop})
+	add("info", "info")
+	check(day, SoundDirective{Action: SoundStop})
+
+	add("warning", "warning")
+	check(day, SoundDirective{Action: SoundLoop, Interval: 2, Key: "warning", Severity: "warning"})
+	check(night, SoundDirective{Action: SoundPlayOnce, Key: "warning", Severity: "warning", Reason: "quiet_hours"})
+
+	// Critical alerts are not quieted, and many unacknowledged alerts loop slower
+	add("critical", "critical")
+	check(night, SoundDirective{Action: SoundLoop, Interval: 60, Key: "critical", Severity: "critical", Reason: "storm"})
+
+	// A newer alert of lower severity doesn't take the critical sound over
+	add("warning2", "warning")
+	check(day, SoundDirective{Action: SoundLoop, Interval: 60, Key: "warning2", Severity: "critical", Reason: "storm"})
+
+	state.acknowledged["critical"] = &Acknowledgement{}
+	state.acknowledged["warning"] = &Acknowledgement{}
+	state.acknowledged["warning2"] = &Acknowledgement{}
+	check(day, SoundDirective{Action: SoundStop})
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// playSound plays a WAV file through .NET's Media.SoundPlayer and waits for it to end
+func playSound(path string) error {
+	quoted := "'" + strings.ReplaceAll(path, "'", "''") + "'"
+	script := "(New-Object Media.SoundPlayer " + quoted + ").PlaySync()"
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Run()
+}
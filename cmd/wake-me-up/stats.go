@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acknowledgement statistics, for on-call load balancing discussions: who
+// acknowledged how many alerts and how fast, and whose alerts went
+// unacknowledged until escalation. They are computed from the history, so
+// they cover history_retention at most.
+
+const (
+	defaultTeamLabel   = "team"
+	defaultStatsPeriod = 7 * 24 * time.Hour
+
+	unknownActor = "unknown" // acknowledged without an actor_header
+	noTeam       = "(none)"  // alerts without the team label
+)
+
+// StatsConfig sets how acknowledgements are attributed
+type StatsConfig struct {
+	TeamLabel   string `yaml:"team_label"`   // Label naming the team of an alert (optional, default: team)
+	ActorHeader string `yaml:"actor_header"` // Header naming who acknowledges, set by an authenticating proxy in trusted_proxies, e.g. X-Forwarded-User (optional)
+}
+
+var (
+	statsTeamLabel = defaultTeamLabel
+	actorHeader    string
+)
+
+// setStats applies the stats settings
+func setStats(config *StatsConfig) {
+	if config == nil {
+		return
+	}
+	if config.TeamLabel != "" {
+		statsTeamLabel = config.TeamLabel
+	}
+	actorHeader = config.ActorHeader
+}
+
+// requestActor returns who made a request as told by a trusted
+// authenticating proxy or by basic auth, or the fallback
+func requestActor(r *http.Request, fallback string) string {
+	if actorHeader != "" && isTrustedProxy(remoteIP(r)) {
+		if actor := strings.TrimSpace(r.Header.Get(actorHeader)); actor != "" {
+			return actor
+		}
+	}
+	if user, ok := basicAuthUser(r); ok {
+		return user
+	}
+	return fallback
+}
+
+// StatsRow is the acknowledgement statistics of an actor or a team
+type StatsRow struct {
+	Name               string  `json:"name"`
+	Acks               int     `json:"acks"`
+	AvgResponseSeconds float64 `json:"avgResponseSeconds"` // from receiving an alert to acknowledging it
+	Escalated          int     `json:"escalated"`          // of an actor, acknowledged after escalation; of a team, alerts escalated
+
+	responseTotal time.Duration
+	timed         int // acknowledgements with a known response time
+}
+
+// AvgResponse returns the average response time for display
+func (r StatsRow) AvgResponse() string {
+	if r.timed == 0 {
+		return "-"
+	}
+	return (r.responseTotal / time.Duration(r.timed)).Round(time.Second).String()
+}
+
+// AckStats breaks acknowledgements down per actor and per team
+type AckStats struct {
+	Since     time.Time  `json:"since"`
+	Until     time.Time  `json:"until"`
+	TeamLabel string     `json:"teamLabel"`
+	Actors    []StatsRow `json:"actors"`
+	Teams     []StatsRow `json:"teams"`
+}
+
+// AckStats computes the statistics of a period from the history
+func (a *AppState) AckStats(since, until time.Time) AckStats {
+	events := a.history.Query(historyQuery{Since: since, Until: until, Limit: math.MaxInt})
+	// Oldest first, so escalations are seen before the acknowledgements
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	stats := computeAckStats(events, statsTeamLabel)
+	stats.Since, stats.Until = since, until
+	return stats
+}
+
+// computeAckStats tallies events, oldest first. Automatic acknowledgements,
+// e.g. by incidents, aren't anyone's work and are left out.
+func computeAckStats(events []HistoryEvent, teamLabel string) AckStats {
+	actors := make(map[string]*StatsRow)
+	teams := make(map[string]*StatsRow)
+	row := func(rows map[string]*StatsRow, name string) *StatsRow {
+		if rows[name] == nil {
+			rows[name] = &StatsRow{Name: name}
+		}
+		return rows[name]
+	}
+	escalated := make(map[string]bool)
+
+	for _, event := range events {
+		team := event.Labels[teamLabel]
+		if team == "" {
+			team = noTeam
+		}
+		switch event.Type {
+		case HistoryEscalated:
+			if !escalated[event.AlertID] {
+				escalated[event.AlertID] = true
+				row(teams, team).Escalated++
+			}
+		case HistoryAcknowledged:
+			if event.Actor == actorAutomatic {
+				continue
+			}
+			actor := event.Actor
+			if actor == "" {
+				actor = unknownActor
+			}
+			for _, r := range []*StatsRow{row(actors, actor), row(teams, team)} {
+				r.Acks++
+				if event.ReceivedAt != nil {
+					r.responseTotal += event.Time.Sub(*event.ReceivedAt)
+					r.timed++
+				}
+			}
+			if escalated[event.AlertID] {
+				row(actors, actor).Escalated++
+			}
+		}
+	}
+	return AckStats{TeamLabel: teamLabel, Actors: sortedStatsRows(actors), Teams: sortedStatsRows(teams)}
+}
+
+// sortedStatsRows returns the rows with averages, the busiest first
+func sortedStatsRows(rows map[string]*StatsRow) []StatsRow {
+	result := make([]StatsRow, 0, len(rows))
+	for _, r := range rows {
+		if r.timed > 0 {
+			r.AvgResponseSeconds = math.Round((r.responseTotal / time.Duration(r.timed)).Seconds())
+		}
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Acks != result[j].Acks {
+			return result[i].Acks > result[j].Acks
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// writeCSV writes the statistics as CSV, the actors first, then the teams
+func (s AckStats) writeCSV(w http.ResponseWriter) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"breakdown", "name", "acks", "avg_response_seconds", "escalated"})
+	for _, part := range []struct {
+		name string
+		rows []StatsRow
+	}{{"actor", s.Actors}, {"team", s.Teams}} {
+		for _, r := range part.rows {
+			out.Write([]string{part.name, r.Name, strconv.Itoa(r.Acks), strconv.FormatFloat(r.AvgResponseSeconds, 'f', 0, 64), strconv.Itoa(r.Escalated)})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// parseStatsPeriod reads the 'since' and 'until' parameters. Since is a time
+// (RFC 3339) or a duration back from now, 168h by default.
+func parseStatsPeriod(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now()
+	since, until := now.Add(-defaultStatsPeriod), now
+	if value := r.URL.Query().Get("since"); value != "" {
+		if period, err := time.ParseDuration(value); err == nil && period > 0 {
+			since = now.Add(-period)
+		} else if since, err = time.Parse(time.RFC3339, value); err != nil {
+			return since, until, fmt.Errorf("invalid 'since' parameter, expected a duration or RFC 3339 time: %q", value)
+		}
+	}
+	if value := r.URL.Query().Get("until"); value != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			return since, until, fmt.Errorf("invalid 'until' parameter: %v", err)
+		}
+	}
+	return since, until, nil
+}
+
+// statsHandler returns the acknowledgement statistics as JSON, or as CSV
+// with format=csv
+func statsHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		since, until, err := parseStatsPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stats := state.AckStats(since, until)
+
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ack-stats-%s.csv"`, until.Format("2006-01-02")))
+			if err := stats.writeCSV(w); err != nil {
+				log.Errorf("Error writing stats CSV: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			log.Errorf("Error encoding stats: %v", err)
+		}
+	}
+}
+
+// StatsTemplateData is the data of the stats page
+type StatsTemplateData struct {
+	AckStats
+	CSVURL   string        // of the same period
+	Timeline BoardTimeline // the board over the days of the period
+}
+
+// statsPageHandler shows the acknowledgement statistics
+func statsPageHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, until, err := parseStatsPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		csvURL := "/api/v1/stats?format=csv"
+		if r.URL.RawQuery != "" {
+			csvURL += "&" + r.URL.RawQuery
+		}
+		w.Header().Set("Content-Type", "text/html")
+		days := min(max(int(math.Ceil(until.Sub(since).Hours()/24)), 1), maxTimelineDays)
+		data := StatsTemplateData{
+			AckStats: state.AckStats(since, until),
+			CSVURL:   csvURL,
+			Timeline: state.timeline.Summary(timelineSince(days, until), until),
+		}
+		if err := state.templates.Execute(w, "stats.html", data); err != nil {
+			log.Errorf("Error executing template: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeAckStats(t *testing.T) {
+	start := time.Now()
+	event := func(eventType, alertID, team, actor string, after time.Duration) HistoryEvent {
+		event := HistoryEvent{Time: start.Add(after), Type: eventType, AlertID: alertID, Labels: map[string]string{"team": team}, Actor: actor}
+		if eventType != HistoryReceived {
+			event.ReceivedAt = &start
+		}
+		return event
+	}
+	events := []HistoryEvent{
+		event(HistoryReceived, "a", "db", "", 0),
+		event(HistoryAcknowledged, "a", "db", "alice", time.Minute),
+		event(HistoryEscalated, "b", "db", "", 10*time.Minute),
+		event(HistoryEscalated, "b", "db", "", 20*time.Minute), // by a second rule
+		event(HistoryAcknowledged, "b", "db", "bob", 30*time.Minute),
+		event(HistoryAcknowledged, "c", "", "alice", 3*time.Minute),
+		event(HistoryAcknowledged, "d", "web", "", 5*time.Minute),
+		event(HistoryAcknowledged, "e", "web", actorAutomatic, 0),
+		event(HistoryEscalated, "f", "web", "", 10*time.Minute),
+	}
+
+	stats := computeAckStats(events, "team")
+	wantActors := []StatsRow{
+		{Name: "alice", Acks: 2, AvgResponseSeconds: 120},
+		{Name: "bob", Acks: 1, AvgResponseSeconds: 1800, Escalated: 1},
+		{Name: unknownActor, Acks: 1, AvgResponseSeconds: 300},
+	}
+	wantTeams := []StatsRow{
+		{Name: "db", Acks: 2, AvgResponseSeconds: 930, Escalated: 1},
+		{Name: noTeam, Acks: 1, AvgResponseSeconds: 180},
+		{Name: "web", Acks: 1, AvgResponseSeconds: 300, Escalated: 1},
+	}
+	strip := func(rows []StatsRow) []StatsRow {
+		for i := range rows {
+			rows[i].responseTotal, rows[i].timed = 0, 0
+		}
+		return rows
+	}
+	if got := strip(stats.Actors); !reflect.DeepEqual(got, wantActors) {
+		t.Errorf("Expected actors %+v, got %+v", wantActors, got)
+	}
+	if got := strip(stats.Teams); !reflect.DeepEqual(got, wantTeams) {
+		t.Errorf("Expected teams %+v, got %+v", wantTeams, got)
+	}
+}
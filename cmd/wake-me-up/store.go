@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage backends of the board
+const (
+	StorageMemory = "memory" // the board is lost on restart
+	StorageSQLite = "sqlite"
+	StorageBolt   = "bolt"
+)
+
+// How long a failed save waits before it is tried again
+const persistRetryDelay = 5 * time.Second
+
+// StoredBoard is the part of the board that survives a restart
+type StoredBoard struct {
+	Alerts       []AlertEntry                // oldest first
+	Acknowledged map[string]*Acknowledgement // alert ID -> who acknowledged it
+}
+
+// Store persists the board between restarts
+type Store interface {
+	Load() (StoredBoard, error)
+	Save(board StoredBoard) error
+	Close() error
+}
+
+// storeBackend is a storage backend that keeps the board in a file
+type storeBackend struct {
+	defaultFile string // in data_dir, unless storage_path is set
+	open        func(path string) (Store, error)
+}
+
+// storeBackends are the storage backends by name. A backend only needs to
+// implement Store and add itself here.
+var storeBackends = map[string]storeBackend{
+	StorageSQLite: {defaultSQLiteFile, func(path string) (Store, error) { return openSQLiteStore(path) }},
+	StorageBolt:   {defaultBoltFile, func(path string) (Store, error) { return openBoltStore(path) }},
+}
+
+// openStore opens the configured storage backend and returns it with its
+// file, or nil for the in-memory board
+func openStore(config *Config) (Store, string, error) {
+	if config.Cluster != nil && config.Storage != StorageRedis {
+		return nil, "", fmt.Errorf("the instances of a cluster share the board in redis, got storage %q", config.Storage)
+	}
+	if config.Storage == "" || config.Storage == StorageMemory {
+		return nil, "", nil
+	}
+	if config.Storage == StorageRedis {
+		store, err := openRedisStore(config.Cluster)
+		if err != nil {
+			return nil, "", err
+		}
+		return store, store.key, nil
+	}
+	backend, ok := storeBackends[config.Storage]
+	if !ok {
+		names := []string{StorageMemory, StorageRedis}
+		for name := range storeBackends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, "", fmt.Errorf("storage must be one of %s, got %q", strings.Join(names, ", "), config.Storage)
+	}
+	path := config.StoragePath
+	if path == "" {
+		path = filepath.Join(config.DataDir, backend.defaultFile)
+	}
+	store, err := backend.open(path)
+	return store, path, err
+}
+
+// boardPersister saves board snapshots in the background, so a slow disk
+// never holds up webhooks. Snapshots queued while a save is running are
+// coalesced into the latest one.
+type boardPersister struct {
+	store Store
+
+	mu      sync.Mutex
+	pending *StoredBoard
+	signal  chan struct{}
+	syncs   chan chan struct{}
+}
+
+func newBoardPersister(store Store) *boardPersister {
+	p := &boardPersister{store: store, signal: make(chan struct{}, 1), syncs: make(chan chan struct{})}
+	go p.run()
+	return p
+}
+
+// queue schedules a snapshot to be saved
+func (p *boardPersister) queue(board StoredBoard) {
+	p.mu.Lock()
+	p.pending = &board
+	p.mu.Unlock()
+	p.wake()
+}
+
+func (p *boardPersister) run() {
+	for {
+		select {
+		case <-p.signal:
+			p.savePending()
+		case done := <-p.syncs:
+			p.savePending()
+			close(done)
+		}
+	}
+}
+
+// savePending saves the latest queued snapshot, if any
+func (p *boardPersister) savePending() {
+	p.mu.Lock()
+	board := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if board == nil {
+		return
+	}
+	if err := p.save(*board); err != nil {
+		log.Errorf("Failed to persist alerts, retrying in %s: %v", persistRetryDelay, err)
+		p.retry(board)
+	}
+}
+
+// Sync saves a snapshot and waits until it is written or the context ends
+func (p *boardPersister) Sync(ctx context.Context, board StoredBoard) {
+	p.mu.Lock()
+	p.pending = &board
+	p.mu.Unlock()
+	done := make(chan struct{})
+	select {
+	case p.syncs <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (p *boardPersister) save(board StoredBoard) error {
+	if err := chaos.storageError(); err != nil {
+		return err
+	}
+	return p.store.Save(board)
+}
+
+// retry saves a snapshot that failed again later, unless a newer one was
+// queued meanwhile
+func (p *boardPersister) retry(board *StoredBoard) {
+	p.mu.Lock()
+	if p.pending == nil {
+		p.pending = board
+	}
+	p.mu.Unlock()
+	time.AfterFunc(persistRetryDelay, p.wake)
+}
+
+func (p *boardPersister) wake() {
+	select {
+	case p.signal <- struct{}{}:
+	default:
+	}
+}
+
+// storedBoard copies the board for the store
+// This should be called while holding the lock
+func (a *AppState) storedBoard() StoredBoard {
+	board := StoredBoard{
+		Alerts:       append([]AlertEntry(nil), a.alerts...),
+		Acknowledged: make(map[string]*Acknowledgement, len(a.acknowledged)),
+	}
+	for id, ack := range a.acknowledged {
+		board.Acknowledged[id] = ack
+	}
+	return board
+}
+
+// RestoreBoard puts back the alerts saved before a restart
+func (a *AppState) RestoreBoard(board StoredBoard) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range board.Alerts {
+		entry.fingerprint = labelFingerprint(entry.Alert.Labels)
+		a.alerts = append(a.alerts, entry)
+		a.search.add(entry.ID, a.searchFields(entry))
+	}
+	for id, ack := range board.Acknowledged {
+		a.acknowledged[id] = ack
+	}
+	if excess := len(a.alerts) - a.maxSize; excess > 0 {
+		for _, evicted := range a.alerts[:excess] {
+			delete(a.acknowledged, evicted.ID)
+			a.search.remove(evicted.ID)
+		}
+		a.alerts = a.alerts[excess:]
+	}
+	a.seq++
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultBoltFile = "alerts.bolt"
+
+// Bucket of the board, keyed by position so a cursor reads it oldest first
+var boltAlertsBucket = []byte("alerts")
+
+// boltRecord is the value of an alert in the bucket
+type boltRecord struct {
+	Entry           AlertEntry       `json:"entry"`
+	Acknowledged    bool             `json:"acknowledged"`
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"` // missing in files of older releases
+}
+
+// boltStore keeps the board in a bbolt file, a pure Go key-value store
+// without the SQL layer
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	// bbolt locks the file; fail rather than hang if another instance holds it
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltAlertsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+// Load reads the saved board, oldest alert first
+func (s *boltStore) Load() (StoredBoard, error) {
+	board := StoredBoard{Acknowledged: make(map[string]*Acknowledgement)}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAlertsBucket).ForEach(func(key, value []byte) error {
+			var record boltRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("alert at position %d: %v", binary.BigEndian.Uint64(key), err)
+			}
+			board.Alerts = append(board.Alerts, record.Entry)
+			if record.Acknowledgement != nil {
+				board.Acknowledged[record.Entry.ID] = record.Acknowledgement
+			} else if record.Acknowledged {
+				board.Acknowledged[record.Entry.ID] = &Acknowledgement{}
+			}
+			return nil
+		})
+	})
+	return board, err
+}
+
+// Save replaces the saved board in a single transaction
+func (s *boltStore) Save(board StoredBoard) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltAlertsBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(boltAlertsBucket)
+		if err != nil {
+			return err
+		}
+		for i, entry := range board.Alerts {
+			ack := board.Acknowledged[entry.ID]
+			value, err := json.Marshal(boltRecord{Entry: entry, Acknowledged: ack != nil, Acknowledgement: ack})
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, uint64(i))
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
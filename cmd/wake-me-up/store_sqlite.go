@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, the image is built without cgo
+)
+
+const defaultSQLiteFile = "alerts.db"
+
+// Version of the SQLite schema, kept in PRAGMA user_version
+const sqliteSchemaVersion = 6
+
+// sqliteMigrations upgrade a database from the schema version before the
+// index to the next one
+var sqliteMigrations = []string{
+	1: "ALTER TABLE alerts ADD COLUMN refired INTEGER NOT NULL DEFAULT 0",
+	2: "ALTER TABLE alerts ADD COLUMN annotations TEXT NOT NULL DEFAULT '{}'",
+	3: "ALTER TABLE alerts ADD COLUMN acknowledgement TEXT NOT NULL DEFAULT ''",
+	4: "ALTER TABLE alerts ADD COLUMN rule TEXT NOT NULL DEFAULT ''",
+	5: "ALTER TABLE alerts ADD COLUMN replicas TEXT NOT NULL DEFAULT '[]'",
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS alerts (
+	id            TEXT PRIMARY KEY,
+	position      INTEGER NOT NULL,
+	received_at   TEXT NOT NULL,
+	status        TEXT NOT NULL,
+	labels        TEXT NOT NULL,
+	annotations   TEXT NOT NULL DEFAULT '{}',
+	starts_at     TEXT NOT NULL,
+	ends_at       TEXT,
+	generator_url TEXT NOT NULL,
+	incident_id   TEXT NOT NULL,
+	receiver      TEXT NOT NULL,
+	external_url  TEXT NOT NULL,
+	acknowledged  INTEGER NOT NULL,
+	refired       INTEGER NOT NULL DEFAULT 0,
+	acknowledgement TEXT NOT NULL DEFAULT '',
+	rule          TEXT NOT NULL DEFAULT '',
+	replicas      TEXT NOT NULL DEFAULT '[]'
+)`
+
+// sqliteStore keeps the board in a SQLite database file
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes writers, which SQLite does anyway
+	db.SetMaxOpenConns(1)
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if version > sqliteSchemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d, newer than this release supports (%d)", path, version, sqliteSchemaVersion)
+	}
+	// A new database gets the current schema, an older one is migrated
+	for ; version > 0 && version < sqliteSchemaVersion; version++ {
+		if _, err := db.Exec(sqliteMigrations[version]); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate %s to schema version %d: %v", path, version+1, err)
+		}
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema in %s: %v", path, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// Load reads the saved board, oldest alert first
+func (s *sqliteStore) Load() (StoredBoard, error) {
+	board := StoredBoard{Acknowledged: make(map[string]*Acknowledgement)}
+	rows, err := s.db.Query(`SELECT id, received_at, status, labels, annotations, starts_at, ends_at, generator_url,
+		incident_id, receiver, external_url, acknowledged, refired, acknowledgement, rule, replicas FROM alerts ORDER BY position`)
+	if err != nil {
+		return board, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entry                AlertEntry
+			receivedAt, startsAt string
+			endsAt               sql.NullString
+			labels, annotations  string
+			acknowledged         bool
+			acknowledgement      string
+			rule, replicas       string
+		)
+		if err := rows.Scan(&entry.ID, &receivedAt, &entry.Alert.Status, &labels, &annotations, &startsAt, &endsAt,
+			&entry.Alert.GeneratorURL, &entry.IncidentID, &entry.Receiver, &entry.ExternalURL, &acknowledged, &entry.Refired,
+			&acknowledgement, &rule, &replicas); err != nil {
+			return board, err
+		}
+		if err := json.Unmarshal([]byte(labels), &entry.Alert.Labels); err != nil {
+			return board, fmt.Errorf("alert %s: invalid labels: %v", entry.ID, err)
+		}
+		if err := json.Unmarshal([]byte(annotations), &entry.Alert.Annotations); err != nil {
+			return board, fmt.Errorf("alert %s: invalid annotations: %v", entry.ID, err)
+		}
+		if entry.Timestamp, err = time.Parse(time.RFC3339Nano, receivedAt); err != nil {
+			return board, fmt.Errorf("alert %s: %v", entry.ID, err)
+		}
+		if entry.Alert.StartsAt, err = time.Parse(time.RFC3339Nano, startsAt); err != nil {
+			return board, fmt.Errorf("alert %s: %v", entry.ID, err)
+		}
+		if err := json.Unmarshal([]byte(replicas), &entry.Replicas); err != nil {
+			return board, fmt.Errorf("alert %s: invalid replicas: %v", entry.ID, err)
+		}
+		if rule != "" {
+			if err := json.Unmarshal([]byte(rule), &entry.Rule); err != nil {
+				return board, fmt.Errorf("alert %s: invalid rule: %v", entry.ID, err)
+			}
+		}
+		if endsAt.Valid {
+			ends, err := time.Parse(time.RFC3339Nano, endsAt.String)
+			if err != nil {
+				return board, fmt.Errorf("alert %s: %v", entry.ID, err)
+			}
+			entry.Alert.EndsAt = &ends
+		}
+		board.Alerts = append(board.Alerts, entry)
+		if acknowledged {
+			// Acknowledged before the acknowledgement column was added
+			ack := &Acknowledgement{}
+			if acknowledgement != "" {
+				if err := json.Unmarshal([]byte(acknowledgement), ack); err != nil {
+					return board, fmt.Errorf("alert %s: invalid acknowledgement: %v", entry.ID, err)
+				}
+			}
+			board.Acknowledged[entry.ID] = ack
+		}
+	}
+	return board, rows.Err()
+}
+
+// Save replaces the saved board in a single transaction
+func (s *sqliteStore) Save(board StoredBoard) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM alerts"); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO alerts (id, position, received_at, status, labels, annotations, starts_at, ends_at,
+		generator_url, incident_id, receiver, external_url, acknowledged, refired, acknowledgement, rule,
+		replicas) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for i, entry := range board.Alerts {
+		labels, err := json.Marshal(entry.Alert.Labels)
+		if err != nil {
+			return err
+		}
+		annotations, err := json.Marshal(entry.Alert.Annotations)
+		if err != nil {
+			return err
+		}
+		var endsAt sql.NullString
+		if entry.Alert.EndsAt != nil {
+			endsAt = sql.NullString{String: entry.Alert.EndsAt.Format(time.RFC3339Nano), Valid: true}
+		}
+		var acknowledgement []byte
+		ack := board.Acknowledged[entry.ID]
+		if ack != nil {
+			if acknowledgement, err = json.Marshal(ack); err != nil {
+				return err
+			}
+		}
+		replicas, err := json.Marshal(entry.Replicas)
+		if err != nil {
+			return err
+		}
+		var rule []byte
+		if entry.Rule != nil {
+			if rule, err = json.Marshal(entry.Rule); err != nil {
+				return err
+			}
+		}
+		if _, err := insert.Exec(entry.ID, i, entry.Timestamp.Format(time.RFC3339Nano), entry.Alert.Status,
+			string(labels), string(annotations), entry.Alert.StartsAt.Format(time.RFC3339Nano), endsAt, entry.Alert.GeneratorURL,
+			entry.IncidentID, entry.Receiver, entry.ExternalURL, ack != nil, entry.Refired, string(acknowledgement), string(rule), string(replicas)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, backend := range storeBackends {
+		t.Run(name, func(t *testing.T) {
+			testStoreRoundTrip(t, backend)
+		})
+	}
+}
+
+func testStoreRoundTrip(t *testing.T, backend storeBackend) {
+	path := filepath.Join(t.TempDir(), backend.defaultFile)
+	store, err := backend.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startsAt := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	endsAt := startsAt.Add(time.Hour)
+	saved := StoredBoard{
+		Alerts: []AlertEntry{
+			{ID: "1-0", Timestamp: startsAt.Add(time.Second), Receiver: "team", ExternalURL: "http://am:9093", Replicas: []string{"http://am-1:9093"},
+				Rule: &AlertRule{Name: "A", Group: "disks", Expr: "disk_free < 0.1", For: "5m", Labels: map[string]string{"severity": "critical"}},
+				Alert: Alert{Status: "firing", Labels: map[string]string{"alertname": "A", "env": "prod"},
+					Annotations: map[string]string{"summary": "Disk almost full"}, StartsAt: startsAt}},
+			{ID: "1-1", Timestamp: startsAt.Add(2 * time.Second), IncidentID: "inc-1", Refired: true,
+				Alert: Alert{Status: "resolved", Labels: map[string]string{"alertname": "B"}, StartsAt: startsAt, EndsAt: &endsAt, GeneratorURL: "http://prom/graph"}},
+		},
+		Acknowledged: map[string]*Acknowledgement{"1-1": {By: "alice", At: startsAt.Add(3 * time.Second), Comment: "Looking into it"}},
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Reopen, as after a restart
+	store, err = backend.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Alerts) != len(saved.Alerts) {
+		t.Fatalf("Loaded %d alerts, want %d", len(loaded.Alerts), len(saved.Alerts))
+	}
+	for i := range saved.Alerts {
+		got, want := loaded.Alerts[i], saved.Alerts[i]
+		if !got.Timestamp.Equal(want.Timestamp) || !got.Alert.StartsAt.Equal(want.Alert.StartsAt) {
+			t.Errorf("Alert %s: times %v/%v, want %v/%v", want.ID, got.Timestamp, got.Alert.StartsAt, want.Timestamp, want.Alert.StartsAt)
+		}
+		got.Timestamp, got.Alert.StartsAt = want.Timestamp, want.Alert.StartsAt
+		if (got.Alert.EndsAt == nil) != (want.Alert.EndsAt == nil) || (got.Alert.EndsAt != nil && !got.Alert.EndsAt.Equal(*want.Alert.EndsAt)) {
+			t.Errorf("Alert %s: ends at %v, want %v", want.ID, got.Alert.EndsAt, want.Alert.EndsAt)
+		}
+		got.Alert.EndsAt = want.Alert.EndsAt
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Alert %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if !reflect.DeepEqual(loaded.Acknowledged, saved.Acknowledged) {
+		t.Errorf("Acknowledged: got %v, want %v", loaded.Acknowledged, saved.Acknowledged)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of suppression counted in the report
+const (
+	SuppressionIncident = "incident" // auto-acknowledged by an open incident
+	SuppressionSilence  = "silence"  // auto-acknowledged by a silence
+)
+
+// SuppressionReportConfig posts a daily summary of suppressed alerts to chat,
+// so rules that hide real problems get reviewed
+type SuppressionReportConfig struct {
+	Time       string `yaml:"time"`        // Time of day to post the report, e.g. "09:00", in time_zone
+	WebhookURL string `yaml:"webhook_url"` // Incoming webhook of Slack, Mattermost or similar, sent {"text": ...}
+}
+
+// SuppressedRule counts the alerts one rule kept from sounding the alarm
+type SuppressedRule struct {
+	Kind   string         `json:"kind"`
+	Rule   string         `json:"rule"`
+	Count  int            `json:"count"`
+	Alerts map[string]int `json:"alerts"` // count by alert name
+}
+
+// SuppressionReport lists what was suppressed since the last report
+type SuppressionReport struct {
+	Since time.Time        `json:"since"`
+	Until time.Time        `json:"until"`
+	Rules []SuppressedRule `json:"rules"`
+}
+
+// suppressionStats counts suppressed alerts by rule
+type suppressionStats struct {
+	mu    sync.Mutex
+	since time.Time
+	rules map[string]*SuppressedRule // kind + rule -> counts
+}
+
+func newSuppressionStats() *suppressionStats {
+	return &suppressionStats{since: time.Now(), rules: make(map[string]*SuppressedRule)}
+}
+
+// record counts an alert suppressed by a rule
+func (s *suppressionStats) record(kind, rule string, alert Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := kind + "\xff" + rule
+	counts, ok := s.rules[key]
+	if !ok {
+		counts = &SuppressedRule{Kind: kind, Rule: rule, Alerts: make(map[string]int)}
+		s.rules[key] = counts
+	}
+	counts.Count++
+	counts.Alerts[alertDisplayName(alert)]++
+}
+
+// report returns the counts since the last reset, most suppressing rule first
+func (s *suppressionStats) report() SuppressionReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := SuppressionReport{Since: s.since, Until: time.Now(), Rules: make([]SuppressedRule, 0, len(s.rules))}
+	for _, rule := range s.rules {
+		report.Rules = append(report.Rules, *rule)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Count != report.Rules[j].Count {
+			return report.Rules[i].Count > report.Rules[j].Count
+		}
+		return report.Rules[i].Rule < report.Rules[j].Rule
+	})
+	return report
+}
+
+// reset starts counting anew
+func (s *suppressionStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.since = time.Now()
+	s.rules = make(map[string]*SuppressedRule)
+}
+
+// Text renders the report as a short plain text message for chat
+func (r SuppressionReport) Text() string {
+	var b strings.Builder
+	total := 0
+	for _, rule := range r.Rules {
+		total += rule.Count
+	}
+	fmt.Fprintf(&b, "Suppressed alerts since %s: %d", timeFormat.Absolute(r.Since), total)
+	for _, rule := range r.Rules {
+		names := make([]string, 0, len(rule.Alerts))
+		for name := range rule.Alerts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "\n- %s %q: %d (%s)", rule.Kind, rule.Rule, rule.Count, strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// suppressionReportHandler serves the counts since the last daily report
+func suppressionReportHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.suppressed.report())
+	}
+}
+
+// runSuppressionReporter posts the report to chat daily and starts counting anew
+func (a *AppState) runSuppressionReporter(config *SuppressionReportConfig, offsets []time.Duration) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		next := nextHandoff(time.Now(), offsets, timeFormat.location)
+		time.Sleep(time.Until(next))
+		if !a.cluster.isLeader() {
+			continue
+		}
+
+		// Counts are kept for the next report if posting fails
+		if err := postChatMessage(client, config.WebhookURL, a.suppressed.report().Text()); err != nil {
+			log.Errorf("Failed to post suppression report: %v", err)
+			continue
+		}
+		a.suppressed.reset()
+		log.Infof("Posted suppression report")
+	}
+}
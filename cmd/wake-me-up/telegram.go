@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+const (
+	// Telegram rejects messages over 4096 characters
+	maxTelegramText    = 4096
+	maxTelegramAlerts  = 20
+	maxTelegramSummary = 1024
+)
+
+// TelegramConfig sends notifications to a Telegram chat through a bot
+type TelegramConfig struct {
+	BotToken       string `yaml:"bot_token"`       // Token of the bot, from @BotFather
+	ChatID         string `yaml:"chat_id"`         // Chat the bot posts to: a numeric ID, or @name of a public channel
+	NotifyResolved bool   `yaml:"notify_resolved"` // Also send when firing alerts resolve (optional, default: false)
+	APIURL         string `yaml:"api_url"`         // Bot API server (optional, default: https://api.telegram.org)
+}
+
+// telegramNotifier sends HTML messages with the Bot API
+type telegramNotifier struct {
+	config   *TelegramConfig
+	links    *ackLinker
+	endpoint string
+	client   *http.Client
+}
+
+func newTelegramNotifier(config *TelegramConfig, links *ackLinker) (*telegramNotifier, error) {
+	if config.BotToken == "" {
+		return nil, fmt.Errorf("missing bot_token")
+	}
+	if config.ChatID == "" {
+		return nil, fmt.Errorf("missing chat_id")
+	}
+	apiURL := strings.TrimSuffix(config.APIURL, "/")
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+	return &telegramNotifier{
+		config:   config,
+		links:    links,
+		endpoint: apiURL + "/bot" + config.BotToken + "/sendMessage",
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (t *telegramNotifier) Name() string {
+	return "telegram"
+}
+
+// Wants takes resolutions only with notify_resolved
+func (t *telegramNotifier) Wants(kind string) bool {
+	return kind != EventResolved || t.config.NotifyResolved
+}
+
+// Notify sends one message per event
+func (t *telegramNotifier) Notify(event NotificationEvent) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  t.config.ChatID,
+		"text":                     t.render(event),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error holds the URL, and so the bot token
+		return fmt.Errorf("sending to telegram failed: %v", strings.ReplaceAll(err.Error(), t.config.BotToken, "***"))
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.OK {
+		return fmt.Errorf("telegram returned %s: %s", resp.Status, result.Description)
+	}
+	return nil
+}
+
+// render builds the HTML text of an event
+func (t *telegramNotifier) render(event NotificationEvent) string {
+	if event.Kind == EventAllClear {
+		return "✅ <b>" + html.EscapeString(event.Note) + "</b>"
+	}
+	heading := fmt.Sprintf("🚨 <b>%d alert(s) need attention</b>", len(event.Alerts))
+	switch event.Kind {
+	case EventFollowUp:
+		heading = "🚨 <b>Still firing at its follow-up time</b>"
+	case EventEscalated:
+		heading = "🚨 <b>Still unacknowledged</b>"
+	case EventResolved:
+		heading = fmt.Sprintf("✅ <b>%d alert(s) resolved</b>", len(event.Alerts))
+	}
+	var text strings.Builder
+	text.WriteString(heading)
+	if event.Note != "" {
+		text.WriteString("\n<i>" + html.EscapeString(truncateRunes(event.Note, maxTelegramSummary)) + "</i>")
+	}
+
+	for i, entry := range event.Alerts {
+		if i == maxTelegramAlerts {
+			fmt.Fprintf(&text, "\n\n…and %d more on the board", len(event.Alerts)-i)
+			break
+		}
+		text.WriteString("\n\n• <b>" + html.EscapeString(alertTitle(entry.Alert)) + "</b>")
+		if severity := alertSeverity(entry.Alert); severity != "" {
+			text.WriteString(" (" + html.EscapeString(severity) + ")")
+		}
+		if summary := entry.Alert.Annotations["summary"]; summary != "" {
+			text.WriteString("\n" + html.EscapeString(truncateRunes(summary, maxTelegramSummary)))
+		}
+		if event.Kind == EventResolved {
+			continue
+		}
+		text.WriteString("\nFiring since " + html.EscapeString(timeFormat.Absolute(entry.Alert.StartsAt)))
+		if link := t.links.Link(entry.ID); link != "" {
+			text.WriteString("\n<a href=\"" + html.EscapeString(link) + "\">✓ Acknowledge</a>")
+		}
+	}
+	return fitTelegramText(text.String())
+}
+
+// fitTelegramText cuts text over Telegram's limit on a rune boundary. The cut
+// falls between alerts, so no tag or entity is left open.
+func fitTelegramText(text string) string {
+	if utf8.RuneCountInString(text) <= maxTelegramText {
+		return text
+	}
+	const more = "\n\n…"
+	cut := string([]rune(text)[:maxTelegramText-utf8.RuneCountInString(more)])
+	if i := strings.LastIndex(cut, "\n\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + more
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTelegramNotifier(t *testing.T) {
+	var sent map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botsecret/sendMessage" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	telegram, err := newTelegramNotifier(&TelegramConfig{BotToken: "secret", ChatID: "-100123", APIURL: server.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := AlertEntry{ID: "1-0", Alert: Alert{
+		Status:      "firing",
+		Labels:      map[string]string{"alertname": "Disk <90%", "severity": "critical"},
+		Annotations: map[string]string{"summary": "Disk almost full"},
+		StartsAt:    time.Now(),
+	}}
+	if err := telegram.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{entry}}); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := sent["text"].(string)
+	if sent["chat_id"] != "-100123" || sent["parse_mode"] != "HTML" {
+		t.Errorf("Unexpected message %v", sent)
+	}
+	for _, want := range []string{"1 alert(s) need attention", "<b>Disk &lt;90%</b> (critical)", "Disk almost full"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in %q", want, text)
+		}
+	}
+
+	var many []AlertEntry
+	for i := 0; i < maxTelegramAlerts; i++ {
+		long := entry
+		long.Alert.Annotations = map[string]string{"summary": strings.Repeat("ü", 2000)}
+		many = append(many, long)
+	}
+	if err := telegram.Notify(NotificationEvent{Kind: EventFiring, Alerts: many}); err != nil {
+		t.Fatal(err)
+	}
+	text, _ = sent["text"].(string)
+	if count := utf8.RuneCountInString(text); count > maxTelegramText {
+		t.Errorf("Expected the text cut to %d characters, got %d", maxTelegramText, count)
+	}
+	if !strings.HasSuffix(text, "\n\n…") || strings.Count(text, "<b>") != strings.Count(text, "</b>") {
+		t.Errorf("Expected the text cut between alerts, got %q", text[len(text)-100:])
+	}
+
+	if telegram.Wants(EventResolved) {
+		t.Error("Expected resolutions left out without notify_resolved")
+	}
+	telegram.config.NotifyResolved = true
+	if !telegram.Wants(EventResolved) {
+		t.Error("Expected resolutions sent with notify_resolved")
+	}
+
+	telegram.endpoint = server.URL + "/botwrong/sendMessage"
+	if err := telegram.Notify(NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{entry}}); err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ppastorf/wake-me-up/templates"
+)
+
+// Functions available to all templates
+var templateFuncs = template.FuncMap{
+	"formatTime": formatTime,
+	"dict":       dict,
+}
+
+// dict builds a map from key/value pairs, to pass several values to a block
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict needs key/value pairs")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// Blocks that are also rendered for live updates when overrides are in use
+var liveBlocks = []string{"banner", "alert-list"}
+
+// templateSet holds the page templates: the embedded defaults with the
+// definitions from the override directory layered on top
+type templateSet struct {
+	mu         sync.RWMutex
+	tmpl       *template.Template
+	overrides  string
+	liveReload bool
+	overridden bool
+}
+
+// newTemplateSet parses the embedded templates and the overrides in dir, if any
+func newTemplateSet(dir string, liveReload bool) (*templateSet, error) {
+	set := &templateSet{overrides: dir, liveReload: liveReload}
+	if err := set.load(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// load (re)parses the templates and validates them by rendering every page
+// with empty data, so a broken override fails at startup rather than on the
+// first page view
+func (s *templateSet) load() error {
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(templates.FS, "*.html")
+	if err != nil {
+		return fmt.Errorf("parsing embedded templates: %w", err)
+	}
+
+	overridden := false
+	if s.overrides != "" {
+		files, err := filepath.Glob(filepath.Join(s.overrides, "*.html"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			if _, err := os.Stat(s.overrides); err != nil {
+				return fmt.Errorf("templates_dir: %w", err)
+			}
+		} else {
+			// Later definitions replace earlier ones, so blocks defined in
+			// the override files win over the embedded ones
+			if tmpl, err = tmpl.ParseFiles(files...); err != nil {
+				return fmt.Errorf("parsing template overrides: %w", err)
+			}
+			overridden = true
+		}
+	}
+
+	for name, data := range validationData() {
+		if err := tmpl.ExecuteTemplate(io.Discard, name, data); err != nil {
+			return fmt.Errorf("validating %s: %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.tmpl = tmpl
+	s.overridden = overridden
+	s.mu.Unlock()
+	return nil
+}
+
+// validationData returns sample data for every page and live block, filled in
+// enough that the card and detail blocks are rendered as well
+func validationData() map[string]interface{} {
+	now := time.Now()
+	banner := &Banner{Message: "Example banner", SetAt: now, ExpiresAt: &now}
+	alerts := []AlertTemplateData{{
+		ID:              "example",
+		Timestamp:       timeFormat.Board(now),
+		StatusClass:     "firing",
+		StatusText:      "Firing",
+		ShowAckButton:   true,
+		AlertName:       "Example",
+		Decoration:      "🔥",
+		Labels:          []LabelData{{Key: "alertname", Value: "Example"}},
+		Summary:         "Example summary",
+		Description:     "Example description",
+		RunbookURL:      "https://example.com/runbook",
+		Annotations:     []LabelData{{Key: "dashboard", Value: "Example"}},
+		StartsAt:        timeFormat.Board(now),
+		EndsAt:          timeFormat.Board(now),
+		FollowUp:        &FollowUp{Note: "Example note", DueAt: now, DueText: timeFormat.Board(now)},
+		Snooze:          &Snooze{Until: now, UntilText: timeFormat.Board(now)},
+		Acknowledgement: &Acknowledgement{By: "alice", At: now, Comment: "Example comment", AtText: timeFormat.Board(now)},
+		Review:          &Review{ID: "rev-example", Note: "Example note", MarkedAt: now, MarkedText: timeFormat.Board(now)},
+		AgeText:         "over 15m",
+		Refired:         true,
+	}}
+	return map[string]interface{}{
+		"index.html": TemplateData{
+			StatusClass: getStatusClass(StatusLevelCritical),
+			StatusText:  getStatusText(StatusLevelCritical),
+			StatusColor: "#d32f2f",
+			Browser:     BrowserSettings{Title: defaultPageTitle, Favicon: defaultFavicon, AlarmFavicon: defaultAlarmFavicon, Notifications: true},
+			Banner:      banner,
+			Alerts:      alerts,
+			Environments: []EnvironmentTab{
+				{Name: "prod", Total: 1, Unacknowledged: 1, Sound: SoundAlways},
+				{Name: "", Total: 1, Sound: SoundAlways},
+			},
+			Environment: "prod",
+		},
+		"clients.html": ClientsTemplateData{},
+		"reviews.html": []Review{{ID: "rev-example", AlertID: "example", Alert: Alert{Status: "resolved", Labels: map[string]string{"alertname": "Example"}, StartsAt: now}, Note: "Example note", MarkedAt: now, MarkedText: timeFormat.Board(now)}},
+		"handoff.html": Handoff{
+			GeneratedAt:  now,
+			Window:       defaultHandoffWindow.String(),
+			Firing:       []AlertEntry{{ID: "example", Timestamp: now, Alert: Alert{Status: "firing", Labels: map[string]string{"alertname": "Example"}, StartsAt: now}}},
+			Acknowledged: []AlertEntry{},
+			Resolved:     []AlertEntry{},
+			Incidents:    []Incident{{ID: "inc-example", Title: "Example", Matchers: map[string]string{"alertname": "Example"}, StartedAt: now}},
+			Banner:       banner,
+		},
+		"stats.html": StatsTemplateData{
+			AckStats: AckStats{Since: now.Add(-defaultStatsPeriod), Until: now, TeamLabel: defaultTeamLabel,
+				Actors: []StatsRow{{Name: "alice", Acks: 3, AvgResponseSeconds: 90, Escalated: 1}},
+				Teams:  []StatsRow{{Name: "platform", Acks: 3, AvgResponseSeconds: 90, Escalated: 2}}},
+			CSVURL: "/api/v1/stats?format=csv",
+		},
+		"recovery.html": RecoveryTemplateData{Path: "config.yaml", Error: "example error", UploadError: "example error"},
+		"banner":        banner,
+		"alert-list":    alerts,
+	}
+}
+
+// current returns the templates to render with, reparsing them first in live
+// reload mode. A failed reload keeps the last good templates.
+func (s *templateSet) current() *template.Template {
+	if s.liveReload {
+		if err := s.load(); err != nil {
+			log.Errorf("Error reloading templates: %v", err)
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tmpl
+}
+
+// Execute renders the named page or block
+func (s *templateSet) Execute(w io.Writer, name string, data interface{}) error {
+	return s.current().ExecuteTemplate(w, name, data)
+}
+
+// Overridden reports whether any block comes from the override directory
+func (s *templateSet) Overridden() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.overridden
+}
+
+// renderBlocks renders the live blocks for an update, so clients can show the
+// overridden markup instead of building their own
+func (s *templateSet) renderBlocks(banner *Banner, alerts []AlertTemplateData) map[string]string {
+	tmpl := s.current()
+	data := map[string]interface{}{"banner": banner, "alert-list": alerts}
+	rendered := make(map[string]string, len(liveBlocks))
+	for _, block := range liveBlocks {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, block, data[block]); err != nil {
+			log.Errorf("Error rendering block %q: %v", block, err)
+			return nil
+		}
+		rendered[block] = buf.String()
+	}
+	return rendered
+}
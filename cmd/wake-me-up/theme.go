@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// StatusThemeConfig styles the board status when an unacknowledged firing
+// alert carries all the labels of Match, e.g. env=prod -> "PRODUCTION IMPACT"
+type StatusThemeConfig struct {
+	Match map[string]string `yaml:"match"`
+	Text  string            `yaml:"text"`  // Status text shown instead of the default (optional)
+	Color string            `yaml:"color"` // Status background, a #hex or named CSS color (optional)
+}
+
+// StatusTheme is the status style sent to clients
+type StatusTheme struct {
+	Text  string `json:"text,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+var themeColorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// validateStatusThemes checks the theme rules, so a typo fails at startup
+func validateStatusThemes(themes []StatusThemeConfig) error {
+	for i, theme := range themes {
+		if len(theme.Match) == 0 {
+			return fmt.Errorf("status theme %d: 'match' is empty", i+1)
+		}
+		if theme.Text == "" && theme.Color == "" {
+			return fmt.Errorf("status theme %d: needs 'text' or 'color'", i+1)
+		}
+		if theme.Color != "" && !themeColorPattern.MatchString(theme.Color) {
+			return fmt.Errorf("status theme %d: invalid color %q", i+1, theme.Color)
+		}
+	}
+	return nil
+}
+
+// statusTheme returns the style of the first theme rule matching an
+// unacknowledged firing alert, or nil to use the default style
+// This should be called while holding the lock
+func (a *AppState) statusTheme() *StatusTheme {
+	if a.config == nil {
+		return nil
+	}
+	for _, theme := range a.config.StatusThemes {
+		for _, entry := range a.alerts {
+			if entry.Alert.Status != "firing" || a.acknowledged[entry.ID] != nil {
+				continue
+			}
+			if labelsMatch(entry.Alert.Labels, theme.Match) {
+				return &StatusTheme{Text: strings.TrimSpace(theme.Text), Color: theme.Color}
+			}
+		}
+	}
+	return nil
+}
+
+// StatusTheme returns the current status style, or nil for the default
+func (a *AppState) StatusTheme() *StatusTheme {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.statusTheme()
+}
+
+// labelsMatch checks if labels contain all the matcher labels
+func labelsMatch(labels, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// During an alert storm Alertmanager may deliver the same group over and
+// over, each delivery taking the lock, broadcasting the board and chiming.
+// With ingest_throttle set, the first delivery of a group is ingested right
+// away and opens a window; deliveries of the group arriving in the window are
+// held and merged, then ingested as one when it ends, which opens the next
+// window. Payloads without a group key are never held.
+
+// ingestThrottle holds the deliveries of the groups in their window
+type ingestThrottle struct {
+	window time.Duration // 0 disables throttling
+
+	mu     sync.Mutex
+	groups map[string]*throttledGroup // by group key
+}
+
+// throttledGroup is a group in its window, with the deliveries held so far
+// merged into pending
+type throttledGroup struct {
+	pending *WebhookPayload
+	timer   *time.Timer
+}
+
+func newIngestThrottle() *ingestThrottle {
+	return &ingestThrottle{groups: make(map[string]*throttledGroup)}
+}
+
+// hold keeps a delivery for the end of the window of its group, and opens a
+// window if there is none. It returns false for deliveries to ingest now.
+func (t *ingestThrottle) hold(payload WebhookPayload, flush func(groupKey string)) bool {
+	if t.window <= 0 || payload.GroupKey == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, ok := t.groups[payload.GroupKey]
+	if !ok {
+		t.groups[payload.GroupKey] = &throttledGroup{timer: time.AfterFunc(t.window, func() { flush(payload.GroupKey) })}
+		return false
+	}
+	if group.pending != nil {
+		webhooksCoalesced.Inc()
+		payload = mergeDeliveries(*group.pending, payload)
+	}
+	group.pending = &payload
+	return true
+}
+
+// release returns the delivery held for a group at the end of its window,
+// opening the next window if there is one, or closes the window
+func (t *ingestThrottle) release(groupKey string, flush func(groupKey string)) (WebhookPayload, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, ok := t.groups[groupKey]
+	if !ok || group.pending == nil {
+		delete(t.groups, groupKey)
+		return WebhookPayload{}, false
+	}
+	payload := *group.pending
+	group.pending = nil
+	group.timer = time.AfterFunc(t.window, func() { flush(groupKey) })
+	return payload, true
+}
+
+// drain closes every window and returns the deliveries still held, for
+// shutdown
+func (t *ingestThrottle) drain() []WebhookPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var held []WebhookPayload
+	for key, group := range t.groups {
+		group.timer.Stop()
+		if group.pending != nil {
+			held = append(held, *group.pending)
+		}
+		delete(t.groups, key)
+	}
+	return held
+}
+
+// mergeDeliveries folds a later delivery of a group into an earlier one: the
+// later payload, plus the alerts of the earlier one it no longer carries,
+// such as resolutions sent only once
+func mergeDeliveries(earlier, later WebhookPayload) WebhookPayload {
+	carried := make(map[string]bool, len(later.Alerts))
+	for _, alert := range later.Alerts {
+		carried[alertIdentity(alert)] = true
+	}
+	var alerts []Alert
+	for _, alert := range earlier.Alerts {
+		if !carried[alertIdentity(alert)] {
+			alerts = append(alerts, alert)
+		}
+	}
+	later.Alerts = append(alerts, later.Alerts...)
+	return later
+}
+
+// alertIdentity tells the alerts of a group apart, by the fingerprint
+// Alertmanager sends or else by labels
+func alertIdentity(alert Alert) string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+	return labelFingerprint(alert.Labels)
+}
+
+// flushThrottled ingests the delivery held for a group when its window ends
+func (a *AppState) flushThrottled(groupKey string) {
+	payload, ok := a.throttle.release(groupKey, a.flushThrottled)
+	if !ok {
+		return
+	}
+	log.Debugf("Ingesting the coalesced deliveries of group %s: %d alerts", groupKey, len(payload.Alerts))
+	a.addWebhook(payload)
+}
+
+// flushAllThrottled ingests every delivery still held, on shutdown
+func (a *AppState) flushAllThrottled() {
+	for _, payload := range a.throttle.drain() {
+		a.addWebhook(payload)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestThrottle(t *testing.T) {
+	state := NewAppState(100)
+	state.throttle.window = 50 * time.Millisecond
+	startsAt := time.Now().Add(-time.Minute)
+	disk := Alert{Labels: map[string]string{"alertname": "Disk"}, StartsAt: startsAt}
+	cpu := Alert{Status: "firing", Labels: map[string]string{"alertname": "CPU"}, StartsAt: startsAt}
+	delivery := func(alerts ...Alert) WebhookPayload {
+		return WebhookPayload{GroupKey: `{}:{team="db"}`, Alerts: alerts}
+	}
+	with := func(alert Alert, status string) Alert {
+		alert.Status = status
+		return alert
+	}
+
+	if result := state.AddWebhook(delivery(with(disk, "firing"))); result.Created != 1 || result.Coalesced {
+		t.Fatalf("Expected the first delivery ingested right away, got %+v", result)
+	}
+	// Disk resolves in a delivery that is then superseded by one without it
+	if result := state.AddWebhook(delivery(with(disk, "resolved"))); !result.Coalesced {
+		t.Fatalf("Expected the next delivery held, got %+v", result)
+	}
+	state.AddWebhook(delivery(cpu))
+	if result := state.AddWebhook(WebhookPayload{Alerts: []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Other"}}}}); result.Coalesced {
+		t.Error("Expected a payload without a group key ingested right away")
+	}
+	if firing := len(state.GetAlerts()); firing != 2 {
+		t.Fatalf("Expected the held deliveries not ingested yet, got %d alerts", firing)
+	}
+
+	statuses := make(map[string]int)
+	for deadline := time.Now().Add(2 * time.Second); statuses["CPU firing"] == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		clear(statuses)
+		for _, entry := range state.GetAlerts() {
+			statuses[entry.Alert.Labels["alertname"]+" "+entry.Alert.Status]++
+		}
+	}
+	if statuses["Disk resolved"] != 1 || statuses["CPU firing"] != 1 {
+		t.Fatalf("Expected the held deliveries ingested as one at the end of the window, got %v", statuses)
+	}
+
+	// The window that ingestion opened closes empty, then the group is
+	// ingested right away again
+	time.Sleep(120 * time.Millisecond)
+	if result := state.AddWebhook(delivery(cpu)); result.Coalesced {
+		t.Error("Expected a delivery after a quiet window ingested right away")
+	}
+}
+
+func TestMergeDeliveries(t *testing.T) {
+	earlier := WebhookPayload{Status: "firing", Alerts: []Alert{
+		{Status: "resolved", Fingerprint: "a"},
+		{Status: "firing", Fingerprint: "b"},
+	}}
+	later := WebhookPayload{Status: "resolved", Alerts: []Alert{{Status: "resolved", Fingerprint: "b"}}}
+	merged := mergeDeliveries(earlier, later)
+	if merged.Status != "resolved" || len(merged.Alerts) != 2 || merged.Alerts[0].Fingerprint != "a" || merged.Alerts[1].Status != "resolved" {
+		t.Errorf("Expected the later payload with the alert it no longer carries, got %+v", merged)
+	}
+}
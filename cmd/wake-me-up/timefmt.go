@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultTimeFormat = "2006-01-02 15:04:05"
+
+// How often the board is refreshed while it shows relative times
+const relativeTimeRefresh = 30 * time.Second
+
+// timeFormatter formats the times shown to people: on the board, in the
+// admin pages and in notifications
+type timeFormatter struct {
+	layout   string
+	location *time.Location
+	relative bool // board times as "3m ago"
+}
+
+// timeFormat is the formatter configured at startup
+var timeFormat = &timeFormatter{layout: defaultTimeFormat, location: time.Local}
+
+// setTimeFormat applies the time_format, time_zone and relative_times config
+func setTimeFormat(config *Config) error {
+	formatter := &timeFormatter{layout: defaultTimeFormat, location: time.Local, relative: config.RelativeTimes}
+	if config.TimeFormat != "" {
+		formatter.layout = config.TimeFormat
+	}
+	if config.TimeZone != "" {
+		location, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return fmt.Errorf("time_zone: %w", err)
+		}
+		formatter.location = location
+	}
+	timeFormat = formatter
+	return nil
+}
+
+// Absolute formats a time with the configured layout and zone
+func (f *timeFormatter) Absolute(t time.Time) string {
+	return t.In(f.location).Format(f.layout)
+}
+
+// Board formats a time for the board, relative to now if configured
+func (f *timeFormatter) Board(t time.Time) string {
+	if f.relative {
+		return relativeTime(t, time.Now())
+	}
+	return f.Absolute(t)
+}
+
+// relativeTime describes how long ago (or from now) a time is, e.g. "3m ago"
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := " ago"
+	if d < 0 {
+		d = -d
+		suffix = " from now"
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%s", int(d.Minutes()), suffix)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%s", int(d.Hours()), suffix)
+	default:
+		return fmt.Sprintf("%dd%s", int(d.Hours()/24), suffix)
+	}
+}
+
+// formatTime is the template function for absolute times; it takes
+// time.Time or *time.Time and renders nil as an empty string
+func formatTime(v interface{}) string {
+	switch t := v.(type) {
+	case time.Time:
+		return timeFormat.Absolute(t)
+	case *time.Time:
+		if t == nil {
+			return ""
+		}
+		return timeFormat.Absolute(*t)
+	}
+	return ""
+}
+
+// refreshRelativeTimes rebroadcasts the board periodically, so relative
+// times keep counting on the clients
+func (a *AppState) refreshRelativeTimes() {
+	ticker := time.NewTicker(relativeTimeRefresh)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.mu.RLock()
+		empty := len(a.alerts) == 0
+		a.mu.RUnlock()
+		if !empty {
+			a.broadcastUpdate()
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The board timeline records when the board went between clear and alarm
+// (unacknowledged firing alerts), to answer "how bad was this week, really?"
+// with daily summaries. Only the transitions are kept, so the retention can
+// be much longer than the alert history's.
+
+const (
+	timelineFile = "timeline.json"
+
+	defaultTimelineRetention = 90 * 24 * time.Hour
+	defaultTimelineDays      = 7
+	maxTimelineDays          = 366
+)
+
+// Board states of the timeline
+const (
+	BoardClear   = "clear"
+	BoardAlarm   = "alarm"   // unacknowledged firing alerts on the board
+	BoardOffline = "offline" // the server was stopped
+	BoardUnknown = "unknown" // before the first transition recorded
+)
+
+// BoardTransition is the board entering a state
+type BoardTransition struct {
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+}
+
+// boardTimeline keeps the board transitions for the retention period, in a
+// file of the data directory if set
+type boardTimeline struct {
+	mu          sync.Mutex
+	transitions []BoardTransition // oldest first
+	retention   time.Duration
+	path        string // empty = memory only
+}
+
+func newBoardTimeline() *boardTimeline {
+	return &boardTimeline{retention: defaultTimelineRetention}
+}
+
+// SetRetention sets how long transitions are kept
+func (t *boardTimeline) SetRetention(retention time.Duration) {
+	t.mu.Lock()
+	t.retention = retention
+	t.mu.Unlock()
+}
+
+// Open loads the timeline file and keeps new transitions there
+func (t *boardTimeline) Open(path string) error {
+	var transitions []BoardTransition
+	if _, err := loadJSON(path, &transitions); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.transitions = append(transitions, t.transitions...)
+	t.path = path
+	t.mu.Unlock()
+	return nil
+}
+
+// record appends a transition if the board changed state
+func (t *boardTimeline) record(state string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := len(t.transitions); n > 0 && t.transitions[n-1].State == state {
+		return
+	}
+	t.transitions = append(t.transitions, BoardTransition{Time: now, State: state})
+
+	// Keep the last transition before the cutoff, it holds the state at the
+	// start of the retention period
+	cutoff := now.Add(-t.retention)
+	expired := 0
+	for expired+1 < len(t.transitions) && !t.transitions[expired+1].Time.After(cutoff) {
+		expired++
+	}
+	t.transitions = append([]BoardTransition(nil), t.transitions[expired:]...)
+
+	if t.path != "" {
+		if err := saveJSON(t.path, t.transitions); err != nil {
+			log.Errorf("Failed to save the board timeline: %v", err)
+		}
+	}
+}
+
+// observe records whether the board is in alarm
+func (t *boardTimeline) observe(alarm bool, now time.Time) {
+	if alarm {
+		t.record(BoardAlarm, now)
+	} else {
+		t.record(BoardClear, now)
+	}
+}
+
+// Summary returns the transitions and daily summaries of a period
+func (t *boardTimeline) Summary(since, until time.Time) BoardTimeline {
+	t.mu.Lock()
+	transitions := append([]BoardTransition(nil), t.transitions...)
+	t.mu.Unlock()
+	return summarizeTimeline(transitions, since, until)
+}
+
+// TimelineDay sums up a day of the board, in the server's time zone
+type TimelineDay struct {
+	Date           string  `json:"date"` // YYYY-MM-DD
+	AlarmSeconds   float64 `json:"alarmSeconds"`
+	ClearSeconds   float64 `json:"clearSeconds"`
+	UnknownSeconds float64 `json:"unknownSeconds"` // offline, not recorded yet or still to come
+	Alarms         int     `json:"alarms"`         // times the board went into alarm
+}
+
+// Level rates how bad the day was for the heat strip, from 0 (always clear)
+// to 4 (in alarm half the day or more), or "none" without any record
+func (d TimelineDay) Level() string {
+	known := d.AlarmSeconds + d.ClearSeconds
+	if known == 0 {
+		return "none"
+	}
+	ratio := d.AlarmSeconds / known
+	switch {
+	case ratio == 0:
+		return "0"
+	case ratio < 0.05:
+		return "1"
+	case ratio < 0.2:
+		return "2"
+	case ratio < 0.5:
+		return "3"
+	}
+	return "4"
+}
+
+// Description tells how the day went, for tooltips
+func (d TimelineDay) Description() string {
+	if d.AlarmSeconds+d.ClearSeconds == 0 {
+		return d.Date + ": no record"
+	}
+	if d.Alarms == 0 && d.AlarmSeconds == 0 {
+		return d.Date + ": clear"
+	}
+	alarmFor := time.Duration(d.AlarmSeconds) * time.Second
+	return fmt.Sprintf("%s: %s in alarm, %d alarms", d.Date, shortDuration(alarmFor.Round(time.Minute)), d.Alarms)
+}
+
+// BoardTimeline is the board over a period
+type BoardTimeline struct {
+	Since       time.Time         `json:"since"`
+	Until       time.Time         `json:"until"`
+	Transitions []BoardTransition `json:"transitions"` // the state at since first
+	Days        []TimelineDay     `json:"days"`
+}
+
+// summarizeTimeline cuts the transitions, oldest first, to a period starting
+// at midnight and sums them up per day
+func summarizeTimeline(transitions []BoardTransition, since, until time.Time) BoardTimeline {
+	state := BoardUnknown
+	i := 0
+	for ; i < len(transitions) && !transitions[i].Time.After(since); i++ {
+		state = transitions[i].State
+	}
+	spans := []BoardTransition{{Time: since, State: state}}
+	for ; i < len(transitions) && transitions[i].Time.Before(until); i++ {
+		spans = append(spans, transitions[i])
+	}
+
+	days := []TimelineDay{}
+	for day := since; day.Before(until); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		summary := TimelineDay{Date: day.Format("2006-01-02")}
+		for j, span := range spans {
+			end := until
+			if j+1 < len(spans) {
+				end = spans[j+1].Time
+			}
+			start := span.Time
+			if start.Before(day) {
+				start = day
+			}
+			if end.After(next) {
+				end = next
+			}
+			if !end.After(start) {
+				continue
+			}
+			seconds := end.Sub(start).Seconds()
+			switch span.State {
+			case BoardAlarm:
+				summary.AlarmSeconds += seconds
+				if j > 0 && !span.Time.Before(day) {
+					summary.Alarms++
+				}
+			case BoardClear:
+				summary.ClearSeconds += seconds
+			default:
+				summary.UnknownSeconds += seconds
+			}
+		}
+		if next.After(until) {
+			summary.UnknownSeconds += next.Sub(until).Seconds()
+		}
+		days = append(days, summary)
+	}
+	return BoardTimeline{Since: since, Until: until, Transitions: spans, Days: days}
+}
+
+// timelineSince returns the midnight starting a period of days ending today
+func timelineSince(days int, now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, now.Location())
+}
+
+// parseTimelineRange reads a number of days, e.g. 7d
+func parseTimelineRange(value string) (int, error) {
+	if value == "" {
+		return defaultTimelineDays, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || days < 1 || days > maxTimelineDays {
+		return 0, fmt.Errorf("invalid 'range' parameter, expected 1d to %dd: %q", maxTimelineDays, value)
+	}
+	return days, nil
+}
+
+// LoadTimeline restores the board timeline from the data directory
+func (a *AppState) LoadTimeline() error {
+	path := a.dataFilePath(timelineFile)
+	if path == "" {
+		return nil
+	}
+	return a.timeline.Open(path)
+}
+
+// StartTimeline records the state of the restored board
+func (a *AppState) StartTimeline() {
+	a.mu.RLock()
+	alarm := a.hasUnacknowledgedFiring()
+	a.mu.RUnlock()
+	a.timeline.observe(alarm, time.Now())
+}
+
+// timelineHandler returns the board timeline of the last days, e.g.
+// range=30d, today included
+func timelineHandler(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		days, err := parseTimelineRange(r.URL.Query().Get("range"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(state.timeline.Summary(timelineSince(days, now), now)); err != nil {
+			log.Errorf("Error encoding timeline: %v", err)
+		}
+	}
+}
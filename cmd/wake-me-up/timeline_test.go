@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoardTimeline(t *testing.T) {
+	since := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	at := func(day int, hour float64) time.Time {
+		return since.AddDate(0, 0, day).Add(time.Duration(hour * float64(time.Hour)))
+	}
+
+	path := filepath.Join(t.TempDir(), timelineFile)
+	timeline := newBoardTimeline()
+	if err := timeline.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	timeline.observe(false, at(-3, 0))
+	timeline.observe(true, at(0, 6))
+	timeline.observe(true, at(0, 7)) // no change
+	timeline.observe(false, at(0, 12))
+	timeline.observe(true, at(1, 22))
+	timeline.observe(false, at(2, 4))
+	timeline.record(BoardOffline, at(2, 12))
+
+	restored := newBoardTimeline()
+	if err := restored.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	summary := restored.Summary(since, at(2, 18))
+	if len(summary.Transitions) != 6 || summary.Transitions[0].State != BoardClear {
+		t.Fatalf("Expected the clear state at since and 5 transitions, got %+v", summary.Transitions)
+	}
+	expected := []TimelineDay{
+		{Date: "2026-10-05", AlarmSeconds: 6 * 3600, ClearSeconds: 18 * 3600, Alarms: 1},
+		{Date: "2026-10-06", AlarmSeconds: 2 * 3600, ClearSeconds: 22 * 3600, Alarms: 1},
+		{Date: "2026-10-07", AlarmSeconds: 4 * 3600, ClearSeconds: 8 * 3600, UnknownSeconds: 12 * 3600},
+	}
+	if len(summary.Days) != len(expected) {
+		t.Fatalf("Expected %d days, got %+v", len(expected), summary.Days)
+	}
+	for i, day := range summary.Days {
+		if day != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], day)
+		}
+	}
+	if level := summary.Days[0].Level(); level != "3" {
+		t.Errorf("Expected a quarter of the day in alarm to be level 3, got %s", level)
+	}
+
+	// Transitions past the retention go, but the state at its start stays
+	restored.SetRetention(24 * time.Hour)
+	restored.observe(true, at(2, 20))
+	if summary := restored.Summary(at(1, 21), at(2, 21)); summary.Transitions[0].State != BoardClear || len(summary.Transitions) != 5 {
+		t.Errorf("Unexpected transitions after pruning: %+v", summary.Transitions)
+	}
+	if first := restored.transitions[0]; !first.Time.Equal(at(0, 12)) {
+		t.Errorf("Expected the last transition before the cutoff kept, got %+v", first)
+	}
+}
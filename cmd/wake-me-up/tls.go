@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes, at most
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves a certificate from files, loading it again when the
+// files change, e.g. after a renewal, without restarting the server
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTimes  [2]time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// fileModTimes returns the modification times of the certificate and key files
+func (c *certReloader) fileModTimes() ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return times, err
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
+
+// load reads the certificate and key
+// This should be called while holding the lock, or before serving
+func (c *certReloader) load() error {
+	times, err := c.fileModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTimes = times
+	return nil
+}
+
+// GetCertificate is the tls.Config hook. A failed reload, e.g. while the
+// files are being replaced, keeps the last good certificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := time.Now(); now.Sub(c.lastCheck) >= certCheckInterval {
+		c.lastCheck = now
+		if times, err := c.fileModTimes(); err == nil && times != c.modTimes {
+			if err := c.load(); err != nil {
+				log.Errorf("Error reloading TLS certificate: %v", err)
+			} else {
+				log.Infof("Reloaded TLS certificate from %s", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// newServer returns a server for an address, serving HTTPS when a
+// certificate is configured
+func newServer(addr string, handler http.Handler, certs *certReloader) *http.Server {
+	server := &http.Server{Addr: addr, Handler: handler}
+	if certs != nil {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	}
+	return server
+}
+
+// serve runs a server from newServer until it is shut down
+func serve(server *http.Server) error {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import "time"
+
+// defaultTombstoneRetention is how long removed alert IDs are remembered
+const defaultTombstoneRetention = 15 * time.Minute
+
+// Tombstone records that an alert was removed from the board, so clients that
+// missed the removal (e.g. while reconnecting) can drop their local copy
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	RemovedAt time.Time `json:"removedAt"`
+	Seq       uint64    `json:"seq"`
+}
+
+// addTombstone records the removal of an alert and bumps the state sequence
+// This should be called while holding the lock
+func (a *AppState) addTombstone(alertID, reason string) {
+	a.search.remove(alertID)
+	a.seq++
+	a.tombstones = append(a.tombstones, Tombstone{
+		ID:        alertID,
+		Reason:    reason,
+		RemovedAt: time.Now(),
+		Seq:       a.seq,
+	})
+	a.pruneTombstones()
+}
+
+// pruneTombstones drops tombstones older than the retention period
+// This should be called while holding the lock
+func (a *AppState) pruneTombstones() {
+	cutoff := time.Now().Add(-a.tombstoneRetention)
+	i := 0
+	for i < len(a.tombstones) && a.tombstones[i].RemovedAt.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		a.tombstones = append([]Tombstone(nil), a.tombstones[i:]...)
+	}
+}
+
+// tombstonesSince returns the retained tombstones newer than the given sequence
+// This should be called while holding the lock
+func (a *AppState) tombstonesSince(seq uint64) []Tombstone {
+	result := make([]Tombstone, 0)
+	for _, t := range a.tombstones {
+		if t.Seq > seq {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTwilioAPIURL   = "https://api.twilio.com"
+	defaultTwilioRepeat   = 5 * time.Minute
+	defaultTwilioMaxCalls = 3
+
+	// How often a calling escalation checks whether its alerts were
+	// acknowledged, to hang up
+	twilioCheckInterval = 5 * time.Second
+
+	// Alert names read out in a call, the rest are counted
+	maxSpokenAlerts = 3
+)
+
+// validateTwilioAction checks a twilio escalation action and sets its defaults
+func validateTwilioAction(name string, action *ActionConfig) error {
+	if action.AccountSID == "" || action.AuthToken == "" {
+		return fmt.Errorf("escalation action %s: missing account_sid or auth_token", name)
+	}
+	if action.From == "" || action.To == "" {
+		return fmt.Errorf("escalation action %s: missing from or to", name)
+	}
+	if action.Repeat < 0 || action.MaxCalls < 0 {
+		return fmt.Errorf("escalation action %s: repeat and max_calls must be positive", name)
+	}
+	if action.Repeat == 0 {
+		action.Repeat = defaultTwilioRepeat
+	}
+	if action.MaxCalls == 0 {
+		action.MaxCalls = defaultTwilioMaxCalls
+	}
+	if action.APIURL == "" {
+		action.APIURL = defaultTwilioAPIURL
+	}
+	action.APIURL = strings.TrimSuffix(action.APIURL, "/")
+	return nil
+}
+
+// pendingEscalatedAlerts returns the alerts of an escalation still firing and
+// unacknowledged
+func (a *AppState) pendingEscalatedAlerts(alerts []AlertEntry) []AlertEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var pending []AlertEntry
+	for _, escalated := range alerts {
+		if entry, ok := a.alertByID(escalated.ID); ok && entry.Alert.Status == "firing" && a.acknowledged[entry.ID] == nil {
+			pending = append(pending, entry)
+		}
+	}
+	return pending
+}
+
+// callUntilAcknowledged phones the on-call person through Twilio, up to
+// max_calls times repeat apart, and hangs up as soon as none of the alerts of
+// the escalation is firing and unacknowledged anymore
+func (a *AppState) callUntilAcknowledged(name string, action *ActionConfig, event escalation) {
+	for calls := 0; calls < action.MaxCalls; calls++ {
+		pending := a.pendingEscalatedAlerts(event.Alerts)
+		if len(pending) == 0 {
+			return
+		}
+		sid, err := placeTwilioCall(action, escalation{Alerts: pending, After: event.After})
+		if err != nil {
+			escalationActions.WithLabelValues(name, "failed").Inc()
+			log.Errorf("Escalation action %s failed: %v", name, err)
+		} else {
+			escalationActions.WithLabelValues(name, "ok").Inc()
+			log.Infof("Escalation action %s called %s", name, action.To)
+		}
+
+		deadline := time.Now().Add(action.Repeat)
+		ticker := time.NewTicker(min(twilioCheckInterval, action.Repeat))
+		for now := range ticker.C {
+			if len(a.pendingEscalatedAlerts(event.Alerts)) == 0 {
+				ticker.Stop()
+				if sid != "" {
+					if err := hangUpTwilioCall(action, sid); err != nil {
+						// Most likely the call ended already
+						log.Debugf("Escalation action %s could not hang up: %v", name, err)
+					}
+				}
+				return
+			}
+			if !now.Before(deadline) {
+				break
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+// placeTwilioCall starts a call reading out the escalated alerts, retrying on
+// failure, and returns its SID
+func placeTwilioCall(action *ActionConfig, event escalation) (string, error) {
+	form := url.Values{
+		"To":    {action.To},
+		"From":  {action.From},
+		"Twiml": {twilioSpeech(event)},
+	}
+	var err error
+	for attempt := 0; attempt <= *action.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(action.RetryDelay)
+		}
+		var call struct {
+			SID string `json:"sid"`
+		}
+		if err = twilioPost(action, "/Calls.json", form, &call); err == nil {
+			return call.SID, nil
+		}
+	}
+	return "", err
+}
+
+// hangUpTwilioCall ends a call, ringing or in progress
+func hangUpTwilioCall(action *ActionConfig, sid string) error {
+	return twilioPost(action, "/Calls/"+url.PathEscape(sid)+".json", url.Values{"Status": {"completed"}}, nil)
+}
+
+// twilioPost calls the Calls API of the account
+func twilioPost(action *ActionConfig, path string, form url.Values, result any) error {
+	target := action.APIURL + "/2010-04-01/Accounts/" + url.PathEscape(action.AccountSID) + path
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(action.AccountSID, action.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := actionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("twilio returned %s: %s", resp.Status, apiErr.Message)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// twilioSpeech is the TwiML of a call: the names of the alerts, read out
+// three times
+func twilioSpeech(event escalation) string {
+	names := make([]string, 0, maxSpokenAlerts+1)
+	for i, entry := range event.Alerts {
+		if i == maxSpokenAlerts {
+			names = append(names, fmt.Sprintf("and %d more", len(event.Alerts)-i))
+			break
+		}
+		names = append(names, alertDisplayName(entry.Alert))
+	}
+	text := fmt.Sprintf("Wake me up. %s unacknowledged for %s: %s.",
+		spokenCount(len(event.Alerts), "alert"), spokenDuration(event.After), strings.Join(names, ", "))
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(text))
+	return `<Response><Say loop="3">` + escaped.String() + `</Say></Response>`
+}
+
+// spokenDuration reads a duration out, e.g. 5 minutes rather than 5m
+func spokenDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return spokenCount(int(d/time.Hour), "hour")
+	case d >= time.Minute:
+		return spokenCount(int(d/time.Minute), "minute")
+	}
+	return spokenCount(int(d/time.Second), "second")
+}
+
+// spokenCount puts a count before a unit, in the plural unless one
+func spokenCount(count int, unit string) string {
+	if count == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwilioCallUntilAcknowledged(t *testing.T) {
+	calls := make(chan string, 10)
+	hangUps := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "AC123" || !strings.HasPrefix(r.URL.Path, "/2010-04-01/Accounts/AC123/Calls") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Authenticate"}`))
+			return
+		}
+		r.ParseForm()
+		if r.URL.Path == "/2010-04-01/Accounts/AC123/Calls.json" {
+			calls <- r.PostForm.Get("Twiml")
+			w.Write([]byte(`{"sid":"CA1","status":"queued"}`))
+			return
+		}
+		hangUps <- r.URL.Path + " " + r.PostForm.Get("Status")
+		w.Write([]byte(`{"sid":"CA1","status":"completed"}`))
+	}))
+	defer server.Close()
+
+	action := &ActionConfig{Type: "twilio", AccountSID: "AC123", AuthToken: "secret", From: "+15005550006", To: "+15005550001", APIURL: server.URL}
+	if err := validateEscalations(nil, map[string]*ActionConfig{"call": action}); err != nil {
+		t.Fatal(err)
+	}
+	if action.Repeat != defaultTwilioRepeat || action.MaxCalls != defaultTwilioMaxCalls || *action.Retries != defaultActionRetries {
+		t.Errorf("Expected the defaults set, got %s, %d and %d", action.Repeat, action.MaxCalls, *action.Retries)
+	}
+	action.Repeat, action.MaxCalls = 200*time.Millisecond, 3
+
+	state := NewAppState(100)
+	state.AddWebhook(WebhookPayload{Alerts: []Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "Disk<Full>", "severity": "critical"}},
+	}})
+	alerts := state.GetAlerts()
+	done := make(chan struct{})
+	go func() {
+		state.callUntilAcknowledged("call", action, escalation{Alerts: alerts, After: 5 * time.Minute})
+		close(done)
+	}()
+
+	select {
+	case twiml := <-calls:
+		if twiml != `<Response><Say loop="3">Wake me up. 1 alert unacknowledged for 5 minutes: Disk&lt;Full&gt;.</Say></Response>` {
+			t.Errorf("Unexpected speech %s", twiml)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a call")
+	}
+	state.Acknowledge(alerts[0].ID, "alice")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected calls to stop once acknowledged")
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected a single call, got %d more", len(calls))
+	}
+	if len(hangUps) != 1 || <-hangUps != "/2010-04-01/Accounts/AC123/Calls/CA1.json completed" {
+		t.Error("Expected the call hung up")
+	}
+
+	if err := validateEscalations(nil, map[string]*ActionConfig{"call": {Type: "twilio", AccountSID: "AC123", AuthToken: "secret"}}); err == nil {
+		t.Error("Expected an action without numbers rejected")
+	}
+
+	none := 0
+	noRetries := &ActionConfig{Type: "push", URL: "http://localhost/", Retries: &none}
+	if err := validateEscalations(nil, map[string]*ActionConfig{"push": noRetries}); err != nil || *noRetries.Retries != 0 {
+		t.Errorf("Expected retries turned off with 0, got %v", err)
+	}
+}
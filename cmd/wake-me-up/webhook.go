@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -8,6 +12,7 @@ import (
 type WebhookPayload struct {
 	Version           string            `json:"version"`
 	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
 	Status            string            `json:"status"`
 	Receiver          string            `json:"receiver"`
 	GroupLabels       map[string]string `json:"groupLabels"`
@@ -22,4 +27,54 @@ type AlertEntry struct {
 	ID        string    `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
 	Alert     Alert     `json:"alert"`
+
+	IncidentID string `json:"incidentId,omitempty"` // open incident the alert is grouped under
+	Refired    bool   `json:"refired,omitempty"`    // fired again soon after the same labels were resolved or cleared
+
+	Rule *AlertRule `json:"rule,omitempty"` // alerting rule of a firing alert, see alert_rules
+
+	// Where the alert came from, to tell Alertmanagers and receivers apart
+	Receiver    string   `json:"receiver,omitempty"`
+	ExternalURL string   `json:"externalURL,omitempty"`
+	Replicas    []string `json:"replicas,omitempty"` // external URLs of other Alertmanager replicas that delivered it too
+
+	fingerprint string // labelFingerprint of the alert, set at ingestion
+	deliveryKey string // identifies its delivery across replicas, set at ingestion
+}
+
+// labelFingerprint returns the fingerprint of the alert labels
+func (e *AlertEntry) labelFingerprint() string {
+	if e.fingerprint == "" {
+		return labelFingerprint(e.Alert.Labels)
+	}
+	return e.fingerprint
+}
+
+// alertmanagerURL returns the base URL of the Alertmanager that sent an
+// alert, or an empty string if it isn't a usable http(s) URL
+func alertmanagerURL(externalURL string) string {
+	u, err := url.Parse(externalURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return strings.TrimRight(u.String(), "/")
+}
+
+// alertmanagerAlertLink links to the alert in the Alertmanager UI, filtered
+// by its labels
+func alertmanagerAlertLink(externalURL string, labels map[string]string) string {
+	base := alertmanagerURL(externalURL)
+	if base == "" {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	matchers := make([]string, len(keys))
+	for i, k := range keys {
+		matchers[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return base + "/#/alerts?filter=" + url.QueryEscape("{"+strings.Join(matchers, ",")+"}")
 }
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Web Push delivers notifications to browsers through their push service
+// (RFC 8030), so phones and laptops show them with the board closed. The
+// server identifies itself to the push services with a VAPID key (RFC 8292)
+// and encrypts each payload for the subscription (RFC 8291).
+
+const (
+	vapidKeysFile         = "vapid.json"
+	pushSubscriptionsFile = "push_subscriptions.json"
+
+	defaultWebPushTTL = 24 * time.Hour
+
+	// Push services take payloads of at least 4096 bytes
+	maxWebPushAlerts = 10
+	// Every browser that allowed notifications subscribes, bound them anyway
+	maxPushSubscriptions = 1000
+)
+
+// defaultPushServices are the hosts of the push services of Chrome, Firefox,
+// Edge and Safari. Subscription endpoints are URLs anyone can post, so
+// pushes only go to these rather than to any server the board can reach.
+var defaultPushServices = []string{
+	"fcm.googleapis.com",
+	"android.googleapis.com",
+	"updates.push.services.mozilla.com",
+	".notify.windows.com",
+	"web.push.apple.com",
+}
+
+// WebPushConfig sends notifications of new firing alerts to the browsers
+// subscribed from the board
+type WebPushConfig struct {
+	Subject    string        `yaml:"subject"`     // Contact for the push services, a mailto: or https: URL
+	PublicKey  string        `yaml:"public_key"`  // VAPID public key, base64url (optional, default: derived from private_key)
+	PrivateKey string        `yaml:"private_key"` // VAPID private key, base64url (optional, default: generated and kept in data_dir)
+	TTL        time.Duration `yaml:"ttl"`         // How long push services keep notifications for offline browsers (optional, default: 24h)
+	Services   []string      `yaml:"services"`    // Hosts of the push services subscriptions may use, ".example.com" for its subdomains (optional, default: those of Chrome, Firefox, Edge and Safari)
+}
+
+// PushSubscription is a browser's push subscription, as serialized by
+// PushSubscription.toJSON()
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256DH string `json:"p256dh"` // public key of the browser, base64url
+		Auth   string `json:"auth"`   // authentication secret, base64url
+	} `json:"keys"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// webPushPayload is what the service worker shows
+type webPushPayload struct {
+	Title              string `json:"title"`
+	Body               string `json:"body"`
+	Tag                string `json:"tag"` // the alert ID like board notifications, so they replace each other
+	URL                string `json:"url"` // opened on click
+	RequireInteraction bool   `json:"requireInteraction"`
+}
+
+// webPushNotifier sends one push message per subscription and event
+type webPushNotifier struct {
+	config    *WebPushConfig
+	links     *ackLinker
+	key       *ecdsa.PrivateKey
+	publicKey string // uncompressed point, base64url
+	client    *http.Client
+
+	mu            sync.Mutex
+	path          string                       // empty keeps subscriptions in memory
+	subscriptions map[string]*PushSubscription // by endpoint
+}
+
+// storedVAPIDKeys is the generated key pair kept in the data directory
+type storedVAPIDKeys struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+}
+
+func newWebPushNotifier(config *WebPushConfig, dataDir string, links *ackLinker) (*webPushNotifier, error) {
+	if !strings.HasPrefix(config.Subject, "mailto:") && !strings.HasPrefix(config.Subject, "https://") {
+		return nil, fmt.Errorf("subject must be a mailto: or https: URL, got %q", config.Subject)
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultWebPushTTL
+	}
+	if len(config.Services) == 0 {
+		config.Services = defaultPushServices
+	}
+
+	privateKey := config.PrivateKey
+	if privateKey == "" && dataDir != "" {
+		var stored storedVAPIDKeys
+		if _, err := loadJSON(filepath.Join(dataDir, vapidKeysFile), &stored); err != nil {
+			return nil, fmt.Errorf("reading %s: %v", vapidKeysFile, err)
+		}
+		privateKey = stored.PrivateKey
+	}
+	if privateKey == "" {
+		generated, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		privateKey = base64.RawURLEncoding.EncodeToString(generated.Bytes())
+		if dataDir == "" {
+			log.Warn("web_push: no private_key or data_dir, browsers must subscribe again after each restart")
+		} else {
+			stored := storedVAPIDKeys{PublicKey: base64.RawURLEncoding.EncodeToString(generated.PublicKey().Bytes()), PrivateKey: privateKey}
+			if err := saveJSON(filepath.Join(dataDir, vapidKeysFile), stored); err != nil {
+				return nil, fmt.Errorf("saving %s: %v", vapidKeysFile, err)
+			}
+			log.Infof("Generated a VAPID key for web push in %s", filepath.Join(dataDir, vapidKeysFile))
+		}
+	}
+	key, publicKey, err := parseVAPIDKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %v", err)
+	}
+	if config.PublicKey != "" && strings.TrimRight(config.PublicKey, "=") != publicKey {
+		return nil, errors.New("public_key does not match private_key")
+	}
+
+	push := &webPushNotifier{
+		config:        config,
+		links:         links,
+		key:           key,
+		publicKey:     publicKey,
+		client:        newPushClient(),
+		subscriptions: make(map[string]*PushSubscription),
+	}
+	if dataDir != "" {
+		push.path = filepath.Join(dataDir, pushSubscriptionsFile)
+		var subscriptions []*PushSubscription
+		if _, err := loadJSON(push.path, &subscriptions); err != nil {
+			return nil, fmt.Errorf("reading %s: %v", pushSubscriptionsFile, err)
+		}
+		for _, subscription := range subscriptions {
+			if err := push.checkEndpoint(subscription.Endpoint); err != nil {
+				log.Warnf("Dropping push subscription %s: %v", subscription.Endpoint, err)
+				continue
+			}
+			push.subscriptions[subscription.Endpoint] = subscription
+		}
+	}
+	return push, nil
+}
+
+// parseVAPIDKey decodes a P-256 private key, returning it with its public key
+func parseVAPIDKey(encoded string) (*ecdsa.PrivateKey, string, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	public := key.PublicKey().Bytes() // 0x04, X, Y
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(public[1:33]), Y: new(big.Int).SetBytes(public[33:])},
+		D:         new(big.Int).SetBytes(raw),
+	}, base64.RawURLEncoding.EncodeToString(public), nil
+}
+
+// decodeBase64URL decodes base64url with or without padding
+func decodeBase64URL(encoded string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+}
+
+func (p *webPushNotifier) Name() string {
+	return "webpush"
+}
+
+// Wants takes new firing alerts only, the board shows the rest
+func (p *webPushNotifier) Wants(kind string) bool {
+	return kind == EventFiring
+}
+
+// newPushClient returns the client pushing to the push services. It
+// connects to public addresses only, whatever the names of the services
+// resolve to, and doesn't follow redirects, so a subscription can't point
+// pushes at the board's network.
+func newPushClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+				return fmt.Errorf("push service address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// nonPublicNetworks are the special purpose ranges the net.IP checks leave
+// out, see RFC 6890
+var nonPublicNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // this network
+		"100.64.0.0/10",   // carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved, and broadcast
+		"64:ff9b::/96",    // NAT64, may reach any IPv4 address
+		"64:ff9b:1::/48",  // local NAT64
+		"2001:db8::/32",   // documentation
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// publicAddress checks that an address is on the internet, not loopback,
+// private, link-local, multicast or special purpose. IPv4-mapped IPv6
+// addresses are checked as the IPv4 address they map.
+func publicAddress(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkEndpoint checks that a subscription endpoint is an https URL of a
+// known push service
+func (p *webPushNotifier) checkEndpoint(rawURL string) error {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if port := endpoint.Port(); port != "" && port != "443" {
+		return fmt.Errorf("endpoint port %s is not the push services' 443", port)
+	}
+	host := strings.ToLower(endpoint.Hostname())
+	if ip := net.ParseIP(host); ip != nil && !publicAddress(ip) {
+		return fmt.Errorf("endpoint address %s is not public", host)
+	}
+	for _, service := range p.config.Services {
+		service = strings.ToLower(service)
+		if host == service || strings.HasPrefix(service, ".") && strings.HasSuffix(host, service) {
+			return nil
+		}
+	}
+	return fmt.Errorf("endpoint host %s is not a known push service", host)
+}
+
+// Subscribe adds or renews a browser's subscription
+func (p *webPushNotifier) Subscribe(subscription PushSubscription) error {
+	if err := p.checkEndpoint(subscription.Endpoint); err != nil {
+		return err
+	}
+	if key, err := decodeBase64URL(subscription.Keys.P256DH); err != nil || len(key) != 65 {
+		return errors.New("keys.p256dh must be an uncompressed P-256 public key")
+	}
+	if auth, err := decodeBase64URL(subscription.Keys.Auth); err != nil || len(auth) != 16 {
+		return errors.New("keys.auth must be 16 bytes")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.subscriptions[subscription.Endpoint]; !ok && len(p.subscriptions) >= maxPushSubscriptions {
+		return fmt.Errorf("too many subscriptions, at most %d", maxPushSubscriptions)
+	}
+	subscription.CreatedAt = time.Now()
+	p.subscriptions[subscription.Endpoint] = &subscription
+	p.save()
+	return nil
+}
+
+// Unsubscribe forgets a subscription, returning false if it is unknown
+func (p *webPushNotifier) Unsubscribe(endpoint string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.subscriptions[endpoint]; !ok {
+		return false
+	}
+	delete(p.subscriptions, endpoint)
+	p.save()
+	return true
+}
+
+// save persists the subscriptions
+// This should be called while holding the lock
+func (p *webPushNotifier) save() {
+	if p.path == "" {
+		return
+	}
+	subscriptions := make([]*PushSubscription, 0, len(p.subscriptions))
+	for _, subscription := range p.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := saveJSON(p.path, subscriptions); err != nil {
+		log.Errorf("Failed to persist push subscriptions: %v", err)
+	}
+}
+
+// Notify pushes the event to every subscription. Subscriptions the push
+// service no longer knows are dropped; it fails only if no push went through.
+func (p *webPushNotifier) Notify(event NotificationEvent) error {
+	p.mu.Lock()
+	subscriptions := make([]PushSubscription, 0, len(p.subscriptions))
+	for _, subscription := range p.subscriptions {
+		subscriptions = append(subscriptions, *subscription)
+	}
+	p.mu.Unlock()
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(p.render(event))
+	if err != nil {
+		return err
+	}
+	urgency := "normal"
+	for _, entry := range event.Alerts {
+		if severityLevel(alertSeverity(entry.Alert)) == StatusLevelCritical {
+			urgency = "high"
+		}
+	}
+	var errs []error
+	for _, subscription := range subscriptions {
+		gone, err := p.push(subscription, payload, urgency)
+		if gone {
+			log.Infof("Push subscription %s expired, dropping it", subscription.Endpoint)
+			p.Unsubscribe(subscription.Endpoint)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(subscriptions) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Warnf("Failed to push a notification: %v", err)
+	}
+	return nil
+}
+
+// push sends an encrypted payload to a subscription, telling if the push
+// service says it is gone
+func (p *webPushNotifier) push(subscription PushSubscription, payload []byte, urgency string) (bool, error) {
+	body, err := encryptWebPush(payload, subscription)
+	if err != nil {
+		return false, err
+	}
+	authorization, err := p.vapidAuthorization(subscription.Endpoint, time.Now())
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(p.config.TTL.Seconds())))
+	req.Header.Set("Urgency", urgency)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("push service %s returned %s", req.URL.Host, resp.Status)
+	}
+	return false, nil
+}
+
+// vapidAuthorization signs the VAPID token for the push service of an
+// endpoint
+func (p *webPushNotifier) vapidAuthorization(endpoint string, now time.Time) (string, error) {
+	service, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": service.Scheme + "://" + service.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": p.config.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return "vapid t=" + unsigned + "." + base64.RawURLEncoding.EncodeToString(signature) + ", k=" + p.publicKey, nil
+}
+
+// render builds the notification of an event
+func (p *webPushNotifier) render(event NotificationEvent) webPushPayload {
+	payload := webPushPayload{
+		Title: fmt.Sprintf("%d new alerts", len(event.Alerts)),
+		Tag:   "summary",
+		URL:   "/",
+	}
+	var lines []string
+	for i, entry := range event.Alerts {
+		if severityLevel(alertSeverity(entry.Alert)) == StatusLevelCritical {
+			payload.RequireInteraction = true
+		}
+		if i == maxWebPushAlerts {
+			lines = append(lines, fmt.Sprintf("…and %d more on the board", len(event.Alerts)-i))
+			break
+		}
+		line := alertTitle(entry.Alert)
+		if summary := entry.Alert.Annotations["summary"]; summary != "" {
+			line += ": " + summary
+		}
+		lines = append(lines, line)
+	}
+	payload.Body = strings.Join(lines, "\n")
+
+	// A single alert can be acknowledged right from the notification
+	if len(event.Alerts) == 1 {
+		entry := event.Alerts[0]
+		payload.Title = alertTitle(entry.Alert)
+		payload.Body = entry.Alert.Annotations["summary"]
+		if payload.Body == "" {
+			payload.Body = "firing since " + timeFormat.Absolute(entry.Alert.StartsAt)
+			if severity := alertSeverity(entry.Alert); severity != "" {
+				payload.Body = severity + ", " + payload.Body
+			}
+		}
+		payload.Tag = entry.ID
+		if link := p.links.Link(entry.ID); link != "" {
+			payload.URL = link
+		}
+	}
+	return payload
+}
+
+// encryptWebPush encrypts a payload for a subscription as a single aes128gcm
+// record (RFC 8291)
+func encryptWebPush(payload []byte, subscription PushSubscription) ([]byte, error) {
+	browserKey, err := decodeBase64URL(subscription.Keys.P256DH)
+	if err != nil {
+		return nil, err
+	}
+	browserPublic, err := ecdh.P256().NewPublicKey(browserKey)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := decodeBase64URL(subscription.Keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(browserPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	serverKey := ephemeral.PublicKey().Bytes()
+	gcm, nonce, err := webPushCipher(shared, auth, browserKey, serverKey, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length and key ID, the server's key
+	header := make([]byte, 0, 21+len(serverKey))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, 4096)
+	header = append(header, byte(len(serverKey)))
+	header = append(header, serverKey...)
+	// 0x02 marks the last record
+	plaintext := append(append([]byte(nil), payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// webPushCipher derives the content encryption key and nonce of a message
+func webPushCipher(shared, auth, browserKey, serverKey, salt []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), browserKey...)
+	keyInfo = append(keyInfo, serverKey...)
+	ikm := hkdfExpand(hkdfExtract(auth, shared), keyInfo, 32)
+	prk := hkdfExtract(salt, ikm)
+	block, err := aes.NewCipher(hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12), nil
+}
+
+// hkdfExtract and hkdfExpand are HKDF-SHA256 (RFC 5869), expanding to at
+// most one block
+func hkdfExtract(salt, ikm []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+func hkdfExpand(prk, info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:length]
+}
+
+// webPushHandler serves the VAPID public key (GET) and adds (POST) or
+// removes (DELETE) the push subscriptions of browsers
+func webPushHandler(push *webPushNotifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"publicKey": push.publicKey})
+
+		case http.MethodPost:
+			var subscription PushSubscription
+			if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := push.Subscribe(subscription); err != nil {
+				http.Error(w, "Invalid subscription: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Infof("Browser subscribed to web push via %s", r.RemoteAddr)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("OK"))
+
+		case http.MethodDelete:
+			var req struct {
+				Endpoint string `json:"endpoint"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if !push.Unsubscribe(req.Endpoint) {
+				http.Error(w, "Subscription not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebPush(t *testing.T) {
+	// A browser's subscription keys
+	browserKey, _ := ecdh.P256().GenerateKey(rand.Reader)
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	var mu sync.Mutex
+	var pushed []webPushPayload
+	var authorization, urgency string
+	service := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		// Decrypt as the browser would
+		salt, keyLength := body[:16], int(body[20])
+		serverKey := body[21 : 21+keyLength]
+		serverPublic, err := ecdh.P256().NewPublicKey(serverKey)
+		if err != nil || binary.BigEndian.Uint32(body[16:20]) != 4096 {
+			t.Errorf("Invalid header: %v", err)
+			return
+		}
+		shared, _ := browserKey.ECDH(serverPublic)
+		gcm, nonce, _ := webPushCipher(shared, auth, browserKey.PublicKey().Bytes(), serverKey, salt)
+		plaintext, err := gcm.Open(nil, nonce, body[21+keyLength:], nil)
+		if err != nil || plaintext[len(plaintext)-1] != 0x02 {
+			t.Errorf("Failed to decrypt the push message: %v", err)
+			return
+		}
+		var payload webPushPayload
+		json.Unmarshal(plaintext[:len(plaintext)-1], &payload)
+		mu.Lock()
+		pushed = append(pushed, payload)
+		authorization, urgency = r.Header.Get("Authorization"), r.Header.Get("Urgency")
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer service.Close()
+
+	// The push client refuses the test server as it's on loopback, so the
+	// allowed push service is dialed to it by the test's own client
+	if _, err := newPushClient().Post(service.URL, "text/plain", nil); err == nil {
+		t.Error("Expected pushes to a loopback address refused")
+	}
+	dir := t.TempDir()
+	config := &WebPushConfig{Subject: "mailto:oncall@example.com", Services: []string{"example.com"}}
+	push, err := newWebPushNotifier(config, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push.client = service.Client()
+	push.client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, service.Listener.Addr().String())
+	}
+	handler := webPushHandler(push)
+	subscribe := func(endpoint string) int {
+		subscription := map[string]interface{}{"endpoint": endpoint, "keys": map[string]string{
+			"p256dh": base64.RawURLEncoding.EncodeToString(browserKey.PublicKey().Bytes()),
+			"auth":   base64.RawURLEncoding.EncodeToString(auth),
+		}}
+		body, _ := json.Marshal(subscription)
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/push", strings.NewReader(string(body))))
+		return rec.Code
+	}
+	for _, endpoint := range []string{
+		"http://example.com/x",       // plain HTTP
+		"https://example.org/x",      // not a push service
+		"https://push.example.com/x", // subdomains need a leading dot
+		"https://example.com:8443/x", // not the push services' port
+		service.URL + "/x",           // loopback
+		"https://10.0.0.1/x",         // private
+	} {
+		if code := subscribe(endpoint); code != http.StatusBadRequest {
+			t.Errorf("Expected %s refused, got %d", endpoint, code)
+		}
+	}
+	if subscribe("https://example.com/browser") != http.StatusCreated || subscribe("https://example.com/gone") != http.StatusCreated {
+		t.Fatal("Expected the subscriptions added")
+	}
+
+	event := NotificationEvent{Kind: EventFiring, Alerts: []AlertEntry{{ID: "a1", Alert: Alert{
+		Status:      "firing",
+		Labels:      map[string]string{"alertname": "DiskFull", "severity": "critical"},
+		Annotations: map[string]string{"summary": "Disk almost full"},
+	}}}}
+	if err := push.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed) != 1 || pushed[0].Title != "DiskFull" || pushed[0].Body != "Disk almost full" || pushed[0].Tag != "a1" || !pushed[0].RequireInteraction {
+		t.Fatalf("Expected the alert pushed, got %+v", pushed)
+	}
+	if urgency != "high" {
+		t.Errorf("Expected a critical alert pushed with high urgency, got %q", urgency)
+	}
+	if len(push.subscriptions) != 1 {
+		t.Errorf("Expected the gone subscription dropped, got %d", len(push.subscriptions))
+	}
+
+	// The VAPID token is signed by the key the browsers subscribed with
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "vapid "), ", ") {
+		if value, ok := strings.CutPrefix(part, "t="); ok {
+			token = value
+		} else if value, ok := strings.CutPrefix(part, "k="); ok {
+			key = value
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/push", nil))
+	if !strings.Contains(rec.Body.String(), key) || key == "" {
+		t.Errorf("Expected the served public key in the authorization, got %q", authorization)
+	}
+	parts := strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(signature) != 64 || !ecdsa.Verify(&push.key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Error("Expected a valid VAPID signature")
+	}
+
+	// The generated key and the subscriptions survive a restart
+	restarted, err := newWebPushNotifier(config, dir, nil)
+	if err != nil || restarted.publicKey != push.publicKey || len(restarted.subscriptions) != 1 {
+		t.Errorf("Expected the key and subscription restored, got %v", err)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::6810":  true,
+		"10.0.0.1":         false,
+		"::ffff:10.0.0.1":  false,
+		"::ffff:127.0.0.1": false,
+		"100.64.0.1":       false,
+		"0.0.0.1":          false,
+		"198.18.0.1":       false,
+		"64:ff9b::a00:1":   false,
+	} {
+		if got := publicAddress(net.ParseIP(address)); got != public {
+			t.Errorf("Expected publicAddress(%s) = %v, got %v", address, public, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const defaultNetworkZoneLabel = "source_zone"
+
+// NetworkZoneConfig maps source networks of webhooks to a zone name
+type NetworkZoneConfig struct {
+	Name  string   `yaml:"name"`
+	CIDRs []string `yaml:"cidrs"`
+}
+
+// networkZone is a parsed NetworkZoneConfig
+type networkZone struct {
+	name string
+	nets []*net.IPNet
+}
+
+// parseNetworkZones validates the zone mappings, so typos fail at startup
+// instead of silently leaving alerts untagged
+func parseNetworkZones(configs []NetworkZoneConfig) ([]networkZone, error) {
+	zones := make([]networkZone, 0, len(configs))
+	for _, config := range configs {
+		if strings.TrimSpace(config.Name) == "" {
+			return nil, fmt.Errorf("network zone without name")
+		}
+		zone := networkZone{name: config.Name}
+		for _, cidr := range config.CIDRs {
+			ipNet, err := parseNetwork(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("network zone %q: %w", config.Name, err)
+			}
+			zone.nets = append(zone.nets, ipNet)
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// parseNetwork parses a CIDR; single IPs are treated as host networks
+func parseNetwork(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		if strings.Contains(cidr, ":") {
+			cidr += "/128"
+		} else {
+			cidr += "/32"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
+
+// zoneFor returns the name of the first zone containing the IP, if any
+func zoneFor(zones []networkZone, clientIP string) string {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return ""
+	}
+	for _, zone := range zones {
+		for _, ipNet := range zone.nets {
+			if ipNet.Contains(ip) {
+				return zone.name
+			}
+		}
+	}
+	return ""
+}
+
+// tagSourceZone labels the alerts of a payload with the network zone it was
+// sent from; labels already set by the sender are kept
+func (a *AppState) tagSourceZone(payload *WebhookPayload, clientIP string) {
+	if len(a.zones) == 0 {
+		return
+	}
+	zone := zoneFor(a.zones, clientIP)
+	if zone == "" {
+		return
+	}
+
+	label := a.config.NetworkZoneLabel
+	if label == "" {
+		label = defaultNetworkZoneLabel
+	}
+	for i := range payload.Alerts {
+		if payload.Alerts[i].Labels == nil {
+			payload.Alerts[i].Labels = make(map[string]string)
+		}
+		if _, exists := payload.Alerts[i].Labels[label]; !exists {
+			payload.Alerts[i].Labels[label] = zone
+		}
+	}
+}
@@ -8,36 +8,95 @@ const reconnectDelay = 3000;
 // Current state
 let currentAlerts = [];
 let currentHasUnacknowledged = false;
+let currentLevel = 'ok';
+let currentTheme = null;
+let currentBanner = null;
+let currentLock = null;
+let currentRendered = null;
+let currentIncidents = [];
+let lastSeq = 0;
+let lastInstance = ''; // in cluster mode, the instance lastSeq belongs to
+let deviceToken = localStorage.getItem('deviceToken') || '';
+let ackName = localStorage.getItem('ackName') || ''; // who acknowledges from this browser
+let zoneLabel = '';
+let zoneFilter = new URLSearchParams(window.location.search).get('zone') || '';
+let currentEnvironments = [];
+let visibleAlerts = []; // alerts shown with the current filters
+let environmentLabel = '';
+let environmentFilter = new URLSearchParams(window.location.search).get('env') || '';
+let searchQuery = '';
+let searchResults = null; // alert ID -> search result, null without a query
+let searchTimer = null;
 
 // Sound playback
 let soundAudio = null;
 let soundInterval = null;
 let soundEnabled = true;
 let audioContextUnlocked = false;
+let currentSound = null; // sound directive of the server: loop, play_once or stop
+let playedSoundKey = null; // key of the last directive played, play_once plays once per key
+let soundEndedAt = 0;
+let currentLabelWarning = null; // labels trimmed lately, see label_limits
+
+function handleMessage(data) {
+    try {
+        const message = JSON.parse(data);
+        if (message.type === 'update') {
+            saveLastState(message);
+            lastSeq = message.seq || lastSeq;
+            lastInstance = message.instance || '';
+            currentAlerts = message.alerts || [];
+            currentBanner = message.banner || null;
+            currentLock = message.lock || null;
+            currentRendered = message.rendered || null;
+            currentIncidents = message.incidents || [];
+            zoneLabel = message.zoneLabel || '';
+            currentEnvironments = message.environments || [];
+            environmentLabel = message.environmentLabel || '';
+            currentHasUnacknowledged = message.hasUnacknowledged || false;
+            currentLevel = message.level || (currentHasUnacknowledged ? 'warning' : 'ok');
+            currentTheme = message.theme || null;
+            currentSound = message.sound || null;
+            currentLabelWarning = message.labelWarning || null;
+            updateUI();
+            updateSoundStatus();
+            if (searchQuery) runSearch();
+            checkBoard(message.checksum);
+        } else if (message.type === 'checksum') {
+            checkBoard(message.checksum);
+        } else if (message.type === 'test-sound' || message.type === 'chime') {
+            playTestSound();
+        } else if (message.type === 'all-clear') {
+            playAllClearChime();
+        } else if (message.type === 'escalation') {
+            playEscalation(message);
+        } else if (message.type === 'notification') {
+            showNotification(message);
+        }
+    } catch (error) {
+        console.error('Error parsing WebSocket message:', error);
+    }
+}
 
 function connectWebSocket() {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = protocol + '//' + window.location.host + '/ws';
+    let wsUrl = protocol + '//' + window.location.host + '/ws?since=' + lastSeq +
+        '&instance=' + encodeURIComponent(lastInstance);
+    if (deviceToken) {
+        wsUrl += '&device=' + encodeURIComponent(deviceToken);
+    }
     
     ws = new WebSocket(wsUrl);
 
     ws.onopen = function() {
         console.log('WebSocket connected');
         reconnectAttempts = 0;
+        reportNotificationPermission();
     };
 
     ws.onmessage = function(event) {
-        try {
-            const message = JSON.parse(event.data);
-            if (message.type === 'update') {
-                currentAlerts = message.alerts || [];
-                currentHasUnacknowledged = message.hasUnacknowledged || false;
-                updateUI();
-                updateSoundStatus();
-            }
-        } catch (error) {
-            console.error('Error parsing WebSocket message:', error);
-        }
+        // The server batches queued messages into one frame, separated by newlines
+        event.data.split('\n').forEach(handleMessage);
     };
 
     ws.onerror = function(error) {
@@ -59,6 +118,166 @@ function connectWebSocket() {
     };
 }
 
+// Checksum of the board as the server computes it: 32-bit FNV-1a over one
+// "id:status:acknowledged" line per alert, sorted
+function boardChecksum(alerts) {
+    const lines = alerts.map(function(entry) {
+        const alert = entry.alert || entry.Alert;
+        return entry.id + ':' + (alert.status || alert.Status) + ':' + (entry.isAcknowledged ? 1 : 0) + '\n';
+    }).sort();
+    let hash = 0x811c9dc5;
+    new TextEncoder().encode(lines.join('')).forEach(function(byte) {
+        hash ^= byte;
+        hash = Math.imul(hash, 0x01000193) >>> 0;
+    });
+    return hash.toString(16).padStart(8, '0');
+}
+
+// Ask the server for a fresh snapshot if the board missed an update
+function checkBoard(checksum) {
+    if (!checksum || boardChecksum(currentAlerts) === checksum) return;
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        console.log('Board out of date, requesting a resync');
+        ws.send(JSON.stringify({ type: 'resync' }));
+    }
+}
+
+// Current browser notification permission: granted, denied, default or unsupported
+function notificationPermission() {
+    return 'Notification' in window ? Notification.permission : 'unsupported';
+}
+
+// Tell the server whether this client can show notifications, for the clients admin view
+function reportNotificationPermission() {
+    if (!('notifications' in document.body.dataset) && !('push' in document.body.dataset)) return;
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'notification-permission', permission: notificationPermission() }));
+    }
+    const buttonEl = document.querySelector('.notifications-btn');
+    if (buttonEl) {
+        buttonEl.style.display = notificationPermission() === 'default' ? '' : 'none';
+    }
+}
+
+function enableNotifications() {
+    if (!('Notification' in window)) {
+        alert('This browser does not support notifications');
+        return;
+    }
+    Notification.requestPermission().then(() => {
+        reportNotificationPermission();
+        subscribePush();
+    });
+}
+
+// Subscribe this browser to web push, so notifications arrive with the board
+// closed. The subscription is posted again on every load, the server keeps
+// the latest.
+function subscribePush() {
+    if (!('push' in document.body.dataset) || notificationPermission() !== 'granted') return;
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) return;
+    navigator.serviceWorker.ready.then(registration =>
+        registration.pushManager.getSubscription().then(subscription => subscription ||
+            fetch('/api/v1/push').then(response => response.json()).then(key =>
+                registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: base64UrlToBytes(key.publicKey)
+                }))))
+        .then(subscription => fetch('/api/v1/push', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(subscription)
+        }))
+        .catch(err => console.error('Web push subscription failed:', err));
+}
+
+function base64UrlToBytes(encoded) {
+    const base64 = encoded.replace(/-/g, '+').replace(/_/g, '/');
+    return Uint8Array.from(atob(base64 + '='.repeat((4 - base64.length % 4) % 4)), c => c.charCodeAt(0));
+}
+
+// Show a notification pushed by the server, unless the user did not allow them
+function showNotification(message) {
+    if (notificationPermission() !== 'granted') return;
+    const notification = new Notification(message.title, {
+        body: message.body,
+        tag: message.tag,
+        requireInteraction: message.requireInteraction,
+        icon: document.body.dataset.alarmFavicon
+    });
+    notification.onclick = function() {
+        window.focus();
+        notification.close();
+    };
+}
+
+// Show the number of unacknowledged alerts in the tab title and favicon
+function updateTabIndicators() {
+    const dataset = document.body.dataset;
+    const unacknowledged = currentAlerts.filter(entry => entry.needsAck).length;
+    const title = unacknowledged > 0 ? '(' + unacknowledged + ') ' + dataset.title : dataset.title;
+    if (document.title !== title) {
+        document.title = title;
+    }
+
+    const iconEl = document.querySelector('link[rel="icon"]');
+    const icon = currentLevel === 'ok' ? dataset.favicon : dataset.alarmFavicon;
+    if (iconEl && icon && iconEl.getAttribute('href') !== icon) {
+        iconEl.setAttribute('href', icon);
+    }
+}
+
+// Keep the last known state so the dashboard can render and alarm offline
+function saveLastState(message) {
+    try {
+        localStorage.setItem('lastState', JSON.stringify(message));
+    } catch (error) {
+        console.error('Error saving last state:', error);
+    }
+}
+
+function restoreLastState() {
+    try {
+        const saved = localStorage.getItem('lastState');
+        if (!saved) return;
+        const message = JSON.parse(saved);
+        lastSeq = message.seq || 0;
+        lastInstance = message.instance || '';
+        currentAlerts = message.alerts || [];
+        currentHasUnacknowledged = message.hasUnacknowledged || false;
+        currentLevel = message.level || (currentHasUnacknowledged ? 'warning' : 'ok');
+        currentBanner = message.banner || null;
+        currentLock = message.lock || null;
+        currentEnvironments = message.environments || [];
+        environmentLabel = message.environmentLabel || '';
+        currentSound = message.sound || null;
+        updateUI();
+        updateSoundStatus();
+    } catch (error) {
+        console.error('Error restoring last state:', error);
+    }
+}
+
+function registerServiceWorker() {
+    if (!('serviceWorker' in navigator)) return;
+
+    navigator.serviceWorker.register('/sw.js').then(registration => {
+        // Ask the worker to refresh its cache when the asset version changed
+        fetch('/api/v1/assets').then(response => response.json()).then(manifest => {
+            if (localStorage.getItem('assetVersion') !== manifest.version) {
+                localStorage.setItem('assetVersion', manifest.version);
+                if (registration.active) {
+                    registration.active.postMessage({ type: 'refresh-assets' });
+                }
+            }
+        }).catch(err => {
+            console.log('Could not check asset version:', err);
+        });
+    }).catch(err => {
+        console.error('Service worker registration failed:', err);
+    });
+}
+
 function acknowledgeAlert(alertId) {
     // Unlock audio context if needed (this is user interaction)
     if (!audioContextUnlocked) {
@@ -76,7 +295,7 @@ function acknowledgeAlert(alertId) {
         }
     }
     
-    fetch('/acknowledge?id=' + alertId, {
+    fetch('/acknowledge?id=' + alertId + (ackName ? '&by=' + encodeURIComponent(ackName) : ''), {
         method: 'POST'
     })
     .then(response => {
@@ -90,6 +309,52 @@ function acknowledgeAlert(alertId) {
     });
 }
 
+// Acknowledge an alert saying who handles it and how; the name is remembered
+// for later acknowledgements from this browser
+function acknowledgeWithComment(alertId) {
+    const name = prompt('Your name:', ackName);
+    if (name === null) return;
+    const comment = prompt('Comment (e.g. restarting the replica):', '');
+    if (comment === null) return;
+    ackName = name.trim();
+    localStorage.setItem('ackName', ackName);
+
+    fetch('/acknowledge?id=' + encodeURIComponent(alertId) +
+        '&by=' + encodeURIComponent(ackName) +
+        '&comment=' + encodeURIComponent(comment.trim()), { method: 'POST' })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to acknowledge alert: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to acknowledge alert');
+    });
+}
+
+// Acknowledge the alerts shown with the current filters in one request
+function acknowledgeVisible() {
+    const ids = visibleAlerts.filter(entry => entry.needsAck).map(entry => entry.id || entry.ID);
+    if (ids.length === 0) return;
+    if (!confirm('Acknowledge ' + ids.length + ' alert(s)?')) return;
+
+    fetch('/api/v1/alerts/acknowledge', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ids: ids, by: ackName })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to acknowledge alerts: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to acknowledge alerts');
+    });
+}
+
 function clearAlerts() {
     // Unlock audio context if needed (this is user interaction)
     if (!audioContextUnlocked) {
@@ -107,11 +372,14 @@ function clearAlerts() {
         }
     }
     
-    fetch('/clear', {
+    // Refuse to clear if the board changed since this client last saw it
+    fetch('/clear?if_version=' + lastSeq + '&instance=' + encodeURIComponent(lastInstance), {
         method: 'POST'
     })
     .then(response => {
-        if (!response.ok) {
+        if (response.status === 409) {
+            alert('The board changed in the meantime, check the new alerts before clearing');
+        } else if (!response.ok) {
             alert('Failed to clear alerts');
         }
     })
@@ -121,19 +389,464 @@ function clearAlerts() {
     });
 }
 
+// Name this device so it shows up in the clients admin view
+function registerDevice() {
+    const name = prompt('Name for this device (e.g. Bedroom tablet):', localStorage.getItem('deviceName') || '');
+    if (name === null || name.trim() === '') return;
+
+    fetch('/api/v1/devices/register', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token: deviceToken, name: name.trim() })
+    })
+    .then(response => {
+        if (!response.ok) {
+            throw new Error('status ' + response.status);
+        }
+        return response.json();
+    })
+    .then(device => {
+        deviceToken = device.token;
+        localStorage.setItem('deviceToken', device.token);
+        localStorage.setItem('deviceName', device.name);
+        // Reconnect so the server associates this connection with the device
+        if (ws) {
+            ws.close();
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to register device');
+    });
+}
+
+function playTestSound() {
+    if (!soundAudio) {
+        initializeAudio();
+    }
+    soundAudio.currentTime = 0;
+    soundAudio.play().catch(err => {
+        console.error('Error playing test sound:', err);
+    });
+}
+
+// A short rising two-tone chime, so the board going green sounds nothing
+// like the alarm
+function playAllClearChime() {
+    if (!soundEnabled || !audioContextUnlocked) return;
+    const AudioContextClass = window.AudioContext || window.webkitAudioContext;
+    if (!AudioContextClass) return;
+    const context = new AudioContextClass();
+    [523.25, 783.99].forEach((frequency, i) => {
+        const oscillator = context.createOscillator();
+        const gain = context.createGain();
+        const start = context.currentTime + i * 0.18;
+        oscillator.type = 'sine';
+        oscillator.frequency.value = frequency;
+        gain.gain.setValueAtTime(0.3, start);
+        gain.gain.exponentialRampToValueAtTime(0.001, start + 0.4);
+        oscillator.connect(gain).connect(context.destination);
+        oscillator.start(start);
+        oscillator.stop(start + 0.4);
+    });
+    setTimeout(() => context.close(), 1000);
+}
+
+// Replay the alarm louder for an alert left unacknowledged too long. The
+// element volume tops out at 1.0, so the sound goes through a gain node.
+function playEscalation(message) {
+    if (!soundEnabled || !audioContextUnlocked || !soundWanted()) return;
+    initializeAudio();
+    const audio = new Audio(soundAudio.getAttribute('src') || '/sound');
+    const AudioContextClass = window.AudioContext || window.webkitAudioContext;
+    if (AudioContextClass) {
+        const context = new AudioContextClass();
+        const gain = context.createGain();
+        gain.gain.value = 2.0;
+        context.createMediaElementSource(audio).connect(gain).connect(context.destination);
+        audio.addEventListener('ended', () => context.close());
+    }
+    audio.play().catch(err => {
+        console.error('Error playing escalation sound:', err);
+    });
+}
+
+function editBanner() {
+    const message = prompt('Banner message (empty to remove):', currentBanner ? currentBanner.message : '');
+    if (message === null) return;
+
+    let request;
+    if (message.trim() === '') {
+        request = fetch('/api/v1/banner', { method: 'DELETE' });
+    } else {
+        const duration = prompt('Show for (e.g. 2h, 30m, empty for no expiry):', '');
+        if (duration === null) return;
+        const body = { message: message };
+        if (duration.trim() !== '') {
+            body.duration = duration.trim();
+        }
+        request = fetch('/api/v1/banner', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+    }
+
+    request
+    .then(response => {
+        if (!response.ok) {
+            alert('Failed to update banner');
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to update banner');
+    });
+}
+
+// Acknowledge an alert for a while, it sounds the alarm again afterwards if
+// still firing
+function snoozeAlert(alertId) {
+    const duration = prompt('Snooze for (e.g. 30m or 2h):', '30m');
+    if (duration === null) return;
+
+    fetch('/snooze?id=' + encodeURIComponent(alertId) +
+        '&duration=' + encodeURIComponent(duration.trim()), { method: 'POST' })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to snooze alert: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to snooze alert');
+    });
+}
+
+// Acknowledge an alert until a follow-up time, when it chimes again if it is
+// still firing, with a note for whoever looks at it next
+function acknowledgeWithFollowUp(alertId) {
+    const followUp = prompt('Remind me if still firing at (e.g. 08:00 or 2h):', '08:00');
+    if (followUp === null) return;
+    const note = prompt('Note:', '');
+    if (note === null) return;
+
+    fetch('/acknowledge?id=' + encodeURIComponent(alertId) +
+        '&followUp=' + encodeURIComponent(followUp.trim()) +
+        '&note=' + encodeURIComponent(note.trim()), { method: 'POST' })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to acknowledge alert: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to acknowledge alert');
+    });
+}
+
+// Mark an alert's outage as in progress: it and related alerts are
+// acknowledged and only chime now and then until the incident is closed
+function startIncident(alertId) {
+    const title = prompt('Incident title:', '');
+    if (title === null) return;
+    const labels = prompt('Group alerts with the same values of these labels:', 'alertname');
+    if (labels === null) return;
+
+    fetch('/api/v1/incidents', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            alertId: alertId,
+            title: title.trim(),
+            labels: labels.split(',').map(l => l.trim()).filter(l => l !== '')
+        })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to start incident: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to start incident');
+    });
+}
+
+// Put an alert on the follow-up list, which keeps it after clears until closed
+function markForReview(alertId) {
+    const note = prompt('What needs following up?', '');
+    if (note === null) return;
+
+    fetch('/api/v1/reviews', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ alertId: alertId, note: note.trim() })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => alert('Failed to mark alert: ' + text));
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to mark alert');
+    });
+}
+
+function closeIncident(incidentId) {
+    if (!confirm('Close this incident? Related alerts will sound the alarm again.')) return;
+
+    fetch('/api/v1/incidents?id=' + encodeURIComponent(incidentId), { method: 'DELETE' })
+    .then(response => {
+        if (!response.ok) {
+            alert('Failed to close incident');
+        }
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        alert('Failed to close incident');
+    });
+}
+
+function updateBanner() {
+    const bannerEl = document.querySelector('.banner');
+    if (!bannerEl) return;
+
+    // Overridden templates are rendered by the server
+    if (currentRendered) {
+        bannerEl.outerHTML = currentRendered.banner;
+        return;
+    }
+
+    if (!currentBanner) {
+        bannerEl.style.display = 'none';
+        return;
+    }
+    bannerEl.style.display = '';
+    bannerEl.querySelector('.banner-message').textContent = currentBanner.message;
+    bannerEl.querySelector('.banner-expiry').textContent = currentBanner.expiresAt
+        ? 'until ' + (currentBanner.expiresText || new Date(currentBanner.expiresAt).toLocaleString())
+        : '';
+}
+
+// Show the board lock and disable clears and bulk actions while it is set
+function updateBoardLock() {
+    document.querySelectorAll('.locked-btn').forEach(buttonEl => {
+        buttonEl.disabled = currentLock !== null;
+    });
+    const lockEl = document.querySelector('.board-lock');
+    if (!lockEl) return;
+    if (!currentLock) {
+        lockEl.style.display = 'none';
+        return;
+    }
+    lockEl.style.display = '';
+    lockEl.textContent = '🔒 Board locked' + (currentLock.by ? ' by ' + currentLock.by : '') +
+        (currentLock.reason ? ': ' + currentLock.reason : '');
+}
+
+function updateLabelWarning() {
+    const warningEl = document.querySelector('.label-warning');
+    if (!warningEl) return;
+    if (!currentLabelWarning) {
+        warningEl.style.display = 'none';
+        return;
+    }
+    warningEl.style.display = '';
+    warningEl.textContent = '⚠️ ' + currentLabelWarning.message;
+}
+
+// Fill the zone filter with the zones of the current alerts
+function updateZoneFilter() {
+    const selectEl = document.querySelector('.zone-filter');
+    if (!selectEl) return;
+
+    if (!zoneLabel) {
+        selectEl.style.display = 'none';
+        return;
+    }
+
+    const zones = new Set();
+    currentAlerts.forEach(entry => {
+        const labels = (entry.alert || entry.Alert).labels || {};
+        if (labels[zoneLabel]) {
+            zones.add(labels[zoneLabel]);
+        }
+    });
+    if (zoneFilter) {
+        zones.add(zoneFilter);
+    }
+
+    // Zones come from alert labels, so the options are built as elements
+    // rather than HTML
+    const options = [new Option('All zones', '')];
+    Array.from(zones).sort().forEach(zone => {
+        options.push(new Option(zone, zone, false, zone === zoneFilter));
+    });
+    selectEl.replaceChildren(...options);
+    selectEl.style.display = '';
+}
+
+function setZoneFilter(zone) {
+    zoneFilter = zone;
+    const url = new URL(window.location.href);
+    if (zone) {
+        url.searchParams.set('zone', zone);
+    } else {
+        url.searchParams.delete('zone');
+    }
+    window.history.replaceState(null, '', url);
+    updateUI();
+}
+
+// Tabs of the environments on the board, with their unacknowledged and total counts
+function updateEnvironmentTabs() {
+    const tabsEl = document.querySelector('.env-tabs');
+    if (!tabsEl) return;
+
+    if (!environmentLabel) {
+        tabsEl.style.display = 'none';
+        return;
+    }
+
+    let html = '<button class="env-tab' + (environmentFilter ? '' : ' active') + '" data-env="">All</button>';
+    currentEnvironments.forEach(tab => {
+        if (!tab.name) return;
+        html += '<button class="env-tab' + (tab.name === environmentFilter ? ' active' : '') + '" data-env="' + escapeAttribute(tab.name) + '">' +
+            escapeHTML(tab.name) + ' <span class="env-count">' + tab.unacknowledged + '/' + tab.total + '</span></button>';
+    });
+    tabsEl.innerHTML = html;
+    tabsEl.style.display = '';
+}
+
+// Environment names come from alert labels, so the tabs carry them as data
+// rather than in inline handlers
+document.addEventListener('click', function(event) {
+    const tab = event.target.closest('.env-tab');
+    if (tab) setEnvironment(tab.dataset.env);
+});
+
+function setEnvironment(env) {
+    environmentFilter = env;
+    const url = new URL(window.location.href);
+    if (env) {
+        url.searchParams.set('env', env);
+    } else {
+        url.searchParams.delete('env');
+    }
+    window.history.replaceState(null, '', url);
+    updateUI();
+    updateSoundStatus();
+}
+
+// Filter the board by a search, run on the server shortly after typing stops
+function searchAlerts(query) {
+    searchQuery = query.trim();
+    clearTimeout(searchTimer);
+    if (!searchQuery) {
+        searchResults = null;
+        updateUI();
+        return;
+    }
+    searchTimer = setTimeout(runSearch, 200);
+}
+
+function runSearch() {
+    const query = searchQuery;
+    fetch('/api/v1/search?q=' + encodeURIComponent(query))
+        .then(response => response.ok ? response.json() : Promise.reject(new Error(response.statusText)))
+        .then(data => {
+            if (query !== searchQuery) return; // a newer search is running
+            searchResults = new Map((data.results || []).map(result => [result.id, result]));
+            updateUI();
+        })
+        .catch(error => console.error('Search failed:', error));
+}
+
+// Escape a text, marking the ranges a search matched
+function highlightHTML(text, ranges) {
+    let html = '';
+    let last = 0;
+    (ranges || []).forEach(range => {
+        html += escapeHTML(text.slice(last, range[0])) + '<mark>' + escapeHTML(text.slice(range[0], range[1])) + '</mark>';
+        last = range[1];
+    });
+    return html + escapeHTML(text.slice(last));
+}
+
+// Ranges of a field the search matched in an alert, if any
+function searchRanges(entry, field) {
+    const result = searchResults && searchResults.get(entry.id || entry.ID);
+    const match = result && result.matches.find(m => m.field === field);
+    return match ? match.ranges : null;
+}
+
+// Whether the alarm should sound, following the sound policy of each
+// environment: always, only on its tab, or never
+function soundWanted() {
+    if (!currentHasUnacknowledged) return false;
+    if (!environmentLabel) return true;
+    return currentEnvironments.some(tab => tab.unacknowledged > 0 &&
+        (tab.sound === 'always' || (tab.sound === 'tab' && tab.name === environmentFilter)));
+}
+
+function getStatusClass(level) {
+    if (level === 'critical') return 'active';
+    if (level === 'warning') return 'warning';
+    return 'clear';
+}
+
+function getStatusText(level) {
+    if (level === 'critical') return '🚨 CRITICAL ALERTS UNACKNOWLEDGED';
+    if (level === 'warning') return '⚠️ UNACKNOWLEDGED ALERTS';
+    return '✓ ALL CLEAR';
+}
+
 function updateUI() {
     // Update status indicator
     const statusEl = document.querySelector('.status');
     if (statusEl) {
-        statusEl.className = 'status ' + (currentHasUnacknowledged ? 'active' : 'clear');
-        statusEl.textContent = currentHasUnacknowledged ? '⚠️ UNACKNOWLEDGED ALERTS' : '✓ ALL CLEAR';
+        statusEl.className = 'status ' + getStatusClass(currentLevel);
+        statusEl.textContent = (currentTheme && currentTheme.text) || getStatusText(currentLevel);
+        statusEl.style.background = (currentTheme && currentTheme.color) || '';
     }
+    updateBanner();
+    updateBoardLock();
+    updateLabelWarning();
+    updateZoneFilter();
+    updateEnvironmentTabs();
+    updateTabIndicators();
 
     // Update alert list
     const alertListEl = document.querySelector('.alert-list');
     if (!alertListEl) return;
 
-    if (currentAlerts.length === 0) {
+    // Overridden templates are rendered by the server, unfiltered
+    if (currentRendered) {
+        visibleAlerts = currentAlerts;
+        alertListEl.innerHTML = currentRendered['alert-list'];
+        return;
+    }
+
+    visibleAlerts = currentAlerts.filter(entry => {
+        const labels = (entry.alert || entry.Alert).labels || {};
+        if (environmentLabel && environmentFilter && labels[environmentLabel] !== environmentFilter) return false;
+        if (searchResults && !searchResults.has(entry.id || entry.ID)) return false;
+        if (!zoneLabel || !zoneFilter) return true;
+        return labels[zoneLabel] === zoneFilter;
+    });
+
+    if (searchResults) {
+        // Best matches first
+        visibleAlerts.sort((a, b) => searchResults.get(b.id || b.ID).score - searchResults.get(a.id || a.ID).score);
+    }
+
+    if (visibleAlerts.length === 0 && searchResults) {
+        alertListEl.innerHTML = '<div class="empty-state"><h2>No alerts match "' + escapeHTML(searchQuery) + '"</h2></div>';
+        return;
+    }
+    if (visibleAlerts.length === 0) {
         alertListEl.innerHTML = '<div class="empty-state">' +
             '<h2>No alerts received yet</h2>' +
             '<p>Waiting for Alertmanager to send alerts...</p>' +
@@ -141,84 +854,231 @@ function updateUI() {
         return;
     }
 
+    // Alerts of open incidents are grouped under them, the rest follow
     let html = '';
-    currentAlerts.forEach(entry => {
-        const alert = entry.alert || entry.Alert;
-        const isAcknowledged = entry.isAcknowledged || false;
-        
-        // Determine status
-        let statusClass = 'resolved';
-        let statusText = 'Resolved';
-        const alertStatus = alert.status || alert.Status;
-
-        if (alertStatus === 'firing') {
-            if (isAcknowledged) {
-                statusClass = 'acknowledged';
-                statusText = 'Acknowledged';
-            } else {
-                statusClass = 'firing';
-                statusText = 'Firing';
-            }
-        } else if (alertStatus === 'resolved') {
-            statusClass = 'resolved';
-            statusText = 'Resolved';
+    const grouped = new Set();
+    currentIncidents.forEach(incident => {
+        const members = visibleAlerts.filter(entry => entry.incidentId === incident.id);
+        members.forEach(entry => grouped.add(entry));
+        html += '<div class="incident">' +
+            '<div class="incident-header">' +
+            '<h2>🔧 ' + escapeHTML(incident.title) + ' (' + members.length + ' alerts)</h2>' +
+            '<button class="clear-btn" onclick="closeIncident(\'' + incident.id + '\')">Close incident</button>' +
+            '</div>';
+        members.forEach(entry => {
+            html += renderAlertCard(entry);
+        });
+        html += '</div>';
+    });
+    visibleAlerts.forEach(entry => {
+        if (!grouped.has(entry)) {
+            html += renderAlertCard(entry);
         }
+    });
 
-        const timestamp = entry.timestamp || entry.Timestamp;
-        const timestampStr = typeof timestamp === 'string' ? timestamp : new Date(timestamp).toLocaleString();
-
-        html += '<div class="alert-card">' +
-            '<div class="alert-header">' +
-            '<div>' +
-            '<div class="alert-id">ID: ' + (entry.id || entry.ID) + '</div>' +
-            '<div class="alert-time">' + timestampStr + '</div>' +
-            '</div>' +
-            '<div>' +
-            '<div class="alert-status ' + statusClass + '">' + statusText + '</div>' +
-            '</div>' +
-            '</div>';
+    alertListEl.innerHTML = html;
+}
+
+function renderAlertCard(entry) {
+    const alert = entry.alert || entry.Alert;
+    const isAcknowledged = entry.isAcknowledged || false;
+    
+    // Determine status
+    let statusClass = 'resolved';
+    let statusText = 'Resolved';
+    const alertStatus = alert.status || alert.Status;
 
-        if (alertStatus === 'firing' && !isAcknowledged) {
-            html += '<div style="margin-bottom: 15px;">' +
-                '<button class="ack-btn" onclick="acknowledgeAlert(\'' + (entry.id || entry.ID) + '\')">' +
-                '✓ Acknowledge Alert' +
-                '</button>' +
-                '</div>';
+    if (alertStatus === 'firing') {
+        if (isAcknowledged && entry.acknowledgement && entry.acknowledgement.silence) {
+            statusClass = 'silenced';
+            statusText = 'Silenced';
+        } else if (isAcknowledged) {
+            statusClass = 'acknowledged';
+            statusText = 'Acknowledged';
+        } else {
+            statusClass = 'firing';
+            statusText = 'Firing';
         }
+    } else if (alertStatus === 'resolved') {
+        statusClass = 'resolved';
+        statusText = 'Resolved';
+    }
 
-        html += '<div class="alert-item ' + statusClass + '">';
+    const timestamp = entry.timestamp || entry.Timestamp;
+    const timestampStr = entry.timestampText || new Date(timestamp).toLocaleString();
 
-        const labels = alert.labels || alert.Labels || {};
-        if (Object.keys(labels).length > 0) {
-            const alertName = labels.alertname || labels.alertname;
-            if (alertName) {
-                html += '<div style="margin: 8px 0;"><span style="font-size: 16px; font-weight: bold; color: #333;">' + alertName + '</span></div>';
-            }
+    let html = '<div class="alert-card">' +
+        '<div class="alert-header">' +
+        '<div>' +
+        '<div class="alert-id">ID: ' + (entry.id || entry.ID) + '</div>' +
+        '<div class="alert-time">' + timestampStr + '</div>' +
+        renderAlertSource(entry) +
+        '</div>' +
+        '<div>' +
+        '<div class="alert-status ' + statusClass + '">' + statusText + '</div>' +
+        (entry.severity ? '<div class="alert-severity"' + (entry.severityColor ? ' style="background: ' + escapeHTML(entry.severityColor) + ';"' : '') + '>' + escapeHTML(entry.severity) + '</div>' : '') +
+        (entry.refired ? '<div class="alert-refired" title="Fired again soon after it was resolved or cleared">🔁 Re-fired</div>' : '') +
+        '</div>' +
+        '</div>';
 
-            html += '<div style="margin: 8px 0;"><strong>Labels:</strong><br>';
-            const labelKeys = Object.keys(labels).sort();
-            labelKeys.forEach(function(k) {
-                html += '<span class="label">' + k + '=' + labels[k] + '</span>';
-            });
-            html += '</div>';
-        }
+    if (entry.needsAck) {
+        html += '<div style="margin-bottom: 15px;">' +
+            '<button class="ack-btn" onclick="acknowledgeAlert(\'' + (entry.id || entry.ID) + '\')">' +
+            '✓ Acknowledge Alert' +
+            '</button>' +
+            ' <button class="comment-btn" onclick="acknowledgeWithComment(\'' + (entry.id || entry.ID) + '\')">💬 Comment</button>' +
+            ' <button class="followup-btn" onclick="acknowledgeWithFollowUp(\'' + (entry.id || entry.ID) + '\')">⏰ Remind me</button>' +
+            (alertStatus === 'firing' ? ' <button class="snooze-btn" onclick="snoozeAlert(\'' + (entry.id || entry.ID) + '\')">😴 Snooze</button>' : '') +
+            '</div>';
+        html += '<img class="alert-qr" src="/api/v1/alerts/qr?id=' + encodeURIComponent(entry.id || entry.ID) + '" alt="Scan to acknowledge" loading="lazy">';
+    }
+    if (alertStatus === 'firing' && !entry.incidentId) {
+        html += '<div style="margin-bottom: 15px;">' +
+            '<button class="incident-btn" onclick="startIncident(\'' + (entry.id || entry.ID) + '\')">Incident in progress</button>' +
+            '</div>';
+    }
+    if (entry.ageText) {
+        html += '<div class="alert-age">⏱ Unacknowledged for ' + escapeHTML(entry.ageText) + '</div>';
+    }
+    if (entry.acknowledgement) {
+        const ack = entry.acknowledgement;
+        html += '<div class="alert-ack">' + (ack.silence ? '🔇 Silenced' : '✓ Acknowledged') + (ack.by ? ' by ' + escapeHTML(ack.by) : '') +
+            ' ' + escapeHTML(ack.atText || '') + (ack.comment ? ': ' + escapeHTML(ack.comment) : '') + '</div>';
+    }
+    if (entry.snooze) {
+        html += '<div class="alert-snooze">😴 Snoozed until ' + escapeHTML(entry.snooze.untilText) + '</div>';
+    }
+    if (entry.followUp) {
+        const noteRanges = searchRanges(entry, 'note');
+        html += '<div class="alert-followup">⏰ Follow-up ' + escapeHTML(entry.followUp.dueText) +
+            (entry.followUp.note ? ': ' + (noteRanges ? highlightHTML(entry.followUp.note, noteRanges) : escapeHTML(entry.followUp.note)) : '') + '</div>';
+    }
+    if (entry.review) {
+        html += '<div class="alert-review">📝 Needs follow-up' + (entry.review.note ? ': ' + escapeHTML(entry.review.note) : '') + '</div>';
+    } else {
+        html += '<button class="review-btn" onclick="markForReview(\'' + (entry.id || entry.ID) + '\')">📝 Needs follow-up</button>';
+    }
 
-        const startsAt = alert.startsAt || alert.StartsAt;
-        if (startsAt) {
-            const startsAtStr = typeof startsAt === 'string' ? startsAt : new Date(startsAt).toLocaleString();
-            html += '<div style="margin-top: 8px; font-size: 12px; color: #666;">Started: ' + startsAtStr + '</div>';
-        }
+    html += '<div class="alert-item ' + statusClass + '">';
 
-        const endsAt = alert.endsAt || alert.EndsAt;
-        if (endsAt) {
-            const endsAtStr = typeof endsAt === 'string' ? endsAt : new Date(endsAt).toLocaleString();
-            html += '<div style="margin-top: 4px; font-size: 12px; color: #666;">Ended: ' + endsAtStr + '</div>';
+    const labels = alert.labels || alert.Labels || {};
+    if (Object.keys(labels).length > 0) {
+        const alertName = labels.alertname || labels.alertname;
+        if (alertName) {
+            html += '<div style="margin: 8px 0;"><span style="font-size: 16px; font-weight: bold; color: #333;">' +
+                (entry.decoration ? escapeHTML(entry.decoration) + ' ' : '') + alertName + '</span></div>';
         }
+    }
 
-        html += '</div></div>';
-    });
+    const annotations = alert.annotations || {};
+    if (annotations.summary) {
+        html += '<div class="alert-summary">' + annotationHTML(entry, 'summary', annotations.summary) + '</div>';
+    }
+    if (annotations.description) {
+        html += '<div class="alert-description">' + annotationHTML(entry, 'description', annotations.description) + '</div>';
+    }
 
-    alertListEl.innerHTML = html;
+    if (Object.keys(labels).length > 0) {
+        html += '<div style="margin: 8px 0;"><strong>Labels:</strong><br>';
+        const labelKeys = Object.keys(labels).sort();
+        labelKeys.forEach(function(k) {
+            const ranges = searchRanges(entry, 'labels.' + k);
+            html += '<span class="label">' + escapeHTML(k) + '=' + (ranges ? highlightHTML(labels[k], ranges) : escapeHTML(labels[k])) + '</span>';
+        });
+        html += '</div>';
+    }
+
+    const annotationKeys = Object.keys(annotations).filter(k => !['summary', 'description', 'runbook_url'].includes(k)).sort();
+    if (annotationKeys.length > 0) {
+        html += '<div style="margin: 8px 0;"><strong>Annotations:</strong><br>';
+        annotationKeys.forEach(function(k) {
+            html += '<div class="annotation"><span class="annotation-name">' + escapeHTML(k) + ':</span> ' + annotationHTML(entry, k, annotations[k]) + '</div>';
+        });
+        html += '</div>';
+    }
+
+    if (entry.rule) {
+        html += '<div class="alert-rule"><strong>Rule</strong> ' + escapeHTML(entry.rule.name) +
+            (entry.rule.group ? ' in ' + escapeHTML(entry.rule.group) : '') +
+            (entry.rule.for ? ', for ' + escapeHTML(entry.rule.for) : '') +
+            ':<pre class="alert-rule-expr">' + escapeHTML(entry.rule.expr) + '</pre></div>';
+    }
+
+    const startsAt = alert.startsAt || alert.StartsAt;
+    if (startsAt) {
+        const startsAtStr = entry.startsAtText || new Date(startsAt).toLocaleString();
+        html += '<div style="margin-top: 8px; font-size: 12px; color: #666;">Started: ' + startsAtStr + '</div>';
+    }
+
+    const endsAt = alert.endsAt || alert.EndsAt;
+    if (endsAt) {
+        const endsAtStr = entry.endsAtText || new Date(endsAt).toLocaleString();
+        html += '<div style="margin-top: 4px; font-size: 12px; color: #666;">Ended: ' + endsAtStr + '</div>';
+    }
+
+    const alertLink = alertmanagerAlertLink(entry.externalURL, labels);
+    if (alertLink) {
+        html += '<div style="margin-top: 4px; font-size: 12px;"><a href="' + alertLink + '" target="_blank" rel="noopener">View in Alertmanager</a></div>';
+    }
+
+    const runbook = alertmanagerURL(annotations.runbook_url);
+    if (runbook) {
+        html += '<div style="margin-top: 4px; font-size: 12px;"><a href="' + escapeHTML(runbook.href) + '" target="_blank" rel="noopener">📖 Runbook</a></div>';
+    }
+
+    html += '</div></div>';
+    return html;
+}
+
+// An annotation value, escaped and with the search matches highlighted
+function annotationHTML(entry, name, value) {
+    const ranges = searchRanges(entry, 'annotations.' + name);
+    return ranges ? highlightHTML(value, ranges) : escapeHTML(value);
+}
+
+// Base URL of the Alertmanager that sent an alert, if it is an http(s) URL
+function alertmanagerURL(externalURL) {
+    try {
+        const url = new URL(externalURL);
+        if (url.protocol !== 'http:' && url.protocol !== 'https:') return null;
+        return url;
+    } catch (e) {
+        return null;
+    }
+}
+
+// Link to the alert in the Alertmanager UI, filtered by its labels
+function alertmanagerAlertLink(externalURL, labels) {
+    const url = alertmanagerURL(externalURL);
+    if (!url) return '';
+    const matchers = Object.keys(labels).sort().map(k => k + '=' + JSON.stringify(labels[k]));
+    return url.href.replace(/\/$/, '') + '/#/alerts?filter=' + encodeURIComponent('{' + matchers.join(',') + '}');
+}
+
+// Escape user-entered text, such as follow-up notes, before inserting it as HTML
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text || '';
+    return div.innerHTML;
+}
+
+// escapeAttribute escapes text for an attribute value in double quotes
+function escapeAttribute(text) {
+    return escapeHTML(text).replace(/"/g, '&quot;');
+}
+
+// Receiver and Alertmanager that routed the alert
+function renderAlertSource(entry) {
+    const url = alertmanagerURL(entry.externalURL);
+    if (!entry.receiver && !url) return '';
+    let html = '<div class="alert-source">';
+    if (entry.receiver) {
+        html += 'via ' + escapeHTML(entry.receiver) + ' ';
+    }
+    if (url) {
+        html += '@ <a href="' + escapeAttribute(url.href) + '" target="_blank" rel="noopener">' + escapeHTML(url.host) + '</a>';
+    }
+    return html + '</div>';
 }
 
 function initializeAudio() {
@@ -227,16 +1087,9 @@ function initializeAudio() {
         soundAudio.volume = 1.0;
         soundAudio.preload = 'auto';
         
+        // The loop restarts the sound once the server's interval passed
         soundAudio.addEventListener('ended', function() {
-            if (soundInterval !== null && soundEnabled && currentHasUnacknowledged) {
-                setTimeout(() => {
-                    if (soundInterval !== null && soundEnabled && currentHasUnacknowledged) {
-                        soundAudio.play().catch(err => {
-                            console.error('Error playing sound after end:', err);
-                        });
-                    }
-                }, 2000);
-            }
+            soundEndedAt = Date.now();
         });
         
         soundAudio.addEventListener('error', function(e) {
@@ -246,12 +1099,53 @@ function initializeAudio() {
     }
 }
 
+// Play the sound the server asks for: the re-fired sound while any
+// unacknowledged alert fired again soon after it went away, else the sound of
+// the most severe sounding alert
+function updateSoundVariant() {
+    if (!soundAudio) return;
+    const params = new URLSearchParams();
+    if (currentSound && currentSound.variant) params.set('variant', currentSound.variant);
+    if (currentSound && currentSound.severity) params.set('severity', currentSound.severity);
+    const src = params.toString() ? '/sound?' + params.toString() : '/sound';
+    if (soundAudio.getAttribute('src') !== src) {
+        const playing = !soundAudio.paused;
+        soundAudio.src = src;
+        if (playing) {
+            soundAudio.play().catch(err => {
+                console.error('Error playing sound:', err);
+            });
+        }
+    }
+}
+
+// Follow the sound directive of the server, as long as the alarm is wanted
+// on this tab
 function updateSoundStatus() {
-    if (currentHasUnacknowledged && soundEnabled && audioContextUnlocked) {
-                startSoundLoop();
-            } else {
-                stopSoundLoop();
-            }
+    updateSoundVariant();
+    const action = currentSound ? currentSound.action : 'stop';
+    if (action === 'stop' || !soundWanted() || !soundEnabled || !audioContextUnlocked) {
+        stopSoundLoop();
+        return;
+    }
+    const played = currentSound.key === playedSoundKey;
+    playedSoundKey = currentSound.key;
+    if (action === 'play_once') {
+        if (soundInterval !== null) {
+            stopSoundLoop();
+        }
+        if (!played) {
+            playTestSound();
+        }
+        return;
+    }
+    startSoundLoop();
+}
+
+// Pause between plays of the loop, as set by the server
+function soundLoopDelay() {
+    const seconds = currentSound && currentSound.interval;
+    return (seconds || 2) * 1000;
 }
 
 function startSoundLoop() {
@@ -268,16 +1162,16 @@ function startSoundLoop() {
     });
 
     soundInterval = setInterval(() => {
-        if (!soundEnabled || !audioContextUnlocked || !currentHasUnacknowledged) {
+        if (!soundEnabled || !audioContextUnlocked || !soundWanted()) {
             stopSoundLoop();
             return;
         }
         
-        if (soundAudio.paused && soundInterval !== null) {
-                    soundAudio.play().catch(err => {
-                        console.error('Error restarting sound:', err);
-                    });
-                }
+        if (soundAudio.paused && soundInterval !== null && Date.now() - soundEndedAt >= soundLoopDelay()) {
+            soundAudio.play().catch(err => {
+                console.error('Error restarting sound:', err);
+            });
+        }
     }, 1000);
 }
 
@@ -322,6 +1216,14 @@ if (soundAudio) {
     });
 }
 
+// Render the last known state until the server answers
+if (!navigator.onLine) {
+    restoreLastState();
+}
+registerServiceWorker();
+reportNotificationPermission();
+subscribePush();
+
 // Connect WebSocket
 connectWebSocket();
 
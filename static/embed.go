@@ -0,0 +1,10 @@
+// Package static embeds the board's CSS, JS and icons, so the binary serves
+// the dashboard, and installs as an app, without a static directory next to it.
+package static
+
+import "embed"
+
+// FS holds the default static files, the service worker included
+//
+//go:embed *.js *.css *.svg
+var FS embed.FS
@@ -0,0 +1,106 @@
+// Service worker: keeps the dashboard shell, assets and alarm sound cached so
+// the page can still load and alarm during brief network blips
+
+const CACHE_PREFIX = 'wake-me-up-';
+const SHELL_URLS = ['/'];
+
+async function fetchManifest() {
+    const response = await fetch('/api/v1/assets', { cache: 'no-store' });
+    if (!response.ok) {
+        throw new Error('Failed to fetch asset manifest: ' + response.status);
+    }
+    return response.json();
+}
+
+// Cache every asset of the current manifest version under its own cache name
+async function precache() {
+    const manifest = await fetchManifest();
+    const cache = await caches.open(CACHE_PREFIX + manifest.version);
+    await cache.addAll(SHELL_URLS.concat(manifest.assets.map(asset => asset.url)));
+    return manifest.version;
+}
+
+// Drop caches of older asset versions
+async function cleanup(currentVersion) {
+    const names = await caches.keys();
+    await Promise.all(names
+        .filter(name => name.startsWith(CACHE_PREFIX) && name !== CACHE_PREFIX + currentVersion)
+        .map(name => caches.delete(name)));
+}
+
+self.addEventListener('install', event => {
+    event.waitUntil(precache().then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', event => {
+    event.waitUntil(fetchManifest()
+        .then(manifest => cleanup(manifest.version))
+        .catch(err => console.error('Error cleaning up caches:', err))
+        .then(() => self.clients.claim()));
+});
+
+// Clients ask for a refresh when they notice a new asset version
+self.addEventListener('message', event => {
+    if (event.data && event.data.type === 'refresh-assets') {
+        event.waitUntil(precache().then(version => cleanup(version)));
+    }
+});
+
+// Notifications pushed by the server through web push, shown even with the
+// board closed
+self.addEventListener('push', event => {
+    const message = event.data ? event.data.json() : { title: 'Wake me Up!', body: 'New alerts' };
+    event.waitUntil(self.registration.showNotification(message.title, {
+        body: message.body,
+        tag: message.tag,
+        requireInteraction: message.requireInteraction,
+        icon: '/static/icon-alarm.svg',
+        data: { url: message.url || '/' }
+    }));
+});
+
+// Clicking a pushed notification focuses an open board, or opens its link
+self.addEventListener('notificationclick', event => {
+    event.notification.close();
+    const url = event.notification.data && event.notification.data.url || '/';
+    event.waitUntil(self.clients.matchAll({ type: 'window' }).then(windows => {
+        const board = windows.find(client => new URL(client.url).pathname === '/');
+        if (board && url === '/') {
+            return board.focus();
+        }
+        return self.clients.openWindow(url);
+    }));
+});
+
+self.addEventListener('fetch', event => {
+    const url = new URL(event.request.url);
+    if (event.request.method !== 'GET' || url.origin !== self.location.origin) {
+        return;
+    }
+
+    // Live data is never served from cache
+    if (url.pathname.startsWith('/api/') || url.pathname === '/status' || url.pathname === '/ws') {
+        return;
+    }
+
+    // The page is fetched fresh when possible, falling back to the cached shell
+    if (url.pathname === '/') {
+        event.respondWith(fetch(event.request)
+            .then(response => {
+                const copy = response.clone();
+                caches.keys().then(names => {
+                    const name = names.find(n => n.startsWith(CACHE_PREFIX));
+                    if (name) {
+                        caches.open(name).then(cache => cache.put('/', copy));
+                    }
+                });
+                return response;
+            })
+            .catch(() => caches.match('/')));
+        return;
+    }
+
+    // Assets and the sound are served from cache first
+    event.respondWith(caches.match(event.request)
+        .then(cached => cached || fetch(event.request)));
+});
@@ -0,0 +1,10 @@
+// Package templates embeds the default HTML templates, so the binary renders
+// the dashboard without a templates directory next to it.
+package templates
+
+import "embed"
+
+// FS holds the default page templates and the blocks they are built from
+//
+//go:embed *.html
+var FS embed.FS
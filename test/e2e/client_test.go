@@ -0,0 +1,162 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppastorf/wake-me-up/client"
+)
+
+func TestClientPackage(t *testing.T) {
+	s := startServer(t, "")
+	c := client.New(s.baseURL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan client.Update, 16)
+	go c.StreamUpdates(ctx, func(u client.Update) { updates <- u })
+	waitForUpdate := func(desc string, cond func(client.Update) bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case u := <-updates:
+				if cond(u) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Timed out waiting for %s", desc)
+			}
+		}
+	}
+	waitForUpdate("initial state", func(u client.Update) bool { return len(u.Alerts) == 0 })
+
+	data, err := os.ReadFile(filepath.Join(repoRoot, "test", "mock-webhook-firing.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var payload client.WebhookPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatalf("Failed to decode fixture: %v", err)
+	}
+	result, err := c.PushAlerts(ctx, payload)
+	if err != nil {
+		t.Fatalf("PushAlerts failed: %v", err)
+	}
+	if result.Created != 1 || result.Alerts[0].ID == "" {
+		t.Fatalf("Expected one created alert, got %+v", result)
+	}
+	id := result.Alerts[0].ID
+
+	alerts, err := c.ListAlerts(ctx)
+	if err != nil {
+		t.Fatalf("ListAlerts failed: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != id || alerts[0].IsAcknowledged {
+		t.Fatalf("Expected the pushed alert unacknowledged, got %+v", alerts)
+	}
+
+	if err := c.Acknowledge(ctx, id); err != nil {
+		t.Fatalf("Acknowledge failed: %v", err)
+	}
+	waitForUpdate("acknowledged alert", func(u client.Update) bool {
+		return len(u.Alerts) == 1 && u.Alerts[0].IsAcknowledged && !u.HasUnacknowledged
+	})
+
+	// Acknowledging again with a name and comment tells who handles it
+	if err := c.AcknowledgeWithComment(ctx, id, "alice", "restarting the replica"); err != nil {
+		t.Fatalf("AcknowledgeWithComment failed: %v", err)
+	}
+	waitForUpdate("acknowledgement by alice", func(u client.Update) bool {
+		ack := u.Alerts[0].Acknowledgement
+		return ack != nil && ack.By == "alice" && ack.Comment == "restarting the replica" && !ack.At.IsZero()
+	})
+
+	var statusErr *client.StatusError
+	if err := c.Acknowledge(ctx, ""); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected a 400 status error for a missing ID, got %v", err)
+	}
+}
+
+func TestClientQueryAlerts(t *testing.T) {
+	s := startServer(t, "")
+	c := client.New(s.baseURL)
+	ctx := context.Background()
+
+	payload := `{"status": "firing", "alerts": [
+		{"status": "firing", "labels": {"alertname": "A", "severity": "warning", "instance": "db-1"}, "startsAt": "2024-01-15T10:30:00Z"},
+		{"status": "firing", "labels": {"alertname": "B", "severity": "critical", "instance": "db-2"}, "startsAt": "2024-01-15T10:31:00Z"},
+		{"status": "firing", "labels": {"alertname": "C", "severity": "critical", "instance": "web-1"}, "startsAt": "2024-01-15T10:32:00Z"}]}`
+	s.post(t, "/webhook", "application/json", []byte(payload))
+
+	names := func(alerts []client.AlertEntry) string {
+		var names []string
+		for _, alert := range alerts {
+			names = append(names, alert.Alert.Labels["alertname"])
+		}
+		return strings.Join(names, ",")
+	}
+
+	alerts, total, err := c.QueryAlerts(ctx, client.AlertQuery{Labels: []string{`instance=~"db-.*"`}, Sort: "name", Descending: true})
+	if err != nil || total != 2 || names(alerts) != "B,A" {
+		t.Fatalf("Expected B,A of 2, got %s of %d (%v)", names(alerts), total, err)
+	}
+
+	alerts, total, err = c.QueryAlerts(ctx, client.AlertQuery{Labels: []string{"severity=critical"}, Sort: "starts_at", Limit: 1, Offset: 1})
+	if err != nil || total != 2 || names(alerts) != "C" {
+		t.Fatalf("Expected the second page to be C of 2, got %s of %d (%v)", names(alerts), total, err)
+	}
+
+	acknowledged := true
+	if alerts, total, err = c.QueryAlerts(ctx, client.AlertQuery{Acknowledged: &acknowledged}); err != nil || total != 0 || len(alerts) != 0 {
+		t.Fatalf("Expected no acknowledged alerts, got %d (%v)", total, err)
+	}
+
+	var statusErr *client.StatusError
+	if _, _, err := c.QueryAlerts(ctx, client.AlertQuery{Sort: "random"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected a 400 status error for an unknown sort order, got %v", err)
+	}
+}
+
+func TestClientBulkAcknowledge(t *testing.T) {
+	s := startServer(t, "")
+	c := client.New(s.baseURL)
+	ctx := context.Background()
+	ws := s.connect(t)
+	ws.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-multiple-alerts.json")
+	seen := ws.waitFor(t, "three firing alerts", alertCount(3))
+
+	ids := []string{seen.Alerts[0].ID, seen.Alerts[1].ID}
+	if acked, err := c.AcknowledgeAlerts(ctx, ids); err != nil || len(acked) != 2 {
+		t.Fatalf("Expected two alerts acknowledged, got %v (%v)", acked, err)
+	}
+	// A single broadcast carries both acknowledgements
+	updates := ws.next(t)
+	if len(updates) != 1 {
+		t.Fatalf("Expected one update, got %+v", updates)
+	}
+	for _, alert := range updates[0].Alerts {
+		if alert.IsAcknowledged != (alert.ID != seen.Alerts[2].ID) {
+			t.Fatalf("Expected both alerts acknowledged in the update, got %+v", updates[0].Alerts)
+		}
+	}
+
+	acked, err := c.AcknowledgeAllAlerts(ctx, "")
+	if err != nil || len(acked) != 1 || acked[0] != seen.Alerts[2].ID {
+		t.Fatalf("Expected the remaining alert acknowledged, got %v (%v)", acked, err)
+	}
+
+	var statusErr *client.StatusError
+	if _, err := c.AcknowledgeAlerts(ctx, nil); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected a 400 status error without IDs, got %v", err)
+	}
+}
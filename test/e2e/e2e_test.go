@@ -0,0 +1,1084 @@
+// Package e2e runs the wake-me-up binary against realistic Alertmanager
+// payloads and checks what connected WebSocket clients see.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// repoRoot is where templates, static assets and fixtures live
+const repoRoot = "../.."
+
+var binaryPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "wake-me-up-e2e")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create temp dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	binaryPath = filepath.Join(dir, "wake-me-up")
+	build := exec.Command("go", "build", "-o", binaryPath, "./cmd/wake-me-up")
+	build.Dir = repoRoot
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build server: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// server is a running wake-me-up instance
+type server struct {
+	baseURL string
+	wsURL   string
+	cmd     *exec.Cmd
+}
+
+// startServer runs the binary with a temp config and waits until it serves requests
+func startServer(t *testing.T, extraConfig string) *server {
+	t.Helper()
+
+	port := freePort(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := fmt.Sprintf("listen_port: %d\nlog_level: debug\nsound_effect_file_path: 'sounds/siren1.wav'\n%s", port, extraConfig)
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(binaryPath, "-config="+configPath)
+	cmd.Dir = repoRoot
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if t.Failed() {
+			t.Logf("Server output:\n%s", output.String())
+		}
+	})
+
+	s := &server{
+		baseURL: fmt.Sprintf("http://127.0.0.1:%d", port),
+		wsURL:   fmt.Sprintf("ws://127.0.0.1:%d/ws", port),
+		cmd:     cmd,
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(s.baseURL + "/status")
+		if err == nil {
+			resp.Body.Close()
+			return s
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Server did not start listening on port %d", port)
+	return nil
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// postFixture sends a payload from the test directory to the webhook endpoint
+func (s *server) postFixture(t *testing.T, name string) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join(repoRoot, "test", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	s.post(t, "/webhook", "application/json", body)
+}
+
+func (s *server) post(t *testing.T, path, contentType string, body []byte) {
+	t.Helper()
+	resp, err := http.Post(s.baseURL+path, contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s returned %d", path, resp.StatusCode)
+	}
+}
+
+func (s *server) status(t *testing.T) map[string]interface{} {
+	t.Helper()
+	resp, err := http.Get(s.baseURL + "/status")
+	if err != nil {
+		t.Fatalf("GET /status failed: %v", err)
+	}
+	defer resp.Body.Close()
+	result := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	return result
+}
+
+// update mirrors the fields of the WebSocket update message the tests rely on
+type update struct {
+	Type              string  `json:"type"`
+	Seq               uint64  `json:"seq"`
+	HasUnacknowledged bool    `json:"hasUnacknowledged"`
+	Alerts            []entry `json:"alerts"`
+	Tombstones        []struct {
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	} `json:"tombstones"`
+	Banner *struct {
+		Message   string     `json:"message"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	} `json:"banner"`
+	Rendered     map[string]string `json:"rendered"`
+	Environments []struct {
+		Name           string `json:"name"`
+		Total          int    `json:"total"`
+		Unacknowledged int    `json:"unacknowledged"`
+		Sound          string `json:"sound"`
+	} `json:"environments"`
+}
+
+type entry struct {
+	ID             string `json:"id"`
+	IsAcknowledged bool   `json:"isAcknowledged"`
+	IncidentID     string `json:"incidentId"`
+	Alert          struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+		EndsAt *time.Time        `json:"endsAt"`
+	} `json:"alert"`
+}
+
+// wsClient is a headless dashboard client
+type wsClient struct {
+	conn *websocket.Conn
+}
+
+func (s *server) connect(t *testing.T) *wsClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(s.wsURL, nil)
+	if err != nil {
+		t.Fatalf("WebSocket dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{conn: conn}
+}
+
+// next returns the next update message, splitting frames that carry several
+// newline-separated messages
+func (c *wsClient) next(t *testing.T) []update {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("WebSocket read failed: %v", err)
+	}
+	var updates []update
+	for _, line := range strings.Split(string(data), "\n") {
+		var u update
+		if err := json.Unmarshal([]byte(line), &u); err != nil {
+			t.Fatalf("Failed to decode update %q: %v", line, err)
+		}
+		if u.Type == "update" {
+			updates = append(updates, u)
+		}
+	}
+	return updates
+}
+
+// waitFor reads updates until one satisfies the condition
+func (c *wsClient) waitFor(t *testing.T, desc string, cond func(update) bool) update {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, u := range c.next(t) {
+			if cond(u) {
+				return u
+			}
+		}
+	}
+	t.Fatalf("Timed out waiting for update: %s", desc)
+	return update{}
+}
+
+func alertCount(n int) func(update) bool {
+	return func(u update) bool { return len(u.Alerts) == n }
+}
+
+func TestInitialSnapshot(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+
+	u := client.waitFor(t, "initial snapshot", func(update) bool { return true })
+	if len(u.Alerts) != 0 || u.HasUnacknowledged {
+		t.Fatalf("Expected empty board, got %+v", u)
+	}
+}
+
+func TestFiringThenResolvedReplacesAlert(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	firing := client.waitFor(t, "firing alert", alertCount(1))
+	if firing.Alerts[0].Alert.Status != "firing" || !firing.HasUnacknowledged {
+		t.Fatalf("Expected one unacknowledged firing alert, got %+v", firing)
+	}
+	firingID := firing.Alerts[0].ID
+
+	s.postFixture(t, "mock-webhook-resolved.json")
+	resolved := client.waitFor(t, "resolved alert", func(u update) bool {
+		return len(u.Alerts) == 1 && u.Alerts[0].Alert.Status == "resolved"
+	})
+	if resolved.HasUnacknowledged {
+		t.Fatalf("Expected board to be clear after resolve")
+	}
+
+	found := false
+	for _, tomb := range resolved.Tombstones {
+		if tomb.ID == firingID && tomb.Reason == "resolved" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected tombstone for %s, got %+v", firingID, resolved.Tombstones)
+	}
+}
+
+func TestUnmatchedResolvedIsIgnored(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-resolved.json")
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	u := client.waitFor(t, "firing alert", alertCount(1))
+	if u.Alerts[0].Alert.Status != "firing" {
+		t.Fatalf("Unmatched resolved alert should not be stored, got %+v", u.Alerts)
+	}
+}
+
+func TestOrderingAckAndClear(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-multiple-alerts.json")
+	u := client.waitFor(t, "three firing alerts", alertCount(3))
+
+	ackedID := u.Alerts[1].ID
+	s.post(t, "/acknowledge?id="+ackedID, "", nil)
+	u = client.waitFor(t, "acknowledged alert", func(u update) bool {
+		for _, e := range u.Alerts {
+			if e.ID == ackedID {
+				return e.IsAcknowledged
+			}
+		}
+		return false
+	})
+
+	// Unacknowledged firing alerts sort before acknowledged ones
+	if u.Alerts[2].ID != ackedID {
+		t.Fatalf("Expected acknowledged alert last, got order %v", ids(u))
+	}
+	if !u.HasUnacknowledged {
+		t.Fatalf("Expected unacknowledged alerts to remain")
+	}
+
+	s.post(t, "/clear", "", nil)
+	u = client.waitFor(t, "cleared board", alertCount(2))
+	for _, e := range u.Alerts {
+		if e.ID == ackedID {
+			t.Fatalf("Acknowledged alert should have been cleared")
+		}
+	}
+
+	if status := s.status(t); status["hasUnacknowledged"] != true {
+		t.Fatalf("Expected /status to report unacknowledged alerts, got %v", status)
+	}
+}
+
+func TestVersionedClearAndBulkAck(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-multiple-alerts.json")
+	seen := client.waitFor(t, "three firing alerts", alertCount(3))
+	s.post(t, fmt.Sprintf("/acknowledge?id=%s&id=%s&if_version=%d", seen.Alerts[0].ID, seen.Alerts[1].ID, seen.Seq), "", nil)
+	acked := client.waitFor(t, "two acknowledged alerts", func(u update) bool {
+		return u.Alerts[2].IsAcknowledged && u.Alerts[1].IsAcknowledged && !u.Alerts[0].IsAcknowledged
+	})
+
+	// A clear based on an outdated board is refused
+	s.postFixture(t, "mock-webhook-firing.json")
+	client.waitFor(t, "new alert", alertCount(4))
+	for _, path := range []string{
+		fmt.Sprintf("/clear?if_version=%d", acked.Seq),
+		fmt.Sprintf("/acknowledge?id=%s&if_version=%d", acked.Alerts[0].ID, acked.Seq),
+	} {
+		resp, err := http.Post(s.baseURL+path, "", nil)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("POST %s returned %d, want 409", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(s.baseURL + "/api/v1/alerts")
+	if err != nil {
+		t.Fatalf("GET /api/v1/alerts failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var board []entry
+	if err := json.NewDecoder(resp.Body).Decode(&board); err != nil || len(board) != 4 || board[0].IsAcknowledged || board[1].IsAcknowledged {
+		t.Fatalf("Board should be unchanged, got %+v (%v)", board, err)
+	}
+}
+
+func TestReconnectReceivesTombstones(t *testing.T) {
+	s := startServer(t, "")
+	first := s.connect(t)
+	first.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	u := first.waitFor(t, "firing alert", alertCount(1))
+	firingID := u.Alerts[0].ID
+	first.conn.Close()
+
+	s.post(t, "/acknowledge?id="+firingID, "", nil)
+	s.post(t, "/clear", "", nil)
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s?since=%d", s.wsURL, u.Seq), nil)
+	if err != nil {
+		t.Fatalf("WebSocket dial failed: %v", err)
+	}
+	defer conn.Close()
+	second := &wsClient{conn: conn}
+
+	snapshot := second.waitFor(t, "snapshot", func(update) bool { return true })
+	if len(snapshot.Alerts) != 0 {
+		t.Fatalf("Expected empty board, got %v", ids(snapshot))
+	}
+	if len(snapshot.Tombstones) != 1 || snapshot.Tombstones[0].ID != firingID || snapshot.Tombstones[0].Reason != "cleared" {
+		t.Fatalf("Expected cleared tombstone for %s, got %+v", firingID, snapshot.Tombstones)
+	}
+}
+
+func TestPayloadCornerCases(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	// Alerts without labels are shown but can never be resolved by label match
+	s.postFixture(t, "mock-webhook-empty-labels.json")
+	u := client.waitFor(t, "alert without labels", alertCount(1))
+	if len(u.Alerts[0].Alert.Labels) != 0 {
+		t.Fatalf("Expected alert without labels, got %v", u.Alerts[0].Alert.Labels)
+	}
+
+	// truncatedAlerts only reports alerts Alertmanager left out of the payload
+	s.postFixture(t, "mock-webhook-truncated.json")
+	client.waitFor(t, "truncated payload alert", alertCount(2))
+
+	// A resolved alert without endsAt still resolves its firing counterpart
+	s.postFixture(t, "mock-webhook-firing.json")
+	client.waitFor(t, "firing alert", alertCount(3))
+	s.postFixture(t, "mock-webhook-no-endsat.json")
+	u = client.waitFor(t, "resolved alert without endsAt", func(u update) bool {
+		for _, e := range u.Alerts {
+			if e.Alert.Status == "resolved" {
+				return e.Alert.EndsAt == nil
+			}
+		}
+		return false
+	})
+	if len(u.Alerts) != 3 {
+		t.Fatalf("Expected 3 alerts, got %v", ids(u))
+	}
+}
+
+func TestDryRunDoesNotChangeBoard(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	u := client.waitFor(t, "firing alert", alertCount(1))
+
+	body, err := os.ReadFile(filepath.Join(repoRoot, "test", "mock-webhook-resolved.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	resp, err := http.Post(s.baseURL+"/api/v1/ingest/dry-run", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST dry-run failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Created  int `json:"created"`
+		Resolved int `json:"resolved"`
+		Alerts   []struct {
+			Outcome  string   `json:"outcome"`
+			Resolves []string `json:"resolves"`
+		} `json:"alerts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode dry-run result: %v", err)
+	}
+	if result.Created != 1 || result.Resolved != 1 || len(result.Alerts) != 1 {
+		t.Fatalf("Unexpected dry-run result: %+v", result)
+	}
+	if got := result.Alerts[0].Resolves; len(got) != 1 || got[0] != u.Alerts[0].ID {
+		t.Fatalf("Expected dry-run to resolve %s, got %v", u.Alerts[0].ID, got)
+	}
+
+	if status := s.status(t); status["hasUnacknowledged"] != true {
+		t.Fatalf("Dry-run must not change the board, got %v", status)
+	}
+}
+
+func TestBannerBroadcastAndExpiry(t *testing.T) {
+	s := startServer(t, "data_dir: "+t.TempDir()+"\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.post(t, "/api/v1/banner", "application/json", []byte(`{"message": "Network maintenance", "duration": "1s"}`))
+	u := client.waitFor(t, "banner", func(u update) bool { return u.Banner != nil })
+	if u.Banner.Message != "Network maintenance" || u.Banner.ExpiresAt == nil {
+		t.Fatalf("Unexpected banner: %+v", u.Banner)
+	}
+
+	client.waitFor(t, "banner expiry", func(u update) bool { return u.Banner == nil })
+}
+
+func TestTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{{define "detail"}}<div class="custom-detail">{{.AlertName}}</div>{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "detail.html"), []byte(override), 0o600); err != nil {
+		t.Fatalf("Failed to write override: %v", err)
+	}
+	s := startServer(t, "templates_dir: "+dir+"\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	u := client.waitFor(t, "firing alert", alertCount(1))
+	if !strings.Contains(u.Rendered["alert-list"], `class="custom-detail"`) {
+		t.Fatalf("Update is not rendered with the override: %q", u.Rendered["alert-list"])
+	}
+
+	resp, err := http.Get(s.baseURL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(page), `class="custom-detail"`) || !strings.Contains(string(page), `class="alert-card"`) {
+		t.Fatalf("Page is not rendered with the override:\n%s", page)
+	}
+}
+
+func TestIncidentGroupsRelatedAlerts(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	firing := client.waitFor(t, "firing alert", alertCount(1))
+
+	body := fmt.Sprintf(`{"alertId": %q, "title": "CPU outage", "chimeInterval": "1h"}`, firing.Alerts[0].ID)
+	s.post(t, "/api/v1/incidents", "application/json", []byte(body))
+	started := client.waitFor(t, "incident started", func(u update) bool {
+		return len(u.Alerts) == 1 && u.Alerts[0].IncidentID != ""
+	})
+	if started.HasUnacknowledged {
+		t.Fatalf("Alert of the incident should be acknowledged")
+	}
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	related := client.waitFor(t, "related alert", alertCount(2))
+	if related.HasUnacknowledged {
+		t.Fatalf("Related alert should be acknowledged, got %+v", related.Alerts)
+	}
+	for _, e := range related.Alerts {
+		if e.IncidentID != started.Alerts[0].IncidentID {
+			t.Fatalf("Alert %s is not grouped under the incident", e.ID)
+		}
+	}
+}
+
+func TestBrowserNotifications(t *testing.T) {
+	s := startServer(t, "browser:\n  notifications: true\n  notification_title: 'Alert: {{.AlertName}}'\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	if err := client.conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "notification-permission", "permission": "granted"}`)); err != nil {
+		t.Fatalf("Failed to report permission: %v", err)
+	}
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	var notification struct {
+		Type               string `json:"type"`
+		Title              string `json:"title"`
+		RequireInteraction bool   `json:"requireInteraction"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for notification.Type != "notification" && time.Now().Before(deadline) {
+		client.conn.SetReadDeadline(deadline)
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("WebSocket read failed: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.Contains(line, `"type":"notification"`) {
+				json.Unmarshal([]byte(line), &notification)
+			}
+		}
+	}
+	if notification.Title != "Alert: HighCPU" || notification.RequireInteraction {
+		t.Fatalf("Unexpected notification: %+v", notification)
+	}
+
+	resp, err := http.Get(s.baseURL + "/api/v1/clients")
+	if err != nil {
+		t.Fatalf("GET /api/v1/clients failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var clients []struct {
+		NotificationPermission string `json:"notificationPermission"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&clients); err != nil || len(clients) != 1 || clients[0].NotificationPermission != "granted" {
+		t.Fatalf("Expected the client to report its permission, got %+v (%v)", clients, err)
+	}
+}
+
+func TestEnvironmentTabs(t *testing.T) {
+	s := startServer(t, "environments:\n  order: [prod]\n  sound: {dev: never}\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	payload := `{"status": "firing", "alerts": [
+		{"status": "firing", "labels": {"alertname": "A", "env": "dev"}, "startsAt": "2024-01-15T10:30:00Z"},
+		{"status": "firing", "labels": {"alertname": "B", "env": "prod"}, "startsAt": "2024-01-15T10:30:00Z"},
+		{"status": "firing", "labels": {"alertname": "C", "env": "dev"}, "startsAt": "2024-01-15T10:30:00Z"}]}`
+	s.post(t, "/webhook", "application/json", []byte(payload))
+	u := client.waitFor(t, "three alerts", alertCount(3))
+
+	if len(u.Environments) != 2 || u.Environments[0].Name != "prod" || u.Environments[1].Name != "dev" {
+		t.Fatalf("Expected prod then dev tabs, got %+v", u.Environments)
+	}
+	if dev := u.Environments[1]; dev.Total != 2 || dev.Unacknowledged != 2 || dev.Sound != "never" {
+		t.Fatalf("Unexpected dev tab: %+v", dev)
+	}
+
+	resp, err := http.Get(s.baseURL + "/api/v1/alerts?env=prod")
+	if err != nil {
+		t.Fatalf("GET /api/v1/alerts failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var prod []entry
+	if err := json.NewDecoder(resp.Body).Decode(&prod); err != nil || len(prod) != 1 || prod[0].Alert.Labels["alertname"] != "B" {
+		t.Fatalf("Expected only the prod alert, got %+v (%v)", prod, err)
+	}
+}
+
+func TestInvalidPayloadRejected(t *testing.T) {
+	s := startServer(t, "")
+	resp, err := http.Post(s.baseURL+"/webhook", "application/json", strings.NewReader("{not json"))
+	if err != nil {
+		t.Fatalf("POST /webhook failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid JSON, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(s.baseURL+"/webhook", "application/x-www-form-urlencoded", strings.NewReader("status=firing"))
+	if err != nil {
+		t.Fatalf("POST /webhook failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected 415 for a form-encoded body, got %d", resp.StatusCode)
+	}
+}
+
+func TestRecoveryModeAcceptsCorrectedConfig(t *testing.T) {
+	port := freePort(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("webhook_api_key: 'hunter2'\nlisten_port: [oops\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(binaryPath, "-config="+configPath, fmt.Sprintf("-recovery-port=%d", port), "-bootstrap-token=letmein")
+	cmd.Dir = repoRoot
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if t.Failed() {
+			t.Logf("Server output:\n%s", output.String())
+		}
+	})
+
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	waitForStatus := func(url string, want int) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			resp, err := http.Get(url)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == want {
+					return
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("GET %s did not return %d", url, want)
+	}
+	waitForStatus(baseURL+"/api/v1/recovery", http.StatusServiceUnavailable)
+
+	// The config file and its secrets are only shown with the token
+	showsSecret := func(resp *http.Response, err error) bool {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Request to the recovery page failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return strings.Contains(string(body), "hunter2")
+	}
+	if showsSecret(http.Get(baseURL + "/")) {
+		t.Error("Expected the recovery page not to show the config without the token")
+	}
+	if showsSecret(http.PostForm(baseURL+"/api/v1/recovery/current", url.Values{"token": {"wrong"}})) {
+		t.Error("Expected the config not shown for a wrong token")
+	}
+	if !showsSecret(http.PostForm(baseURL+"/api/v1/recovery/current", url.Values{"token": {"letmein"}})) {
+		t.Error("Expected the config shown for the token")
+	}
+
+	upload := func(token, config string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/v1/recovery/config", strings.NewReader(config))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/v1/recovery/config failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	boardPort := freePort(t)
+	fixed := fmt.Sprintf("listen_port: %d\nsound_effect_file_path: 'sounds/siren1.wav'\n", boardPort)
+	if code := upload("wrong", fixed); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for a wrong token, got %d", code)
+	}
+	if code := upload("letmein", "listen_port: [still broken\n"); code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a config that doesn't parse, got %d", code)
+	}
+	if code := upload("letmein", fixed); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a corrected config, got %d", code)
+	}
+
+	waitForStatus(fmt.Sprintf("http://127.0.0.1:%d/status", boardPort), http.StatusOK)
+	saved, err := os.ReadFile(configPath)
+	if err != nil || string(saved) != fixed {
+		t.Fatalf("Expected the corrected config on disk, got %q (%v)", saved, err)
+	}
+}
+
+func TestDroppedBroadcastsReconcileOnReconnect(t *testing.T) {
+	s := startServer(t, "chaos:\n  drop_broadcasts: 100\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	// The update was dropped, but a reconnecting client gets the full board
+	client.conn.Close()
+	reconnected := s.connect(t)
+	u := reconnected.waitFor(t, "snapshot after reconnect", func(update) bool { return true })
+	if len(u.Alerts) != 1 || u.Alerts[0].Alert.Status != "firing" {
+		t.Fatalf("Expected the firing alert after reconnecting, got %+v", u.Alerts)
+	}
+}
+
+func TestDroppedBroadcastsReconcileOnResync(t *testing.T) {
+	s := startServer(t, "chaos:\n  drop_broadcasts: 100\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	// The update was dropped, but asking for a resync brings the full board
+	if err := client.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resync"}`)); err != nil {
+		t.Fatalf("Failed to send resync: %v", err)
+	}
+	u := client.waitFor(t, "resync snapshot", alertCount(1))
+	if u.Alerts[0].Alert.Status != "firing" {
+		t.Fatalf("Expected the firing alert after the resync, got %+v", u.Alerts)
+	}
+}
+
+func TestHistoryOutlivesClear(t *testing.T) {
+	s := startServer(t, "data_dir: "+t.TempDir()+"\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-multiple-alerts.json")
+	u := client.waitFor(t, "three firing alerts", alertCount(3))
+	clearedID := u.Alerts[0].ID
+	s.post(t, "/acknowledge?id="+clearedID, "", nil)
+	s.post(t, "/clear", "", nil)
+	client.waitFor(t, "cleared board", alertCount(2))
+
+	var events []struct {
+		Type    string `json:"type"`
+		AlertID string `json:"alertId"`
+	}
+	resp, err := http.Get(s.baseURL + "/api/history?id=" + clearedID)
+	if err != nil {
+		t.Fatalf("GET /api/history failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "cleared,acknowledged,received" {
+		t.Fatalf("Expected the cleared alert's history newest first, got %v", types)
+	}
+
+	resp, err = http.Get(s.baseURL + "/api/history?type=received")
+	if err != nil {
+		t.Fatalf("GET /api/history failed: %v", err)
+	}
+	defer resp.Body.Close()
+	events = nil
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil || len(events) != 3 {
+		t.Fatalf("Expected 3 received events, got %+v (%v)", events, err)
+	}
+}
+
+func TestGenericWebhookMapping(t *testing.T) {
+	s := startServer(t, `generic_webhooks:
+  - name: uptime
+    alerts_path: data.checks
+    status: '{{if eq .state "down"}}firing{{else}}resolved{{end}}'
+    labels:
+      alertname: 'SiteDown'
+      site: '{{.url}}'
+      severity: '{{.priority | default "warning" | lower}}'
+    annotations:
+      summary: '{{.url}} is {{.state}}'
+    starts_at: '{{unixTime .since}}'
+`)
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.post(t, "/webhook/generic", "application/json", []byte(`{"data": {"checks": [
+		{"url": "https://a.example", "state": "down", "priority": "CRITICAL", "since": 1700000000},
+		{"url": "https://b.example", "state": "down", "since": 1700000000}]}}`))
+	u := client.waitFor(t, "two mapped alerts", alertCount(2))
+	for _, e := range u.Alerts {
+		want := map[string]string{"https://a.example": "critical", "https://b.example": "warning"}[e.Alert.Labels["site"]]
+		if e.Alert.Status != "firing" || e.Alert.Labels["alertname"] != "SiteDown" || e.Alert.Labels["severity"] != want {
+			t.Fatalf("Unexpected mapped alert: %+v", e.Alert)
+		}
+	}
+
+	// A recovery resolves the alert with the same labels
+	s.post(t, "/webhook/generic?source=uptime", "application/json", []byte(`{"data": {"checks": [
+		{"url": "https://a.example", "state": "up", "priority": "critical", "since": 1700000000}]}}`))
+	client.waitFor(t, "resolved mapped alert", func(u update) bool {
+		for _, e := range u.Alerts {
+			if e.Alert.Labels["site"] == "https://a.example" {
+				return e.Alert.Status == "resolved"
+			}
+		}
+		return false
+	})
+
+	resp, err := http.Post(s.baseURL+"/webhook/generic?source=other", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an unknown source, got %d", resp.StatusCode)
+	}
+}
+
+func TestAlertmanagerPolling(t *testing.T) {
+	var mu sync.Mutex
+	firing := `[{"labels": {"alertname": "A", "instance": "1"}, "startsAt": "2024-01-15T10:00:00Z"},
+		{"labels": {"alertname": "B", "instance": "2"}, "startsAt": "2024-01-15T10:00:00Z"}]`
+	alertmanager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "wmu" || pass != "secret" || r.URL.Path != "/api/v2/alerts" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]byte(firing))
+	}))
+	defer alertmanager.Close()
+
+	s := startServer(t, fmt.Sprintf("alertmanager_poll:\n  url: %s\n  interval: 100ms\n  username: wmu\n  password: secret\n", alertmanager.URL))
+	client := s.connect(t)
+	client.waitFor(t, "polled alerts", alertCount(2))
+
+	// Alerts gone from Alertmanager are resolved, still firing ones aren't added again
+	mu.Lock()
+	firing = `[{"labels": {"alertname": "A", "instance": "1"}, "startsAt": "2024-01-15T10:00:00Z"}]`
+	mu.Unlock()
+	client.waitFor(t, "B resolved", func(u update) bool {
+		for _, e := range u.Alerts {
+			if e.Alert.Labels["alertname"] == "B" && e.Alert.Status == "resolved" {
+				return true
+			}
+		}
+		return false
+	})
+	time.Sleep(300 * time.Millisecond)
+
+	resp, err := http.Get(s.baseURL + "/api/v1/alerts")
+	if err != nil {
+		t.Fatalf("GET /api/v1/alerts failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var board []entry
+	if err := json.NewDecoder(resp.Body).Decode(&board); err != nil || len(board) != 2 {
+		t.Fatalf("Expected A firing and B resolved only, got %+v (%v)", board, err)
+	}
+}
+
+func TestAdminListener(t *testing.T) {
+	adminURL := fmt.Sprintf("http://127.0.0.1:%d", freePort(t))
+	s := startServer(t, "admin_listen: "+strings.TrimPrefix(adminURL, "http://")+"\n")
+
+	contentType := func(url string) string {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.Status
+		}
+		return resp.Header.Get("Content-Type")
+	}
+	// Admin APIs answer on the admin listener only, the public one serves the
+	// board for any unknown path
+	for _, path := range []string{"/debug/vars", "/api/v1/clients"} {
+		if got := contentType(adminURL + path); !strings.HasPrefix(got, "application/json") {
+			t.Errorf("GET %s on the admin listener returned %s", path, got)
+		}
+		if got := contentType(s.baseURL + path); strings.HasPrefix(got, "application/json") {
+			t.Errorf("GET %s should not be served on the public listener", path)
+		}
+	}
+	if got := contentType(adminURL + "/api/v1/alerts"); got != "404 Not Found" {
+		t.Errorf("The admin listener should not serve the board API, got %s", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := startServer(t, "")
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	resp, err := http.Get(s.baseURL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`wakemeup_webhooks_received_total{source="alertmanager"} 1`,
+		`wakemeup_alerts{state="firing"} 1`,
+		`wakemeup_websocket_clients 0`,
+		`wakemeup_http_request_duration_seconds_count{code="200",handler="/webhook"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s in the metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	s := startServer(t, "allowed_origins: ['https://wall.example.com']\n")
+	s.postFixture(t, "mock-webhook-firing.json")
+
+	clear := func(origin string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, s.baseURL+"/clear", nil)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /clear failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := clear("https://evil.example.com"); code != http.StatusForbidden {
+		t.Fatalf("Expected a cross-origin clear to be forbidden, got %d", code)
+	}
+	if code := clear(s.baseURL); code != http.StatusOK {
+		t.Fatalf("Expected a same-origin clear to pass, got %d", code)
+	}
+
+	dial := func(origin string) error {
+		conn, _, err := websocket.DefaultDialer.Dial(s.wsURL, http.Header{"Origin": {origin}})
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := dial("https://evil.example.com"); err == nil {
+		t.Fatal("Expected a WebSocket from another origin to be refused")
+	}
+	if err := dial("https://wall.example.com"); err != nil {
+		t.Fatalf("Expected a WebSocket from an allowed origin to connect: %v", err)
+	}
+}
+
+func TestFollowUpListSurvivesClear(t *testing.T) {
+	s := startServer(t, "")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	s.postFixture(t, "mock-webhook-firing.json")
+	s.postFixture(t, "mock-webhook-resolved.json")
+	resolved := client.waitFor(t, "resolved alert", func(u update) bool {
+		return len(u.Alerts) == 1 && u.Alerts[0].Alert.Status == "resolved"
+	})
+
+	body := fmt.Sprintf(`{"alertId": %q, "note": "raise the disk quota for real"}`, resolved.Alerts[0].ID)
+	s.post(t, "/api/v1/reviews", "application/json", []byte(body))
+	s.post(t, "/clear", "", nil)
+	client.waitFor(t, "cleared board", alertCount(0))
+
+	var reviews []struct {
+		ID      string `json:"id"`
+		AlertID string `json:"alertId"`
+		Note    string `json:"note"`
+	}
+	list := func() {
+		t.Helper()
+		resp, err := http.Get(s.baseURL + "/api/v1/reviews")
+		if err != nil {
+			t.Fatalf("GET /api/v1/reviews failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&reviews); err != nil {
+			t.Fatalf("Invalid follow-up list: %v", err)
+		}
+	}
+	list()
+	if len(reviews) != 1 || reviews[0].AlertID != resolved.Alerts[0].ID || reviews[0].Note != "raise the disk quota for real" {
+		t.Fatalf("Expected the marked alert to stay on the follow-up list, got %+v", reviews)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, s.baseURL+"/api/v1/reviews?id="+reviews[0].ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Closing the follow-up failed: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	list()
+	if len(reviews) != 0 {
+		t.Fatalf("Expected an empty follow-up list after closing, got %+v", reviews)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := startServer(t, "shutdown_timeout: 5s\n")
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to signal the server: %v", err)
+	}
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := client.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("Expected a going away close message, got %v", err)
+		}
+		break
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- s.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("Expected a clean exit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not exit after SIGTERM")
+	}
+}
+
+func ids(u update) []string {
+	result := make([]string, len(u.Alerts))
+	for i, e := range u.Alerts {
+		result[i] = e.ID + ":" + e.Alert.Status
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackAcknowledgeButton(t *testing.T) {
+	const secret = "test-signing-secret"
+	messages := make(chan string, 16)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		messages <- string(body)
+	}))
+	defer slack.Close()
+	nextMessage := func(desc string) string {
+		t.Helper()
+		select {
+		case message := <-messages:
+			return message
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for Slack %s", desc)
+			return ""
+		}
+	}
+
+	s := startServer(t, fmt.Sprintf("slack:\n  webhook_url: %q\n  signing_secret: %q\n", slack.URL, secret))
+	client := s.connect(t)
+	client.waitFor(t, "initial snapshot", alertCount(0))
+	s.postFixture(t, "mock-webhook-firing.json")
+	alertID := client.waitFor(t, "firing alert", alertCount(1)).Alerts[0].ID
+
+	if notification := nextMessage("notification"); !strings.Contains(notification, `"value":"`+alertID+`"`) {
+		t.Fatalf("Notification lacks the acknowledge button of %s: %s", alertID, notification)
+	}
+
+	payload := fmt.Sprintf(`{"type": "block_actions", "user": {"id": "U1", "username": "alice"},
+		"actions": [{"action_id": "acknowledge", "value": %q}], "response_url": %q}`, alertID, slack.URL)
+	body := "payload=" + url.QueryEscape(payload)
+	post := func(signature string) int {
+		t.Helper()
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		if signature == "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+			signature = "v0=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		req, _ := http.NewRequest(http.MethodPost, s.baseURL+"/webhook/slack-actions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", signature)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /webhook/slack-actions failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post("v0=forged"); status != http.StatusUnauthorized {
+		t.Fatalf("Forged signature returned %d, want 401", status)
+	}
+	if status := post(""); status != http.StatusOK {
+		t.Fatalf("Signed action returned %d", status)
+	}
+	client.waitFor(t, "acknowledged alert", func(u update) bool {
+		return len(u.Alerts) == 1 && u.Alerts[0].IsAcknowledged
+	})
+	if reply := nextMessage("reply"); !strings.Contains(reply, "acknowledged by alice") {
+		t.Fatalf("Unexpected reply: %s", reply)
+	}
+}